@@ -4,7 +4,7 @@
 package yubikey
 
 import (
-	"github.com/go-piv/piv-go/piv"
+	"fmt"
 )
 
 const (
@@ -20,6 +20,10 @@ const (
 	AlgorithmRSA1024 Algorithm = 4
 	// AlgorithmRSA2048 represents the RSA2048 algorithm.
 	AlgorithmRSA2048 Algorithm = 5
+	// AlgorithmRSA3072 represents the RSA3072 algorithm (firmware 5.7+).
+	AlgorithmRSA3072 Algorithm = 6
+	// AlgorithmRSA4096 represents the RSA4096 algorithm (firmware 5.7+).
+	AlgorithmRSA4096 Algorithm = 7
 )
 
 // Algorithm represents an algorithm.
@@ -38,25 +42,145 @@ func (alg Algorithm) String() string {
 		return "rsa1024"
 	case AlgorithmRSA2048:
 		return "rsa2048"
+	case AlgorithmRSA3072:
+		return "rsa3072"
+	case AlgorithmRSA4096:
+		return "rsa4096"
 	default:
 		return ""
 	}
 }
 
-// piv returns the PIV representation of the algorithm.
-func (alg Algorithm) piv() piv.Algorithm {
+// MarshalText implements the encoding.TextMarshaler interface.
+func (alg Algorithm) MarshalText() ([]byte, error) {
+	return []byte(alg.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface by ParseAlgorithm.
+// An empty text is the unknown algorithm.
+func (alg *Algorithm) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*alg = AlgorithmUnknown
+		return nil
+	}
+	v, err := ParseAlgorithm(string(text))
+	if err != nil {
+		return err
+	}
+	*alg = v
+	return nil
+}
+
+// ParseAlgorithm returns the algorithm by the given name. The names are case-insensitive and
+// the common aliases are accepted (i.e. "p256", "ECCP256", "P-256", "secp256r1", "ed25519", "RSA2048").
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch normalizeName(name) {
+	case "p256", "ec256", "ecc256", "ecp256", "eccp256", "secp256r1", "prime256v1", "nistp256":
+		return AlgorithmEC256, nil
+	case "p384", "ec384", "ecc384", "ecp384", "eccp384", "secp384r1", "nistp384":
+		return AlgorithmEC384, nil
+	case "ed25519":
+		return AlgorithmEd25519, nil
+	case "rsa1024":
+		return AlgorithmRSA1024, nil
+	case "rsa2048":
+		return AlgorithmRSA2048, nil
+	case "rsa3072":
+		return AlgorithmRSA3072, nil
+	case "rsa4096":
+		return AlgorithmRSA4096, nil
+	}
+	return AlgorithmUnknown, fmt.Errorf("unknown algorithm: %q", name)
+}
+
+// code returns the PIV encoded value of the algorithm.
+func (alg Algorithm) code() byte {
 	switch alg {
 	case AlgorithmEC256:
-		return piv.AlgorithmEC256
+		return 0x11
 	case AlgorithmEC384:
-		return piv.AlgorithmEC384
+		return 0x14
 	case AlgorithmEd25519:
-		return piv.AlgorithmEd25519
+		return 0xe0
 	case AlgorithmRSA1024:
-		return piv.AlgorithmRSA1024
+		return 0x06
 	case AlgorithmRSA2048:
-		return piv.AlgorithmRSA2048
+		return 0x07
+	case AlgorithmRSA3072:
+		return 0x05
+	case AlgorithmRSA4096:
+		return 0x16
+	default:
+		return 0x00
+	}
+}
+
+// algorithmFromByte returns the algorithm by the given PIV encoded algorithm value.
+func algorithmFromByte(b byte) Algorithm {
+	switch b {
+	case 0x11:
+		return AlgorithmEC256
+	case 0x14:
+		return AlgorithmEC384
+	case 0xe0:
+		return AlgorithmEd25519
+	case 0x06:
+		return AlgorithmRSA1024
+	case 0x07:
+		return AlgorithmRSA2048
+	case 0x05:
+		return AlgorithmRSA3072
+	case 0x16:
+		return AlgorithmRSA4096
+	default:
+		return AlgorithmUnknown
+	}
+}
+
+const (
+	// ManagementKeyAlgorithmUnknown represents the unknown management key algorithm.
+	ManagementKeyAlgorithmUnknown ManagementKeyAlgorithm = 0
+	// ManagementKeyAlgorithm3DES represents the 3DES management key algorithm.
+	ManagementKeyAlgorithm3DES ManagementKeyAlgorithm = 1
+	// ManagementKeyAlgorithmAES128 represents the AES-128 management key algorithm.
+	ManagementKeyAlgorithmAES128 ManagementKeyAlgorithm = 2
+	// ManagementKeyAlgorithmAES192 represents the AES-192 management key algorithm.
+	ManagementKeyAlgorithmAES192 ManagementKeyAlgorithm = 3
+	// ManagementKeyAlgorithmAES256 represents the AES-256 management key algorithm.
+	ManagementKeyAlgorithmAES256 ManagementKeyAlgorithm = 4
+)
+
+// ManagementKeyAlgorithm represents a management key algorithm.
+type ManagementKeyAlgorithm int
+
+// String returns the algorithm name.
+func (alg ManagementKeyAlgorithm) String() string {
+	switch alg {
+	case ManagementKeyAlgorithm3DES:
+		return "3des"
+	case ManagementKeyAlgorithmAES128:
+		return "aes128"
+	case ManagementKeyAlgorithmAES192:
+		return "aes192"
+	case ManagementKeyAlgorithmAES256:
+		return "aes256"
+	default:
+		return ""
+	}
+}
+
+// managementKeyAlgorithmFromByte returns the management key algorithm by the given PIV encoded algorithm value.
+func managementKeyAlgorithmFromByte(b byte) ManagementKeyAlgorithm {
+	switch b {
+	case 0x03:
+		return ManagementKeyAlgorithm3DES
+	case 0x08:
+		return ManagementKeyAlgorithmAES128
+	case 0x0a:
+		return ManagementKeyAlgorithmAES192
+	case 0x0c:
+		return ManagementKeyAlgorithmAES256
 	default:
-		return piv.Algorithm(0)
+		return ManagementKeyAlgorithmUnknown
 	}
 }
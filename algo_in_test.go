@@ -5,25 +5,84 @@ package yubikey
 
 import (
 	"testing"
-
-	"github.com/go-piv/piv-go/piv"
 )
 
 func TestAlgorithmPIV(t *testing.T) {
 	table := []struct {
 		alg  Algorithm
-		want piv.Algorithm
+		want byte
 	}{
 		{AlgorithmUnknown, 0},
-		{AlgorithmEC256, piv.AlgorithmEC256},
-		{AlgorithmEC384, piv.AlgorithmEC384},
-		{AlgorithmEd25519, piv.AlgorithmEd25519},
-		{AlgorithmRSA1024, piv.AlgorithmRSA1024},
-		{AlgorithmRSA2048, piv.AlgorithmRSA2048},
+		{AlgorithmEC256, 0x11},
+		{AlgorithmEC384, 0x14},
+		{AlgorithmEd25519, 0xe0},
+		{AlgorithmRSA1024, 0x06},
+		{AlgorithmRSA2048, 0x07},
+		{AlgorithmRSA3072, 0x05},
+		{AlgorithmRSA4096, 0x16},
 	}
 	for _, v := range table {
-		if p := v.alg.piv(); p != v.want {
+		if p := v.alg.code(); p != v.want {
 			t.Errorf("got %v, want %v", p, v.want)
 		}
 	}
 }
+
+func TestAlgorithmFromByte(t *testing.T) {
+	table := []struct {
+		b    byte
+		want Algorithm
+	}{
+		{0x00, AlgorithmUnknown},
+		{0x11, AlgorithmEC256},
+		{0x14, AlgorithmEC384},
+		{0xe0, AlgorithmEd25519},
+		{0x06, AlgorithmRSA1024},
+		{0x07, AlgorithmRSA2048},
+		{0x05, AlgorithmRSA3072},
+		{0x16, AlgorithmRSA4096},
+	}
+	for _, v := range table {
+		if a := algorithmFromByte(v.b); a != v.want {
+			t.Errorf("got %v, want %v", a, v.want)
+		}
+	}
+}
+
+func TestManagementKeyAlgorithmFromByte(t *testing.T) {
+	table := []struct {
+		b    byte
+		want ManagementKeyAlgorithm
+	}{
+		{0x00, ManagementKeyAlgorithmUnknown},
+		{0x03, ManagementKeyAlgorithm3DES},
+		{0x08, ManagementKeyAlgorithmAES128},
+		{0x0a, ManagementKeyAlgorithmAES192},
+		{0x0c, ManagementKeyAlgorithmAES256},
+	}
+	for _, v := range table {
+		if a := managementKeyAlgorithmFromByte(v.b); a != v.want {
+			t.Errorf("got %v, want %v", a, v.want)
+		}
+	}
+}
+
+func TestAlgorithmText(t *testing.T) {
+	for _, alg := range []Algorithm{AlgorithmUnknown, AlgorithmEC256, AlgorithmEC384, AlgorithmEd25519, AlgorithmRSA1024, AlgorithmRSA2048, AlgorithmRSA3072, AlgorithmRSA4096} {
+		b, err := alg.MarshalText()
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		var got Algorithm
+		if err := got.UnmarshalText(b); err != nil || got != alg {
+			t.Errorf("got %v (%v), want %v", got, err, alg)
+		}
+	}
+	var got Algorithm
+	if err := got.UnmarshalText([]byte("P384")); err != nil || got != AlgorithmEC384 {
+		t.Errorf("got %v (%v), want %v", got, err, AlgorithmEC384)
+	}
+	if err := got.UnmarshalText([]byte("rsa8192")); err == nil {
+		t.Errorf("got nil, want error")
+	}
+}
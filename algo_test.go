@@ -20,6 +20,8 @@ func TestAlgorithmString(t *testing.T) {
 		{yubikey.AlgorithmEd25519, "ed25519"},
 		{yubikey.AlgorithmRSA1024, "rsa1024"},
 		{yubikey.AlgorithmRSA2048, "rsa2048"},
+		{yubikey.AlgorithmRSA3072, "rsa3072"},
+		{yubikey.AlgorithmRSA4096, "rsa4096"},
 	}
 	for _, v := range table {
 		if s := v.alg.String(); s != v.want {
@@ -27,3 +29,49 @@ func TestAlgorithmString(t *testing.T) {
 		}
 	}
 }
+
+func TestManagementKeyAlgorithmString(t *testing.T) {
+	table := []struct {
+		alg  yubikey.ManagementKeyAlgorithm
+		want string
+	}{
+		{yubikey.ManagementKeyAlgorithmUnknown, ""},
+		{yubikey.ManagementKeyAlgorithm3DES, "3des"},
+		{yubikey.ManagementKeyAlgorithmAES128, "aes128"},
+		{yubikey.ManagementKeyAlgorithmAES192, "aes192"},
+		{yubikey.ManagementKeyAlgorithmAES256, "aes256"},
+	}
+	for _, v := range table {
+		if s := v.alg.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	table := []struct {
+		name string
+		want yubikey.Algorithm
+	}{
+		{"p256", yubikey.AlgorithmEC256},
+		{"ECCP256", yubikey.AlgorithmEC256},
+		{"P-256", yubikey.AlgorithmEC256},
+		{"secp256r1", yubikey.AlgorithmEC256},
+		{"eccp384", yubikey.AlgorithmEC384},
+		{"Ed25519", yubikey.AlgorithmEd25519},
+		{"RSA1024", yubikey.AlgorithmRSA1024},
+		{"rsa-2048", yubikey.AlgorithmRSA2048},
+		{"RSA3072", yubikey.AlgorithmRSA3072},
+		{"rsa-4096", yubikey.AlgorithmRSA4096},
+	}
+	for _, v := range table {
+		if alg, err := yubikey.ParseAlgorithm(v.name); err != nil || alg != v.want {
+			t.Errorf("got %v (%v), want %v", alg, err, v.want)
+		}
+	}
+	for _, name := range []string{"", "rsa8192", "x25519"} {
+		if _, err := yubikey.ParseAlgorithm(name); err == nil {
+			t.Errorf("got nil, want error (%s)", name)
+		}
+	}
+}
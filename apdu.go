@@ -0,0 +1,269 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// Common instructions
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/
+	insSelect      = 0xa4
+	insGetResponse = 0xc0
+
+	// PIV instructions
+	insGetMetadata = 0xf7
+	insMoveKey     = 0xf6
+	insGenerateKey = 0x47
+	insGetVersion  = 0xfd
+	insGetSerial   = 0xf8
+	insAttest      = 0xf9
+
+	// Status words
+	swSuccess        = 0x9000
+	swMoreData       = 0x61
+	swWrongData      = 0x6a80
+	swNotFound       = 0x6a82
+	swSecurityStatus = 0x6982
+	swAuthBlocked    = 0x6983
+	swNotSupported   = 0x6d00
+
+	// apduMaxData holds the maximum data length of a short APDU.
+	// Longer data is sent by command chaining.
+	apduMaxData = 0xff
+	// claChaining holds the command chaining class bit.
+	claChaining = 0x10
+)
+
+var (
+	// ErrNotSupported represents a not supported operation error.
+	ErrNotSupported = errors.New("operation not supported by the card")
+
+	// aidPIV holds the PIV application identifier.
+	aidPIV = []byte{0xa0, 0x00, 0x00, 0x03, 0x08}
+)
+
+// apdu represents a smart card command.
+// Ref: https://docs.yubico.com/yesdk/users-manual/yubikey-reference/apdu.html
+type apdu struct {
+	cla  byte
+	ins  byte
+	p1   byte
+	p2   byte
+	data []byte
+}
+
+// apduError represents a smart card status word error.
+type apduError struct {
+	sw uint16
+}
+
+// Error returns the error message.
+func (err *apduError) Error() string {
+	var msg string
+	switch {
+	case err.sw&0xfff0 == 0x63c0:
+		r := "retries"
+		if err.sw&0x0f == 1 {
+			r = "retry"
+		}
+		msg = fmt.Sprintf("verification failed (%d %s remaining)", err.sw&0x0f, r)
+	case err.sw == 0x6300:
+		msg = "verification failed"
+	case err.sw == 0x6581:
+		msg = "memory failure"
+	case err.sw == 0x6700:
+		msg = "wrong length"
+	case err.sw == swSecurityStatus:
+		msg = "security status not satisfied"
+	case err.sw == swAuthBlocked:
+		msg = "authentication method blocked"
+	case err.sw == 0x6984:
+		msg = "referenced data invalidated"
+	case err.sw == 0x6985:
+		msg = "conditions of use not satisfied"
+	case err.sw == swWrongData:
+		msg = "incorrect parameter in command data field"
+	case err.sw == 0x6a81:
+		msg = "function not supported"
+	case err.sw == swNotFound:
+		msg = "data object or application not found"
+	case err.sw == 0x6a84:
+		msg = "not enough memory"
+	case err.sw == 0x6a86:
+		msg = "incorrect parameter in P1 or P2"
+	case err.sw == 0x6a88:
+		msg = "referenced data or reference data not found"
+	case err.sw == swNotSupported:
+		msg = "instruction not supported"
+	case err.sw == 0x6e00:
+		msg = "class not supported"
+	default:
+		msg = "unknown error"
+	}
+	return fmt.Sprintf("smart card error %04x: %s", err.sw, msg)
+}
+
+// retries returns the remaining retries if the error is a verification error.
+func (err *apduError) retries() (int, bool) {
+	if err.sw&0xfff0 == 0x63c0 {
+		return int(err.sw & 0x0f), true
+	}
+	return 0, false
+}
+
+// isStatus returns whether the given error is a smart card error with the given status word or not.
+func isStatus(err error, sw uint16) bool {
+	var e *apduError
+	return errors.As(err, &e) && e.sw == sw
+}
+
+// transport represents a smart card transport.
+type transport interface {
+	// transmit transmits the given request and returns the response (including the status word).
+	transmit(req []byte) ([]byte, error)
+	// Close closes the transport.
+	Close() error
+}
+
+// listReaders returns the smart card reader names.
+var listReaders = func() ([]string, error) {
+	return scardReaders()
+}
+
+// openTransport opens an exclusive transport by the given reader name.
+var openTransport = func(reader string) (transport, error) {
+	return scardOpen(reader)
+}
+
+// session represents a smart card application session.
+type session struct {
+	tr transport
+	// insMore is the instruction which collects the remaining response data (GET RESPONSE by default).
+	insMore byte
+	// selected is the response data of the application selection.
+	selected []byte
+	// scp is the secure channel state if the secure channel is open.
+	scp *scpState
+	// secrets are the sensitive buffers which are zeroized when the session is closed.
+	secrets [][]byte
+}
+
+// openSession opens a session by the given reader name and selects the given application.
+// The caller must hold openMu.
+func openSession(reader string, aid []byte) (*session, error) {
+	tr, err := openTransport(reader)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{tr: tr, insMore: insGetResponse}
+	if s.selected, err = s.send(apdu{ins: insSelect, p1: 0x04, data: aid}); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("couldn't select the application (%x): %s", aid, err)
+	}
+	return s, nil
+}
+
+// send sends the given command and returns the response data.
+// Long commands are chained and long responses are collected.
+// The command is wrapped if the secure channel is open.
+func (s *session) send(cmd apdu) ([]byte, error) {
+	if s.scp == nil {
+		return s.exchange(cmd)
+	}
+	wrapped, err := s.scp.wrap(cmd)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.exchange(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return s.scp.unwrap(resp)
+}
+
+// exchange sends the given command as is and returns the response data.
+func (s *session) exchange(cmd apdu) ([]byte, error) {
+	// Send the command (chain if it's necessary)
+	data := cmd.data
+	var resp []byte
+	var sw uint16
+	for {
+		cla := cmd.cla
+		chunk := data
+		if len(chunk) > apduMaxData {
+			cla |= claChaining
+			chunk = chunk[:apduMaxData]
+		}
+		var err error
+		resp, sw, err = s.transmit(cla, cmd.ins, cmd.p1, cmd.p2, chunk)
+		if err != nil {
+			return nil, err
+		}
+		data = data[len(chunk):]
+		if len(data) == 0 {
+			break
+		} else if sw != swSuccess {
+			return nil, &apduError{sw: sw}
+		}
+	}
+
+	// Collect the remaining response data
+	for sw>>8 == swMoreData {
+		var more []byte
+		var err error
+		more, sw, err = s.transmit(0x00, s.insMore, 0x00, 0x00, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, more...)
+	}
+	if sw != swSuccess {
+		return nil, &apduError{sw: sw}
+	}
+
+	return resp, nil
+}
+
+// transmit transmits a short APDU and returns the response data and status word.
+func (s *session) transmit(cla, ins, p1, p2 byte, data []byte) ([]byte, uint16, error) {
+	req := []byte{cla, ins, p1, p2}
+	if len(data) > 0 {
+		req = append(req, byte(len(data)))
+		req = append(req, data...)
+	}
+	req = append(req, 0x00)
+	resp, err := s.tr.transmit(req)
+	zero(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp) < 2 {
+		return nil, 0, fmt.Errorf("invalid smart card response: %x", resp)
+	}
+	return resp[:len(resp)-2], uint16(resp[len(resp)-2])<<8 | uint16(resp[len(resp)-1]), nil
+}
+
+// keep keeps the given sensitive buffer so it's zeroized when the session is closed and returns it.
+func (s *session) keep(b []byte) []byte {
+	s.secrets = append(s.secrets, b)
+	return b
+}
+
+// Close zeroizes the session secrets and closes the session.
+func (s *session) Close() error {
+	for _, b := range s.secrets {
+		zero(b)
+	}
+	s.secrets = nil
+	if s.scp != nil {
+		zero(s.scp.enc)
+		zero(s.scp.mac)
+		zero(s.scp.rmac)
+		s.scp = nil
+	}
+	return s.tr.Close()
+}
@@ -0,0 +1,151 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fakeTransport represents a fake smart card transport which replies the requests by the given handler.
+type fakeTransport struct {
+	handle   func(req []byte) []byte
+	requests [][]byte
+	closed   bool
+	// selected returns the response data of the application selections.
+	selected func() []byte
+}
+
+// transmit implements the transport interface.
+func (ft *fakeTransport) transmit(req []byte) ([]byte, error) {
+	// The session zeroizes the requests so the handlers get a copy
+	ft.requests = append(ft.requests, append([]byte(nil), req...))
+	return ft.handle(append([]byte(nil), req...)), nil
+}
+
+// Close implements the transport interface.
+func (ft *fakeTransport) Close() error {
+	ft.closed = true
+	return nil
+}
+
+// useFakeTransport replaces the smart card transport with a fake transport during the test.
+// Application selections are replied with success and the other requests are replied by the given handler.
+func useFakeTransport(t *testing.T, handle func(req []byte) []byte) *fakeTransport {
+	t.Helper()
+	ft := &fakeTransport{}
+	ft.handle = func(req []byte) []byte {
+		if req[1] == insSelect && req[2] == 0x04 {
+			if ft.selected != nil {
+				return append(ft.selected(), 0x90, 0x00)
+			}
+			return []byte{0x90, 0x00}
+		}
+		return handle(req)
+	}
+	orig := openTransport
+	openTransport = func(reader string) (transport, error) {
+		ft.closed = false
+		return ft, nil
+	}
+	t.Cleanup(func() { openTransport = orig })
+	return ft
+}
+
+// testCard returns a test card instance by the given firmware version.
+func testCard(major, minor, patch int) *Card {
+	card := &Card{name: "Yubico YubiKey", serial: "12345678", pin: NewSecretString(DefaultPIN), puk: NewSecretString(DefaultPUK), manKey: NewSecret(DefaultManagementKey[:])}
+	card.version.Major, card.version.Minor, card.version.Patch = major, minor, patch
+	return card
+}
+
+func TestSessionSend(t *testing.T) {
+	// Chained command and response
+	data := bytes.Repeat([]byte{0x01}, 300)
+	ft := useFakeTransport(t, func(req []byte) []byte {
+		switch req[1] {
+		case insGetResponse:
+			return []byte{0x03, 0x04, 0x90, 0x00}
+		case 0x01:
+			if req[0]&claChaining != 0 {
+				return []byte{0x90, 0x00}
+			}
+			return []byte{0x01, 0x02, 0x61, 0x02}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	s, err := openSession("reader", aidPIV)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	resp, err := s.send(apdu{ins: 0x01, data: data})
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := []byte{0x01, 0x02, 0x03, 0x04}; !bytes.Equal(resp, want) {
+		t.Errorf("got %x, want %x", resp, want)
+	}
+	// select, 2 chained chunks and get response
+	if l := len(ft.requests); l != 4 {
+		t.Errorf("got %v, want %v", l, 4)
+	} else if v := ft.requests[1]; v[0] != claChaining || v[4] != apduMaxData {
+		t.Errorf("got %x, want a chained request", v[:5])
+	} else if v := ft.requests[2]; v[0] != 0x00 || v[4] != byte(300-apduMaxData) {
+		t.Errorf("got %x, want the last chained request", v[:5])
+	}
+
+	// Status word error
+	_, err = s.send(apdu{ins: 0x02})
+	if !isStatus(err, swNotSupported) {
+		t.Errorf("got %v, want %v", err, &apduError{sw: swNotSupported})
+	}
+	if err := s.Close(); err != nil || !ft.closed {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestAPDUError(t *testing.T) {
+	table := []struct {
+		sw      uint16
+		want    string
+		retries int
+	}{
+		{0x63c2, "smart card error 63c2: verification failed (2 retries remaining)", 2},
+		{0x63c1, "smart card error 63c1: verification failed (1 retry remaining)", 1},
+		{0x6982, "smart card error 6982: security status not satisfied", -1},
+		{0x6983, "smart card error 6983: authentication method blocked", -1},
+		{0x6a82, "smart card error 6a82: data object or application not found", -1},
+		{0x6f00, "smart card error 6f00: unknown error", -1},
+	}
+	for _, v := range table {
+		err := &apduError{sw: v.sw}
+		if s := err.Error(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+		if r, ok := err.retries(); (ok && r != v.retries) || (!ok && v.retries != -1) {
+			t.Errorf("got %v, want %v", r, v.retries)
+		}
+	}
+	if isStatus(errors.New("6982"), swSecurityStatus) {
+		t.Error("got true, want false")
+	}
+}
+
+func TestSessionCloseSecrets(t *testing.T) {
+	useFakeTransport(t, func(req []byte) []byte {
+		return []byte{0x90, 0x00}
+	})
+	s, err := openSession("Yubico YubiKey", aidPIV)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	b := s.keep([]byte{1, 2, 3})
+	s.scp = &scpState{enc: []byte{4}, mac: []byte{5}, rmac: []byte{6}}
+	scp := s.scp
+	s.Close()
+	if !bytes.Equal(b, []byte{0, 0, 0}) || scp.enc[0] != 0 || scp.mac[0] != 0 || scp.rmac[0] != 0 {
+		t.Errorf("got %x %+v, want zeroized secrets", b, scp)
+	}
+}
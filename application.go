@@ -0,0 +1,59 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"strings"
+)
+
+const (
+	// ApplicationOTP represents the OTP application.
+	ApplicationOTP Applications = 0x0001
+	// ApplicationU2F represents the FIDO U2F application.
+	ApplicationU2F Applications = 0x0002
+	// ApplicationOpenPGP represents the OpenPGP application.
+	ApplicationOpenPGP Applications = 0x0008
+	// ApplicationPIV represents the PIV application.
+	ApplicationPIV Applications = 0x0010
+	// ApplicationOATH represents the OATH application.
+	ApplicationOATH Applications = 0x0020
+	// ApplicationHSMAuth represents the YubiHSM Auth application.
+	ApplicationHSMAuth Applications = 0x0100
+	// ApplicationFIDO2 represents the FIDO2 application.
+	ApplicationFIDO2 Applications = 0x0200
+)
+
+// applicationNames holds the application names in the display order.
+var applicationNames = []struct {
+	app  Applications
+	name string
+}{
+	{ApplicationOTP, "OTP"},
+	{ApplicationU2F, "U2F"},
+	{ApplicationFIDO2, "FIDO2"},
+	{ApplicationOATH, "OATH"},
+	{ApplicationPIV, "PIV"},
+	{ApplicationOpenPGP, "OpenPGP"},
+	{ApplicationHSMAuth, "HSMAuth"},
+}
+
+// Applications represents a set of YubiKey applications.
+// Ref: https://docs.yubico.com/yesdk/users-manual/application-management/management-commands.html
+type Applications uint16
+
+// Has returns whether the set has all the given applications or not.
+func (apps Applications) Has(app Applications) bool {
+	return app != 0 && apps&app == app
+}
+
+// String returns the application names (i.e. OTP|PIV).
+func (apps Applications) String() string {
+	var names []string
+	for _, v := range applicationNames {
+		if apps.Has(v.app) {
+			names = append(names, v.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
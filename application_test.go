@@ -0,0 +1,37 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestApplicationsString(t *testing.T) {
+	table := []struct {
+		apps yubikey.Applications
+		want string
+	}{
+		{0, ""},
+		{yubikey.ApplicationPIV, "PIV"},
+		{yubikey.ApplicationOTP | yubikey.ApplicationPIV | yubikey.ApplicationFIDO2, "OTP|FIDO2|PIV"},
+		{0x023b, "OTP|U2F|FIDO2|OATH|PIV|OpenPGP"},
+	}
+	for _, v := range table {
+		if s := v.apps.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
+
+func TestApplicationsHas(t *testing.T) {
+	apps := yubikey.ApplicationOTP | yubikey.ApplicationPIV
+	if !apps.Has(yubikey.ApplicationPIV) || !apps.Has(yubikey.ApplicationOTP|yubikey.ApplicationPIV) {
+		t.Error("got false, want true")
+	}
+	if apps.Has(yubikey.ApplicationOATH) || apps.Has(yubikey.ApplicationPIV|yubikey.ApplicationOATH) || apps.Has(0) {
+		t.Error("got true, want false")
+	}
+}
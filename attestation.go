@@ -0,0 +1,160 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/devfacet/yubikey/attestation"
+)
+
+var (
+	// ErrNoAttestation represents a missing attestation error.
+	// Only the keys which have been generated on the card can be attested.
+	ErrNoAttestation = errors.New("slot has no key to attest")
+)
+
+// Attestation represents a verified slot key attestation.
+// For more information see https://developers.yubico.com/PIV/Introduction/PIV_attestation.html
+type Attestation struct {
+	// Serial is the serial number of the card which generated the key.
+	Serial string
+	// Version is the firmware version of the card which generated the key.
+	Version string
+	// FormFactor is the form factor of the card. It's unknown for the older YubiKeys.
+	FormFactor FormFactor
+	// IsFIPS indicates whether the card is a FIPS series YubiKey.
+	IsFIPS bool
+	// IsSKY indicates whether the card is a Security Key series YubiKey.
+	IsSKY bool
+	// PINPolicy is the PIN policy of the key.
+	PINPolicy PINPolicy
+	// TouchPolicy is the touch policy of the key.
+	TouchPolicy TouchPolicy
+	// Slot is the slot key which holds the key (i.e. 9a).
+	Slot string
+	// PublicKey is the attested public key.
+	PublicKey crypto.PublicKey
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the attested public key (SPKI).
+	Fingerprint string
+	// Certificate is the slot attestation certificate.
+	Certificate *x509.Certificate
+	// AttestationCertificate is the card attestation (f9) certificate which signs the slot attestation certificate.
+	AttestationCertificate *x509.Certificate
+}
+
+// Attest returns the verified attestation of the slot key.
+// It proves that the key was generated on a genuine YubiKey by verifying the attestation against
+// the Yubico CAs and the card attestation roots (see Card.SetAttestationRoots).
+func (slot *Slot) Attest() (*Attestation, error) {
+	// Get the attestation bundle
+	bundle, err := slot.AttestationBundle()
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the attestation
+	att, err := VerifyAttestationBundle(bundle, slot.card.attestationRoots)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't verify the slot attestation (%s): %s", slot.key, err)
+	}
+	if att.Slot != slot.key {
+		return nil, fmt.Errorf("slot attestation mismatch (%s): %s", slot.key, att.Slot)
+	}
+	if att.Serial != "" && att.Serial != slot.card.serial {
+		return nil, fmt.Errorf("card attestation mismatch (%s): %s", slot.card.serial, att.Serial)
+	}
+
+	return att, nil
+}
+
+// AttestationBundle returns the portable attestation bundle of the slot key.
+// The bundle isn't verified and it can be verified on the systems which have no smart card stack
+// (see attestation.VerifyBundle).
+func (slot *Slot) AttestationBundle() (*attestation.Bundle, error) {
+	if slot == nil || slot.card == nil {
+		return nil, errors.New("invalid slot")
+	}
+
+	// Get the slot and card attestation certificates
+	var bundle attestation.Bundle
+	err := slot.card.withSession(aidPIV, func(s *session) error {
+		cert, err := attestSlot(s, slot.slot.Key)
+		if errors.Is(err, ErrNoAttestation) {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("couldn't attest the slot key (%s): %s", slot.key, err)
+		}
+		aCert, err := readCertificate(s, objectAttestation)
+		if err != nil {
+			return fmt.Errorf("couldn't access to the key attestation certificate (%s): %s", slot.key, err)
+		}
+		bundle.Certificate, bundle.AttestationCertificate = cert, aCert
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &bundle, nil
+}
+
+// attestSlot returns the slot attestation certificate which is signed by the card attestation key.
+// It returns ErrNoAttestation if the slot has no key or the key is imported.
+// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/attestation.html
+func attestSlot(s *session, key uint32) (*x509.Certificate, error) {
+	resp, err := s.send(apdu{ins: insAttest, p1: byte(key)})
+	if isStatus(err, swNotFound) || isStatus(err, swWrongData) {
+		return nil, ErrNoAttestation
+	} else if err != nil {
+		return nil, err
+	}
+	// Some firmware versions wrap the certificate by the certificate tag
+	if len(resp) > 0 && resp[0] == tagCertificate {
+		list, err := parseTLVs(resp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attestation certificate: %s", err)
+		}
+		resp, _ = list.get(tagCertificate)
+	}
+	cert, err := x509.ParseCertificate(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation certificate: %s", err)
+	}
+	return cert, nil
+}
+
+// Bundle returns the portable attestation bundle of the attestation.
+func (att *Attestation) Bundle() *attestation.Bundle {
+	return &attestation.Bundle{Certificate: att.Certificate, AttestationCertificate: att.AttestationCertificate}
+}
+
+// VerifyAttestationBundle verifies the given attestation bundle and returns the attestation with the decoded policies.
+// The bundle must be chained to the Yubico CAs or the given roots.
+// This package requires the PC/SC stack so the servers which verify the exported bundles should use
+// attestation.VerifyBundle instead (the attestation package has no smart card dependency).
+func VerifyAttestationBundle(bundle *attestation.Bundle, roots []*x509.Certificate) (*Attestation, error) {
+	a, err := attestation.VerifyBundle(bundle, roots)
+	if err != nil {
+		return nil, err
+	}
+	formFactor, isFIPS, isSKY := parseFormFactor(a.FormFactor)
+	return &Attestation{
+		Serial:                 a.Serial,
+		Version:                a.Version,
+		FormFactor:             formFactor,
+		IsFIPS:                 isFIPS,
+		IsSKY:                  isSKY,
+		PINPolicy:              pinPolicyFromByte(a.PINPolicy),
+		TouchPolicy:            touchPolicyFromByte(a.TouchPolicy),
+		Slot:                   a.Slot,
+		PublicKey:              a.PublicKey,
+		Fingerprint:            a.Fingerprint,
+		Certificate:            a.Certificate,
+		AttestationCertificate: a.AttestationCertificate,
+	}, nil
+}
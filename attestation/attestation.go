@@ -0,0 +1,266 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+// Package attestation provides YubiKey PIV attestation verification.
+// It doesn't depend on a smart card stack (cgo or PC/SC) so it's the package which the servers should import
+// for verifying the attestation bundles exported by the clients (see ParseBundle and VerifyBundle).
+// The yubikey package requires the PC/SC stack and its wrappers are only for the clients which have the cards.
+package attestation
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Yubico attestation certificate extensions.
+	// Ref: https://developers.yubico.com/PIV/Introduction/PIV_attestation.html
+	//
+	// OIDFirmwareVersion holds the firmware version extension OID.
+	OIDFirmwareVersion = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 3}
+	// OIDSerialNumber holds the serial number extension OID.
+	OIDSerialNumber = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 7}
+	// OIDPolicy holds the PIN and touch policy extension OID.
+	OIDPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 8}
+	// OIDFormFactor holds the form factor extension OID.
+	OIDFormFactor = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 9}
+
+	// Yubico CA certificates.
+	// Ref: https://developers.yubico.com/PKI/
+	//
+	// Yubico PIV root CA which has been used since 2018.
+	//go:embed certs/yubico-piv-ca.pem
+	yubicoPIVCA []byte
+	// Yubico U2F root CA which has been used for the YubiKeys manufactured before 2018.
+	//go:embed certs/yubico-u2f-ca.pem
+	yubicoU2FCA []byte
+	// Yubico attestation root CA which has been used since 2024 (firmware 5.7.4+).
+	//go:embed certs/yubico-ca-1.pem
+	yubicoCA1 []byte
+	// Yubico attestation intermediate CAs of the Yubico attestation root CA.
+	//go:embed certs/yubico-intermediate.pem
+	yubicoIntermediates []byte
+)
+
+const (
+	// subjectPrefix holds the common name prefix of the slot attestation certificates.
+	subjectPrefix = "YubiKey PIV Attestation "
+
+	// Common name prefixes of the Yubico attestation intermediate CAs
+	// The common intermediate CAs issue the application intermediate CAs (PIV, FIDO, OpenPGP and Security Domain).
+	intermediateCommon  = "Yubico Attestation Intermediate "
+	intermediatePIV     = "Yubico PIV Attestation "
+	intermediateFIDO    = "Yubico FIDO Attestation "
+	intermediateOpenPGP = "Yubico OPGP Attestation "
+	intermediateSD      = "Yubico SD Attestation "
+)
+
+// Attestation represents a verified slot key attestation.
+// Policies and form factor are kept in their PIV encoded forms (see yubikey.Attestation for the decoded forms).
+type Attestation struct {
+	// Serial is the serial number of the card which generated the key.
+	Serial string
+	// Version is the firmware version of the card which generated the key.
+	Version string
+	// FormFactor is the encoded form factor of the card (including the FIPS and Security Key flags).
+	// It's zero for the older YubiKeys.
+	FormFactor byte
+	// PINPolicy is the encoded PIN policy of the key (0x01: never, 0x02: once, 0x03: always).
+	PINPolicy byte
+	// TouchPolicy is the encoded touch policy of the key (0x01: never, 0x02: always, 0x03: cached).
+	TouchPolicy byte
+	// Slot is the slot key which holds the key (i.e. 9a).
+	Slot string
+	// PublicKey is the attested public key.
+	PublicKey crypto.PublicKey
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the attested public key (SPKI).
+	Fingerprint string
+	// Certificate is the slot attestation certificate.
+	Certificate *x509.Certificate
+	// AttestationCertificate is the card attestation (f9) certificate which signs the slot attestation certificate.
+	AttestationCertificate *x509.Certificate
+}
+
+// Verify verifies the given slot attestation certificate by the given card attestation certificate and
+// returns the attestation. The card attestation certificate must be chained to the Yubico CAs or the given roots.
+func Verify(attestationCert, slotCert *x509.Certificate, roots []*x509.Certificate) (*Attestation, error) {
+	if attestationCert == nil || slotCert == nil {
+		return nil, errors.New("missing attestation certificate")
+	}
+
+	// Init the cert pools
+	rootPool, intermediatePool, err := yubicoCAs(intermediatePIV)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range roots {
+		rootPool.AddCert(v)
+	}
+
+	// The attestation certificates of some YubiKey 4 don't have the basic constraints extension which fails
+	// the chain verification. Since the attestation certificate is always a CA, use a copy of it instead.
+	ac := *attestationCert
+	if !ac.BasicConstraintsValid {
+		ac.BasicConstraintsValid = true
+		ac.IsCA = true
+	}
+	intermediatePool.AddCert(&ac)
+
+	// Verify the certificate chain
+	_, err = slotCert.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediatePool,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't verify the attestation certificate: %s", err)
+	}
+
+	return parse(attestationCert, slotCert)
+}
+
+// parse parses the given slot attestation certificate and returns the attestation.
+// It doesn't verify the certificates.
+func parse(attestationCert, slotCert *x509.Certificate) (*Attestation, error) {
+	attestation := Attestation{
+		PublicKey:              slotCert.PublicKey,
+		Certificate:            slotCert,
+		AttestationCertificate: attestationCert,
+	}
+
+	// Determine the slot
+	if !strings.HasPrefix(slotCert.Subject.CommonName, subjectPrefix) {
+		return nil, fmt.Errorf("invalid attestation subject: %s", slotCert.Subject.CommonName)
+	}
+	attestation.Slot = strings.ToLower(strings.TrimPrefix(slotCert.Subject.CommonName, subjectPrefix))
+	if !isSlot(attestation.Slot) {
+		return nil, fmt.Errorf("invalid attestation slot: %s", attestation.Slot)
+	}
+
+	// Iterate over the extensions and set the attestation values
+	for _, ext := range slotCert.Extensions {
+		switch {
+		case ext.Id.Equal(OIDFirmwareVersion):
+			if len(ext.Value) != 3 {
+				return nil, fmt.Errorf("invalid attestation firmware version: %x", ext.Value)
+			}
+			attestation.Version = fmt.Sprintf("%d.%d.%d", ext.Value[0], ext.Value[1], ext.Value[2])
+		case ext.Id.Equal(OIDSerialNumber):
+			var serial int64
+			if _, err := asn1.Unmarshal(ext.Value, &serial); err != nil || serial < 0 {
+				return nil, fmt.Errorf("invalid attestation serial number: %x", ext.Value)
+			}
+			attestation.Serial = fmt.Sprintf("%d", serial)
+		case ext.Id.Equal(OIDPolicy):
+			if len(ext.Value) != 2 {
+				return nil, fmt.Errorf("invalid attestation policy: %x", ext.Value)
+			}
+			attestation.PINPolicy = ext.Value[0]
+			attestation.TouchPolicy = ext.Value[1]
+		case ext.Id.Equal(OIDFormFactor):
+			if len(ext.Value) != 1 {
+				return nil, fmt.Errorf("invalid attestation form factor: %x", ext.Value)
+			}
+			attestation.FormFactor = ext.Value[0]
+		}
+	}
+
+	// Set the fingerprint
+	spki, err := x509.MarshalPKIXPublicKey(slotCert.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal the public key: %s", err)
+	}
+	sum := sha256.Sum256(spki)
+	attestation.Fingerprint = hex.EncodeToString(sum[:])
+
+	return &attestation, nil
+}
+
+// isSlot returns whether the given slot key is an attestable PIV slot or not.
+func isSlot(slotKey string) bool {
+	switch slotKey {
+	case "9a", "9c", "9d", "9e":
+		return true
+	}
+	// Retired key management slots (82-95)
+	key, err := strconv.ParseUint(slotKey, 16, 8)
+	if err != nil || len(slotKey) != 2 {
+		return false
+	}
+	return key >= 0x82 && key <= 0x95
+}
+
+// yubicoCAs returns the Yubico root CA pool and the intermediate CA pool of the given application
+// (i.e. intermediatePIV). The application intermediate CAs are kept in separate pools so the keys of an application
+// can't be verified by a chain through the intermediate CAs of the other applications.
+func yubicoCAs(app string) (roots, intermediates *x509.CertPool, err error) {
+	roots = x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(yubicoPIVCA) || !roots.AppendCertsFromPEM(yubicoCA1) {
+		return nil, nil, errors.New("couldn't parse the Yubico root CA certificates")
+	}
+	cas, err := yubicoIntermediateCAs(app)
+	if err != nil {
+		return nil, nil, err
+	}
+	intermediates = x509.NewCertPool()
+	for _, v := range cas {
+		intermediates.AddCert(v)
+	}
+
+	// The U2F root CA has the path length constraint set to 0 which doesn't allow the card attestation
+	// certificate as an intermediate certificate. So allow one intermediate certificate for it.
+	// Ref: https://datatracker.ietf.org/doc/html/rfc5280#section-4.2.1.9
+	certs, err := parseCertificatesPEM(yubicoU2FCA)
+	if err != nil || len(certs) != 1 {
+		return nil, nil, errors.New("couldn't parse the Yubico U2F root CA certificate")
+	}
+	certs[0].MaxPathLen = 1
+	roots.AddCert(certs[0])
+
+	return roots, intermediates, nil
+}
+
+// yubicoIntermediateCAs returns the common Yubico intermediate CAs and the intermediate CAs of the given application.
+func yubicoIntermediateCAs(app string) ([]*x509.Certificate, error) {
+	certs, err := parseCertificatesPEM(yubicoIntermediates)
+	if err != nil || len(certs) == 0 {
+		return nil, errors.New("couldn't parse the Yubico intermediate CA certificates")
+	}
+	var cas []*x509.Certificate
+	for _, v := range certs {
+		if strings.HasPrefix(v.Subject.CommonName, intermediateCommon) || strings.HasPrefix(v.Subject.CommonName, app) {
+			cas = append(cas, v)
+		}
+	}
+	return cas, nil
+}
+
+// parseCertificatesPEM parses the given PEM encoded certificates.
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -0,0 +1,69 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package attestation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSlot(t *testing.T) {
+	table := []struct {
+		slotKey string
+		want    bool
+	}{
+		{"9a", true},
+		{"9c", true},
+		{"9d", true},
+		{"9e", true},
+		{"82", true},
+		{"8f", true},
+		{"95", true},
+		{"9b", false},
+		{"f9", false},
+		{"81", false},
+		{"96", false},
+		{"082", false},
+		{"", false},
+	}
+	for _, v := range table {
+		if b := isSlot(v.slotKey); b != v.want {
+			t.Errorf("got %v, want %v for %v", b, v.want, v.slotKey)
+		}
+	}
+}
+
+func TestYubicoCAs(t *testing.T) {
+	roots, intermediates, err := yubicoCAs(intermediatePIV)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if roots == nil || intermediates == nil {
+		t.Error("got nil, want cert pools")
+	}
+}
+
+func TestYubicoIntermediateCAs(t *testing.T) {
+	table := []struct {
+		app  string
+		want []string
+	}{
+		{intermediatePIV, []string{"Yubico Attestation Intermediate A 1", "Yubico Attestation Intermediate B 1", "Yubico PIV Attestation A 1", "Yubico PIV Attestation B 1"}},
+		{intermediateFIDO, []string{"Yubico Attestation Intermediate A 1", "Yubico Attestation Intermediate B 1", "Yubico FIDO Attestation A 1", "Yubico FIDO Attestation B 1"}},
+		{intermediateOpenPGP, []string{"Yubico Attestation Intermediate A 1", "Yubico Attestation Intermediate B 1", "Yubico OPGP Attestation A 1", "Yubico OPGP Attestation B 1"}},
+		{intermediateSD, []string{"Yubico Attestation Intermediate A 1", "Yubico Attestation Intermediate B 1", "Yubico SD Attestation A 1", "Yubico SD Attestation B 1"}},
+	}
+	for _, v := range table {
+		certs, err := yubicoIntermediateCAs(v.app)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		var names []string
+		for _, cert := range certs {
+			names = append(names, cert.Subject.CommonName)
+		}
+		if !reflect.DeepEqual(names, v.want) {
+			t.Errorf("got %v, want %v", names, v.want)
+		}
+	}
+}
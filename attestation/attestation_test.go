@@ -0,0 +1,133 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package attestation_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/devfacet/yubikey/attestation"
+)
+
+// testChain returns a test root, card attestation and slot attestation certificates.
+func testChain(t *testing.T, slotKey string) (root, attestationCert, slotCert *x509.Certificate) {
+	t.Helper()
+
+	newCert := func(template, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		return cert
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		return key
+	}
+
+	rootKey, attestationKey, leafKey := newKey(), newKey(), newKey()
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test PIV Root CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root = newCert(rootTemplate, rootTemplate, rootKey.Public(), rootKey)
+	attestationCert = newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Yubico PIV Attestation"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageCertSign,
+		// Some YubiKey 4 attestation certificates don't have the basic constraints extension
+		BasicConstraintsValid: false,
+	}, root, attestationKey.Public(), rootKey)
+	serialExt, err := asn1.Marshal(12345678)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	slotCert = newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "YubiKey PIV Attestation " + slotKey},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: attestation.OIDFirmwareVersion, Value: []byte{5, 7, 1}},
+			{Id: attestation.OIDSerialNumber, Value: serialExt},
+			{Id: attestation.OIDPolicy, Value: []byte{0x03, 0x02}},
+			{Id: attestation.OIDFormFactor, Value: []byte{0x04}},
+		},
+	}, attestationCert, leafKey.Public(), attestationKey)
+
+	return root, attestationCert, slotCert
+}
+
+func TestVerify(t *testing.T) {
+	root, attestationCert, slotCert := testChain(t, "9d")
+
+	// Untrusted root
+	if _, err := attestation.Verify(attestationCert, slotCert, nil); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if _, err := attestation.Verify(nil, slotCert, nil); err == nil {
+		t.Error("got nil, want an error")
+	}
+
+	// Trusted root
+	a, err := attestation.Verify(attestationCert, slotCert, []*x509.Certificate{root})
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := a.Serial; v != "12345678" {
+		t.Errorf("got %v, want %v", v, "12345678")
+	}
+	if v := a.Version; v != "5.7.1" {
+		t.Errorf("got %v, want %v", v, "5.7.1")
+	}
+	if v := a.Slot; v != "9d" {
+		t.Errorf("got %v, want %v", v, "9d")
+	}
+	if v := a.PINPolicy; v != 0x03 {
+		t.Errorf("got %v, want %v", v, 0x03)
+	}
+	if v := a.TouchPolicy; v != 0x02 {
+		t.Errorf("got %v, want %v", v, 0x02)
+	}
+	if v := a.FormFactor; v != 0x04 {
+		t.Errorf("got %v, want %v", v, 0x04)
+	}
+	if v := a.Fingerprint; len(v) != 64 {
+		t.Errorf("got %v, want a fingerprint", v)
+	}
+	if attestationCert.BasicConstraintsValid {
+		t.Error("attestation certificate shouldn't be modified")
+	}
+
+	// Invalid slots
+	for _, slotKey := range []string{"9b", "f9", "81", "96", "xyz"} {
+		root, attestationCert, slotCert := testChain(t, slotKey)
+		if _, err := attestation.Verify(attestationCert, slotCert, []*x509.Certificate{root}); err == nil {
+			t.Errorf("got nil, want an error for %v", slotKey)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package attestation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	// BundleVersion holds the current version of the JSON encoded bundles.
+	BundleVersion = 1
+)
+
+// Bundle represents a portable slot key attestation bundle.
+// It holds the slot attestation certificate and the card attestation (f9) certificate which signs it.
+type Bundle struct {
+	// Certificate is the slot attestation certificate.
+	Certificate *x509.Certificate
+	// AttestationCertificate is the card attestation (f9) certificate.
+	AttestationCertificate *x509.Certificate
+}
+
+// bundleJSON represents the JSON encoded form of a bundle.
+type bundleJSON struct {
+	Version                int    `json:"version"`
+	Certificate            []byte `json:"certificate"`
+	AttestationCertificate []byte `json:"attestation_certificate"`
+}
+
+// ParseBundle parses the given PEM or JSON encoded bundle.
+func ParseBundle(data []byte) (*Bundle, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		var bundle Bundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return nil, err
+		}
+		return &bundle, nil
+	}
+
+	// PEM encoded bundles start with the slot attestation certificate
+	certs, err := parseCertificatesPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the bundle certificates: %s", err)
+	} else if len(certs) != 2 {
+		return nil, fmt.Errorf("invalid bundle certificate count: %d", len(certs))
+	}
+	return &Bundle{Certificate: certs[0], AttestationCertificate: certs[1]}, nil
+}
+
+// MarshalPEM returns the PEM encoded bundle.
+// The slot attestation certificate is followed by the card attestation certificate.
+func (bundle *Bundle) MarshalPEM() ([]byte, error) {
+	if err := bundle.check(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, cert := range []*x509.Certificate{bundle.Certificate, bundle.AttestationCertificate} {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// Certificates are encoded as base64 DER.
+func (bundle *Bundle) MarshalJSON() ([]byte, error) {
+	if err := bundle.check(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(bundleJSON{
+		Version:                BundleVersion,
+		Certificate:            bundle.Certificate.Raw,
+		AttestationCertificate: bundle.AttestationCertificate.Raw,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (bundle *Bundle) UnmarshalJSON(data []byte) error {
+	var bj bundleJSON
+	if err := json.Unmarshal(data, &bj); err != nil {
+		return err
+	}
+	if bj.Version != BundleVersion {
+		return fmt.Errorf("unsupported bundle version: %d", bj.Version)
+	}
+	cert, err := x509.ParseCertificate(bj.Certificate)
+	if err != nil {
+		return fmt.Errorf("couldn't parse the slot attestation certificate: %s", err)
+	}
+	aCert, err := x509.ParseCertificate(bj.AttestationCertificate)
+	if err != nil {
+		return fmt.Errorf("couldn't parse the card attestation certificate: %s", err)
+	}
+	bundle.Certificate = cert
+	bundle.AttestationCertificate = aCert
+	return nil
+}
+
+// VerifyBundle verifies the given bundle and returns the attestation.
+// The bundle must be chained to the Yubico CAs or the given roots.
+// It's the entry point for verifying the attestations on the servers which have no smart card stack.
+func VerifyBundle(bundle *Bundle, roots []*x509.Certificate) (*Attestation, error) {
+	if err := bundle.check(); err != nil {
+		return nil, err
+	}
+	return Verify(bundle.AttestationCertificate, bundle.Certificate, roots)
+}
+
+// check checks the bundle certificates.
+func (bundle *Bundle) check() error {
+	if bundle == nil || bundle.Certificate == nil || bundle.AttestationCertificate == nil {
+		return errors.New("missing bundle certificate")
+	}
+	return nil
+}
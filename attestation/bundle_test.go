@@ -0,0 +1,75 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package attestation_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+
+	"github.com/devfacet/yubikey/attestation"
+)
+
+func TestBundle(t *testing.T) {
+	root, attestationCert, slotCert := testChain(t, "9a")
+	bundle := &attestation.Bundle{Certificate: slotCert, AttestationCertificate: attestationCert}
+
+	// PEM
+	pemData, err := bundle.MarshalPEM()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	pemBundle, err := attestation.ParseBundle(pemData)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !pemBundle.Certificate.Equal(slotCert) || !pemBundle.AttestationCertificate.Equal(attestationCert) {
+		t.Error("got a different bundle, want the same bundle")
+	}
+
+	// JSON
+	jsonData, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	jsonBundle, err := attestation.ParseBundle(jsonData)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !jsonBundle.Certificate.Equal(slotCert) || !jsonBundle.AttestationCertificate.Equal(attestationCert) {
+		t.Error("got a different bundle, want the same bundle")
+	}
+
+	// Verify
+	a, err := attestation.VerifyBundle(jsonBundle, []*x509.Certificate{root})
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if v := a.Slot; v != "9a" {
+		t.Errorf("got %v, want %v", v, "9a")
+	}
+	if _, err := attestation.VerifyBundle(jsonBundle, nil); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
+
+func TestParseBundleInvalid(t *testing.T) {
+	table := []string{
+		"",
+		"{}",
+		`{"version":2}`,
+		`{"version":1,"certificate":"AA==","attestation_certificate":"AA=="}`,
+		"-----BEGIN CERTIFICATE-----\nAA==\n-----END CERTIFICATE-----\n",
+	}
+	for _, v := range table {
+		if _, err := attestation.ParseBundle([]byte(v)); err == nil {
+			t.Errorf("got nil, want an error for %q", v)
+		}
+	}
+	if _, err := (&attestation.Bundle{}).MarshalPEM(); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if _, err := attestation.VerifyBundle(nil, nil); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
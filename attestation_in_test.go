@@ -0,0 +1,184 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/devfacet/yubikey/attestation"
+)
+
+// testAttestationChain returns a test root, card attestation and slot attestation certificates.
+func testAttestationChain(t *testing.T, slotKey string, serial int64) (root, attestationCert, slotCert *x509.Certificate) {
+	t.Helper()
+
+	newCert := func(template, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		return cert
+	}
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		return key
+	}
+
+	rootKey, attestationKey, leafKey := newKey(), newKey(), newKey()
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test PIV Root CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root = newCert(rootTemplate, rootTemplate, rootKey.Public(), rootKey)
+	attestationCert = newCert(&x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Yubico PIV Attestation"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, root, attestationKey.Public(), rootKey)
+	serialExt, err := asn1.Marshal(serial)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	slotCert = newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "YubiKey PIV Attestation " + slotKey},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: attestation.OIDFirmwareVersion, Value: []byte{5, 4, 3}},
+			{Id: attestation.OIDSerialNumber, Value: serialExt},
+			{Id: attestation.OIDPolicy, Value: []byte{0x02, 0x03}},
+			{Id: attestation.OIDFormFactor, Value: []byte{0x81}},
+		},
+	}, attestationCert, leafKey.Public(), attestationKey)
+
+	return root, attestationCert, slotCert
+}
+
+func TestVerifyAttestationBundle(t *testing.T) {
+	root, attestationCert, slotCert := testAttestationChain(t, "9a", 12345678)
+	bundle := &attestation.Bundle{Certificate: slotCert, AttestationCertificate: attestationCert}
+
+	// Untrusted root
+	if _, err := VerifyAttestationBundle(bundle, nil); err == nil {
+		t.Error("got nil, want an error")
+	}
+
+	// Trusted root
+	att, err := VerifyAttestationBundle(bundle, []*x509.Certificate{root})
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := att.Serial; v != "12345678" {
+		t.Errorf("got %v, want %v", v, "12345678")
+	}
+	if v := att.Version; v != "5.4.3" {
+		t.Errorf("got %v, want %v", v, "5.4.3")
+	}
+	if v := att.Slot; v != "9a" {
+		t.Errorf("got %v, want %v", v, "9a")
+	}
+	if v := att.PINPolicy; v != PINPolicyOnce {
+		t.Errorf("got %v, want %v", v, PINPolicyOnce)
+	}
+	if v := att.TouchPolicy; v != TouchPolicyCached {
+		t.Errorf("got %v, want %v", v, TouchPolicyCached)
+	}
+	if v := att.FormFactor; v != FormFactorUSBAKeychain {
+		t.Errorf("got %v, want %v", v, FormFactorUSBAKeychain)
+	}
+	if v := att.IsFIPS; !v {
+		t.Errorf("got %v, want true", v)
+	}
+	if v := att.IsSKY; v {
+		t.Errorf("got %v, want false", v)
+	}
+	if v := att.Fingerprint; len(v) != 64 {
+		t.Errorf("got %v, want a fingerprint", v)
+	}
+
+	if b := att.Bundle(); b.Certificate != slotCert || b.AttestationCertificate != attestationCert {
+		t.Errorf("got %v, want %v", b, bundle)
+	}
+}
+
+func TestSlotAttestationBundle(t *testing.T) {
+	root, attestationCert, slotCert := testAttestationChain(t, "9a", 12345678)
+	objects := fakeObjects{objectAttestation: marshalTLV(tagCertificate, attestationCert.Raw)}
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := objects.handle(req); resp != nil {
+			return resp
+		}
+		if req[1] == insAttest {
+			switch req[2] {
+			case 0x9a:
+				return append(append([]byte(nil), slotCert.Raw...), 0x90, 0x00)
+			case 0x9c:
+				return append(marshalTLV(tagCertificate, slotCert.Raw), 0x90, 0x00)
+			case 0x9d:
+				return []byte{0x6a, 0x80}
+			}
+			return []byte{0x6a, 0x82}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 4, 3)
+	card.SetAttestationRoots(root)
+
+	// Plain and wrapped certificates
+	for _, key := range []string{"9a", "9c"} {
+		slot := &Slot{key: key, card: card, slot: slotMap[key]}
+		bundle, err := slot.AttestationBundle()
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if !bundle.Certificate.Equal(slotCert) || !bundle.AttestationCertificate.Equal(attestationCert) {
+			t.Errorf("got %v, want the test certificates", bundle)
+		}
+	}
+
+	// Verified attestation
+	att, err := (&Slot{key: "9a", card: card, slot: slotMap["9a"]}).Attest()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := att.PINPolicy; v != PINPolicyOnce {
+		t.Errorf("got %v, want %v", v, PINPolicyOnce)
+	}
+
+	// Imported key and empty slot
+	for _, key := range []string{"9d", "9e"} {
+		slot := &Slot{key: key, card: card, slot: slotMap[key]}
+		if _, err := slot.AttestationBundle(); !errors.Is(err, ErrNoAttestation) {
+			t.Errorf("got %v, want %v", err, ErrNoAttestation)
+		}
+	}
+}
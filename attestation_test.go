@@ -0,0 +1,48 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestSlotAttest(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		slots, err := card.SlotsByKey([]string{"82", "9e"})
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		for _, slot := range slots {
+			if !slot.IsGenerated() {
+				continue
+			}
+			attestation, err := slot.Attest()
+			if err != nil {
+				t.Errorf("got %v, want nil", err)
+				continue
+			}
+			if v := attestation.Serial; v != card.Serial() {
+				t.Errorf("got %v, want %v", v, card.Serial())
+			}
+			if v := attestation.Slot; v != slot.Key() {
+				t.Errorf("got %v, want %v", v, slot.Key())
+			}
+			if v := attestation.PINPolicy; v != slot.PINPolicy() {
+				t.Errorf("got %v, want %v", v, slot.PINPolicy())
+			}
+			if v := attestation.TouchPolicy; v != slot.TouchPolicy() {
+				t.Errorf("got %v, want %v", v, slot.TouchPolicy())
+			}
+			if v := attestation.Fingerprint; v == "" {
+				t.Errorf("got %v, want a fingerprint", v)
+			}
+		}
+	}
+}
@@ -5,24 +5,47 @@ package yubikey
 
 import (
 	"crypto/ecdsa"
-	"crypto/elliptic"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"sort"
-	"strings"
+	"sync"
+	"time"
 
-	"github.com/go-piv/piv-go/piv"
+	"github.com/devfacet/yubikey/attestation"
 )
 
+// version represents a card firmware version.
+type version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
 // Card represents a YubiKey smart card.
 // For more information see https://developers.yubico.com/PIV/Introduction/YubiKey_and_PIV.html
 type Card struct {
 	name    string
 	serial  string
-	version piv.Version
-	pin     string
-	puk     string
-	manKey  [24]byte
-	keyAuth piv.KeyAuth
+	version version
+	pin     *Secret
+	puk     *Secret
+	manKey  *Secret
+
+	attestationRoots []*x509.Certificate
+	secureChannel    *SecureChannel
+	sdKey            *ecdsa.PublicKey
+	onTouchRequired  TouchFunc
+	onTouchCompleted TouchCompletedFunc
+
+	touchMu   sync.Mutex
+	touchedAt time.Time
+
+	pinMu       sync.Mutex
+	pinProvider PINProvider
+	pinTTL      time.Duration
+	cachedPIN   *Secret
+	cachedAt    time.Time
 }
 
 // Name returns the card name.
@@ -40,19 +63,81 @@ func (card *Card) Version() string {
 	return fmt.Sprintf("%d.%d.%d", card.version.Major, card.version.Minor, card.version.Patch)
 }
 
-// SetPIN sets the card pin.
+// isVersion returns whether the card firmware version is the given version or later.
+func (card *Card) isVersion(major, minor, patch int) bool {
+	v := card.version
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// SetPIN sets the card pin. The card PIN provider is removed.
+// The string can't be zeroized so SetPINSecret should be preferred.
 func (card *Card) SetPIN(pin string) {
-	card.pin = pin
+	secret := NewSecretString(pin)
+	defer secret.Zero()
+	card.SetPINSecret(secret)
+}
+
+// SetPINSecret sets a copy of the given card PIN. The card PIN provider is removed.
+func (card *Card) SetPINSecret(pin *Secret) {
+	card.pinMu.Lock()
+	defer card.pinMu.Unlock()
+	card.pin.Zero()
+	card.pin = pin.Clone()
+	card.pinProvider = nil
+	card.cachedPIN.Zero()
+	card.cachedPIN, card.cachedAt = nil, time.Time{}
 }
 
 // SetPUK sets the card puk.
+// The string can't be zeroized so SetPUKSecret should be preferred.
 func (card *Card) SetPUK(puk string) {
-	card.puk = puk
+	card.setPUK(NewSecretString(puk))
 }
 
-// SetManKey sets the management key
+// SetPUKSecret sets a copy of the given card PUK.
+func (card *Card) SetPUKSecret(puk *Secret) {
+	card.setPUK(puk.Clone())
+}
+
+// SetManKey sets the management key.
+// It can be a 3DES (24 bytes) or AES (16, 24 or 32 bytes) key.
 func (card *Card) SetManKey(manKey []byte) {
-	copy(card.manKey[:], manKey)
+	card.setManKey(NewSecret(manKey))
+}
+
+// ZeroSecrets zeroizes the PIN, PUK and management key of the card (including the cached PIN).
+// The card secrets must be set again before the operations which require them.
+func (card *Card) ZeroSecrets() {
+	card.pinMu.Lock()
+	card.pin.Zero()
+	card.cachedPIN.Zero()
+	card.pinMu.Unlock()
+	card.puk.Zero()
+	card.manKey.Zero()
+}
+
+// setPUK sets the card PUK and zeroizes the previous one.
+func (card *Card) setPUK(puk *Secret) {
+	card.puk.Zero()
+	card.puk = puk
+}
+
+// setManKey sets the card management key and zeroizes the previous one.
+func (card *Card) setManKey(manKey *Secret) {
+	card.manKey.Zero()
+	card.manKey = manKey
+}
+
+// SetAttestationRoots sets the additional root certificates which are trusted for verifying the slot attestations.
+// The Yubico CA certificates are always trusted.
+func (card *Card) SetAttestationRoots(roots ...*x509.Certificate) {
+	card.attestationRoots = roots
 }
 
 // SlotKeys returns the card slot keys.
@@ -70,143 +155,185 @@ func (card *Card) Slots() ([]*Slot, error) {
 }
 
 // SlotsByKey returns the card slots by the given slot keys.
+// The slot names are resolved by ParseSlot and it returns the ParseSlot error if a slot is unknown.
 func (card *Card) SlotsByKey(slotKeys []string) ([]*Slot, error) {
-	openMu.Lock()
-	defer openMu.Unlock()
-
-	// Connect to the smart card
-	yk, err := piv.Open(card.name)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", card.serial, err)
+	// Resolve the slot names (i.e. "authentication") into the slot keys
+	keys := make([]string, 0, len(slotKeys))
+	seen := make(map[string]bool)
+	for _, v := range slotKeys {
+		key, err := ParseSlot(v)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
 	}
-	defer yk.Close()
+	slotKeys = keys
 
 	// Iterate over the slots and initialize the slot instances
 	var slots []*Slot
-	for _, slotKey := range slotKeys {
-		// Check the slot name
-		smv, ok := slotMap[slotKey]
-		if !ok {
-			continue
+	err := card.withSession(aidPIV, func(s *session) error {
+		// Get the slot key metadata which is used for the keys that can't be attested (i.e. imported keys)
+		metadata, err := card.slotsMetadata(s, slotKeys)
+		if err != nil {
+			return err
 		}
 
-		// Init the slot instance
-		slot := Slot{key: slotKey, card: card, slot: smv}
+		for _, slotKey := range slotKeys {
+			// Check the slot name
+			smv, ok := slotMap[slotKey]
+			if !ok {
+				continue
+			}
 
-		// Attest method checks keys which have been generated, not imported
-		cert, err := yk.Attest(slot.slot)
-		if err != nil {
-			if strings.Contains(err.Error(), "data object or application not found") {
-				// Certificate method checks imported keys/certificates which may not be secured
-				certImp, err := yk.Certificate(slot.slot)
-				if err != nil {
-					if strings.Contains(err.Error(), "data object or application not found") {
-						// No cert found
-					} else {
-						return nil, fmt.Errorf("couldn't access to the key slot (%s): %s", slotKey, err)
-					}
-				} else {
+			// Init the slot instance
+			slot := Slot{key: slotKey, card: card, slot: smv}
+
+			// Attestation checks keys which have been generated, not imported
+			cert, err := attestSlot(s, slot.slot.Key)
+			if errors.Is(err, ErrNoAttestation) {
+				// The certificate object checks imported keys/certificates which may not be secured
+				certImp, err := readCertificate(s, slot.slot.Object)
+				if err != nil && !errors.Is(err, ErrNoObject) {
+					return fmt.Errorf("couldn't access to the key slot (%s): %s", slotKey, err)
+				} else if err == nil {
 					slot.isImported = true
+					slot.certificate = certImp
 					cert = certImp
 				}
+			} else if err != nil {
+				return fmt.Errorf("couldn't access to the key slot (%s): %s", slotKey, err)
 			} else {
-				return nil, fmt.Errorf("couldn't access to the key slot (%s): %s", slotKey, err)
+				slot.isGenerated = true
+				// The generated keys may have a certificate too (it's optional so the errors are ignored)
+				if certGen, err := readCertificate(s, slot.slot.Object); err == nil {
+					slot.certificate = certGen
+				}
 			}
-		} else {
-			slot.isGenerated = true
-		}
-		if cert == nil {
+			if cert == nil {
+				slots = append(slots, &slot)
+				continue
+			} else if cert.PublicKey == nil {
+				return fmt.Errorf("slot certificate has no public key (%s)", slotKey)
+			}
+			slot.hasKey = true
+
+			// Determine the slot PIN and touch policies
+			if slot.isGenerated {
+				aCert, err := readCertificate(s, objectAttestation)
+				if err != nil {
+					return fmt.Errorf("couldn't access to the key attestation certificate (%s): %s", slotKey, err)
+				}
+				sAttestation, err := attestation.Verify(aCert, cert, card.attestationRoots)
+				if err != nil {
+					return fmt.Errorf("couldn't access to the slot attestation (%s): %s", slotKey, err)
+				}
+				slot.pinPolicy = pinPolicyFromByte(sAttestation.PINPolicy)
+				slot.touchPolicy = touchPolicyFromByte(sAttestation.TouchPolicy)
+			} else if md, ok := metadata[slotKey]; ok {
+				slot.pinPolicy = md.PINPolicy
+				slot.touchPolicy = md.TouchPolicy
+			}
+
+			// Set the public key
+			slot.setPublicKey(cert.PublicKey)
+
 			slots = append(slots, &slot)
-			continue
-		} else if cert != nil && cert.PublicKey == nil {
-			return nil, fmt.Errorf("slot certificate has no public key (%s): %s", slotKey, err)
 		}
-		slot.hasKey = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].key < slots[j].key })
 
-		// Determine the slot PIN and touch policies
-		aCert, err := yk.AttestationCertificate()
-		if err != nil {
-			return nil, fmt.Errorf("couldn't access to the key attestation certificate (%s): %s", slotKey, err)
-		}
-		sAttestation, err := piv.Verify(aCert, cert)
-		if err != nil {
-			return nil, fmt.Errorf("couldn't access to the slot attestation (%s): %s", slotKey, err)
-		}
-		// We could simply cast PIN and touch policies but that would be bad if the upstream ever changes
-		switch sAttestation.PINPolicy {
-		case piv.PINPolicyAlways:
-			slot.pinPolicy = PINPolicyAlways
-		case piv.PINPolicyNever:
-			slot.pinPolicy = PINPolicyNever
-		case piv.PINPolicyOnce:
-			slot.pinPolicy = PINPolicyOnce
-		}
-		switch sAttestation.TouchPolicy {
-		case piv.TouchPolicyAlways:
-			slot.touchPolicy = TouchPolicyAlways
-		case piv.TouchPolicyCached:
-			slot.touchPolicy = TouchPolicyCached
-		case piv.TouchPolicyNever:
-			slot.touchPolicy = TouchPolicyNever
-		}
+	return slots, nil
+}
 
-		// Get the private key object
-		privateKey, err := yk.PrivateKey(slot.slot, cert.PublicKey, card.keyAuth)
-		if err != nil {
-			return nil, fmt.Errorf("couldn't get the slot key (%s): %s", slotKey, err)
-		}
-		privateKeyECDSA, ok := privateKey.(*piv.ECDSAPrivateKey)
-		if !ok {
-			// For now only ECDSA keys are allowed
-			continue
-		}
-		// Set the public key
-		slot.publicKeyECDSA, ok = privateKeyECDSA.Public().(*ecdsa.PublicKey)
+// slotsMetadata returns the key metadata of the given slots by the given session.
+// It returns an empty map if the card doesn't support the metadata.
+func (card *Card) slotsMetadata(s *session, slotKeys []string) (map[string]*KeyMetadata, error) {
+	metadata := make(map[string]*KeyMetadata)
+	if !card.isVersion(5, 3, 0) {
+		return metadata, nil
+	}
+
+	// Iterate over the slots and get the key metadata
+	for _, slotKey := range slotKeys {
+		smv, ok := slotMap[slotKey]
 		if !ok {
-			// This shouldn't happen since private key is checked above
 			continue
 		}
-		slot.publicKey = elliptic.MarshalCompressed(slot.publicKeyECDSA.Curve, slot.publicKeyECDSA.X, slot.publicKeyECDSA.Y)
-		switch slot.publicKeyECDSA.Curve {
-		case elliptic.P256():
-			slot.publicKeyAlg = AlgorithmEC256
-		case elliptic.P384():
-			slot.publicKeyAlg = AlgorithmEC384
-		default:
-			slot.publicKeyAlg = AlgorithmUnknown
+		md, err := card.keyMetadata(s, byte(smv.Key))
+		if err != nil {
+			if errors.Is(err, ErrNoKey) {
+				continue
+			}
+			return nil, fmt.Errorf("couldn't get the slot metadata (%s): %s", slotKey, err)
 		}
-
-		slots = append(slots, &slot)
+		metadata[slotKey] = md
 	}
-	sort.Slice(slots, func(i, j int) bool { return slots[i].key < slots[j].key })
 
-	return slots, nil
+	return metadata, nil
 }
 
 // VerifyPIN attempts to authenticate against the card with the provided PIN.
+// If the card has a PIN protected management key then it's set as the card management key.
+// The string can't be zeroized so VerifyPINSecret should be preferred.
 func (card *Card) VerifyPIN(pin string) error {
+	secret := NewSecretString(pin)
+	defer secret.Zero()
+	return card.VerifyPINSecret(secret)
+}
+
+// VerifyPINSecret attempts to authenticate against the card with the provided PIN.
+// If the card has a PIN protected management key then it's set as the card management key.
+func (card *Card) VerifyPINSecret(pin *Secret) error {
 	// Connect to the smart card
-	openMu.Lock()
-	defer openMu.Unlock()
-	yk, err := piv.Open(card.name)
-	if err != nil {
-		return fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", card.name, err)
-	}
-	defer yk.Close()
+	return card.withSession(aidPIV, func(s *session) error {
+		// Verify the PIN and get the PIN protected management key
+		if err := verifyPIN(s, pin.Bytes()); err != nil {
+			return card.pinError(err, ErrInvalidPIN)
+		}
+		manKey, err := protectedManagementKey(s)
+		if err != nil {
+			return err
+		} else if manKey != nil {
+			card.setManKey(NewSecret(manKey))
+		}
 
-	return yk.VerifyPIN(pin)
+		return nil
+	})
 }
 
-// Unblock unblocks the PIN, setting it to a new value.
+// Unblock unblocks the PIN, setting it to a new value. The card PIN is updated after the PIN is unblocked.
+// The strings can't be zeroized so UnblockSecret should be preferred.
 func (card *Card) Unblock(puk, newPIN string) error {
-	// Connect to the smart card
-	openMu.Lock()
-	defer openMu.Unlock()
-	yk, err := piv.Open(card.name)
-	if err != nil {
-		return fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", card.name, err)
+	pukSecret, pinSecret := NewSecretString(puk), NewSecretString(newPIN)
+	defer pukSecret.Zero()
+	defer pinSecret.Zero()
+	return card.UnblockSecret(pukSecret, pinSecret)
+}
+
+// UnblockSecret unblocks the PIN, setting it to a new value. The card PIN is updated after the PIN is unblocked.
+func (card *Card) UnblockSecret(puk, newPIN *Secret) error {
+	if err := validatePINLength(puk.Len()); err != nil {
+		return err
+	} else if err := validatePINLength(newPIN.Len()); err != nil {
+		return err
 	}
-	defer yk.Close()
 
-	return yk.Unblock(puk, newPIN)
+	// Connect to the smart card
+	return card.withSession(aidPIV, func(s *session) error {
+		// Reset the PIN retry counter
+		data := s.keep(append(s.keep(encodePIN(puk.Bytes())), s.keep(encodePIN(newPIN.Bytes()))...))
+		if _, err := s.send(apdu{ins: insResetRetryCounter, p2: keyPIN, data: data}); err != nil {
+			return card.pinError(err, ErrInvalidPUK)
+		}
+		card.setPIN(newPIN)
+
+		return nil
+	})
 }
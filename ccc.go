@@ -0,0 +1,99 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const (
+	// CCC tags
+	// Ref: https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-73-4.pdf#page=38
+	tagCCCCardIdentifier    = 0xf0
+	tagCCCContainerVersion  = 0xf1
+	tagCCCGrammarVersion    = 0xf2
+	tagCCCApplicationsURL   = 0xf3
+	tagCCCPKCS15            = 0xf4
+	tagCCCDataModel         = 0xf5
+	tagCCCAccessControl     = 0xf6
+	tagCCCCardAPDUs         = 0xf7
+	tagCCCRedirection       = 0xfa
+	tagCCCCapabilityTuples  = 0xfb
+	tagCCCStatusTuples      = 0xfc
+	tagCCCNext              = 0xfd
+	cccCardIdentifierLength = 21
+)
+
+// cccCardIdentifierPrefix holds the GSC-RID and manufacturer prefix which is used by the Yubico tools.
+var cccCardIdentifierPrefix = []byte{0xa0, 0x00, 0x00, 0x01, 0x16, 0xff, 0x02}
+
+// CCC represents the Card Capability Container data object.
+type CCC struct {
+	// CardIdentifier is the card identifier (21 bytes).
+	CardIdentifier []byte
+	// ContainerVersion is the capability container version.
+	ContainerVersion byte
+	// GrammarVersion is the capability grammar version.
+	GrammarVersion byte
+	// DataModel is the registered data model number.
+	DataModel byte
+}
+
+// NewCCC returns a new CCC with a random card identifier.
+func NewCCC() (*CCC, error) {
+	ccc := CCC{
+		CardIdentifier:   make([]byte, cccCardIdentifierLength),
+		ContainerVersion: 0x21,
+		GrammarVersion:   0x21,
+		DataModel:        0x10,
+	}
+	n := copy(ccc.CardIdentifier, cccCardIdentifierPrefix)
+	if _, err := rand.Read(ccc.CardIdentifier[n:]); err != nil {
+		return nil, fmt.Errorf("couldn't generate a card identifier: %s", err)
+	}
+	return &ccc, nil
+}
+
+// ParseCCC parses the given CCC data object content.
+func ParseCCC(b []byte) (*CCC, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CCC: %s", err)
+	}
+
+	var ccc CCC
+	id, ok := list.get(tagCCCCardIdentifier)
+	if !ok {
+		return nil, errors.New("invalid CCC: missing card identifier")
+	}
+	ccc.CardIdentifier = id
+	if v, ok := list.get(tagCCCContainerVersion); ok && len(v) == 1 {
+		ccc.ContainerVersion = v[0]
+	}
+	if v, ok := list.get(tagCCCGrammarVersion); ok && len(v) == 1 {
+		ccc.GrammarVersion = v[0]
+	}
+	if v, ok := list.get(tagCCCDataModel); ok && len(v) == 1 {
+		ccc.DataModel = v[0]
+	}
+
+	return &ccc, nil
+}
+
+// Marshal returns the CCC data object content.
+func (ccc *CCC) Marshal() []byte {
+	b := marshalTLV(tagCCCCardIdentifier, ccc.CardIdentifier)
+	b = append(b, marshalTLV(tagCCCContainerVersion, []byte{ccc.ContainerVersion})...)
+	b = append(b, marshalTLV(tagCCCGrammarVersion, []byte{ccc.GrammarVersion})...)
+	b = append(b, marshalTLV(tagCCCApplicationsURL, nil)...)
+	b = append(b, marshalTLV(tagCCCPKCS15, []byte{0x00})...)
+	b = append(b, marshalTLV(tagCCCDataModel, []byte{ccc.DataModel})...)
+	// The remaining mandatory tags are empty
+	for _, tag := range []uint32{tagCCCAccessControl, tagCCCCardAPDUs, tagCCCRedirection, tagCCCCapabilityTuples, tagCCCStatusTuples, tagCCCNext, tagErrorDetection} {
+		b = append(b, marshalTLV(tag, nil)...)
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// CHUID tags
+	// Ref: https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-73-4.pdf#page=39
+	tagCHUIDFASCN      = 0x30
+	tagCHUIDOrgID      = 0x32
+	tagCHUIDDUNS       = 0x33
+	tagCHUIDGUID       = 0x34
+	tagCHUIDExpiration = 0x35
+	tagCHUIDUUID       = 0x36
+	tagCHUIDSignature  = 0x3e
+	tagErrorDetection  = 0xfe
+	chuidDateLayout    = "20060102"
+)
+
+var (
+	// defaultFASCN holds the FASC-N which is used by the Yubico tools (agency code 9999, system code 9999, credential number 999999).
+	defaultFASCN = []byte{
+		0xd4, 0xe7, 0x39, 0xda, 0x73, 0x9c, 0xed, 0x39, 0xce, 0x73, 0x9d, 0x83, 0x68,
+		0x58, 0x21, 0x08, 0x42, 0x10, 0x84, 0x21, 0xc8, 0x42, 0x10, 0xc3, 0xeb,
+	}
+)
+
+// CHUID represents the Card Holder Unique Identifier data object.
+type CHUID struct {
+	// FASCN is the Federal Agency Smart Credential Number (25 bytes).
+	FASCN []byte
+	// OrgID is the optional Organizational Identifier.
+	OrgID []byte
+	// DUNS is the optional Data Universal Numbering System number.
+	DUNS []byte
+	// GUID is the Global Unique Identifier of the card.
+	GUID [16]byte
+	// Expiration is the expiration date of the CHUID.
+	Expiration time.Time
+	// UUID is the optional Cardholder UUID.
+	UUID []byte
+	// Signature is the optional issuer asymmetric signature.
+	Signature []byte
+}
+
+// NewCHUID returns a new CHUID with a random GUID.
+// It uses the same FASC-N and expiration date (2030-01-01) as the Yubico tools.
+func NewCHUID() (*CHUID, error) {
+	chuid := CHUID{
+		FASCN:      append([]byte(nil), defaultFASCN...),
+		Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if _, err := rand.Read(chuid.GUID[:]); err != nil {
+		return nil, fmt.Errorf("couldn't generate a GUID: %s", err)
+	}
+	return &chuid, nil
+}
+
+// ParseCHUID parses the given CHUID data object content.
+func ParseCHUID(b []byte) (*CHUID, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CHUID: %s", err)
+	}
+
+	var chuid CHUID
+	fascn, ok := list.get(tagCHUIDFASCN)
+	if !ok {
+		return nil, errors.New("invalid CHUID: missing FASC-N")
+	}
+	chuid.FASCN = fascn
+	guid, ok := list.get(tagCHUIDGUID)
+	if !ok || len(guid) != len(chuid.GUID) {
+		return nil, errors.New("invalid CHUID: missing GUID")
+	}
+	copy(chuid.GUID[:], guid)
+	expiration, ok := list.get(tagCHUIDExpiration)
+	if !ok {
+		return nil, errors.New("invalid CHUID: missing expiration date")
+	}
+	if chuid.Expiration, err = time.Parse(chuidDateLayout, string(expiration)); err != nil {
+		return nil, fmt.Errorf("invalid CHUID expiration date: %s", err)
+	}
+	chuid.OrgID, _ = list.get(tagCHUIDOrgID)
+	chuid.DUNS, _ = list.get(tagCHUIDDUNS)
+	chuid.UUID, _ = list.get(tagCHUIDUUID)
+	chuid.Signature, _ = list.get(tagCHUIDSignature)
+
+	return &chuid, nil
+}
+
+// Marshal returns the CHUID data object content.
+func (chuid *CHUID) Marshal() []byte {
+	b := marshalTLV(tagCHUIDFASCN, chuid.FASCN)
+	if len(chuid.OrgID) > 0 {
+		b = append(b, marshalTLV(tagCHUIDOrgID, chuid.OrgID)...)
+	}
+	if len(chuid.DUNS) > 0 {
+		b = append(b, marshalTLV(tagCHUIDDUNS, chuid.DUNS)...)
+	}
+	b = append(b, marshalTLV(tagCHUIDGUID, chuid.GUID[:])...)
+	b = append(b, marshalTLV(tagCHUIDExpiration, []byte(chuid.Expiration.Format(chuidDateLayout)))...)
+	if len(chuid.UUID) > 0 {
+		b = append(b, marshalTLV(tagCHUIDUUID, chuid.UUID)...)
+	}
+	// The signature tag is mandatory but it can be empty
+	b = append(b, marshalTLV(tagCHUIDSignature, chuid.Signature)...)
+	return append(b, marshalTLV(tagErrorDetection, nil)...)
+}
@@ -0,0 +1,365 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Management instructions
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-management/management-commands.html
+	insReadConfig  = 0x1d
+	insWriteConfig = 0x1c
+
+	// Device info tags
+	deviceTagUSBSupported    = 0x01
+	deviceTagSerial          = 0x02
+	deviceTagUSBEnabled      = 0x03
+	deviceTagFormFactor      = 0x04
+	deviceTagVersion         = 0x05
+	deviceTagAutoEject       = 0x06
+	deviceTagChalRespTimeout = 0x07
+	deviceTagFlags           = 0x08
+	deviceTagConfigLock      = 0x0a
+	deviceTagUnlock          = 0x0b
+	deviceTagReboot          = 0x0c
+	deviceTagNFCSupported    = 0x0d
+	deviceTagNFCEnabled      = 0x0e
+	deviceTagMoreData        = 0x10
+	deviceTagPINComplexity   = 0x16
+	deviceTagNFCRestricted   = 0x17
+
+	// Device flags
+	deviceFlagRemoteWakeup = 0x40
+	deviceFlagTouchEject   = 0x80
+
+	// deviceInfoMaxPages holds the maximum number of the device info pages.
+	deviceInfoMaxPages = 0x10
+	// lockCodeLen holds the configuration lock code length.
+	lockCodeLen = 16
+)
+
+// ErrConfigLocked represents a locked configuration error.
+var ErrConfigLocked = errors.New("configuration is locked")
+
+// aidManagement holds the Management application identifier.
+var aidManagement = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x47, 0x11, 0x17}
+
+// DeviceInfo represents the YubiKey device information which is returned by the Management application.
+type DeviceInfo struct {
+	// Serial is the serial number. It's empty if the serial number isn't visible.
+	Serial string
+	// Version is the firmware version.
+	Version string
+	// FormFactor is the form factor.
+	FormFactor FormFactor
+	// IsFIPS indicates whether the device is a FIPS series device or not.
+	IsFIPS bool
+	// IsSKY indicates whether the device is a Security Key series device or not.
+	IsSKY bool
+	// USBSupported is the applications which are supported over USB.
+	USBSupported Applications
+	// USBEnabled is the applications which are enabled over USB.
+	USBEnabled Applications
+	// NFCSupported is the applications which are supported over NFC. It's empty if the device has no NFC.
+	NFCSupported Applications
+	// NFCEnabled is the applications which are enabled over NFC.
+	NFCEnabled Applications
+	// AutoEjectTimeout is the auto eject timeout of the CCID interface.
+	AutoEjectTimeout time.Duration
+	// ChallengeResponseTimeout is the touch timeout of the OTP challenge-response.
+	ChallengeResponseTimeout time.Duration
+	// RemoteWakeup indicates whether the remote wakeup is enabled or not.
+	RemoteWakeup bool
+	// TouchEject indicates whether the CCID interface is ejected by touch or not.
+	TouchEject bool
+	// ConfigLocked indicates whether the configuration is protected by a lock code or not.
+	ConfigLocked bool
+	// PINComplexity indicates whether the PIN complexity is enforced or not.
+	PINComplexity bool
+	// NFCRestricted indicates whether the NFC is restricted (i.e. for shipping) or not.
+	NFCRestricted bool
+}
+
+// SerialVisible returns whether the serial number is visible over the Management application or not.
+func (info *DeviceInfo) SerialVisible() bool {
+	return info.Serial != ""
+}
+
+// HasNFC returns whether the device supports NFC or not.
+func (info *DeviceInfo) HasNFC() bool {
+	return info.NFCSupported != 0
+}
+
+// DeviceInfo returns the device information by the Management application.
+// It requires firmware 5.0 or later.
+func (card *Card) DeviceInfo() (*DeviceInfo, error) {
+	if !card.isVersion(5, 0, 0) {
+		return nil, ErrNotSupported
+	}
+
+	// Read the device info pages
+	var list tlvs
+	err := card.withSession(aidManagement, func(s *session) error {
+		var err error
+		list, err = readDeviceInfo(s)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDeviceInfo(list)
+}
+
+// readDeviceInfo reads all the device info pages by the given Management session.
+// The firmware 5.6 or later returns the device info in pages.
+func readDeviceInfo(s *session) (tlvs, error) {
+	var list tlvs
+	for page := 0; page < deviceInfoMaxPages; page++ {
+		resp, err := s.send(apdu{ins: insReadConfig, p1: byte(page)})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read the device info: %s", err)
+		}
+		if len(resp) == 0 || int(resp[0]) != len(resp)-1 {
+			return nil, errors.New("invalid device info: invalid length")
+		}
+		pageList, err := parseTLVs(resp[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid device info: %s", err)
+		}
+		list = append(list, pageList...)
+		if v, ok := pageList.get(deviceTagMoreData); !ok || len(v) != 1 || v[0] != 0x01 {
+			break
+		}
+	}
+	return list, nil
+}
+
+// parseDeviceInfo parses the given device info data objects.
+func parseDeviceInfo(list tlvs) (*DeviceInfo, error) {
+	var info DeviceInfo
+	if v, ok := list.get(deviceTagVersion); ok && len(v) == 3 {
+		info.Version = fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+	} else {
+		return nil, errors.New("invalid device info: missing version")
+	}
+	if v, ok := list.get(deviceTagSerial); ok && len(v) == 4 {
+		info.Serial = fmt.Sprintf("%d", uint32(v[0])<<24|uint32(v[1])<<16|uint32(v[2])<<8|uint32(v[3]))
+	}
+	if v, ok := list.get(deviceTagFormFactor); ok && len(v) == 1 {
+		info.FormFactor, info.IsFIPS, info.IsSKY = parseFormFactor(v[0])
+	}
+	info.USBSupported = applicationsValue(list, deviceTagUSBSupported)
+	info.USBEnabled = applicationsValue(list, deviceTagUSBEnabled)
+	info.NFCSupported = applicationsValue(list, deviceTagNFCSupported)
+	info.NFCEnabled = applicationsValue(list, deviceTagNFCEnabled)
+	if v, ok := list.get(deviceTagAutoEject); ok && len(v) == 2 {
+		info.AutoEjectTimeout = time.Duration(int(v[0])<<8|int(v[1])) * time.Second
+	}
+	if v, ok := list.get(deviceTagChalRespTimeout); ok && len(v) == 1 {
+		info.ChallengeResponseTimeout = time.Duration(v[0]) * time.Second
+	}
+	if v, ok := list.get(deviceTagFlags); ok && len(v) == 1 {
+		info.RemoteWakeup = v[0]&deviceFlagRemoteWakeup != 0
+		info.TouchEject = v[0]&deviceFlagTouchEject != 0
+	}
+	if v, ok := list.get(deviceTagConfigLock); ok && len(v) == 1 {
+		info.ConfigLocked = v[0] == 0x01
+	}
+	if v, ok := list.get(deviceTagPINComplexity); ok && len(v) == 1 {
+		info.PINComplexity = v[0] == 0x01
+	}
+	if v, ok := list.get(deviceTagNFCRestricted); ok && len(v) == 1 {
+		info.NFCRestricted = v[0] == 0x01
+	}
+	return &info, nil
+}
+
+// applicationsValue returns the applications of the given device info tag.
+// The applications are encoded in one byte by the older firmware and in two bytes by the others.
+func applicationsValue(list tlvs, tag uint32) Applications {
+	v, _ := list.get(tag)
+	switch len(v) {
+	case 1:
+		return Applications(v[0])
+	case 2:
+		return Applications(uint16(v[0])<<8 | uint16(v[1]))
+	default:
+		return 0
+	}
+}
+
+// DeviceConfig represents the device configuration changes which are written by the Management application.
+// Nil values are kept as they are.
+type DeviceConfig struct {
+	// USBEnabled is the applications which are enabled over USB. The device reboots if it's changed.
+	USBEnabled *Applications
+	// NFCEnabled is the applications which are enabled over NFC.
+	NFCEnabled *Applications
+	// AutoEjectTimeout is the auto eject timeout of the CCID interface (up to 65535 seconds).
+	AutoEjectTimeout *time.Duration
+	// ChallengeResponseTimeout is the touch timeout of the OTP challenge-response (up to 255 seconds).
+	ChallengeResponseTimeout *time.Duration
+	// RemoteWakeup sets the remote wakeup flag.
+	RemoteWakeup *bool
+	// TouchEject sets the touch eject flag.
+	TouchEject *bool
+	// LockCode is the current configuration lock code. It's required if the configuration is locked.
+	LockCode []byte
+	// NewLockCode is the new configuration lock code (16 bytes). A lock code of zeros clears the lock.
+	NewLockCode []byte
+	// Reboot indicates whether the device reboots after the configuration is written or not.
+	Reboot bool
+}
+
+// WriteDeviceConfig writes the given device configuration by the Management application.
+// It requires firmware 5.0 or later.
+func (card *Card) WriteDeviceConfig(config DeviceConfig) error {
+	if !card.isVersion(5, 0, 0) {
+		return ErrNotSupported
+	}
+
+	// Connect to the smart card
+	return card.withSession(aidManagement, func(s *session) error {
+		// Read the current device flags if they're changed partially
+		var flags *byte
+		if config.RemoteWakeup != nil || config.TouchEject != nil {
+			list, err := readDeviceInfo(s)
+			if err != nil {
+				return err
+			}
+			var v byte
+			if b, ok := list.get(deviceTagFlags); ok && len(b) == 1 {
+				v = b[0]
+			}
+			v = setFlag(v, deviceFlagRemoteWakeup, config.RemoteWakeup)
+			v = setFlag(v, deviceFlagTouchEject, config.TouchEject)
+			flags = &v
+		}
+
+		// Write the configuration
+		data, err := config.marshal(flags)
+		if err != nil {
+			return err
+		}
+		if _, err := s.send(apdu{ins: insWriteConfig, data: data}); err != nil {
+			if isStatus(err, swSecurityStatus) {
+				// write config: smart card error 6982: security status not satisfied
+				return ErrConfigLocked
+			}
+			return fmt.Errorf("couldn't write the device configuration: %s", err)
+		}
+
+		return nil
+	})
+}
+
+// EnableApplications enables the given applications over USB and NFC by the given lock code (if any).
+// The device reboots if the USB applications are changed.
+func (card *Card) EnableApplications(usb, nfc Applications, lockCode []byte) error {
+	return card.updateApplications(func(enabled, apps Applications) Applications { return enabled | apps }, usb, nfc, lockCode)
+}
+
+// DisableApplications disables the given applications over USB and NFC by the given lock code (if any).
+// The device reboots if the USB applications are changed. Disabling PIV over USB makes the card unreachable for this package.
+func (card *Card) DisableApplications(usb, nfc Applications, lockCode []byte) error {
+	return card.updateApplications(func(enabled, apps Applications) Applications { return enabled &^ apps }, usb, nfc, lockCode)
+}
+
+// SetLockCode sets the configuration lock code by the given current lock code (if any).
+func (card *Card) SetLockCode(lockCode, newLockCode []byte) error {
+	if len(newLockCode) != lockCodeLen {
+		return fmt.Errorf("invalid lock code length: %d", len(newLockCode))
+	}
+	return card.WriteDeviceConfig(DeviceConfig{LockCode: lockCode, NewLockCode: newLockCode})
+}
+
+// ClearLockCode clears the configuration lock code by the given current lock code.
+func (card *Card) ClearLockCode(lockCode []byte) error {
+	return card.WriteDeviceConfig(DeviceConfig{LockCode: lockCode, NewLockCode: make([]byte, lockCodeLen)})
+}
+
+// updateApplications updates the enabled applications by the given update function.
+func (card *Card) updateApplications(update func(enabled, apps Applications) Applications, usb, nfc Applications, lockCode []byte) error {
+	info, err := card.DeviceInfo()
+	if err != nil {
+		return err
+	}
+	config := DeviceConfig{LockCode: lockCode}
+	if v := update(info.USBEnabled, usb) & info.USBSupported; usb != 0 && v != info.USBEnabled {
+		config.USBEnabled = &v
+		config.Reboot = true
+	}
+	if v := update(info.NFCEnabled, nfc) & info.NFCSupported; nfc != 0 && info.HasNFC() && v != info.NFCEnabled {
+		config.NFCEnabled = &v
+	}
+	if config.USBEnabled == nil && config.NFCEnabled == nil {
+		return nil
+	}
+	return card.WriteDeviceConfig(config)
+}
+
+// marshal returns the encoded device configuration by the given device flags.
+func (config *DeviceConfig) marshal(flags *byte) ([]byte, error) {
+	var b []byte
+	if config.USBEnabled != nil {
+		if *config.USBEnabled == 0 {
+			return nil, errors.New("invalid device configuration: at least one USB application must be enabled")
+		}
+		b = append(b, marshalTLV(deviceTagUSBEnabled, []byte{byte(*config.USBEnabled >> 8), byte(*config.USBEnabled)})...)
+	}
+	if config.NFCEnabled != nil {
+		b = append(b, marshalTLV(deviceTagNFCEnabled, []byte{byte(*config.NFCEnabled >> 8), byte(*config.NFCEnabled)})...)
+	}
+	if config.AutoEjectTimeout != nil {
+		v := int(*config.AutoEjectTimeout / time.Second)
+		if v < 0 || v > 0xffff {
+			return nil, fmt.Errorf("invalid auto eject timeout: %s", *config.AutoEjectTimeout)
+		}
+		b = append(b, marshalTLV(deviceTagAutoEject, []byte{byte(v >> 8), byte(v)})...)
+	}
+	if config.ChallengeResponseTimeout != nil {
+		v := int(*config.ChallengeResponseTimeout / time.Second)
+		if v < 0 || v > 0xff {
+			return nil, fmt.Errorf("invalid challenge-response timeout: %s", *config.ChallengeResponseTimeout)
+		}
+		b = append(b, marshalTLV(deviceTagChalRespTimeout, []byte{byte(v)})...)
+	}
+	if flags != nil {
+		b = append(b, marshalTLV(deviceTagFlags, []byte{*flags})...)
+	}
+	if config.Reboot {
+		b = append(b, marshalTLV(deviceTagReboot, nil)...)
+	}
+	if len(config.LockCode) > 0 {
+		if len(config.LockCode) != lockCodeLen {
+			return nil, fmt.Errorf("invalid lock code length: %d", len(config.LockCode))
+		}
+		b = append(b, marshalTLV(deviceTagUnlock, config.LockCode)...)
+	}
+	if len(config.NewLockCode) > 0 {
+		if len(config.NewLockCode) != lockCodeLen {
+			return nil, fmt.Errorf("invalid lock code length: %d", len(config.NewLockCode))
+		}
+		b = append(b, marshalTLV(deviceTagConfigLock, config.NewLockCode)...)
+	}
+	if len(b) > 0xff {
+		return nil, errors.New("invalid device configuration: too long")
+	}
+	return append([]byte{byte(len(b))}, b...), nil
+}
+
+// setFlag sets or clears the given flag by the given value. Nil value keeps the flag as it is.
+func setFlag(flags, flag byte, value *bool) byte {
+	if value == nil {
+		return flags
+	} else if *value {
+		return flags | flag
+	}
+	return flags &^ flag
+}
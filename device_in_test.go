@@ -0,0 +1,180 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeDeviceInfo returns the fake device info response by the given data objects.
+func fakeDeviceInfo(b []byte) []byte {
+	return append(append([]byte{byte(len(b))}, b...), 0x90, 0x00)
+}
+
+func TestCardDeviceInfo(t *testing.T) {
+	pages := [][]byte{
+		{
+			0x01, 0x02, 0x02, 0x3b, // USB supported
+			0x02, 0x04, 0x00, 0xbc, 0x61, 0x4e, // Serial
+			0x03, 0x02, 0x02, 0x3a, // USB enabled
+			0x04, 0x01, 0x81, // Form factor (FIPS)
+			0x05, 0x03, 0x05, 0x07, 0x01, // Version
+			0x06, 0x02, 0x00, 0x3c, // Auto eject timeout
+			0x07, 0x01, 0x0f, // Challenge-response timeout
+			0x08, 0x01, 0x80, // Device flags
+			0x0a, 0x01, 0x01, // Configuration lock
+			0x0d, 0x02, 0x02, 0x3b, // NFC supported
+			0x0e, 0x02, 0x00, 0x10, // NFC enabled
+			0x10, 0x01, 0x01, // More data
+		},
+		{
+			0x16, 0x01, 0x01, // PIN complexity
+		},
+	}
+	var read []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		if req[1] == insReadConfig {
+			read = append(read, req[2])
+			return fakeDeviceInfo(pages[req[2]])
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+
+	info, err := card.DeviceInfo()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(read) != 2 {
+		t.Errorf("got %x, want two pages", read)
+	}
+	want := DeviceInfo{
+		Serial:                   "12345678",
+		Version:                  "5.7.1",
+		FormFactor:               FormFactorUSBAKeychain,
+		IsFIPS:                   true,
+		USBSupported:             0x023b,
+		USBEnabled:               0x023a,
+		NFCSupported:             0x023b,
+		NFCEnabled:               ApplicationPIV,
+		AutoEjectTimeout:         60 * time.Second,
+		ChallengeResponseTimeout: 15 * time.Second,
+		TouchEject:               true,
+		ConfigLocked:             true,
+		PINComplexity:            true,
+	}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+	if !info.SerialVisible() || !info.HasNFC() || info.USBEnabled.Has(ApplicationOTP) {
+		t.Errorf("got %+v, want a visible serial, NFC and disabled OTP", info)
+	}
+
+	// Not supported
+	card = testCard(4, 3, 7)
+	if _, err := card.DeviceInfo(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestParseDeviceInfo(t *testing.T) {
+	// Hidden serial, one byte applications and no NFC
+	list, err := parseTLVs([]byte{0x01, 0x01, 0x3f, 0x03, 0x01, 0x3f, 0x04, 0x01, 0x04, 0x05, 0x03, 0x05, 0x02, 0x04})
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	info, err := parseDeviceInfo(list)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if info.SerialVisible() || info.HasNFC() || info.USBEnabled != 0x3f || info.FormFactor != FormFactorUSBCNano {
+		t.Errorf("got %+v, want a hidden serial, no NFC and USB-C Nano", info)
+	}
+
+	// Missing version
+	if _, err := parseDeviceInfo(nil); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
+
+func TestCardWriteDeviceConfig(t *testing.T) {
+	lockCode := bytes.Repeat([]byte{0x01}, 16)
+	info := []byte{
+		0x01, 0x02, 0x02, 0x3b, // USB supported
+		0x03, 0x02, 0x02, 0x3b, // USB enabled
+		0x05, 0x03, 0x05, 0x07, 0x01, // Version
+		0x08, 0x01, 0x80, // Device flags
+		0x0d, 0x02, 0x02, 0x3b, // NFC supported
+		0x0e, 0x02, 0x02, 0x3b, // NFC enabled
+	}
+	var written []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		switch req[1] {
+		case insReadConfig:
+			return fakeDeviceInfo(info)
+		case insWriteConfig:
+			written = req[5 : 5+int(req[4])]
+			if list, _ := parseTLVs(written[1:]); list != nil {
+				if v, _ := list.get(deviceTagUnlock); !bytes.Equal(v, lockCode) {
+					return []byte{0x69, 0x82}
+				}
+			}
+			return []byte{0x90, 0x00}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+
+	// Disable OTP and OpenPGP
+	if err := card.DisableApplications(ApplicationOTP|ApplicationOpenPGP, ApplicationOTP|ApplicationOpenPGP, lockCode); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := append([]byte{0x1c, 0x03, 0x02, 0x02, 0x32, 0x0e, 0x02, 0x02, 0x32, 0x0c, 0x00, 0x0b, 0x10}, lockCode...)
+	if !bytes.Equal(written, want) {
+		t.Errorf("got %x, want %x", written, want)
+	}
+
+	// Enable the already enabled applications
+	written = nil
+	if err := card.EnableApplications(ApplicationPIV, 0, lockCode); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if written != nil {
+		t.Errorf("got %x, want nil", written)
+	}
+
+	// Timeouts and flags
+	timeout, touchEject, remoteWakeup := 30*time.Second, false, true
+	if err := card.WriteDeviceConfig(DeviceConfig{AutoEjectTimeout: &timeout, ChallengeResponseTimeout: &timeout, TouchEject: &touchEject, RemoteWakeup: &remoteWakeup, LockCode: lockCode}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := []byte{0x06, 0x02, 0x00, 0x1e, 0x07, 0x01, 0x1e, 0x08, 0x01, 0x40}; !bytes.HasPrefix(written[1:], want) {
+		t.Errorf("got %x, want %x", written, want)
+	}
+
+	// Lock code
+	if err := card.ClearLockCode(lockCode); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if want := append(append([]byte{0x24, 0x0b, 0x10}, lockCode...), append([]byte{0x0a, 0x10}, make([]byte, 16)...)...); !bytes.Equal(written, want) {
+		t.Errorf("got %x, want %x", written, want)
+	}
+	if err := card.SetLockCode(nil, lockCode); !errors.Is(err, ErrConfigLocked) {
+		t.Errorf("got %v, want %v", err, ErrConfigLocked)
+	}
+	if err := card.SetLockCode(lockCode, lockCode[:8]); err == nil {
+		t.Error("got nil, want an error")
+	}
+
+	// Invalid configuration
+	var none Applications
+	if err := card.WriteDeviceConfig(DeviceConfig{USBEnabled: &none}); err == nil {
+		t.Error("got nil, want an error")
+	}
+	timeout = 300 * time.Second
+	if err := card.WriteDeviceConfig(DeviceConfig{ChallengeResponseTimeout: &timeout}); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
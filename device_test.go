@@ -0,0 +1,33 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardDeviceInfo(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		info, err := card.DeviceInfo()
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+			continue
+		}
+		if info.Version != card.Version() {
+			t.Errorf("got %v, want %v", info.Version, card.Version())
+		}
+		if info.SerialVisible() && info.Serial != card.Serial() {
+			t.Errorf("got %v, want %v", info.Serial, card.Serial())
+		}
+		if !info.USBEnabled.Has(yubikey.ApplicationPIV) {
+			t.Errorf("got %v, want PIV", info.USBEnabled)
+		}
+	}
+}
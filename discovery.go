@@ -0,0 +1,100 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// Discovery tags
+	// Ref: https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-73-4.pdf#page=43
+	tagDiscoveryAID       = 0x4f
+	tagDiscoveryPINPolicy = 0x5f2f
+
+	// PIN usage policy bits
+	discoveryPIVPIN           = 0x40
+	discoveryGlobalPIN        = 0x20
+	discoveryOCC              = 0x10
+	discoveryVCI              = 0x08
+	discoveryPIVPINPrimary    = 0x10
+	discoveryGlobalPINPrimary = 0x20
+)
+
+// aidPIVFull holds the full PIV application identifier (including the version).
+var aidPIVFull = []byte{0xa0, 0x00, 0x00, 0x03, 0x08, 0x00, 0x00, 0x10, 0x00, 0x01, 0x00}
+
+// Discovery represents the Discovery data object which holds the PIN usage policy.
+type Discovery struct {
+	// AID is the PIV application identifier.
+	AID []byte
+	// PIVPIN indicates whether the PIV application PIN satisfies the access control rules or not.
+	PIVPIN bool
+	// GlobalPIN indicates whether the global PIN satisfies the access control rules or not.
+	GlobalPIN bool
+	// OCC indicates whether the on-card biometric comparison satisfies the access control rules or not.
+	OCC bool
+	// VCI indicates whether the virtual contact interface is supported or not.
+	VCI bool
+	// GlobalPINPrimary indicates whether the global PIN is the primary PIN or not.
+	GlobalPINPrimary bool
+}
+
+// NewDiscovery returns a new Discovery which only allows the PIV application PIN.
+func NewDiscovery() *Discovery {
+	return &Discovery{AID: append([]byte(nil), aidPIVFull...), PIVPIN: true}
+}
+
+// ParseDiscovery parses the given Discovery data object content.
+func ParseDiscovery(b []byte) (*Discovery, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery object: %s", err)
+	}
+
+	var discovery Discovery
+	aid, ok := list.get(tagDiscoveryAID)
+	if !ok {
+		return nil, errors.New("invalid discovery object: missing AID")
+	}
+	discovery.AID = aid
+	policy, ok := list.get(tagDiscoveryPINPolicy)
+	if !ok || len(policy) != 2 {
+		return nil, errors.New("invalid discovery object: missing PIN usage policy")
+	}
+	discovery.PIVPIN = policy[0]&discoveryPIVPIN != 0
+	discovery.GlobalPIN = policy[0]&discoveryGlobalPIN != 0
+	discovery.OCC = policy[0]&discoveryOCC != 0
+	discovery.VCI = policy[0]&discoveryVCI != 0
+	discovery.GlobalPINPrimary = policy[1] == discoveryGlobalPINPrimary
+
+	return &discovery, nil
+}
+
+// Marshal returns the Discovery data object content.
+func (discovery *Discovery) Marshal() []byte {
+	policy := []byte{0x00, 0x00}
+	for _, v := range []struct {
+		set bool
+		bit byte
+	}{
+		{discovery.PIVPIN, discoveryPIVPIN},
+		{discovery.GlobalPIN, discoveryGlobalPIN},
+		{discovery.OCC, discoveryOCC},
+		{discovery.VCI, discoveryVCI},
+	} {
+		if v.set {
+			policy[0] |= v.bit
+		}
+	}
+	// The primary PIN is only meaningful when both PINs are allowed
+	if discovery.PIVPIN && discovery.GlobalPIN {
+		policy[1] = discoveryPIVPINPrimary
+		if discovery.GlobalPINPrimary {
+			policy[1] = discoveryGlobalPINPrimary
+		}
+	}
+	return append(marshalTLV(tagDiscoveryAID, discovery.AID), marshalTLV(tagDiscoveryPINPolicy, policy)...)
+}
@@ -0,0 +1,146 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSlotNotFound represents a slot not found error.
+var ErrSlotNotFound = errors.New("slot not found")
+
+// FingerprintSHA256 returns the SHA-256 digest of the PKIX (SubjectPublicKeyInfo) encoding of the slot public key.
+func (slot *Slot) FingerprintSHA256() ([]byte, error) {
+	der, err := slot.PublicKeyPKIX()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return sum[:], nil
+}
+
+// FingerprintSSH returns the OpenSSH SHA256 fingerprint (i.e. "SHA256:...") of the slot public key.
+func (slot *Slot) FingerprintSSH() (string, error) {
+	_, b, err := slot.sshPublicKey()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKThumbprint returns the base64url encoded SHA-256 JWK thumbprint of the slot public key.
+// Ref: https://www.rfc-editor.org/rfc/rfc7638
+func (slot *Slot) JWKThumbprint() (string, error) {
+	key, err := slot.jwk()
+	if err != nil {
+		return "", err
+	}
+
+	// Only the required members are used and they are ordered lexicographically (json.Marshal sorts the map keys).
+	members := map[string]string{"kty": key.Kty}
+	switch key.Kty {
+	case "EC":
+		members["crv"], members["x"], members["y"] = key.Crv, key.X, key.Y
+	case "OKP":
+		members["crv"], members["x"] = key.Crv, key.X
+	case "RSA":
+		members["e"], members["n"] = key.E, key.N
+	}
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("couldn't marshal the JWK: %s", err)
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// SubjectKeyID returns the X.509 subject key identifier of the slot public key
+// (SHA-1 digest of the subject public key bit string).
+// Ref: https://www.rfc-editor.org/rfc/rfc5280#section-4.2.1.2
+func (slot *Slot) SubjectKeyID() ([]byte, error) {
+	der, err := slot.PublicKeyPKIX()
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, fmt.Errorf("couldn't parse the public key (%s): %s", slot.key, err)
+	}
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:], nil
+}
+
+// matchFingerprint returns whether the slot public key matches the given fingerprint or not.
+// The fingerprint can be an OpenSSH fingerprint, a hex encoded SHA-256 fingerprint or subject key identifier
+// (colons are allowed) or a JWK thumbprint.
+func (slot *Slot) matchFingerprint(fingerprint string) bool {
+	if slot.cryptoKey == nil || fingerprint == "" {
+		return false
+	}
+
+	// OpenSSH fingerprint
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		fp, err := slot.FingerprintSSH()
+		return err == nil && fp == strings.TrimRight(fingerprint, "=")
+	}
+
+	// Hex encoded fingerprints
+	if b, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", "")); err == nil {
+		switch len(b) {
+		case sha256.Size:
+			fp, err := slot.FingerprintSHA256()
+			if err == nil && bytes.Equal(fp, b) {
+				return true
+			}
+		case sha1.Size:
+			ski, err := slot.SubjectKeyID()
+			if err == nil && bytes.Equal(ski, b) {
+				return true
+			}
+		}
+	}
+
+	// JWK thumbprint
+	fp, err := slot.JWKThumbprint()
+	return err == nil && fp == fingerprint
+}
+
+// FindSlotByFingerprint returns the slot whose public key matches the given fingerprint by searching all the connected cards.
+// The fingerprint can be an OpenSSH fingerprint (i.e. "SHA256:..."), a hex encoded SHA-256 fingerprint,
+// a hex encoded subject key identifier or a JWK thumbprint. It returns ErrSlotNotFound if there is no match.
+func FindSlotByFingerprint(fingerprint string) (*Slot, error) {
+	// Get the card list
+	cards, err := Cards()
+	if err != nil {
+		return nil, err
+	}
+
+	// Iterate over the card slots
+	for _, card := range cards {
+		slots, err := card.Slots()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get the card slots (%s): %s", card.Serial(), err)
+		}
+		for _, slot := range slots {
+			if slot.matchFingerprint(fingerprint) {
+				return slot, nil
+			}
+		}
+	}
+	return nil, ErrSlotNotFound
+}
@@ -0,0 +1,107 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlotJWKThumbprint(t *testing.T) {
+	// Ref: https://www.rfc-editor.org/rfc/rfc7638#section-3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	slot := &Slot{key: "9a"}
+	slot.setPublicKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	if fp, err := slot.JWKThumbprint(); err != nil || fp != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("got %v (%v), want %v", fp, err, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs")
+	}
+}
+
+func TestSlotFingerprints(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	slot := &Slot{key: "9a"}
+	slot.setPublicKey(&ecKey.PublicKey)
+
+	// SHA-256
+	der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	want := sha256.Sum256(der)
+	fp, err := slot.FingerprintSHA256()
+	if err != nil || !bytes.Equal(fp, want[:]) {
+		t.Errorf("got %x (%v), want %x", fp, err, want)
+	}
+
+	// OpenSSH
+	line, _ := slot.PublicKeySSH("")
+	blob, _ := base64.StdEncoding.DecodeString(strings.Fields(line)[1])
+	sum := sha256.Sum256(blob)
+	sshFP, err := slot.FingerprintSSH()
+	if wantSSH := "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]); err != nil || sshFP != wantSSH {
+		t.Errorf("got %v (%v), want %v", sshFP, err, wantSSH)
+	}
+
+	// Subject key identifier (Go generates it for the CA certificates)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &ecKey.PublicKey, ecKey)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	cert, _ := x509.ParseCertificate(certDER)
+	ski, err := slot.SubjectKeyID()
+	if err != nil || !bytes.Equal(ski, cert.SubjectKeyId) {
+		t.Errorf("got %x (%v), want %x", ski, err, cert.SubjectKeyId)
+	}
+
+	// Matching
+	jwkFP, _ := slot.JWKThumbprint()
+	colonFP := strings.ToUpper(hex.EncodeToString(fp[:1])) + ":" + hex.EncodeToString(fp[1:])
+	for _, v := range []string{hex.EncodeToString(fp), colonFP, sshFP, hex.EncodeToString(ski), jwkFP} {
+		if !slot.matchFingerprint(v) {
+			t.Errorf("got %v, want %v (%s)", false, true, v)
+		}
+	}
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	other := &Slot{key: "9c"}
+	other.setPublicKey(edKey)
+	for _, v := range []string{hex.EncodeToString(fp), sshFP, hex.EncodeToString(ski), jwkFP, ""} {
+		if other.matchFingerprint(v) {
+			t.Errorf("got %v, want %v (%s)", true, false, v)
+		}
+	}
+
+	// No key
+	empty := &Slot{key: "9d"}
+	if _, err := empty.FingerprintSHA256(); !errors.Is(err, ErrNoKey) {
+		t.Errorf("got %v, want %v", err, ErrNoKey)
+	}
+	if _, err := empty.JWKThumbprint(); !errors.Is(err, ErrNoKey) {
+		t.Errorf("got %v, want %v", err, ErrNoKey)
+	}
+	if empty.matchFingerprint(jwkFP) {
+		t.Errorf("got %v, want %v", true, false)
+	}
+}
@@ -0,0 +1,40 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestFindSlotByFingerprint(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		slots, err := card.Slots()
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		for _, slot := range slots {
+			if !slot.HasKey() || slot.CryptoPublicKey() == nil {
+				continue
+			}
+			fp, err := slot.FingerprintSHA256()
+			if err != nil {
+				t.Errorf("got %v, want nil", err)
+				continue
+			}
+			found, err := yubikey.FindSlotByFingerprint(hex.EncodeToString(fp))
+			if err != nil {
+				t.Errorf("got %v, want nil", err)
+			} else if found.Key() != slot.Key() {
+				t.Errorf("got %v, want %v", found.Key(), slot.Key())
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+const (
+	// FormFactorUnknown represents the unknown form factor.
+	FormFactorUnknown FormFactor = 0
+	// FormFactorUSBAKeychain represents the USB-A keychain form factor.
+	FormFactorUSBAKeychain FormFactor = 1
+	// FormFactorUSBANano represents the USB-A nano form factor.
+	FormFactorUSBANano FormFactor = 2
+	// FormFactorUSBCKeychain represents the USB-C keychain form factor.
+	FormFactorUSBCKeychain FormFactor = 3
+	// FormFactorUSBCNano represents the USB-C nano form factor.
+	FormFactorUSBCNano FormFactor = 4
+	// FormFactorUSBCLightning represents the USB-C and Lightning form factor.
+	FormFactorUSBCLightning FormFactor = 5
+	// FormFactorUSBABio represents the USB-A biometric keychain form factor.
+	FormFactorUSBABio FormFactor = 6
+	// FormFactorUSBCBio represents the USB-C biometric keychain form factor.
+	FormFactorUSBCBio FormFactor = 7
+
+	// formFactorMask holds the bits of the form factor byte which represent the form factor.
+	// The remaining bits are flags (i.e. FIPS and Security Key).
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-management/management-commands.html
+	// Ref: https://github.com/Yubico/yubikey-manager/blob/main/yubikit/management.py
+	formFactorMask = 0x0f
+	// formFactorFlagFIPS holds the form factor flag for FIPS series devices.
+	formFactorFlagFIPS = 0x80
+	// formFactorFlagSKY holds the form factor flag for Security Key series devices.
+	formFactorFlagSKY = 0x40
+)
+
+// FormFactor represents a YubiKey form factor.
+type FormFactor int
+
+// String returns the form factor name.
+func (formFactor FormFactor) String() string {
+	switch formFactor {
+	case FormFactorUSBAKeychain:
+		return "USB-A Keychain"
+	case FormFactorUSBANano:
+		return "USB-A Nano"
+	case FormFactorUSBCKeychain:
+		return "USB-C Keychain"
+	case FormFactorUSBCNano:
+		return "USB-C Nano"
+	case FormFactorUSBCLightning:
+		return "USB-C Lightning"
+	case FormFactorUSBABio:
+		return "USB-A Bio"
+	case FormFactorUSBCBio:
+		return "USB-C Bio"
+	default:
+		return ""
+	}
+}
+
+// parseFormFactor parses the given form factor byte and returns the form factor and its flags.
+func parseFormFactor(b byte) (formFactor FormFactor, isFIPS, isSKY bool) {
+	formFactor = FormFactor(b & formFactorMask)
+	if formFactor > FormFactorUSBCBio {
+		formFactor = FormFactorUnknown
+	}
+	return formFactor, b&formFactorFlagFIPS != 0, b&formFactorFlagSKY != 0
+}
@@ -0,0 +1,32 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"testing"
+)
+
+func TestParseFormFactor(t *testing.T) {
+	table := []struct {
+		b          byte
+		formFactor FormFactor
+		isFIPS     bool
+		isSKY      bool
+	}{
+		{0x00, FormFactorUnknown, false, false},
+		{0x01, FormFactorUSBAKeychain, false, false},
+		{0x04, FormFactorUSBCNano, false, false},
+		{0x83, FormFactorUSBCKeychain, true, false},
+		{0x05, FormFactorUSBCLightning, false, false},
+		{0x41, FormFactorUSBAKeychain, false, true},
+		{0x43, FormFactorUSBCKeychain, false, true},
+		{0x0f, FormFactorUnknown, false, false},
+	}
+	for _, v := range table {
+		formFactor, isFIPS, isSKY := parseFormFactor(v.b)
+		if formFactor != v.formFactor || isFIPS != v.isFIPS || isSKY != v.isSKY {
+			t.Errorf("got %v %v %v, want %v %v %v", formFactor, isFIPS, isSKY, v.formFactor, v.isFIPS, v.isSKY)
+		}
+	}
+}
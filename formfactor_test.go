@@ -0,0 +1,31 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestFormFactorString(t *testing.T) {
+	table := []struct {
+		formFactor yubikey.FormFactor
+		want       string
+	}{
+		{yubikey.FormFactorUnknown, ""},
+		{yubikey.FormFactorUSBAKeychain, "USB-A Keychain"},
+		{yubikey.FormFactorUSBANano, "USB-A Nano"},
+		{yubikey.FormFactorUSBCKeychain, "USB-C Keychain"},
+		{yubikey.FormFactorUSBCNano, "USB-C Nano"},
+		{yubikey.FormFactorUSBCLightning, "USB-C Lightning"},
+		{yubikey.FormFactorUSBABio, "USB-A Bio"},
+		{yubikey.FormFactorUSBCBio, "USB-C Bio"},
+	}
+	for _, v := range table {
+		if s := v.formFactor.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 module github.com/devfacet/yubikey
 
-go 1.19
+go 1.20
 
-require github.com/go-piv/piv-go v1.11.0
+require golang.org/x/term v0.29.0
+
+require golang.org/x/sys v0.30.0 // indirect
@@ -0,0 +1,224 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Key History tags
+	// Ref: https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-73-4.pdf#page=49
+	tagKeyHistoryOnCard  = 0xc1
+	tagKeyHistoryOffCard = 0xc2
+	tagKeyHistoryURL     = 0xf3
+
+	// Retired slot key references
+	retiredSlotFirst = 0x82
+	retiredSlotLast  = 0x95
+)
+
+// ErrNoRetiredSlot represents a no free retired slot error.
+var ErrNoRetiredSlot = errors.New("no free retired slot")
+
+// KeyHistory represents the Key History data object which holds the number of the retired keys.
+type KeyHistory struct {
+	// OnCardCerts is the number of the retired keys which have their certificates on the card.
+	OnCardCerts int
+	// OffCardCerts is the number of the retired keys which have their certificates off the card.
+	OffCardCerts int
+	// OffCardCertURL is the URL of the off card certificates.
+	OffCardCertURL string
+}
+
+// ParseKeyHistory parses the given Key History data object content.
+func ParseKeyHistory(b []byte) (*KeyHistory, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key history: %s", err)
+	}
+
+	var history KeyHistory
+	if v, ok := list.get(tagKeyHistoryOnCard); ok && len(v) == 1 {
+		history.OnCardCerts = int(v[0])
+	} else {
+		return nil, errors.New("invalid key history: missing on card certificates")
+	}
+	if v, ok := list.get(tagKeyHistoryOffCard); ok && len(v) == 1 {
+		history.OffCardCerts = int(v[0])
+	} else {
+		return nil, errors.New("invalid key history: missing off card certificates")
+	}
+	if v, ok := list.get(tagKeyHistoryURL); ok {
+		history.OffCardCertURL = string(v)
+	}
+
+	return &history, nil
+}
+
+// Marshal returns the Key History data object content.
+func (history *KeyHistory) Marshal() []byte {
+	b := marshalTLV(tagKeyHistoryOnCard, []byte{byte(history.OnCardCerts)})
+	b = append(b, marshalTLV(tagKeyHistoryOffCard, []byte{byte(history.OffCardCerts)})...)
+	if history.OffCardCertURL != "" {
+		b = append(b, marshalTLV(tagKeyHistoryURL, []byte(history.OffCardCertURL))...)
+	}
+	return append(b, marshalTLV(tagErrorDetection, nil)...)
+}
+
+// KeyHistory returns the Key History of the card.
+// It returns an empty Key History if the card doesn't have one.
+func (card *Card) KeyHistory() (*KeyHistory, error) {
+	var history *KeyHistory
+	err := card.withSession(aidPIV, func(s *session) error {
+		var err error
+		history, err = readKeyHistory(s)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// SetKeyHistory writes the given Key History into the card by the card management key.
+// The Key History is updated automatically when the retired slot keys change so it's only needed
+// for setting the off card certificate URL or the keys which aren't managed by this package.
+// The off card certificate URL is required if there are off card certificates (SP 800-73-4).
+func (card *Card) SetKeyHistory(history *KeyHistory) error {
+	if history == nil || history.OnCardCerts < 0 || history.OffCardCerts < 0 || history.OnCardCerts+history.OffCardCerts > retiredSlotLast-retiredSlotFirst+1 {
+		return errors.New("invalid key history")
+	} else if history.OffCardCerts > 0 && history.OffCardCertURL == "" {
+		return errors.New("invalid key history: missing off card certificate URL")
+	}
+
+	// Connect to the smart card
+	return card.withSession(aidPIV, func(s *session) error {
+		// Write the key history
+		if err := card.authenticate(s, nil); err != nil {
+			return err
+		}
+		if err := putData(s, ObjectKeyHistory, history.Marshal()); err != nil {
+			return fmt.Errorf("couldn't write the key history: %s", managementKeyError(err))
+		}
+
+		return nil
+	})
+}
+
+// NextRetiredSlot returns the first retired slot (82-95) which has no key.
+// It returns ErrNoRetiredSlot if all the retired slots have keys.
+// It requires firmware 5.3 or later since the keys without certificates can't be detected on the prior cards.
+func (card *Card) NextRetiredSlot() (*Slot, error) {
+	if !card.isVersion(5, 3, 0) {
+		return nil, ErrNotSupported
+	}
+
+	// Find the first free retired slot
+	var slot *Slot
+	err := card.withSession(aidPIV, func(s *session) error {
+		for _, slotKey := range retiredSlotKeys() {
+			hasKey, _, err := card.retiredSlotState(s, slotKey)
+			if err != nil {
+				return err
+			} else if !hasKey {
+				slot = &Slot{key: slotKey, card: card, slot: slotMap[slotKey]}
+				return nil
+			}
+		}
+		return ErrNoRetiredSlot
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slot, nil
+}
+
+// readKeyHistory reads the Key History by the given session.
+func readKeyHistory(s *session) (*KeyHistory, error) {
+	data, err := getData(s, ObjectKeyHistory)
+	if err != nil {
+		if isStatus(err, swNotFound) {
+			return &KeyHistory{}, nil
+		}
+		return nil, fmt.Errorf("couldn't read the key history: %s", err)
+	}
+	return ParseKeyHistory(data)
+}
+
+// updateKeyHistory updates the Key History by the retired slot keys and certificates.
+// The session must be authenticated by the management key.
+func (card *Card) updateKeyHistory(s *session) error {
+	// The keys without certificates can't be counted prior to firmware 5.3 so the Key History is kept as it is
+	if !card.isVersion(5, 3, 0) {
+		return nil
+	}
+	history, err := readKeyHistory(s)
+	if err != nil {
+		return err
+	}
+
+	// Count the retired slot keys
+	updated := KeyHistory{OffCardCertURL: history.OffCardCertURL}
+	for _, slotKey := range retiredSlotKeys() {
+		hasKey, hasCert, err := card.retiredSlotState(s, slotKey)
+		if err != nil {
+			return err
+		}
+		if hasCert {
+			updated.OnCardCerts++
+		} else if hasKey {
+			updated.OffCardCerts++
+		}
+	}
+	if updated == *history {
+		return nil
+	}
+	if err := putData(s, ObjectKeyHistory, updated.Marshal()); err != nil {
+		return fmt.Errorf("couldn't write the key history: %s", err)
+	}
+
+	return nil
+}
+
+// retiredSlotState returns whether the given retired slot has a key and a certificate or not.
+// It requires firmware 5.3 or later since the keys are detected by the metadata.
+func (card *Card) retiredSlotState(s *session, slotKey string) (hasKey, hasCert bool, err error) {
+	if !card.isVersion(5, 3, 0) {
+		return false, false, ErrNotSupported
+	}
+	smv := slotMap[slotKey]
+	if _, err := getData(s, smv.Object); err == nil {
+		hasCert = true
+	} else if !isStatus(err, swNotFound) {
+		return false, false, fmt.Errorf("couldn't get the slot certificate (%s): %s", slotKey, err)
+	}
+	if _, err := card.keyMetadata(s, byte(smv.Key)); err == nil {
+		hasKey = true
+	} else if !errors.Is(err, ErrNoKey) {
+		return false, false, fmt.Errorf("couldn't get the slot metadata (%s): %s", slotKey, err)
+	}
+	return hasKey, hasCert, nil
+}
+
+// retiredSlotKeys returns the retired slot keys in order.
+func retiredSlotKeys() []string {
+	var slotKeys []string
+	for k, v := range slotMap {
+		if isRetiredSlot(v.Key) {
+			slotKeys = append(slotKeys, k)
+		}
+	}
+	sort.Strings(slotKeys)
+	return slotKeys
+}
+
+// isRetiredSlot returns whether the given slot key reference is a retired slot or not.
+func isRetiredSlot(key uint32) bool {
+	return key >= retiredSlotFirst && key <= retiredSlotLast
+}
@@ -0,0 +1,94 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRetiredSlotKeys(t *testing.T) {
+	slotKeys := retiredSlotKeys()
+	if len(slotKeys) != 20 || slotKeys[0] != "82" || slotKeys[19] != "95" {
+		t.Errorf("got %v, want 82-95", slotKeys)
+	}
+	for _, v := range []uint32{0x9a, 0x81, 0x96} {
+		if isRetiredSlot(v) {
+			t.Errorf("got true, want false for %x", v)
+		}
+	}
+}
+
+func TestCardNextRetiredSlot(t *testing.T) {
+	keys := map[byte]bool{0x82: true, 0x83: true, 0x85: true}
+	objects := fakeObjects{0x5fc10d: {0x70, 0x00}}
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := objects.handle(req); resp != nil {
+			return resp
+		}
+		if req[1] == insGetMetadata {
+			if !keys[req[3]] {
+				return []byte{0x6a, 0x82}
+			}
+			return append(marshalTLV(metadataTagAlgorithm, []byte{AlgorithmEC256.code()}), 0x90, 0x00)
+		}
+		return []byte{0x6d, 0x00}
+	})
+
+	// Metadata
+	card := testCard(5, 7, 1)
+	slot, err := card.NextRetiredSlot()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if slot.Key() != "84" || slot.HasKey() {
+		t.Errorf("got %v, want 84", slot.Key())
+	}
+
+	// Full
+	for _, slotKey := range retiredSlotKeys() {
+		keys[byte(slotMap[slotKey].Key)] = true
+	}
+	if _, err := card.NextRetiredSlot(); !errors.Is(err, ErrNoRetiredSlot) {
+		t.Errorf("got %v, want %v", err, ErrNoRetiredSlot)
+	}
+
+	// The keys without certificates can't be detected prior to firmware 5.3
+	card = testCard(5, 2, 7)
+	if _, err := card.NextRetiredSlot(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestCardUpdateKeyHistory(t *testing.T) {
+	keys := map[byte]bool{0x82: true, 0x83: true, 0x84: true}
+	history := (&KeyHistory{OnCardCerts: 3, OffCardCertURL: "https://example.com"}).Marshal()
+	objects := fakeObjects{0x5fc10d: {0x70, 0x00}, ObjectKeyHistory: history}
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := objects.handle(req); resp != nil {
+			return resp
+		}
+		if req[1] == insGetMetadata {
+			if !keys[req[3]] {
+				return []byte{0x6a, 0x82}
+			}
+			return append(marshalTLV(metadataTagAlgorithm, []byte{AlgorithmEC256.code()}), 0x90, 0x00)
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+	s, err := openSession(card.name, aidPIV)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	defer s.Close()
+
+	if err := card.updateKeyHistory(s); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := (&KeyHistory{OnCardCerts: 1, OffCardCerts: 2, OffCardCertURL: "https://example.com"}).Marshal()
+	if v := objects[ObjectKeyHistory]; !bytes.Equal(v, want) {
+		t.Errorf("got %x, want %x", v, want)
+	}
+}
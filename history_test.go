@@ -0,0 +1,51 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardKeyHistory(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		if _, err := card.KeyHistory(); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+}
+
+func TestKeyHistory(t *testing.T) {
+	history := yubikey.KeyHistory{OnCardCerts: 2, OffCardCerts: 1, OffCardCertURL: "https://example.com/certs"}
+	parsed, err := yubikey.ParseKeyHistory(history.Marshal())
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if *parsed != history {
+		t.Errorf("got %+v, want %+v", parsed, history)
+	}
+	if _, err := yubikey.ParseKeyHistory([]byte{0xc1, 0x01, 0x00}); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
+
+func TestCardSetKeyHistoryInvalid(t *testing.T) {
+	// The history is validated before the card is connected
+	card := &yubikey.Card{}
+	for _, history := range []*yubikey.KeyHistory{
+		nil,
+		{OnCardCerts: -1},
+		{OnCardCerts: 20, OffCardCerts: 1, OffCardCertURL: "https://example.com/certs"},
+		{OffCardCerts: 1},
+	} {
+		if err := card.SetKeyHistory(history); err == nil {
+			t.Errorf("got nil, want an error (%+v)", history)
+		}
+	}
+}
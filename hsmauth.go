@@ -0,0 +1,394 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	// YubiHSM Auth instructions
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-yubihsm-auth/commands.html
+	insHSMAuthPut                  = 0x01
+	insHSMAuthDelete               = 0x02
+	insHSMAuthCalculate            = 0x03
+	insHSMAuthList                 = 0x05
+	insHSMAuthPutManagementKey     = 0x08
+	insHSMAuthManagementKeyRetries = 0x09
+	insHSMAuthGetPublicKey         = 0x0a
+
+	// YubiHSM Auth tags
+	tagHSMAuthLabel              = 0x71
+	tagHSMAuthLabelList          = 0x72
+	tagHSMAuthCredentialPassword = 0x73
+	tagHSMAuthAlgorithm          = 0x74
+	tagHSMAuthKeyEnc             = 0x75
+	tagHSMAuthKeyMAC             = 0x76
+	tagHSMAuthContext            = 0x77
+	tagHSMAuthTouch              = 0x7a
+	tagHSMAuthManagementKey      = 0x7b
+	tagHSMAuthPrivateKey         = 0x7d
+
+	// YubiHSM Auth lengths
+	hsmAuthKeyLen                   = 16
+	hsmAuthChallengeLen             = 8
+	hsmAuthLabelMaxLen              = 64
+	hsmAuthCredentialPasswordMaxLen = 16
+
+	// YubiHSM Auth symmetric key derivation (PBKDF2 with HMAC-SHA256)
+	hsmAuthDerivationIterations = 10000
+	hsmAuthDerivationSalt       = "Yubico"
+)
+
+const (
+	// HSMAuthAlgorithmUnknown represents the unknown YubiHSM Auth credential algorithm.
+	HSMAuthAlgorithmUnknown HSMAuthAlgorithm = 0
+	// HSMAuthAlgorithmAES128 represents the symmetric (AES-128) YubiHSM Auth credential algorithm.
+	HSMAuthAlgorithmAES128 HSMAuthAlgorithm = 38
+	// HSMAuthAlgorithmECP256 represents the asymmetric (EC P-256) YubiHSM Auth credential algorithm.
+	HSMAuthAlgorithmECP256 HSMAuthAlgorithm = 39
+)
+
+var (
+	// HSMAuthDefaultManagementKey holds the default YubiHSM Auth management key.
+	HSMAuthDefaultManagementKey = make([]byte, hsmAuthKeyLen)
+
+	// aidHSMAuth holds the YubiHSM Auth application identifier.
+	aidHSMAuth = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x07, 0x01}
+)
+
+// HSMAuthAlgorithm represents a YubiHSM Auth credential algorithm.
+type HSMAuthAlgorithm int
+
+// String returns the algorithm name.
+func (alg HSMAuthAlgorithm) String() string {
+	switch alg {
+	case HSMAuthAlgorithmAES128:
+		return "AES128"
+	case HSMAuthAlgorithmECP256:
+		return "ECP256"
+	default:
+		return ""
+	}
+}
+
+// HSMAuthCredential represents a YubiHSM Auth credential.
+type HSMAuthCredential struct {
+	// Label is the credential label.
+	Label string
+	// Algorithm is the credential algorithm.
+	Algorithm HSMAuthAlgorithm
+	// RequireTouch indicates whether the session key calculation requires touch or not.
+	RequireTouch bool
+	// Retries is the remaining credential password retries.
+	Retries int
+}
+
+// HSMAuthCredentialOpts represents the options of a YubiHSM Auth credential.
+// A symmetric credential needs either the keys or the derivation password and
+// an asymmetric credential needs the private key.
+type HSMAuthCredentialOpts struct {
+	// Label is the credential label (1 to 64 bytes).
+	Label string
+	// Password is the credential password (up to 16 bytes) which is required by the session key calculation.
+	Password *Secret
+	// RequireTouch indicates whether the session key calculation requires touch or not.
+	RequireTouch bool
+	// EncKey is the encryption key of a symmetric credential (16 bytes).
+	EncKey []byte
+	// MACKey is the MAC key of a symmetric credential (16 bytes).
+	MACKey []byte
+	// DerivationPassword is the password which the symmetric keys are derived from (i.e. the YubiHSM 2 authentication key password).
+	DerivationPassword string
+	// PrivateKey is the private key of an asymmetric credential (firmware 5.6+).
+	PrivateKey *ecdsa.PrivateKey
+}
+
+// HSMAuthSessionKeys represents the SCP03 session keys which are calculated by a YubiHSM Auth credential.
+type HSMAuthSessionKeys struct {
+	// Enc is the session encryption key (S-ENC).
+	Enc *Secret
+	// MAC is the session MAC key (S-MAC).
+	MAC *Secret
+	// RMAC is the session response MAC key (S-RMAC).
+	RMAC *Secret
+}
+
+// Zero zeroizes the session keys.
+func (keys *HSMAuthSessionKeys) Zero() {
+	keys.Enc.Zero()
+	keys.MAC.Zero()
+	keys.RMAC.Zero()
+}
+
+// HSMAuth represents the YubiHSM Auth application of a YubiKey smart card (firmware 5.4.3+).
+type HSMAuth struct {
+	card   *Card
+	manKey *Secret
+}
+
+// HSMAuth returns the YubiHSM Auth application of the card. The default management key is used until it's set.
+func (card *Card) HSMAuth() *HSMAuth {
+	return &HSMAuth{card: card, manKey: NewSecret(HSMAuthDefaultManagementKey)}
+}
+
+// SetManKey sets the management key which is used for the credential management.
+func (hsm *HSMAuth) SetManKey(key []byte) error {
+	if len(key) != hsmAuthKeyLen {
+		return fmt.Errorf("invalid management key length: must be %d bytes", hsmAuthKeyLen)
+	}
+	hsm.setManKey(NewSecret(key))
+	return nil
+}
+
+// setManKey sets the management key and zeroizes the previous one.
+func (hsm *HSMAuth) setManKey(key *Secret) {
+	hsm.manKey.Zero()
+	hsm.manKey = key
+}
+
+// List returns the YubiHSM Auth credentials.
+func (hsm *HSMAuth) List() ([]*HSMAuthCredential, error) {
+	var creds []*HSMAuthCredential
+	err := hsm.do(func(s *session) error {
+		resp, err := s.send(apdu{ins: insHSMAuthList})
+		if err != nil {
+			return fmt.Errorf("couldn't list the YubiHSM Auth credentials: %s", err)
+		}
+		list, err := parseTLVs(resp)
+		if err != nil {
+			return fmt.Errorf("invalid YubiHSM Auth credential list: %s", err)
+		}
+		for _, v := range list {
+			// algorithm (1) | touch (1) | label | retries (1)
+			if v.tag != tagHSMAuthLabelList || len(v.value) < 3 {
+				continue
+			}
+			creds = append(creds, &HSMAuthCredential{
+				Label:        string(v.value[2 : len(v.value)-1]),
+				Algorithm:    HSMAuthAlgorithm(v.value[0]),
+				RequireTouch: v.value[1] != 0x00,
+				Retries:      int(v.value[len(v.value)-1]),
+			})
+		}
+		return nil
+	})
+	return creds, err
+}
+
+// Add adds a credential by the management key.
+func (hsm *HSMAuth) Add(opts HSMAuthCredentialOpts) error {
+	if err := validateHSMAuthLabel(opts.Label); err != nil {
+		return err
+	} else if err := validateHSMAuthCredentialPassword(opts.Password); err != nil {
+		return err
+	}
+	alg := HSMAuthAlgorithmAES128
+	switch {
+	case opts.PrivateKey != nil:
+		if opts.PrivateKey.Curve != elliptic.P256() {
+			return errors.New("invalid private key: must be a P-256 key")
+		} else if !hsm.card.isVersion(5, 6, 0) {
+			return ErrNotSupported
+		}
+		alg = HSMAuthAlgorithmECP256
+	case opts.DerivationPassword != "":
+	case len(opts.EncKey) == hsmAuthKeyLen && len(opts.MACKey) == hsmAuthKeyLen:
+	default:
+		return fmt.Errorf("invalid credential keys: must be a private key, a derivation password or %d bytes keys", hsmAuthKeyLen)
+	}
+	touch := byte(0x00)
+	if opts.RequireTouch {
+		touch = 0x01
+	}
+
+	return hsm.do(func(s *session) error {
+		tlvs := [][]byte{
+			s.keep(marshalTLV(tagHSMAuthManagementKey, hsm.manKey.Bytes())),
+			marshalTLV(tagHSMAuthLabel, []byte(opts.Label)),
+			marshalTLV(tagHSMAuthAlgorithm, []byte{byte(alg)}),
+		}
+		switch {
+		case opts.PrivateKey != nil:
+			tlvs = append(tlvs, s.keep(marshalTLV(tagHSMAuthPrivateKey, s.keep(opts.PrivateKey.D.FillBytes(make([]byte, 32))))))
+		case opts.DerivationPassword != "":
+			key := s.keep(pbkdf2Key(sha256.New, []byte(opts.DerivationPassword), []byte(hsmAuthDerivationSalt), hsmAuthDerivationIterations, hsmAuthKeyLen*2))
+			tlvs = append(tlvs, s.keep(marshalTLV(tagHSMAuthKeyEnc, key[:hsmAuthKeyLen])), s.keep(marshalTLV(tagHSMAuthKeyMAC, key[hsmAuthKeyLen:])))
+		default:
+			tlvs = append(tlvs, s.keep(marshalTLV(tagHSMAuthKeyEnc, opts.EncKey)), s.keep(marshalTLV(tagHSMAuthKeyMAC, opts.MACKey)))
+		}
+		tlvs = append(tlvs,
+			s.keep(marshalTLV(tagHSMAuthCredentialPassword, s.keep(hsmAuthCredentialPassword(opts.Password)))),
+			marshalTLV(tagHSMAuthTouch, []byte{touch}),
+		)
+		if _, err := s.send(apdu{ins: insHSMAuthPut, data: s.keep(bytes.Join(tlvs, nil))}); err != nil {
+			return hsmAuthError(err)
+		}
+		return nil
+	})
+}
+
+// Delete deletes the given credential by the management key.
+func (hsm *HSMAuth) Delete(label string) error {
+	if err := validateHSMAuthLabel(label); err != nil {
+		return err
+	}
+	return hsm.do(func(s *session) error {
+		data := s.keep(append(s.keep(marshalTLV(tagHSMAuthManagementKey, hsm.manKey.Bytes())), marshalTLV(tagHSMAuthLabel, []byte(label))...))
+		if _, err := s.send(apdu{ins: insHSMAuthDelete, data: data}); err != nil {
+			if isStatus(err, swNotFound) {
+				return fmt.Errorf("couldn't delete the YubiHSM Auth credential: %q not found", label)
+			}
+			return hsmAuthError(err)
+		}
+		return nil
+	})
+}
+
+// ChangeManagementKey changes the management key. The stored key is updated (and the previous one is zeroized)
+// after the key is changed.
+func (hsm *HSMAuth) ChangeManagementKey(newKey []byte) error {
+	if len(newKey) != hsmAuthKeyLen {
+		return fmt.Errorf("invalid management key length: must be %d bytes", hsmAuthKeyLen)
+	}
+	return hsm.do(func(s *session) error {
+		data := s.keep(append(s.keep(marshalTLV(tagHSMAuthManagementKey, hsm.manKey.Bytes())), s.keep(marshalTLV(tagHSMAuthManagementKey, newKey))...))
+		if _, err := s.send(apdu{ins: insHSMAuthPutManagementKey, data: data}); err != nil {
+			return hsmAuthError(err)
+		}
+		hsm.setManKey(NewSecret(newKey))
+		return nil
+	})
+}
+
+// ManagementKeyRetries returns the remaining management key retries.
+func (hsm *HSMAuth) ManagementKeyRetries() (int, error) {
+	var retries int
+	err := hsm.do(func(s *session) error {
+		resp, err := s.send(apdu{ins: insHSMAuthManagementKeyRetries})
+		if err != nil {
+			return fmt.Errorf("couldn't get the management key retries: %s", err)
+		}
+		for _, v := range resp {
+			retries = retries<<8 | int(v)
+		}
+		return nil
+	})
+	return retries, err
+}
+
+// PublicKey returns the public key of the given asymmetric credential.
+func (hsm *HSMAuth) PublicKey(label string) (*ecdsa.PublicKey, error) {
+	if err := validateHSMAuthLabel(label); err != nil {
+		return nil, err
+	}
+	var pub *ecdsa.PublicKey
+	err := hsm.do(func(s *session) error {
+		resp, err := s.send(apdu{ins: insHSMAuthGetPublicKey, data: marshalTLV(tagHSMAuthLabel, []byte(label))})
+		if err != nil {
+			return fmt.Errorf("couldn't get the public key: %s", err)
+		}
+		x, y := elliptic.Unmarshal(elliptic.P256(), resp)
+		if x == nil {
+			return errors.New("invalid public key point")
+		}
+		pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		return nil
+	})
+	return pub, err
+}
+
+// SessionKeys calculates the SCP03 session keys of the given symmetric credential by the given host and card
+// challenges (8 bytes each). The request waits for touch if the credential requires touch
+// without calling the card touch functions (they cover the PIV slots only).
+// The string can't be zeroized so SessionKeysSecret should be preferred.
+func (hsm *HSMAuth) SessionKeys(label, password string, hostChallenge, cardChallenge []byte) (*HSMAuthSessionKeys, error) {
+	secret := NewSecretString(password)
+	defer secret.Zero()
+	return hsm.SessionKeysSecret(label, secret, hostChallenge, cardChallenge)
+}
+
+// SessionKeysSecret calculates the SCP03 session keys like SessionKeys by the given credential password.
+// The session keys should be zeroized when they're no longer needed.
+func (hsm *HSMAuth) SessionKeysSecret(label string, password *Secret, hostChallenge, cardChallenge []byte) (*HSMAuthSessionKeys, error) {
+	if err := validateHSMAuthLabel(label); err != nil {
+		return nil, err
+	} else if len(hostChallenge) != hsmAuthChallengeLen || len(cardChallenge) != hsmAuthChallengeLen {
+		return nil, fmt.Errorf("invalid challenge length: must be %d bytes", hsmAuthChallengeLen)
+	} else if err := validateHSMAuthCredentialPassword(password); err != nil {
+		return nil, err
+	}
+
+	var keys *HSMAuthSessionKeys
+	err := hsm.do(func(s *session) error {
+		data := bytes.Join([][]byte{
+			marshalTLV(tagHSMAuthLabel, []byte(label)),
+			marshalTLV(tagHSMAuthContext, append(append([]byte(nil), hostChallenge...), cardChallenge...)),
+			s.keep(marshalTLV(tagHSMAuthCredentialPassword, s.keep(hsmAuthCredentialPassword(password)))),
+		}, nil)
+		resp, err := s.send(apdu{ins: insHSMAuthCalculate, data: s.keep(data)})
+		if err != nil {
+			return hsmAuthError(err)
+		}
+		s.keep(resp)
+		if len(resp) < hsmAuthKeyLen*3 {
+			return fmt.Errorf("invalid session keys length: %d", len(resp))
+		}
+		keys = &HSMAuthSessionKeys{
+			Enc:  NewSecret(resp[:hsmAuthKeyLen]),
+			MAC:  NewSecret(resp[hsmAuthKeyLen : hsmAuthKeyLen*2]),
+			RMAC: NewSecret(resp[hsmAuthKeyLen*2 : hsmAuthKeyLen*3]),
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// hsmAuthError returns the error by the given YubiHSM Auth error.
+// The wrong management keys and credential passwords return 63Cx with the remaining retries.
+func hsmAuthError(err error) error {
+	var apduErr *apduError
+	if errors.As(err, &apduErr) {
+		if retries, ok := apduErr.retries(); ok {
+			return fmt.Errorf("%w (%d retries remaining)", ErrAuthError, retries)
+		}
+	}
+	return err
+}
+
+// do opens a YubiHSM Auth session and calls the given function.
+func (hsm *HSMAuth) do(f func(s *session) error) error {
+	if !hsm.card.isVersion(5, 4, 3) {
+		return ErrNotSupported
+	}
+	return hsm.card.withSession(aidHSMAuth, f)
+}
+
+// validateHSMAuthLabel validates the given credential label.
+func validateHSMAuthLabel(label string) error {
+	if l := len(label); l < 1 || l > hsmAuthLabelMaxLen {
+		return fmt.Errorf("invalid label length: must be 1 to %d bytes", hsmAuthLabelMaxLen)
+	}
+	return nil
+}
+
+// validateHSMAuthCredentialPassword validates the given credential password.
+func validateHSMAuthCredentialPassword(password *Secret) error {
+	if password.Len() > hsmAuthCredentialPasswordMaxLen {
+		return fmt.Errorf("invalid credential password length: must be up to %d bytes", hsmAuthCredentialPasswordMaxLen)
+	}
+	return nil
+}
+
+// hsmAuthCredentialPassword returns the credential password which is padded with zeros.
+func hsmAuthCredentialPassword(password *Secret) []byte {
+	b := make([]byte, hsmAuthCredentialPasswordMaxLen)
+	copy(b, password.Bytes())
+	return b
+}
@@ -0,0 +1,299 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeHSMAuthCredential represents a fake YubiHSM Auth credential.
+type fakeHSMAuthCredential struct {
+	alg      byte
+	touch    bool
+	enc      []byte
+	mac      []byte
+	private  []byte
+	password []byte
+	retries  int
+}
+
+// fakeHSMAuth represents a fake YubiHSM Auth application which replies the YubiHSM Auth requests.
+type fakeHSMAuth struct {
+	manKey  []byte
+	retries int
+	creds   map[string]*fakeHSMAuthCredential
+	order   []string
+	context []byte
+}
+
+// useFakeHSMAuth replaces the smart card transport with a fake YubiHSM Auth application during the test.
+func useFakeHSMAuth(t *testing.T) *fakeHSMAuth {
+	t.Helper()
+	fh := &fakeHSMAuth{manKey: make([]byte, hsmAuthKeyLen), retries: 8, creds: map[string]*fakeHSMAuthCredential{}}
+	useFakeTransport(t, func(req []byte) []byte {
+		return fh.handle(t, req)
+	})
+	return fh
+}
+
+// authenticate verifies the management key of the given request.
+func (fh *fakeHSMAuth) authenticate(key []byte) []byte {
+	if !bytes.Equal(key, fh.manKey) {
+		fh.retries--
+		return []byte{0x63, 0xc0 | byte(fh.retries)}
+	}
+	return nil
+}
+
+// handle handles the given YubiHSM Auth request.
+func (fh *fakeHSMAuth) handle(t *testing.T, req []byte) []byte {
+	t.Helper()
+	var list tlvs
+	if len(req) > 5 {
+		var err error
+		if list, err = parseTLVs(req[5 : 5+int(req[4])]); err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+	}
+	label, _ := list.get(tagHSMAuthLabel)
+	switch req[1] {
+	case insHSMAuthList:
+		var resp []byte
+		for _, v := range fh.order {
+			cred := fh.creds[v]
+			touch := byte(0x00)
+			if cred.touch {
+				touch = 0x01
+			}
+			entry := append(append([]byte{cred.alg, touch}, v...), byte(cred.retries))
+			resp = append(resp, marshalTLV(tagHSMAuthLabelList, entry)...)
+		}
+		return append(resp, 0x90, 0x00)
+	case insHSMAuthPut:
+		if resp := fh.authenticate(list[0].value); resp != nil {
+			return resp
+		}
+		cred := &fakeHSMAuthCredential{retries: 8}
+		alg, _ := list.get(tagHSMAuthAlgorithm)
+		cred.alg = alg[0]
+		cred.enc, _ = list.get(tagHSMAuthKeyEnc)
+		cred.mac, _ = list.get(tagHSMAuthKeyMAC)
+		cred.private, _ = list.get(tagHSMAuthPrivateKey)
+		cred.password, _ = list.get(tagHSMAuthCredentialPassword)
+		touch, _ := list.get(tagHSMAuthTouch)
+		cred.touch = touch[0] == 0x01
+		fh.creds[string(label)] = cred
+		fh.order = append(fh.order, string(label))
+		return []byte{0x90, 0x00}
+	case insHSMAuthDelete:
+		if resp := fh.authenticate(list[0].value); resp != nil {
+			return resp
+		} else if _, ok := fh.creds[string(label)]; !ok {
+			return []byte{0x6a, 0x82}
+		}
+		delete(fh.creds, string(label))
+		return []byte{0x90, 0x00}
+	case insHSMAuthPutManagementKey:
+		if resp := fh.authenticate(list[0].value); resp != nil {
+			return resp
+		}
+		fh.manKey = list[1].value
+		return []byte{0x90, 0x00}
+	case insHSMAuthManagementKeyRetries:
+		return []byte{0x00, byte(fh.retries), 0x90, 0x00}
+	case insHSMAuthGetPublicKey:
+		cred, ok := fh.creds[string(label)]
+		if !ok || cred.private == nil {
+			return []byte{0x6a, 0x82}
+		}
+		x, y := elliptic.P256().ScalarBaseMult(cred.private)
+		return append(elliptic.Marshal(elliptic.P256(), x, y), 0x90, 0x00)
+	case insHSMAuthCalculate:
+		cred, ok := fh.creds[string(label)]
+		if !ok {
+			return []byte{0x6a, 0x82}
+		}
+		password, _ := list.get(tagHSMAuthCredentialPassword)
+		if !bytes.Equal(password, cred.password) {
+			cred.retries--
+			return []byte{0x63, 0xc0 | byte(cred.retries)}
+		}
+		fh.context, _ = list.get(tagHSMAuthContext)
+		resp := append(append(append([]byte(nil), cred.enc...), cred.mac...), bytes.Repeat([]byte{0x01}, hsmAuthKeyLen)...)
+		return append(resp, 0x90, 0x00)
+	}
+	return []byte{0x6d, 0x00}
+}
+
+func TestHSMAuthCredentials(t *testing.T) {
+	fh := useFakeHSMAuth(t)
+	hsm := testCard(5, 6, 0).HSMAuth()
+
+	// Symmetric credential by the derivation password (YubiHSM 2 default authentication key)
+	if err := hsm.Add(HSMAuthCredentialOpts{Label: "default", Password: NewSecretString("secret"), DerivationPassword: "password", RequireTouch: true}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := "090b47dbed595654901dee1cc655e420"; hex.EncodeToString(fh.creds["default"].enc) != want {
+		t.Errorf("got %x, want %v", fh.creds["default"].enc, want)
+	}
+	if want := "592fd483f759e29909a04c4505d2ce0a"; hex.EncodeToString(fh.creds["default"].mac) != want {
+		t.Errorf("got %x, want %v", fh.creds["default"].mac, want)
+	}
+	if want := append([]byte("secret"), make([]byte, 10)...); !bytes.Equal(fh.creds["default"].password, want) {
+		t.Errorf("got %x, want %x", fh.creds["default"].password, want)
+	}
+
+	// Symmetric credential by the keys
+	key := bytes.Repeat([]byte{0x02}, hsmAuthKeyLen)
+	if err := hsm.Add(HSMAuthCredentialOpts{Label: "keys", EncKey: key, MACKey: key}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	// Asymmetric credential
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if err := hsm.Add(HSMAuthCredentialOpts{Label: "asymmetric", PrivateKey: priv}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if pub, err := hsm.PublicKey("asymmetric"); err != nil || !pub.Equal(&priv.PublicKey) {
+		t.Errorf("got %v (%v), want %v", pub, err, priv.PublicKey)
+	}
+	if err := testCard(5, 4, 3).HSMAuth().Add(HSMAuthCredentialOpts{Label: "asymmetric", PrivateKey: priv}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+
+	// List
+	creds, err := hsm.List()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := []HSMAuthCredential{
+		{Label: "default", Algorithm: HSMAuthAlgorithmAES128, RequireTouch: true, Retries: 8},
+		{Label: "keys", Algorithm: HSMAuthAlgorithmAES128, Retries: 8},
+		{Label: "asymmetric", Algorithm: HSMAuthAlgorithmECP256, Retries: 8},
+	}
+	if len(creds) != len(want) {
+		t.Fatalf("got %v, want %v", len(creds), len(want))
+	}
+	for i, v := range want {
+		if *creds[i] != v {
+			t.Errorf("got %v, want %v", *creds[i], v)
+		}
+	}
+
+	// Delete
+	if err := hsm.Delete("keys"); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := hsm.Delete("keys"); err == nil {
+		t.Error("got nil, want error")
+	}
+
+	// Invalid values
+	if err := hsm.Add(HSMAuthCredentialOpts{Label: "invalid", EncKey: key}); err == nil {
+		t.Error("got nil, want error")
+	}
+	if err := hsm.Add(HSMAuthCredentialOpts{Label: "", DerivationPassword: "password"}); err == nil {
+		t.Error("got nil, want error")
+	}
+	if err := hsm.Add(HSMAuthCredentialOpts{Label: "invalid", Password: NewSecretString("01234567890123456"), DerivationPassword: "password"}); err == nil {
+		t.Error("got nil, want error")
+	}
+	if _, err := testCard(5, 4, 2).HSMAuth().List(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestHSMAuthManagementKey(t *testing.T) {
+	fh := useFakeHSMAuth(t)
+	hsm := testCard(5, 4, 3).HSMAuth()
+	key := bytes.Repeat([]byte{0x03}, hsmAuthKeyLen)
+
+	old := hsm.manKey.Bytes()
+	if err := hsm.ChangeManagementKey(key); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !bytes.Equal(fh.manKey, key) || !bytes.Equal(hsm.manKey.Bytes(), key) {
+		t.Errorf("got %x, want %x", fh.manKey, key)
+	}
+	// The previous management key is zeroized
+	if !bytes.Equal(old, make([]byte, len(old))) {
+		t.Errorf("got %x, want zeros", old)
+	}
+
+	// Wrong management key
+	other := testCard(5, 4, 3).HSMAuth()
+	if err := other.Delete("label"); !errors.Is(err, ErrAuthError) {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+	if retries, err := other.ManagementKeyRetries(); err != nil || retries != 7 {
+		t.Errorf("got %v (%v), want %v", retries, err, 7)
+	}
+	if err := other.SetManKey(key); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := other.ChangeManagementKey(HSMAuthDefaultManagementKey); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := other.SetManKey(key[:8]); err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestHSMAuthSessionKeys(t *testing.T) {
+	fh := useFakeHSMAuth(t)
+	hsm := testCard(5, 4, 3).HSMAuth()
+	if err := hsm.Add(HSMAuthCredentialOpts{Label: "default", Password: NewSecretString("secret"), DerivationPassword: "password"}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	host, card := bytes.Repeat([]byte{0x0a}, 8), bytes.Repeat([]byte{0x0b}, 8)
+
+	keys, err := hsm.SessionKeys("default", "secret", host, card)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !bytes.Equal(keys.Enc.Bytes(), fh.creds["default"].enc) || !bytes.Equal(keys.MAC.Bytes(), fh.creds["default"].mac) || keys.RMAC.Len() != hsmAuthKeyLen {
+		t.Errorf("got %x %x %x, want the session keys", keys.Enc.Bytes(), keys.MAC.Bytes(), keys.RMAC.Bytes())
+	}
+	keys.Zero()
+	if !keys.Enc.IsEmpty() || !keys.MAC.IsEmpty() || !keys.RMAC.IsEmpty() {
+		t.Error("got the session keys, want zeroized keys")
+	}
+	if want := append(host, card...); !bytes.Equal(fh.context, want) {
+		t.Errorf("got %x, want %x", fh.context, want)
+	}
+
+	if _, err := hsm.SessionKeysSecret("default", NewSecretString("wrong"), host, card); !errors.Is(err, ErrAuthError) {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+	if _, err := hsm.SessionKeys("default", "secret", host[:4], card); err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestHSMAuthError(t *testing.T) {
+	if err := hsmAuthError(&apduError{sw: 0x63c2}); !errors.Is(err, ErrAuthError) || !strings.Contains(err.Error(), "(2 retries remaining)") {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+	// The invalid credential data isn't a PIN complexity error
+	if err := hsmAuthError(&apduError{sw: 0x6a80}); errors.Is(err, ErrPINComplexity) || !isStatus(err, 0x6a80) {
+		t.Errorf("got %v, want %v", err, &apduError{sw: 0x6a80})
+	}
+
+	// The default management key isn't shared
+	hsm := testCard(5, 7, 1).HSMAuth()
+	hsm.manKey.Bytes()[0] = 0x01
+	if HSMAuthDefaultManagementKey[0] != 0x00 {
+		t.Errorf("got %x, want %x", HSMAuthDefaultManagementKey, make([]byte, hsmAuthKeyLen))
+	}
+}
@@ -0,0 +1,39 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardHSMAuth(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		if _, err := card.HSMAuth().List(); err != nil && !errors.Is(err, yubikey.ErrNotSupported) {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+}
+
+func TestHSMAuthAlgorithmString(t *testing.T) {
+	table := []struct {
+		alg  yubikey.HSMAuthAlgorithm
+		want string
+	}{
+		{yubikey.HSMAuthAlgorithmUnknown, ""},
+		{yubikey.HSMAuthAlgorithmAES128, "AES128"},
+		{yubikey.HSMAuthAlgorithmECP256, "ECP256"},
+	}
+	for _, v := range table {
+		if s := v.alg.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
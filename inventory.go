@@ -0,0 +1,127 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// InventorySchemaVersion holds the schema version of the card and slot inventory representations.
+// It's increased when a field is renamed or removed (new fields may be added without a version change).
+const InventorySchemaVersion = 1
+
+// CardInfo represents the inventory representation of a card.
+// It's used for the JSON encoding of the cards and it has YAML tags so it can be encoded by the YAML packages too.
+type CardInfo struct {
+	// Schema is the inventory schema version.
+	Schema int `json:"schema" yaml:"schema"`
+	// Serial is the card serial number.
+	Serial string `json:"serial" yaml:"serial"`
+	// Version is the card firmware version.
+	Version string `json:"version" yaml:"version"`
+	// Reader is the smart card reader name.
+	Reader string `json:"reader" yaml:"reader"`
+	// Slots is the card slots.
+	Slots []SlotInfo `json:"slots" yaml:"slots"`
+}
+
+// SlotInfo represents the inventory representation of a slot.
+type SlotInfo struct {
+	// Key is the slot key (i.e. "9a").
+	Key string `json:"key" yaml:"key"`
+	// HasKey is whether the slot has a key or not.
+	HasKey bool `json:"hasKey" yaml:"hasKey"`
+	// Algorithm is the slot key algorithm.
+	Algorithm Algorithm `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	// PINPolicy is the slot PIN policy.
+	PINPolicy PINPolicy `json:"pinPolicy,omitempty" yaml:"pinPolicy,omitempty"`
+	// TouchPolicy is the slot touch policy.
+	TouchPolicy TouchPolicy `json:"touchPolicy,omitempty" yaml:"touchPolicy,omitempty"`
+	// Origin is the slot key origin.
+	Origin KeyOrigin `json:"origin,omitempty" yaml:"origin,omitempty"`
+	// PublicKey is the PEM encoding of the slot public key.
+	PublicKey string `json:"publicKey,omitempty" yaml:"publicKey,omitempty"`
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the slot public key.
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	// Certificate is the summary of the slot certificate.
+	Certificate *CertificateInfo `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+}
+
+// CertificateInfo represents the summary of a slot certificate.
+type CertificateInfo struct {
+	// Subject is the certificate subject.
+	Subject string `json:"subject" yaml:"subject"`
+	// Issuer is the certificate issuer.
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// SerialNumber is the certificate serial number (hex encoded).
+	SerialNumber string `json:"serialNumber" yaml:"serialNumber"`
+	// NotBefore is the start of the certificate validity.
+	NotBefore time.Time `json:"notBefore" yaml:"notBefore"`
+	// NotAfter is the end of the certificate validity.
+	NotAfter time.Time `json:"notAfter" yaml:"notAfter"`
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the certificate.
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+}
+
+// Info returns the inventory representation of the card. It reads the card slots so the cards aren't marshaled
+// directly (i.e. json.Marshal(card)) and the returned representation should be marshaled instead.
+func (card *Card) Info() (*CardInfo, error) {
+	slots, err := card.Slots()
+	if err != nil {
+		return nil, err
+	}
+	info := CardInfo{
+		Schema:  InventorySchemaVersion,
+		Serial:  card.Serial(),
+		Version: card.Version(),
+		Reader:  card.Name(),
+		Slots:   make([]SlotInfo, 0, len(slots)),
+	}
+	for _, slot := range slots {
+		info.Slots = append(info.Slots, slot.Info())
+	}
+	return &info, nil
+}
+
+// Info returns the inventory representation of the slot.
+func (slot *Slot) Info() SlotInfo {
+	info := SlotInfo{
+		Key:         slot.key,
+		HasKey:      slot.hasKey,
+		Algorithm:   slot.publicKeyAlg,
+		PINPolicy:   slot.pinPolicy,
+		TouchPolicy: slot.touchPolicy,
+	}
+	if slot.isGenerated {
+		info.Origin = KeyOriginGenerated
+	} else if slot.isImported {
+		info.Origin = KeyOriginImported
+	}
+	if b, err := slot.PublicKeyPEM(); err == nil {
+		info.PublicKey = string(b)
+	}
+	if fp, err := slot.FingerprintSHA256(); err == nil {
+		info.Fingerprint = hex.EncodeToString(fp)
+	}
+	if cert := slot.certificate; cert != nil {
+		sum := sha256.Sum256(cert.Raw)
+		info.Certificate = &CertificateInfo{
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			SerialNumber: cert.SerialNumber.Text(16),
+			NotBefore:    cert.NotBefore.UTC(),
+			NotAfter:     cert.NotAfter.UTC(),
+			Fingerprint:  hex.EncodeToString(sum[:]),
+		}
+	}
+	return info
+}
+
+// MarshalJSON implements the json.Marshaler interface by the slot inventory representation.
+func (slot *Slot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(slot.Info())
+}
@@ -0,0 +1,78 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlotMarshalJSON(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(0x1234),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2034, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	slot := &Slot{key: "9a", hasKey: true, isImported: true, pinPolicy: PINPolicyOnce, touchPolicy: TouchPolicyCached, certificate: cert}
+	slot.setPublicKey(cert.PublicKey)
+	b, err := json.Marshal(slot)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	for k, want := range map[string]interface{}{
+		"key":         "9a",
+		"hasKey":      true,
+		"algorithm":   "p256",
+		"pinPolicy":   "Once",
+		"touchPolicy": "Cached",
+		"origin":      "Imported",
+	} {
+		if m[k] != want {
+			t.Errorf("got %v, want %v (%s)", m[k], want, k)
+		}
+	}
+	if pub, _ := m["publicKey"].(string); !strings.HasPrefix(pub, "-----BEGIN PUBLIC KEY-----") {
+		t.Errorf("got %v, want a PEM public key", pub)
+	}
+	certInfo, _ := m["certificate"].(map[string]interface{})
+	if certInfo["subject"] != "CN=test" || certInfo["serialNumber"] != "1234" || certInfo["notAfter"] != "2034-01-01T00:00:00Z" {
+		t.Errorf("got %v, want the certificate summary", certInfo)
+	}
+
+	// Round trip
+	var info SlotInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := slot.Info(); !reflect.DeepEqual(info, want) {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+
+	// Empty slot
+	b, err = json.Marshal(&Slot{key: "9c"})
+	if want := `{"key":"9c","hasKey":false}`; err != nil || string(b) != want {
+		t.Errorf("got %s (%v), want %s", b, err, want)
+	}
+}
@@ -0,0 +1,36 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardInfo(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		cardInfo, err := card.Info()
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+			continue
+		}
+		b, err := json.Marshal(cardInfo)
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+			continue
+		}
+		var info yubikey.CardInfo
+		if err := json.Unmarshal(b, &info); err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if info.Schema != yubikey.InventorySchemaVersion || info.Serial != card.Serial() {
+			t.Errorf("got %v, want %v", info.Serial, card.Serial())
+		}
+	}
+}
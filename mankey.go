@@ -0,0 +1,379 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PIV instructions
+	insAuthenticate     = 0x87
+	insSetManagementKey = 0xff
+
+	// Management key reference
+	keyManagement = 0x9b
+
+	// Dynamic authentication template tags
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/auth-mgmt.html
+	tagDynamicAuth    = 0x7c
+	tagWitness        = 0x80
+	tagChallenge      = 0x81
+	tagResponse       = 0x82
+	tagExponentiation = 0x85
+
+	// PIN-protected management key tags which are compatible with ykman
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/pin-only.html
+	tagAdminData         = 0x80
+	tagAdminFlags        = 0x81
+	tagProtectedData     = 0x88
+	tagProtectedManKey   = 0x89
+	adminFlagPUKBlocked  = 0x01
+	adminFlagProtectedMK = 0x02
+)
+
+// ChangeManagementKeyOpts represents the options which can be used for changing the management key.
+type ChangeManagementKeyOpts struct {
+	// Algorithm is the algorithm of the new management key.
+	// The default is AES-192 for firmware 5.7 or later and 3DES for the others.
+	Algorithm ManagementKeyAlgorithm
+	// Key is the new management key. It's generated randomly if it's empty and PINProtected is set.
+	Key *Secret
+	// RequireTouch indicates whether the new management key requires touch or not.
+	RequireTouch bool
+	// PINProtected indicates whether the new management key is stored in the PIN protected data object or not.
+	// The stored management key is used automatically after the PIN is verified by Card.VerifyPIN.
+	PINProtected bool
+	// ManKey is the current management key. The card management key is used if it's empty.
+	ManKey *Secret
+}
+
+// ChangeManagementKey changes the card management key.
+// AES management keys require firmware 5.4 or later. The card management key is updated after the key is changed.
+func (card *Card) ChangeManagementKey(opts ChangeManagementKeyOpts) error {
+	// Check the options
+	alg := opts.Algorithm
+	if alg == ManagementKeyAlgorithmUnknown {
+		alg = ManagementKeyAlgorithm3DES
+		if card.isVersion(5, 7, 0) {
+			alg = ManagementKeyAlgorithmAES192
+		}
+	}
+	if alg.keyLen() == 0 {
+		return fmt.Errorf("unsupported management key algorithm: %d", alg)
+	} else if alg != ManagementKeyAlgorithm3DES && !card.isVersion(5, 4, 0) {
+		return ErrNotSupported
+	}
+	key := opts.Key.Clone()
+	if key.IsEmpty() {
+		if !opts.PINProtected {
+			return errors.New("missing management key")
+		}
+		key = &Secret{b: make([]byte, alg.keyLen())}
+		if _, err := rand.Read(key.b); err != nil {
+			return fmt.Errorf("couldn't generate a management key: %s", err)
+		}
+	} else if l := key.Len(); l != alg.keyLen() {
+		key.Zero()
+		return fmt.Errorf("invalid management key length for %s: %d", alg, l)
+	}
+	defer key.Zero()
+
+	// Resolve the PIN and connect to the smart card
+	return card.withPIN(opts.PINProtected, func(verify func(s *session) error) error {
+		return card.withSession(aidPIV, func(s *session) error {
+			// Authenticate (the PIN is verified so a PIN protected key can't be stored by mistake with a wrong PIN)
+			if err := card.authenticate(s, opts.ManKey); err != nil {
+				return err
+			}
+			if opts.PINProtected {
+				if err := verify(s); err != nil {
+					return card.pinError(err, ErrInvalidPIN)
+				}
+			}
+			admin, err := readAdminData(s)
+			if err != nil {
+				return err
+			}
+
+			// Change the management key
+			// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/set-mgmt-key.html
+			p2 := byte(0xff)
+			if opts.RequireTouch {
+				p2 = 0xfe
+			}
+			data := s.keep(append([]byte{alg.code(), keyManagement, byte(key.Len())}, key.Bytes()...))
+			if _, err := s.send(apdu{ins: insSetManagementKey, p1: 0xff, p2: p2, data: data}); err != nil {
+				return fmt.Errorf("couldn't change the management key: %s", managementKeyError(err))
+			}
+			card.setManKey(key.Clone())
+
+			// Store or remove the PIN protected management key
+			flags := admin.flags()
+			if opts.PINProtected {
+				if err := putData(s, ObjectPrinted, s.keep(marshalTLV(tagProtectedData, s.keep(marshalTLV(tagProtectedManKey, key.Bytes()))))); err != nil {
+					return fmt.Errorf("couldn't store the PIN protected management key: %s", err)
+				}
+				flags |= adminFlagProtectedMK
+			} else if flags&adminFlagProtectedMK != 0 {
+				if err := putData(s, ObjectPrinted, nil); err != nil {
+					return fmt.Errorf("couldn't remove the PIN protected management key: %s", err)
+				}
+				flags &^= adminFlagProtectedMK
+			}
+			if flags != admin.flags() {
+				if err := putData(s, objectAdminData, admin.withFlags(flags)); err != nil {
+					return fmt.Errorf("couldn't update the admin data: %s", err)
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+// code returns the PIV encoded value of the management key algorithm.
+func (alg ManagementKeyAlgorithm) code() byte {
+	switch alg {
+	case ManagementKeyAlgorithm3DES:
+		return 0x03
+	case ManagementKeyAlgorithmAES128:
+		return 0x08
+	case ManagementKeyAlgorithmAES192:
+		return 0x0a
+	case ManagementKeyAlgorithmAES256:
+		return 0x0c
+	default:
+		return 0x00
+	}
+}
+
+// keyLen returns the key length of the management key algorithm.
+func (alg ManagementKeyAlgorithm) keyLen() int {
+	switch alg {
+	case ManagementKeyAlgorithm3DES, ManagementKeyAlgorithmAES192:
+		return 24
+	case ManagementKeyAlgorithmAES128:
+		return 16
+	case ManagementKeyAlgorithmAES256:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// cipher returns the block cipher of the management key algorithm by the given key.
+func (alg ManagementKeyAlgorithm) cipher(key []byte) (cipher.Block, error) {
+	if l := alg.keyLen(); l == 0 {
+		return nil, fmt.Errorf("unsupported management key algorithm: %d", alg)
+	} else if len(key) != l {
+		return nil, fmt.Errorf("invalid management key length for %s: %d", alg, len(key))
+	}
+	if alg == ManagementKeyAlgorithm3DES {
+		return des.NewTripleDESCipher(key)
+	}
+	return aes.NewCipher(key)
+}
+
+// managementKeyAlgorithm returns the management key algorithm of the card by the given session.
+// The cards prior to firmware 5.3 don't support the metadata so they are assumed to have 3DES management keys.
+func (card *Card) managementKeyAlgorithm(s *session) (ManagementKeyAlgorithm, error) {
+	if !card.isVersion(5, 3, 0) {
+		return ManagementKeyAlgorithm3DES, nil
+	}
+	md, err := card.metadata(s, keyManagement)
+	if err != nil {
+		return ManagementKeyAlgorithmUnknown, fmt.Errorf("couldn't get the management key metadata: %s", err)
+	}
+	if v, ok := md.get(metadataTagAlgorithm); ok && len(v) == 1 {
+		return managementKeyAlgorithmFromByte(v[0]), nil
+	}
+	return ManagementKeyAlgorithm3DES, nil
+}
+
+// authenticate authenticates the session by the given management key.
+// If the given management key is empty then the card management key is used.
+func (card *Card) authenticate(s *session, manKey *Secret) error {
+	if manKey.IsEmpty() {
+		manKey = card.manKey
+	}
+	alg, err := card.managementKeyAlgorithm(s)
+	if err != nil {
+		return err
+	}
+	return authenticateManagementKey(s, alg, manKey.Bytes())
+}
+
+// authenticateManagementKey authenticates the session by the given management key algorithm and key.
+// It uses the mutual authentication so the card is authenticated too.
+// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/auth-mgmt.html
+func authenticateManagementKey(s *session, alg ManagementKeyAlgorithm, key []byte) error {
+	block, err := alg.cipher(key)
+	if err != nil {
+		return err
+	}
+	bs := block.BlockSize()
+
+	// Request a witness
+	resp, err := s.send(apdu{
+		ins:  insAuthenticate,
+		p1:   alg.code(),
+		p2:   keyManagement,
+		data: marshalTLV(tagDynamicAuth, marshalTLV(tagWitness, nil)),
+	})
+	if err != nil {
+		return managementKeyError(err)
+	}
+	witness, err := dynamicAuthValue(resp, tagWitness, bs)
+	if err != nil {
+		return err
+	}
+
+	// Decrypt the witness and send it back with a challenge
+	decrypted := make([]byte, bs)
+	block.Decrypt(decrypted, witness)
+	challenge := make([]byte, bs)
+	if _, err := rand.Read(challenge); err != nil {
+		return fmt.Errorf("couldn't generate a challenge: %s", err)
+	}
+	resp, err = s.send(apdu{
+		ins:  insAuthenticate,
+		p1:   alg.code(),
+		p2:   keyManagement,
+		data: marshalTLV(tagDynamicAuth, append(marshalTLV(tagWitness, decrypted), marshalTLV(tagChallenge, challenge)...)),
+	})
+	if err != nil {
+		return managementKeyError(err)
+	}
+
+	// Verify the card response
+	response, err := dynamicAuthValue(resp, tagResponse, bs)
+	if err != nil {
+		return err
+	}
+	expected := make([]byte, bs)
+	block.Encrypt(expected, challenge)
+	if subtle.ConstantTimeCompare(response, expected) != 1 {
+		return errors.New("invalid management key challenge response")
+	}
+
+	return nil
+}
+
+// dynamicAuthValue returns the value of the given tag from the given dynamic authentication template.
+func dynamicAuthValue(resp []byte, tag uint32, l int) ([]byte, error) {
+	list, err := parseTLVs(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication response: %s", err)
+	}
+	template, ok := list.get(tagDynamicAuth)
+	if !ok {
+		return nil, errors.New("invalid authentication response: missing template")
+	}
+	list, err = parseTLVs(template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication response: %s", err)
+	}
+	value, ok := list.get(tag)
+	if !ok || len(value) != l {
+		return nil, fmt.Errorf("invalid authentication response: missing %x", tag)
+	}
+	return value, nil
+}
+
+// adminData represents the ykman compatible admin data object.
+type adminData tlvs
+
+// readAdminData reads the admin data object by the given session.
+// It returns empty admin data if the object doesn't exist.
+func readAdminData(s *session) (adminData, error) {
+	data, err := getData(s, objectAdminData)
+	if err != nil {
+		if isStatus(err, swNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("couldn't read the admin data: %s", err)
+	}
+	list, err := parseTLVs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin data: %s", err)
+	}
+	v, ok := list.get(tagAdminData)
+	if !ok {
+		return nil, errors.New("invalid admin data: missing template")
+	}
+	list, err = parseTLVs(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin data: %s", err)
+	}
+	return adminData(list), nil
+}
+
+// flags returns the admin flags.
+func (admin adminData) flags() byte {
+	if v, ok := tlvs(admin).get(tagAdminFlags); ok && len(v) == 1 {
+		return v[0]
+	}
+	return 0
+}
+
+// withFlags returns the encoded admin data object with the given admin flags.
+// The other admin data (i.e. the PIN derived key salt) is kept as it is.
+func (admin adminData) withFlags(flags byte) []byte {
+	b := marshalTLV(tagAdminFlags, []byte{flags})
+	for _, v := range admin {
+		if v.tag != tagAdminFlags {
+			b = append(b, marshalTLV(v.tag, v.value)...)
+		}
+	}
+	return marshalTLV(tagAdminData, b)
+}
+
+// protectedManagementKey returns the PIN protected management key by the given session.
+// It returns nil if the management key isn't PIN protected. The PIN must be verified before.
+func protectedManagementKey(s *session) ([]byte, error) {
+	admin, err := readAdminData(s)
+	if err != nil {
+		return nil, err
+	} else if admin.flags()&adminFlagProtectedMK == 0 {
+		return nil, nil
+	}
+	data, err := getData(s, ObjectPrinted)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the PIN protected management key: %s", err)
+	}
+	list, err := parseTLVs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PIN protected data: %s", err)
+	}
+	v, ok := list.get(tagProtectedData)
+	if !ok {
+		return nil, errors.New("invalid PIN protected data: missing template")
+	}
+	if list, err = parseTLVs(v); err != nil {
+		return nil, fmt.Errorf("invalid PIN protected data: %s", err)
+	}
+	key, ok := list.get(tagProtectedManKey)
+	if !ok {
+		return nil, errors.New("invalid PIN protected data: missing management key")
+	}
+	return key, nil
+}
+
+// managementKeyError returns the authentication error by the given management key authentication error.
+func managementKeyError(err error) error {
+	if isStatus(err, swSecurityStatus) {
+		// auth challenge: smart card error 6982: security status not satisfied
+		return ErrAuthError
+	} else if isStatus(err, swAuthBlocked) {
+		return ErrAuthBlocked
+	}
+	return err
+}
@@ -0,0 +1,206 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fakeManagementKey represents a fake card management key which replies the authentication requests.
+type fakeManagementKey struct {
+	alg           ManagementKeyAlgorithm
+	key           []byte
+	witness       []byte
+	authenticated bool
+}
+
+// handle handles the given management key request. It returns nil if the request isn't handled.
+func (fmk *fakeManagementKey) handle(t *testing.T, req []byte) []byte {
+	t.Helper()
+	switch {
+	case req[1] == insGetMetadata && req[3] == keyManagement:
+		resp := marshalTLV(metadataTagAlgorithm, []byte{fmk.alg.code()})
+		resp = append(resp, marshalTLV(metadataTagPolicy, []byte{0x00, 0x01})...)
+		resp = append(resp, marshalTLV(metadataTagDefault, []byte{0x00})...)
+		return append(resp, 0x90, 0x00)
+	case req[1] == insAuthenticate && req[3] == keyManagement:
+		block, err := fmk.alg.cipher(fmk.key)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if req[2] != fmk.alg.code() {
+			return []byte{0x6a, 0x80}
+		}
+		list, err := parseTLVs(req[5 : 5+int(req[4])])
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		template, _ := list.get(tagDynamicAuth)
+		list, _ = parseTLVs(template)
+		challenge, ok := list.get(tagChallenge)
+		if !ok {
+			// Witness request
+			fmk.witness = bytes.Repeat([]byte{0x5a}, block.BlockSize())
+			encrypted := make([]byte, block.BlockSize())
+			block.Encrypt(encrypted, fmk.witness)
+			return append(marshalTLV(tagDynamicAuth, marshalTLV(tagWitness, encrypted)), 0x90, 0x00)
+		}
+		if witness, _ := list.get(tagWitness); !bytes.Equal(witness, fmk.witness) {
+			return []byte{0x69, 0x82}
+		}
+		fmk.authenticated = true
+		encrypted := make([]byte, block.BlockSize())
+		block.Encrypt(encrypted, challenge)
+		return append(marshalTLV(tagDynamicAuth, marshalTLV(tagResponse, encrypted)), 0x90, 0x00)
+	}
+	return nil
+}
+
+func TestAuthenticateManagementKey(t *testing.T) {
+	table := []struct {
+		alg ManagementKeyAlgorithm
+		key []byte
+	}{
+		{ManagementKeyAlgorithm3DES, DefaultManagementKey[:]},
+		{ManagementKeyAlgorithmAES128, bytes.Repeat([]byte{0x01}, 16)},
+		{ManagementKeyAlgorithmAES192, DefaultManagementKey[:]},
+		{ManagementKeyAlgorithmAES256, bytes.Repeat([]byte{0x02}, 32)},
+	}
+	for _, v := range table {
+		fmk := &fakeManagementKey{alg: v.alg, key: v.key}
+		useFakeTransport(t, func(req []byte) []byte {
+			if resp := fmk.handle(t, req); resp != nil {
+				return resp
+			}
+			return []byte{0x6d, 0x00}
+		})
+		card := testCard(5, 7, 1)
+		s, err := openSession(card.name, aidPIV)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+
+		// Valid key
+		if err := card.authenticate(s, NewSecret(v.key)); err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if !fmk.authenticated {
+			t.Error("got false, want true")
+		}
+
+		// Invalid key
+		invalidKey := bytes.Repeat([]byte{0xff}, len(v.key))
+		if err := card.authenticate(s, NewSecret(invalidKey)); !errors.Is(err, ErrAuthError) {
+			t.Errorf("got %v, want %v", err, ErrAuthError)
+		}
+		if err := authenticateManagementKey(s, v.alg, invalidKey[1:]); err == nil {
+			t.Error("got nil, want an error")
+		}
+		s.Close()
+	}
+}
+
+func TestManagementKeyAlgorithmKeyLen(t *testing.T) {
+	table := []struct {
+		alg  ManagementKeyAlgorithm
+		code byte
+		want int
+	}{
+		{ManagementKeyAlgorithmUnknown, 0x00, 0},
+		{ManagementKeyAlgorithm3DES, 0x03, 24},
+		{ManagementKeyAlgorithmAES128, 0x08, 16},
+		{ManagementKeyAlgorithmAES192, 0x0a, 24},
+		{ManagementKeyAlgorithmAES256, 0x0c, 32},
+	}
+	for _, v := range table {
+		if l := v.alg.keyLen(); l != v.want {
+			t.Errorf("got %v, want %v", l, v.want)
+		}
+		if c := v.alg.code(); c != v.code {
+			t.Errorf("got %v, want %v", c, v.code)
+		}
+	}
+}
+
+func TestCardChangeManagementKey(t *testing.T) {
+	fmk := &fakeManagementKey{alg: ManagementKeyAlgorithm3DES, key: DefaultManagementKey[:]}
+	objects := fakeObjects{objectAdminData: marshalTLV(tagAdminData, marshalTLV(0x82, []byte{0x01, 0x02}))}
+	var touch bool
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := fmk.handle(t, req); resp != nil {
+			return resp
+		} else if resp := objects.handle(req); resp != nil {
+			return resp
+		}
+		switch req[1] {
+		case insVerify:
+			return []byte{0x90, 0x00}
+		case insSetManagementKey:
+			if !fmk.authenticated {
+				return []byte{0x69, 0x82}
+			}
+			data := req[5 : 5+int(req[4])]
+			fmk.alg = managementKeyAlgorithmFromByte(data[0])
+			fmk.key = append([]byte(nil), data[3:]...)
+			fmk.authenticated = false
+			touch = req[3] == 0xfe
+			return []byte{0x90, 0x00}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+
+	// AES-256 with touch
+	key := bytes.Repeat([]byte{0x03}, 32)
+	if err := card.ChangeManagementKey(ChangeManagementKeyOpts{Algorithm: ManagementKeyAlgorithmAES256, Key: NewSecret(key), RequireTouch: true}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if fmk.alg != ManagementKeyAlgorithmAES256 || !bytes.Equal(fmk.key, key) || !bytes.Equal(card.manKey.Bytes(), key) || !touch {
+		t.Errorf("got %v %x %x %v, want the new management key", fmk.alg, fmk.key, card.manKey.Bytes(), touch)
+	}
+
+	// PIN protected (the default algorithm is AES-192)
+	if err := card.ChangeManagementKey(ChangeManagementKeyOpts{PINProtected: true}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if fmk.alg != ManagementKeyAlgorithmAES192 || len(fmk.key) != 24 || bytes.Equal(fmk.key, DefaultManagementKey[:]) {
+		t.Errorf("got %v %x, want a random AES-192 key", fmk.alg, fmk.key)
+	}
+	want := marshalTLV(tagAdminData, append(marshalTLV(tagAdminFlags, []byte{adminFlagProtectedMK}), marshalTLV(0x82, []byte{0x01, 0x02})...))
+	if v := objects[objectAdminData]; !bytes.Equal(v, want) {
+		t.Errorf("got %x, want %x", v, want)
+	}
+	card.SetManKey(nil)
+	if err := card.VerifyPIN(DefaultPIN); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !bytes.Equal(card.manKey.Bytes(), fmk.key) {
+		t.Errorf("got %x, want %x", card.manKey.Bytes(), fmk.key)
+	}
+
+	// Not PIN protected anymore
+	if err := card.ChangeManagementKey(ChangeManagementKeyOpts{Algorithm: ManagementKeyAlgorithm3DES, Key: NewSecret(DefaultManagementKey[:])}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if _, ok := objects[ObjectPrinted]; ok {
+		t.Error("got true, want false")
+	}
+	want = marshalTLV(tagAdminData, append(marshalTLV(tagAdminFlags, []byte{0x00}), marshalTLV(0x82, []byte{0x01, 0x02})...))
+	if v := objects[objectAdminData]; !bytes.Equal(v, want) {
+		t.Errorf("got %x, want %x", v, want)
+	}
+
+	// Invalid options
+	if err := card.ChangeManagementKey(ChangeManagementKeyOpts{}); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if err := card.ChangeManagementKey(ChangeManagementKeyOpts{Algorithm: ManagementKeyAlgorithmAES128, Key: NewSecret(key)}); err == nil {
+		t.Error("got nil, want an error")
+	}
+	card.version.Minor = 3
+	if err := card.ChangeManagementKey(ChangeManagementKeyOpts{Algorithm: ManagementKeyAlgorithmAES128, Key: NewSecret(key[:16])}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
@@ -0,0 +1,248 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// Metadata references which aren't slots
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/metadata.html
+	metadataPIN           = 0x80
+	metadataPUK           = 0x81
+	metadataManagementKey = 0x9b
+
+	// Metadata tags
+	metadataTagAlgorithm = 0x01
+	metadataTagPolicy    = 0x02
+	metadataTagOrigin    = 0x03
+	metadataTagPublicKey = 0x04
+	metadataTagDefault   = 0x05
+	metadataTagRetries   = 0x06
+)
+
+// KeyMetadata represents the metadata of a slot key.
+type KeyMetadata struct {
+	// Algorithm is the algorithm of the key.
+	Algorithm Algorithm
+	// PINPolicy is the PIN policy of the key.
+	PINPolicy PINPolicy
+	// TouchPolicy is the touch policy of the key.
+	TouchPolicy TouchPolicy
+	// Origin is the origin of the key (generated or imported).
+	Origin KeyOrigin
+	// PublicKey is the public key of the key.
+	PublicKey crypto.PublicKey
+}
+
+// PINMetadata represents the metadata of the PIN or PUK.
+type PINMetadata struct {
+	// IsDefault indicates whether the default value is still set or not.
+	IsDefault bool
+	// TotalRetries is the total number of the retries.
+	TotalRetries int
+	// RemainingRetries is the remaining number of the retries.
+	RemainingRetries int
+}
+
+// ManagementKeyMetadata represents the metadata of the management key.
+type ManagementKeyMetadata struct {
+	// Algorithm is the algorithm of the management key.
+	Algorithm ManagementKeyAlgorithm
+	// TouchPolicy is the touch policy of the management key.
+	TouchPolicy TouchPolicy
+	// IsDefault indicates whether the default value is still set or not.
+	IsDefault bool
+}
+
+// Metadata returns the metadata of the slot key.
+// It requires firmware 5.3 or later.
+func (slot *Slot) Metadata() (*KeyMetadata, error) {
+	if slot == nil || slot.card == nil {
+		return nil, errors.New("invalid slot")
+	}
+
+	var metadata *KeyMetadata
+	err := slot.card.withSession(aidPIV, func(s *session) error {
+		var err error
+		metadata, err = slot.card.keyMetadata(s, byte(slot.slot.Key))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// PINMetadata returns the metadata of the PIN.
+// It requires firmware 5.3 or later.
+func (card *Card) PINMetadata() (*PINMetadata, error) {
+	return card.pinMetadata(metadataPIN)
+}
+
+// PUKMetadata returns the metadata of the PUK.
+// It requires firmware 5.3 or later.
+func (card *Card) PUKMetadata() (*PINMetadata, error) {
+	return card.pinMetadata(metadataPUK)
+}
+
+// ManagementKeyMetadata returns the metadata of the management key.
+// It requires firmware 5.3 or later.
+func (card *Card) ManagementKeyMetadata() (*ManagementKeyMetadata, error) {
+	// Get the metadata
+	var md tlvs
+	err := card.withSession(aidPIV, func(s *session) error {
+		var err error
+		md, err = card.metadata(s, metadataManagementKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var metadata ManagementKeyMetadata
+	if v, ok := md.get(metadataTagAlgorithm); ok && len(v) == 1 {
+		metadata.Algorithm = managementKeyAlgorithmFromByte(v[0])
+	} else {
+		// Firmware prior to 5.4 doesn't return the algorithm since it only supports 3DES
+		metadata.Algorithm = ManagementKeyAlgorithm3DES
+	}
+	if v, ok := md.get(metadataTagPolicy); ok && len(v) == 2 {
+		metadata.TouchPolicy = touchPolicyFromByte(v[1])
+	}
+	if v, ok := md.get(metadataTagDefault); ok && len(v) == 1 {
+		metadata.IsDefault = v[0] == 0x01
+	}
+
+	return &metadata, nil
+}
+
+// pinMetadata returns the metadata of the PIN or PUK by the given reference.
+func (card *Card) pinMetadata(ref byte) (*PINMetadata, error) {
+	// Get the metadata
+	var md tlvs
+	err := card.withSession(aidPIV, func(s *session) error {
+		var err error
+		md, err = card.metadata(s, ref)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var metadata PINMetadata
+	if v, ok := md.get(metadataTagDefault); ok && len(v) == 1 {
+		metadata.IsDefault = v[0] == 0x01
+	}
+	if v, ok := md.get(metadataTagRetries); ok && len(v) == 2 {
+		metadata.TotalRetries = int(v[0])
+		metadata.RemainingRetries = int(v[1])
+	} else {
+		return nil, fmt.Errorf("invalid metadata (%x): missing retries", ref)
+	}
+
+	return &metadata, nil
+}
+
+// keyMetadata returns the metadata of the slot key by the given session and slot key.
+// It returns ErrNoKey if the slot has no key.
+func (card *Card) keyMetadata(s *session, key byte) (*KeyMetadata, error) {
+	md, err := card.metadata(s, key)
+	if err != nil {
+		if isStatus(err, swNotFound) {
+			return nil, ErrNoKey
+		}
+		return nil, err
+	}
+
+	var metadata KeyMetadata
+	alg, ok := md.get(metadataTagAlgorithm)
+	if !ok || len(alg) != 1 {
+		return nil, fmt.Errorf("invalid metadata (%x): missing algorithm", key)
+	}
+	metadata.Algorithm = algorithmFromByte(alg[0])
+	if v, ok := md.get(metadataTagPolicy); ok && len(v) == 2 {
+		metadata.PINPolicy = pinPolicyFromByte(v[0])
+		metadata.TouchPolicy = touchPolicyFromByte(v[1])
+	}
+	if v, ok := md.get(metadataTagOrigin); ok && len(v) == 1 {
+		metadata.Origin = keyOriginFromByte(v[0])
+	}
+	if v, ok := md.get(metadataTagPublicKey); ok {
+		metadata.PublicKey, err = decodePublicKey(metadata.Algorithm, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata (%x): %s", key, err)
+		}
+	}
+
+	return &metadata, nil
+}
+
+// metadata returns the raw metadata by the given session and reference.
+func (card *Card) metadata(s *session, ref byte) (tlvs, error) {
+	if !card.isVersion(5, 3, 0) {
+		return nil, ErrNotSupported
+	}
+	resp, err := s.send(apdu{ins: insGetMetadata, p2: ref})
+	if err != nil {
+		return nil, err
+	}
+	md, err := parseTLVs(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata (%x): %s", ref, err)
+	}
+	return md, nil
+}
+
+// decodePublicKey decodes the given PIV encoded public key by the given algorithm.
+// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/generate-pair.html
+func decodePublicKey(alg Algorithm, b []byte) (crypto.PublicKey, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case AlgorithmEC256, AlgorithmEC384:
+		curve := elliptic.P256()
+		if alg == AlgorithmEC384 {
+			curve = elliptic.P384()
+		}
+		point, ok := list.get(0x86)
+		if !ok {
+			return nil, errors.New("missing public key point")
+		}
+		x, y := elliptic.Unmarshal(curve, point)
+		if x == nil {
+			return nil, errors.New("invalid public key point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case AlgorithmEd25519:
+		point, ok := list.get(0x86)
+		if !ok || len(point) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key point")
+		}
+		return ed25519.PublicKey(point), nil
+	case AlgorithmRSA1024, AlgorithmRSA2048, AlgorithmRSA3072, AlgorithmRSA4096:
+		n, okN := list.get(0x81)
+		e, okE := list.get(0x82)
+		if !okN || !okE || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid public key modulus or exponent")
+		}
+		var exp int
+		for _, v := range e {
+			exp = exp<<8 | int(v)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %d", alg)
+	}
+}
@@ -0,0 +1,126 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestSlotMetadata(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	point := elliptic.Marshal(privateKey.Curve, privateKey.X, privateKey.Y)
+	useFakeTransport(t, func(req []byte) []byte {
+		if req[1] != insGetMetadata {
+			return []byte{0x6d, 0x00}
+		}
+		switch req[3] {
+		case 0x9a:
+			resp := marshalTLV(metadataTagAlgorithm, []byte{0x11})
+			resp = append(resp, marshalTLV(metadataTagPolicy, []byte{0x03, 0x01})...)
+			resp = append(resp, marshalTLV(metadataTagOrigin, []byte{0x02})...)
+			resp = append(resp, marshalTLV(metadataTagPublicKey, marshalTLV(0x86, point))...)
+			return append(resp, 0x90, 0x00)
+		case metadataPIN:
+			resp := marshalTLV(metadataTagAlgorithm, []byte{0xff})
+			resp = append(resp, marshalTLV(metadataTagDefault, []byte{0x01})...)
+			resp = append(resp, marshalTLV(metadataTagRetries, []byte{0x03, 0x02})...)
+			return append(resp, 0x90, 0x00)
+		case metadataPUK:
+			resp := marshalTLV(metadataTagDefault, []byte{0x00})
+			resp = append(resp, marshalTLV(metadataTagRetries, []byte{0x05, 0x05})...)
+			return append(resp, 0x90, 0x00)
+		case metadataManagementKey:
+			resp := marshalTLV(metadataTagAlgorithm, []byte{0x0c})
+			resp = append(resp, marshalTLV(metadataTagPolicy, []byte{0x00, 0x02})...)
+			resp = append(resp, marshalTLV(metadataTagDefault, []byte{0x00})...)
+			return append(resp, 0x90, 0x00)
+		}
+		return []byte{0x6a, 0x82}
+	})
+	card := testCard(5, 7, 1)
+
+	// Slot
+	slot := &Slot{key: "9a", card: card, slot: slotMap["9a"]}
+	md, err := slot.Metadata()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := md.Algorithm; v != AlgorithmEC256 {
+		t.Errorf("got %v, want %v", v, AlgorithmEC256)
+	}
+	if v := md.PINPolicy; v != PINPolicyAlways {
+		t.Errorf("got %v, want %v", v, PINPolicyAlways)
+	}
+	if v := md.TouchPolicy; v != TouchPolicyNever {
+		t.Errorf("got %v, want %v", v, TouchPolicyNever)
+	}
+	if v := md.Origin; v != KeyOriginImported {
+		t.Errorf("got %v, want %v", v, KeyOriginImported)
+	}
+	if v, ok := md.PublicKey.(*ecdsa.PublicKey); !ok || !v.Equal(&privateKey.PublicKey) {
+		t.Errorf("got %v, want %v", v, privateKey.PublicKey)
+	}
+	slot = &Slot{key: "9c", card: card, slot: slotMap["9c"]}
+	if _, err := slot.Metadata(); !errors.Is(err, ErrNoKey) {
+		t.Errorf("got %v, want %v", err, ErrNoKey)
+	}
+
+	// PIN and PUK
+	pinMD, err := card.PINMetadata()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := *pinMD; v != (PINMetadata{IsDefault: true, TotalRetries: 3, RemainingRetries: 2}) {
+		t.Errorf("got %+v, want default PIN metadata", v)
+	}
+	pukMD, err := card.PUKMetadata()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := *pukMD; v != (PINMetadata{IsDefault: false, TotalRetries: 5, RemainingRetries: 5}) {
+		t.Errorf("got %+v, want custom PUK metadata", v)
+	}
+
+	// Management key
+	mkMD, err := card.ManagementKeyMetadata()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := *mkMD; v != (ManagementKeyMetadata{Algorithm: ManagementKeyAlgorithmAES256, TouchPolicy: TouchPolicyAlways}) {
+		t.Errorf("got %+v, want AES-256 management key metadata", v)
+	}
+
+	// Unsupported version
+	card = testCard(5, 2, 7)
+	if _, err := card.PINMetadata(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestDecodePublicKey(t *testing.T) {
+	if _, err := decodePublicKey(AlgorithmEC256, marshalTLV(0x86, []byte{0x04, 0x01})); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if _, err := decodePublicKey(AlgorithmEd25519, marshalTLV(0x86, make([]byte, 31))); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if _, err := decodePublicKey(AlgorithmUnknown, nil); err == nil {
+		t.Error("got nil, want an error")
+	}
+	b := append(marshalTLV(0x81, []byte{0xc1, 0x01}), marshalTLV(0x82, []byte{0x01, 0x00, 0x01})...)
+	pub, err := decodePublicKey(AlgorithmRSA2048, b)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := pub.(interface{ Size() int }).Size(); v != 2 {
+		t.Errorf("got %v, want %v", v, 2)
+	}
+}
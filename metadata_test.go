@@ -0,0 +1,50 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardMetadata(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		pinMD, err := card.PINMetadata()
+		if errors.Is(err, yubikey.ErrNotSupported) {
+			continue
+		} else if err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if pinMD.TotalRetries == 0 {
+			t.Errorf("got %v, want PIN retries", pinMD.TotalRetries)
+		}
+		if _, err := card.PUKMetadata(); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		if mkMD, err := card.ManagementKeyMetadata(); err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if mkMD.Algorithm == yubikey.ManagementKeyAlgorithmUnknown {
+			t.Errorf("got %v, want a management key algorithm", mkMD.Algorithm)
+		}
+		slots, err := card.SlotsByKey([]string{"82", "9e"})
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		for _, slot := range slots {
+			md, err := slot.Metadata()
+			if !slot.HasKey() {
+				continue
+			} else if err != nil {
+				t.Errorf("got %v, want nil", err)
+			} else if md.PINPolicy != slot.PINPolicy() {
+				t.Errorf("got %v, want %v", md.PINPolicy, slot.PINPolicy())
+			}
+		}
+	}
+}
@@ -0,0 +1,672 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// OATH instructions
+	// Ref: https://developers.yubico.com/OATH/YKOATH_Protocol.html
+	insOATHPut           = 0x01
+	insOATHDelete        = 0x02
+	insOATHSetCode       = 0x03
+	insOATHRename        = 0x05
+	insOATHList          = 0xa1
+	insOATHCalculate     = 0xa2
+	insOATHValidate      = 0xa3
+	insOATHCalculateAll  = 0xa4
+	insOATHSendRemaining = 0xa5
+
+	// OATH tags
+	tagOATHName      = 0x71
+	tagOATHListEntry = 0x72
+	tagOATHKey       = 0x73
+	tagOATHChallenge = 0x74
+	tagOATHResponse  = 0x75
+	tagOATHTruncated = 0x76
+	tagOATHHOTP      = 0x77
+	tagOATHProperty  = 0x78
+	tagOATHAlgorithm = 0x7b
+	tagOATHTouch     = 0x7c
+	tagOATHCounter   = 0x7a
+
+	// OATH properties
+	oathPropertyTouch = 0x02
+
+	// oathDefaultPeriod holds the default TOTP period.
+	oathDefaultPeriod = 30 * time.Second
+	// oathMinSecretLen holds the minimum secret length (shorter secrets are padded).
+	oathMinSecretLen = 14
+	// oathMaxNameLen holds the maximum credential id length.
+	oathMaxNameLen = 64
+	// oathPasswordIterations holds the PBKDF2 iterations of the access key derivation.
+	oathPasswordIterations = 1000
+	// oathPasswordKeyLen holds the access key length.
+	oathPasswordKeyLen = 16
+)
+
+const (
+	// OATHTypeUnknown represents the unknown OATH credential type.
+	OATHTypeUnknown OATHType = 0
+	// OATHTypeHOTP represents the counter based OATH credential type.
+	OATHTypeHOTP OATHType = 1
+	// OATHTypeTOTP represents the time based OATH credential type.
+	OATHTypeTOTP OATHType = 2
+)
+
+// OATHType represents an OATH credential type.
+type OATHType int
+
+// String returns the OATH credential type name.
+func (oathType OATHType) String() string {
+	switch oathType {
+	case OATHTypeHOTP:
+		return "HOTP"
+	case OATHTypeTOTP:
+		return "TOTP"
+	default:
+		return ""
+	}
+}
+
+// code returns the encoded value of the OATH credential type.
+func (oathType OATHType) code() byte {
+	switch oathType {
+	case OATHTypeHOTP:
+		return 0x10
+	case OATHTypeTOTP:
+		return 0x20
+	default:
+		return 0x00
+	}
+}
+
+const (
+	// OATHAlgorithmUnknown represents the unknown OATH algorithm.
+	OATHAlgorithmUnknown OATHAlgorithm = 0
+	// OATHAlgorithmSHA1 represents the HMAC-SHA1 OATH algorithm.
+	OATHAlgorithmSHA1 OATHAlgorithm = 1
+	// OATHAlgorithmSHA256 represents the HMAC-SHA256 OATH algorithm.
+	OATHAlgorithmSHA256 OATHAlgorithm = 2
+	// OATHAlgorithmSHA512 represents the HMAC-SHA512 OATH algorithm.
+	OATHAlgorithmSHA512 OATHAlgorithm = 3
+)
+
+// OATHAlgorithm represents an OATH algorithm.
+type OATHAlgorithm int
+
+// String returns the OATH algorithm name.
+func (alg OATHAlgorithm) String() string {
+	switch alg {
+	case OATHAlgorithmSHA1:
+		return "SHA1"
+	case OATHAlgorithmSHA256:
+		return "SHA256"
+	case OATHAlgorithmSHA512:
+		return "SHA512"
+	default:
+		return ""
+	}
+}
+
+// hash returns the hash function of the OATH algorithm.
+func (alg OATHAlgorithm) hash() func() hash.Hash {
+	switch alg {
+	case OATHAlgorithmSHA256:
+		return sha256.New
+	case OATHAlgorithmSHA512:
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+// oathCredentialFromByte returns the OATH credential type and algorithm by the given encoded value.
+func oathCredentialFromByte(b byte) (OATHType, OATHAlgorithm) {
+	var oathType OATHType
+	switch b & 0xf0 {
+	case 0x10:
+		oathType = OATHTypeHOTP
+	case 0x20:
+		oathType = OATHTypeTOTP
+	}
+	alg := OATHAlgorithm(b & 0x0f)
+	if alg > OATHAlgorithmSHA512 {
+		alg = OATHAlgorithmUnknown
+	}
+	return oathType, alg
+}
+
+var (
+	// ErrOATHPasswordRequired represents a missing OATH password error.
+	ErrOATHPasswordRequired = errors.New("OATH password required")
+
+	// aidOATH holds the OATH application identifier.
+	aidOATH = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01}
+)
+
+// OATHCredential represents an OATH credential.
+type OATHCredential struct {
+	// Name is the account name of the credential.
+	Name string
+	// Issuer is the optional issuer of the credential.
+	Issuer string
+	// Type is the type of the credential.
+	Type OATHType
+	// Algorithm is the algorithm of the credential. The default is SHA1.
+	Algorithm OATHAlgorithm
+	// Period is the TOTP period. The default is 30 seconds.
+	Period time.Duration
+	// Digits is the number of the code digits (6 to 8). The default is 6.
+	Digits int
+	// Counter is the initial HOTP counter.
+	Counter uint32
+	// RequireTouch indicates whether the code calculation requires touch or not.
+	RequireTouch bool
+	// Secret is the shared secret of the credential. It's only used for adding the credential.
+	Secret []byte
+}
+
+// ID returns the credential identifier which is stored in the card (i.e. 60/issuer:name).
+func (cred *OATHCredential) ID() string {
+	id := cred.Name
+	if cred.Issuer != "" {
+		id = cred.Issuer + ":" + id
+	}
+	if cred.Type == OATHTypeTOTP && cred.Period != 0 && cred.Period != oathDefaultPeriod {
+		id = fmt.Sprintf("%d/%s", int(cred.Period/time.Second), id)
+	}
+	return id
+}
+
+// parseOATHCredentialID parses the given credential identifier and sets the name, issuer and period.
+func parseOATHCredentialID(cred *OATHCredential, id string) {
+	cred.Period = 0
+	if cred.Type == OATHTypeTOTP {
+		cred.Period = oathDefaultPeriod
+		if i := strings.Index(id, "/"); i > 0 {
+			if period, err := strconv.Atoi(id[:i]); err == nil && period > 0 {
+				cred.Period = time.Duration(period) * time.Second
+				id = id[i+1:]
+			}
+		}
+	}
+	cred.Issuer, cred.Name = "", id
+	if i := strings.Index(id, ":"); i > 0 {
+		cred.Issuer, cred.Name = id[:i], id[i+1:]
+	}
+}
+
+// OATHCode represents an OATH code.
+type OATHCode struct {
+	// Value is the code.
+	Value string
+	// ValidFrom is the start of the code validity. It's zero for HOTP codes.
+	ValidFrom time.Time
+	// ValidTo is the end of the code validity. It's zero for HOTP codes.
+	ValidTo time.Time
+}
+
+// OATHCalculation represents a credential and its code which is calculated by OATH.CalculateAll.
+type OATHCalculation struct {
+	// Credential is the credential.
+	Credential *OATHCredential
+	// Code is the calculated code. It's nil for the HOTP and touch required credentials.
+	Code *OATHCode
+}
+
+// OATH represents the OATH application of a YubiKey smart card.
+type OATH struct {
+	card *Card
+	key  *Secret
+}
+
+// OATH returns the OATH application of the card.
+func (card *Card) OATH() *OATH {
+	return &OATH{card: card}
+}
+
+// List returns the OATH credentials.
+func (oath *OATH) List() ([]*OATHCredential, error) {
+	var creds []*OATHCredential
+	err := oath.do(func(s *session) error {
+		resp, err := s.send(apdu{ins: insOATHList})
+		if err != nil {
+			return fmt.Errorf("couldn't list the OATH credentials: %s", err)
+		}
+		list, err := parseTLVs(resp)
+		if err != nil {
+			return fmt.Errorf("invalid OATH credential list: %s", err)
+		}
+		for _, v := range list {
+			if v.tag != tagOATHListEntry || len(v.value) == 0 {
+				continue
+			}
+			var cred OATHCredential
+			cred.Type, cred.Algorithm = oathCredentialFromByte(v.value[0])
+			parseOATHCredentialID(&cred, string(v.value[1:]))
+			creds = append(creds, &cred)
+		}
+		return nil
+	})
+	return creds, err
+}
+
+// Calculate calculates the code of the given credential by the given time.
+// The time is ignored for the HOTP credentials. It blocks until the card is touched if the credential requires touch
+// (the card touch functions are only called for the PIV slots).
+func (oath *OATH) Calculate(cred *OATHCredential, t time.Time) (*OATHCode, error) {
+	if cred == nil {
+		return nil, errors.New("invalid OATH credential")
+	}
+	var code *OATHCode
+	err := oath.do(func(s *session) (err error) {
+		code, err = oathCalculate(s, cred, t)
+		return err
+	})
+	return code, err
+}
+
+// CalculateAll calculates the codes of the all TOTP credentials by the given time.
+// The HOTP and touch required credentials are returned without codes.
+func (oath *OATH) CalculateAll(t time.Time) ([]*OATHCalculation, error) {
+	var calcs []*OATHCalculation
+	err := oath.do(func(s *session) error {
+		resp, err := s.send(apdu{ins: insOATHCalculateAll, p2: 0x01, data: marshalTLV(tagOATHChallenge, totpChallenge(t, oathDefaultPeriod))})
+		if err != nil {
+			return fmt.Errorf("couldn't calculate the OATH codes: %s", err)
+		}
+		list, err := parseTLVs(resp)
+		if err != nil {
+			return fmt.Errorf("invalid OATH calculation: %s", err)
+		}
+		for i := 0; i+1 < len(list); i += 2 {
+			name, result := list[i], list[i+1]
+			if name.tag != tagOATHName {
+				return errors.New("invalid OATH calculation: missing name")
+			}
+			cred := OATHCredential{Type: OATHTypeTOTP}
+			switch result.tag {
+			case tagOATHHOTP:
+				cred.Type = OATHTypeHOTP
+			case tagOATHTouch:
+				cred.RequireTouch = true
+			}
+			parseOATHCredentialID(&cred, string(name.value))
+			calc := OATHCalculation{Credential: &cred}
+			if result.tag == tagOATHTruncated {
+				if cred.Period != oathDefaultPeriod {
+					// The codes are calculated by the default period so the others are recalculated
+					if calc.Code, err = oathCalculate(s, &cred, t); err != nil {
+						return err
+					}
+				} else if calc.Code, err = oathCode(result.value, t, cred.Period); err != nil {
+					return err
+				}
+			}
+			calcs = append(calcs, &calc)
+		}
+		return nil
+	})
+	return calcs, err
+}
+
+// Add adds the given OATH credential. It overwrites the credential which has the same name and issuer.
+func (oath *OATH) Add(cred OATHCredential) error {
+	if cred.Type != OATHTypeHOTP && cred.Type != OATHTypeTOTP {
+		return fmt.Errorf("unsupported OATH credential type: %d", cred.Type)
+	} else if len(cred.Secret) == 0 {
+		return errors.New("missing OATH credential secret")
+	}
+	if cred.Algorithm == OATHAlgorithmUnknown {
+		cred.Algorithm = OATHAlgorithmSHA1
+	}
+	if cred.Digits == 0 {
+		cred.Digits = 6
+	} else if cred.Digits < 6 || cred.Digits > 8 {
+		return fmt.Errorf("invalid OATH code digits: %d", cred.Digits)
+	}
+	id := cred.ID()
+	if id == "" || len(id) > oathMaxNameLen {
+		return fmt.Errorf("invalid OATH credential name: %q", id)
+	}
+
+	// Encode the credential
+	key := append([]byte{cred.Type.code() | byte(cred.Algorithm), byte(cred.Digits)}, oathSecret(cred.Algorithm, cred.Secret)...)
+	data := append(marshalTLV(tagOATHName, []byte(id)), marshalTLV(tagOATHKey, key)...)
+	if cred.RequireTouch {
+		data = append(data, tagOATHProperty, oathPropertyTouch)
+	}
+	if cred.Type == OATHTypeHOTP && cred.Counter > 0 {
+		counter := make([]byte, 4)
+		binary.BigEndian.PutUint32(counter, cred.Counter)
+		data = append(data, marshalTLV(tagOATHCounter, counter)...)
+	}
+
+	return oath.do(func(s *session) error {
+		if _, err := s.send(apdu{ins: insOATHPut, data: data}); err != nil {
+			return fmt.Errorf("couldn't add the OATH credential (%s): %s", id, err)
+		}
+		return nil
+	})
+}
+
+// Delete deletes the given OATH credential.
+func (oath *OATH) Delete(cred *OATHCredential) error {
+	if cred == nil {
+		return errors.New("invalid OATH credential")
+	}
+	return oath.do(func(s *session) error {
+		if _, err := s.send(apdu{ins: insOATHDelete, data: marshalTLV(tagOATHName, []byte(cred.ID()))}); err != nil {
+			return fmt.Errorf("couldn't delete the OATH credential (%s): %s", cred.ID(), err)
+		}
+		return nil
+	})
+}
+
+// Rename renames the given OATH credential by the given name and issuer.
+// It requires firmware 5.3 or later. The credential is updated after it's renamed.
+func (oath *OATH) Rename(cred *OATHCredential, name, issuer string) error {
+	if cred == nil {
+		return errors.New("invalid OATH credential")
+	} else if !oath.card.isVersion(5, 3, 0) {
+		return ErrNotSupported
+	}
+	renamed := *cred
+	renamed.Name, renamed.Issuer = name, issuer
+	if id := renamed.ID(); name == "" || len(id) > oathMaxNameLen {
+		return fmt.Errorf("invalid OATH credential name: %q", id)
+	}
+
+	return oath.do(func(s *session) error {
+		data := append(marshalTLV(tagOATHName, []byte(cred.ID())), marshalTLV(tagOATHName, []byte(renamed.ID()))...)
+		if _, err := s.send(apdu{ins: insOATHRename, data: data}); err != nil {
+			return fmt.Errorf("couldn't rename the OATH credential (%s): %s", cred.ID(), err)
+		}
+		*cred = renamed
+		return nil
+	})
+}
+
+// Validate validates the given OATH password. The password is used for the later requests.
+// The string can't be zeroized so ValidateSecret should be preferred.
+func (oath *OATH) Validate(password string) error {
+	secret := NewSecretString(password)
+	defer secret.Zero()
+	return oath.ValidateSecret(secret)
+}
+
+// ValidateSecret validates the given OATH password. The derived access key is used for the later requests.
+func (oath *OATH) ValidateSecret(password *Secret) error {
+	return oath.card.withSession(aidOATH, func(s *session) error {
+		s.insMore = insOATHSendRemaining
+
+		// Derive the access key and validate it
+		salt, _, err := oathSelection(s)
+		if err != nil {
+			return err
+		}
+		key := s.keep(oathPasswordKey(password.Bytes(), salt))
+		if err := oathValidate(s, key); err != nil {
+			return err
+		}
+		oath.setKey(NewSecret(key))
+
+		return nil
+	})
+}
+
+// SetPassword sets the OATH password. The current password must be validated before if there is one.
+// The string can't be zeroized so SetPasswordSecret should be preferred.
+func (oath *OATH) SetPassword(password string) error {
+	secret := NewSecretString(password)
+	defer secret.Zero()
+	return oath.SetPasswordSecret(secret)
+}
+
+// SetPasswordSecret sets the given OATH password. The current password must be validated before if there is one.
+func (oath *OATH) SetPasswordSecret(password *Secret) error {
+	if password.IsEmpty() {
+		return errors.New("missing OATH password")
+	}
+	return oath.do(func(s *session) error {
+		salt, _, err := oathSelection(s)
+		if err != nil {
+			return err
+		}
+		key := s.keep(oathPasswordKey(password.Bytes(), salt))
+		challenge := make([]byte, 8)
+		if _, err := rand.Read(challenge); err != nil {
+			return fmt.Errorf("couldn't generate a challenge: %s", err)
+		}
+		data := s.keep(bytes.Join([][]byte{
+			s.keep(marshalTLV(tagOATHKey, s.keep(append([]byte{OATHTypeTOTP.code() | byte(OATHAlgorithmSHA1)}, key...)))),
+			marshalTLV(tagOATHChallenge, challenge),
+			marshalTLV(tagOATHResponse, oathHMAC(OATHAlgorithmSHA1, key, challenge)),
+		}, nil))
+		if _, err := s.send(apdu{ins: insOATHSetCode, data: data}); err != nil {
+			return fmt.Errorf("couldn't set the OATH password: %s", err)
+		}
+		oath.setKey(NewSecret(key))
+		return nil
+	})
+}
+
+// ClearPassword clears the OATH password. The current password must be validated before.
+func (oath *OATH) ClearPassword() error {
+	return oath.do(func(s *session) error {
+		if _, err := s.send(apdu{ins: insOATHSetCode, data: marshalTLV(tagOATHKey, nil)}); err != nil {
+			return fmt.Errorf("couldn't clear the OATH password: %s", err)
+		}
+		oath.setKey(nil)
+		return nil
+	})
+}
+
+// setKey sets the access key and zeroizes the previous one.
+func (oath *OATH) setKey(key *Secret) {
+	oath.key.Zero()
+	oath.key = key
+}
+
+// do opens an OATH session, validates the password (if any) and calls the given function.
+func (oath *OATH) do(f func(s *session) error) error {
+	return oath.card.withSession(aidOATH, func(s *session) error {
+		s.insMore = insOATHSendRemaining
+
+		// Validate the password if it's set
+		_, locked, err := oathSelection(s)
+		if err != nil {
+			return err
+		}
+		if locked {
+			if oath.key.IsEmpty() {
+				return ErrOATHPasswordRequired
+			} else if err := oathValidate(s, oath.key.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		return f(s)
+	})
+}
+
+// oathSelection returns the device salt and whether the OATH password is set or not by the given session.
+func oathSelection(s *session) (salt []byte, locked bool, err error) {
+	list, err := parseTLVs(s.selected)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid OATH selection: %s", err)
+	}
+	salt, ok := list.get(tagOATHName)
+	if !ok {
+		return nil, false, errors.New("invalid OATH selection: missing salt")
+	}
+	_, locked = list.get(tagOATHChallenge)
+	return salt, locked, nil
+}
+
+// oathValidate validates the given access key by the given session.
+// It uses the mutual authentication so the card is authenticated too.
+func oathValidate(s *session, key []byte) error {
+	list, err := parseTLVs(s.selected)
+	if err != nil {
+		return fmt.Errorf("invalid OATH selection: %s", err)
+	}
+	cardChallenge, ok := list.get(tagOATHChallenge)
+	if !ok {
+		return errors.New("OATH password isn't set")
+	}
+	alg := OATHAlgorithmSHA1
+	if v, ok := list.get(tagOATHAlgorithm); ok && len(v) == 1 {
+		_, alg = oathCredentialFromByte(v[0])
+	}
+
+	// Send the response with a challenge and verify the card response
+	challenge := make([]byte, 8)
+	if _, err := rand.Read(challenge); err != nil {
+		return fmt.Errorf("couldn't generate a challenge: %s", err)
+	}
+	data := append(marshalTLV(tagOATHResponse, oathHMAC(alg, key, cardChallenge)), marshalTLV(tagOATHChallenge, challenge)...)
+	resp, err := s.send(apdu{ins: insOATHValidate, data: data})
+	if err != nil {
+		if isStatus(err, 0x6984) || isStatus(err, swSecurityStatus) {
+			// validate: smart card error 6984: referenced data invalidated
+			return ErrAuthError
+		}
+		return fmt.Errorf("couldn't validate the OATH password: %s", err)
+	}
+	if list, err = parseTLVs(resp); err != nil {
+		return fmt.Errorf("invalid OATH validation: %s", err)
+	}
+	response, _ := list.get(tagOATHResponse)
+	if subtle.ConstantTimeCompare(response, oathHMAC(alg, key, challenge)) != 1 {
+		return errors.New("invalid OATH validation response")
+	}
+	return nil
+}
+
+// oathCalculate calculates the code of the given credential by the given session and time.
+func oathCalculate(s *session, cred *OATHCredential, t time.Time) (*OATHCode, error) {
+	var challenge []byte
+	period := cred.Period
+	if cred.Type == OATHTypeTOTP {
+		if period == 0 {
+			period = oathDefaultPeriod
+		}
+		challenge = totpChallenge(t, period)
+	}
+	data := append(marshalTLV(tagOATHName, []byte(cred.ID())), marshalTLV(tagOATHChallenge, challenge)...)
+	resp, err := s.send(apdu{ins: insOATHCalculate, p2: 0x01, data: data})
+	if err != nil {
+		if isStatus(err, swNotFound) {
+			return nil, fmt.Errorf("OATH credential not found: %s", cred.ID())
+		}
+		return nil, fmt.Errorf("couldn't calculate the OATH code (%s): %s", cred.ID(), err)
+	}
+	list, err := parseTLVs(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OATH calculation: %s", err)
+	}
+	truncated, ok := list.get(tagOATHTruncated)
+	if !ok {
+		return nil, errors.New("invalid OATH calculation: missing response")
+	}
+	if cred.Type != OATHTypeTOTP {
+		return oathCode(truncated, time.Time{}, 0)
+	}
+	return oathCode(truncated, t, period)
+}
+
+// oathCode returns the OATH code by the given truncated response, time and period.
+func oathCode(truncated []byte, t time.Time, period time.Duration) (*OATHCode, error) {
+	if len(truncated) != 5 || truncated[0] < 6 || truncated[0] > 8 {
+		return nil, errors.New("invalid OATH calculation: invalid response")
+	}
+	digits := int(truncated[0])
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	value := (binary.BigEndian.Uint32(truncated[1:]) & 0x7fffffff) % mod
+	code := OATHCode{Value: fmt.Sprintf("%0*d", digits, value)}
+	if period > 0 {
+		code.ValidFrom = time.Unix(t.Unix()-t.Unix()%int64(period/time.Second), 0)
+		code.ValidTo = code.ValidFrom.Add(period)
+	}
+	return &code, nil
+}
+
+// totpChallenge returns the TOTP challenge by the given time and period.
+func totpChallenge(t time.Time, period time.Duration) []byte {
+	challenge := make([]byte, 8)
+	binary.BigEndian.PutUint64(challenge, uint64(t.Unix()/int64(period/time.Second)))
+	return challenge
+}
+
+// oathSecret returns the secret which is shortened or padded as the card expects.
+func oathSecret(alg OATHAlgorithm, secret []byte) []byte {
+	h := alg.hash()()
+	if len(secret) > h.BlockSize() {
+		h.Write(secret)
+		secret = h.Sum(nil)
+	}
+	if len(secret) < oathMinSecretLen {
+		secret = append(append([]byte(nil), secret...), make([]byte, oathMinSecretLen-len(secret))...)
+	}
+	return secret
+}
+
+// oathHMAC returns the HMAC of the given message by the given algorithm and key.
+func oathHMAC(alg OATHAlgorithm, key, message []byte) []byte {
+	mac := hmac.New(alg.hash(), key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// oathPasswordKey derives the OATH access key by the given password and device salt (PBKDF2 with HMAC-SHA1).
+func oathPasswordKey(password, salt []byte) []byte {
+	return pbkdf2Key(sha1.New, password, salt, oathPasswordIterations, oathPasswordKeyLen)
+}
+
+// pbkdf2Key derives a key by the given hash function, password, salt, iterations and key length.
+// Ref: https://www.rfc-editor.org/rfc/rfc8018#section-5.2
+func pbkdf2Key(h func() hash.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	mac := hmac.New(h, password)
+	key := make([]byte, 0, keyLen+mac.Size())
+	for block := uint32(1); len(key) < keyLen; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := mac.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+		zero(t)
+		zero(u)
+	}
+	zero(key[keyLen:])
+	return key[:keyLen]
+}
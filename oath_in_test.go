@@ -0,0 +1,336 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeOATHCredential represents a fake OATH credential.
+type fakeOATHCredential struct {
+	id      string
+	key     []byte
+	touch   bool
+	counter uint32
+}
+
+// fakeOATH represents a fake OATH application which replies the OATH requests.
+type fakeOATH struct {
+	ft        *fakeTransport
+	salt      []byte
+	challenge []byte
+	key       []byte
+	validated bool
+	creds     []*fakeOATHCredential
+}
+
+// useFakeOATH replaces the smart card transport with a fake OATH application during the test.
+func useFakeOATH(t *testing.T) *fakeOATH {
+	t.Helper()
+	fo := &fakeOATH{salt: []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, challenge: []byte{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11}}
+	fo.ft = useFakeTransport(t, func(req []byte) []byte {
+		return fo.handle(t, req)
+	})
+	fo.ft.selected = fo.selected
+	return fo
+}
+
+// selected returns the selection response and resets the validation.
+func (fo *fakeOATH) selected() []byte {
+	fo.validated = false
+	resp := append(marshalTLV(0x79, []byte{0x05, 0x07, 0x01}), marshalTLV(tagOATHName, fo.salt)...)
+	if fo.key != nil {
+		resp = append(resp, marshalTLV(tagOATHChallenge, fo.challenge)...)
+		resp = append(resp, marshalTLV(tagOATHAlgorithm, []byte{0x01})...)
+	}
+	return resp
+}
+
+// credential returns the credential by the given id.
+func (fo *fakeOATH) credential(id []byte) (int, *fakeOATHCredential) {
+	for i, v := range fo.creds {
+		if v.id == string(id) {
+			return i, v
+		}
+	}
+	return -1, nil
+}
+
+// truncated returns the truncated response of the given credential by the given challenge.
+func (fo *fakeOATH) truncated(cred *fakeOATHCredential, challenge []byte) []byte {
+	_, alg := oathCredentialFromByte(cred.key[0])
+	if cred.key[0]&0xf0 == OATHTypeHOTP.code() {
+		challenge = make([]byte, 8)
+		binary.BigEndian.PutUint64(challenge, uint64(cred.counter))
+		cred.counter++
+	}
+	h := oathHMAC(alg, cred.key[2:], challenge)
+	offset := h[len(h)-1] & 0x0f
+	return append([]byte{cred.key[1]}, h[offset:offset+4]...)
+}
+
+// handle handles the given OATH request.
+func (fo *fakeOATH) handle(t *testing.T, req []byte) []byte {
+	t.Helper()
+	if fo.key != nil && !fo.validated && req[1] != insOATHValidate {
+		return []byte{0x69, 0x82}
+	}
+	var data []byte
+	if len(req) > 5 {
+		data = req[5 : 5+int(req[4])]
+	}
+	list, _ := parseTLVs(data)
+	switch req[1] {
+	case insOATHPut:
+		// The property isn't BER-TLV encoded so the name and key are parsed manually
+		name := data[2 : 2+int(data[1])]
+		rest := data[2+len(name):]
+		key := rest[2 : 2+int(rest[1])]
+		rest = rest[2+len(key):]
+		cred := &fakeOATHCredential{id: string(name), key: append([]byte(nil), key...)}
+		if len(rest) >= 2 && rest[0] == tagOATHProperty {
+			cred.touch = rest[1]&oathPropertyTouch != 0
+			rest = rest[2:]
+		}
+		if list, _ := parseTLVs(rest); list != nil {
+			if v, ok := list.get(tagOATHCounter); ok {
+				cred.counter = binary.BigEndian.Uint32(v)
+			}
+		}
+		if i, _ := fo.credential(name); i >= 0 {
+			fo.creds[i] = cred
+		} else {
+			fo.creds = append(fo.creds, cred)
+		}
+		return []byte{0x90, 0x00}
+	case insOATHDelete:
+		name, _ := list.get(tagOATHName)
+		i, _ := fo.credential(name)
+		if i < 0 {
+			return []byte{0x6a, 0x82}
+		}
+		fo.creds = append(fo.creds[:i], fo.creds[i+1:]...)
+		return []byte{0x90, 0x00}
+	case insOATHRename:
+		_, cred := fo.credential(list[0].value)
+		if cred == nil {
+			return []byte{0x6a, 0x82}
+		}
+		cred.id = string(list[1].value)
+		return []byte{0x90, 0x00}
+	case insOATHList:
+		var resp []byte
+		for _, v := range fo.creds {
+			resp = append(resp, marshalTLV(tagOATHListEntry, append([]byte{v.key[0]}, v.id...))...)
+		}
+		return append(resp, 0x90, 0x00)
+	case insOATHCalculate:
+		name, _ := list.get(tagOATHName)
+		challenge, _ := list.get(tagOATHChallenge)
+		_, cred := fo.credential(name)
+		if cred == nil {
+			return []byte{0x6a, 0x82}
+		}
+		return append(marshalTLV(tagOATHTruncated, fo.truncated(cred, challenge)), 0x90, 0x00)
+	case insOATHCalculateAll:
+		challenge, _ := list.get(tagOATHChallenge)
+		var resp []byte
+		for _, v := range fo.creds {
+			resp = append(resp, marshalTLV(tagOATHName, []byte(v.id))...)
+			switch {
+			case v.key[0]&0xf0 == OATHTypeHOTP.code():
+				resp = append(resp, marshalTLV(tagOATHHOTP, v.key[1:2])...)
+			case v.touch:
+				resp = append(resp, marshalTLV(tagOATHTouch, v.key[1:2])...)
+			default:
+				resp = append(resp, marshalTLV(tagOATHTruncated, fo.truncated(v, challenge))...)
+			}
+		}
+		return append(resp, 0x90, 0x00)
+	case insOATHSetCode:
+		key, _ := list.get(tagOATHKey)
+		if len(key) == 0 {
+			fo.key = nil
+			return []byte{0x90, 0x00}
+		}
+		challenge, _ := list.get(tagOATHChallenge)
+		response, _ := list.get(tagOATHResponse)
+		if !bytes.Equal(response, oathHMAC(OATHAlgorithmSHA1, key[1:], challenge)) {
+			return []byte{0x6a, 0x80}
+		}
+		fo.key = append([]byte(nil), key[1:]...)
+		return []byte{0x90, 0x00}
+	case insOATHValidate:
+		response, _ := list.get(tagOATHResponse)
+		challenge, _ := list.get(tagOATHChallenge)
+		if fo.key == nil || !bytes.Equal(response, oathHMAC(OATHAlgorithmSHA1, fo.key, fo.challenge)) {
+			return []byte{0x69, 0x84}
+		}
+		fo.validated = true
+		return append(marshalTLV(tagOATHResponse, oathHMAC(OATHAlgorithmSHA1, fo.key, challenge)), 0x90, 0x00)
+	}
+	return []byte{0x6d, 0x00}
+}
+
+func TestOATH(t *testing.T) {
+	fo := useFakeOATH(t)
+	oath := testCard(5, 7, 1).OATH()
+
+	// RFC 4226 and RFC 6238 test vectors
+	secret := []byte("12345678901234567890")
+	if err := oath.Add(OATHCredential{Name: "hotp", Type: OATHTypeHOTP, Secret: secret}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if err := oath.Add(OATHCredential{Name: "alice", Issuer: "Example", Type: OATHTypeTOTP, Digits: 8, Secret: secret}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if err := oath.Add(OATHCredential{Name: "bob", Type: OATHTypeTOTP, Period: 60 * time.Second, Algorithm: OATHAlgorithmSHA256, RequireTouch: true, Secret: secret}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !fo.creds[2].touch || fo.creds[2].id != "60/bob" {
+		t.Errorf("got %+v, want a touch required credential", fo.creds[2])
+	}
+
+	// List
+	creds, err := oath.List()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(creds) != 3 {
+		t.Fatalf("got %v, want 3", len(creds))
+	}
+	if v := creds[1]; v.Name != "alice" || v.Issuer != "Example" || v.Type != OATHTypeTOTP || v.Algorithm != OATHAlgorithmSHA1 || v.Period != 30*time.Second {
+		t.Errorf("got %+v, want alice", v)
+	}
+	if v := creds[2]; v.Name != "bob" || v.Period != 60*time.Second || v.Algorithm != OATHAlgorithmSHA256 {
+		t.Errorf("got %+v, want bob", v)
+	}
+
+	// Calculate
+	if code, err := oath.Calculate(creds[0], time.Now()); err != nil || code.Value != "755224" || !code.ValidTo.IsZero() {
+		t.Errorf("got %+v %v, want 755224", code, err)
+	}
+	if code, err := oath.Calculate(creds[1], time.Unix(59, 0)); err != nil || code.Value != "94287082" {
+		t.Errorf("got %+v %v, want 94287082", code, err)
+	} else if !code.ValidFrom.Equal(time.Unix(30, 0)) || !code.ValidTo.Equal(time.Unix(60, 0)) {
+		t.Errorf("got %v %v, want the code validity", code.ValidFrom, code.ValidTo)
+	}
+	calcs, err := oath.CalculateAll(time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(calcs) != 3 || calcs[0].Code != nil || calcs[0].Credential.Type != OATHTypeHOTP || calcs[1].Code == nil || calcs[1].Code.Value != "94287082" || calcs[2].Code != nil || !calcs[2].Credential.RequireTouch {
+		t.Errorf("got %+v, want the calculations", calcs)
+	}
+
+	// Rename and delete
+	if err := oath.Rename(creds[1], "carol", ""); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if creds[1].ID() != "carol" || fo.creds[1].id != "carol" {
+		t.Errorf("got %v, want carol", creds[1].ID())
+	}
+	if err := oath.Delete(creds[0]); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if len(fo.creds) != 2 {
+		t.Errorf("got %v, want 2", len(fo.creds))
+	}
+	if err := oath.Delete(creds[0]); err == nil {
+		t.Error("got nil, want an error")
+	}
+
+	// Invalid credentials
+	if err := oath.Add(OATHCredential{Name: "x", Type: OATHTypeTOTP}); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if err := oath.Add(OATHCredential{Name: "x", Secret: secret}); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if err := oath.Add(OATHCredential{Name: "x", Type: OATHTypeTOTP, Digits: 9, Secret: secret}); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
+
+func TestOATHPassword(t *testing.T) {
+	fo := useFakeOATH(t)
+	card := testCard(5, 7, 1)
+	oath := card.OATH()
+
+	if err := oath.SetPassword("password"); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := oathPasswordKey([]byte("password"), fo.salt); !bytes.Equal(fo.key, want) {
+		t.Errorf("got %x, want %x", fo.key, want)
+	}
+	if _, err := oath.List(); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+
+	// Another handle
+	other := card.OATH()
+	if _, err := other.List(); !errors.Is(err, ErrOATHPasswordRequired) {
+		t.Errorf("got %v, want %v", err, ErrOATHPasswordRequired)
+	}
+	if err := other.Validate("wrong"); !errors.Is(err, ErrAuthError) {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+	if err := other.ValidateSecret(NewSecretString("password")); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	key := other.key.Bytes()
+	if err := other.ClearPassword(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	} else if fo.key != nil {
+		t.Errorf("got %x, want nil", fo.key)
+	}
+	// The previous access key is zeroized
+	if !bytes.Equal(key, make([]byte, len(key))) || other.key != nil {
+		t.Errorf("got %x, want zeros", key)
+	}
+}
+
+func TestOATHPasswordKey(t *testing.T) {
+	want, _ := hex.DecodeString("ed1b5a43d3a86504dd13c9da7606bd35")
+	if key := oathPasswordKey([]byte("password"), []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}); !bytes.Equal(key, want) {
+		t.Errorf("got %x, want %x", key, want)
+	}
+}
+
+func TestOATHCredentialID(t *testing.T) {
+	table := []struct {
+		cred OATHCredential
+		id   string
+	}{
+		{OATHCredential{Name: "alice", Type: OATHTypeTOTP, Period: 30 * time.Second}, "alice"},
+		{OATHCredential{Name: "alice", Issuer: "Example", Type: OATHTypeTOTP, Period: 30 * time.Second}, "Example:alice"},
+		{OATHCredential{Name: "alice", Issuer: "Example", Type: OATHTypeTOTP, Period: 15 * time.Second}, "15/Example:alice"},
+		{OATHCredential{Name: "alice@example.com", Type: OATHTypeHOTP}, "alice@example.com"},
+	}
+	for _, v := range table {
+		if id := v.cred.ID(); id != v.id {
+			t.Errorf("got %v, want %v", id, v.id)
+		}
+		cred := OATHCredential{Type: v.cred.Type}
+		parseOATHCredentialID(&cred, v.id)
+		if cred.Name != v.cred.Name || cred.Issuer != v.cred.Issuer || cred.Period != v.cred.Period {
+			t.Errorf("got %+v, want %+v", cred, v.cred)
+		}
+	}
+}
+
+func TestOATHSecret(t *testing.T) {
+	if v := oathSecret(OATHAlgorithmSHA1, []byte{0x01}); len(v) != oathMinSecretLen {
+		t.Errorf("got %v, want %v", len(v), oathMinSecretLen)
+	}
+	if v := oathSecret(OATHAlgorithmSHA1, make([]byte, 65)); len(v) != 20 {
+		t.Errorf("got %v, want 20", len(v))
+	}
+	if v := oathSecret(OATHAlgorithmSHA512, make([]byte, 65)); len(v) != 65 {
+		t.Errorf("got %v, want 65", len(v))
+	}
+}
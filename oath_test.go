@@ -0,0 +1,56 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardOATH(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		if _, err := card.OATH().List(); err != nil && !errors.Is(err, yubikey.ErrOATHPasswordRequired) {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+}
+
+func TestOATHTypeString(t *testing.T) {
+	table := []struct {
+		oathType yubikey.OATHType
+		want     string
+	}{
+		{yubikey.OATHTypeUnknown, ""},
+		{yubikey.OATHTypeHOTP, "HOTP"},
+		{yubikey.OATHTypeTOTP, "TOTP"},
+	}
+	for _, v := range table {
+		if s := v.oathType.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
+
+func TestOATHAlgorithmString(t *testing.T) {
+	table := []struct {
+		alg  yubikey.OATHAlgorithm
+		want string
+	}{
+		{yubikey.OATHAlgorithmUnknown, ""},
+		{yubikey.OATHAlgorithmSHA1, "SHA1"},
+		{yubikey.OATHAlgorithmSHA256, "SHA256"},
+		{yubikey.OATHAlgorithmSHA512, "SHA512"},
+	}
+	for _, v := range table {
+		if s := v.alg.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PIV instructions
+	insGetData = 0xcb
+	insPutData = 0xdb
+
+	// Data object tags
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/get-data.html
+	tagObjectID    = 0x5c
+	tagObjectData  = 0x53
+	tagCertificate = 0x70
+
+	// Yubico data objects
+	objectAdminData   = 0x5fff00
+	objectAttestation = 0x5fff01
+)
+
+const (
+	// ObjectDiscovery represents the Discovery data object.
+	ObjectDiscovery uint32 = 0x7e
+	// ObjectCHUID represents the Card Holder Unique Identifier data object.
+	ObjectCHUID uint32 = 0x5fc102
+	// ObjectSecurity represents the Security data object.
+	ObjectSecurity uint32 = 0x5fc106
+	// ObjectCCC represents the Card Capability Container data object.
+	ObjectCCC uint32 = 0x5fc107
+	// ObjectPrinted represents the Printed Information data object.
+	// The PIN-protected management key is stored in this object so it requires the PIN for reading.
+	ObjectPrinted uint32 = 0x5fc109
+	// ObjectFacialImage represents the Cardholder Facial Image data object.
+	ObjectFacialImage uint32 = 0x5fc108
+	// ObjectFingerprints represents the Cardholder Fingerprints data object.
+	ObjectFingerprints uint32 = 0x5fc103
+	// ObjectKeyHistory represents the Key History data object.
+	ObjectKeyHistory uint32 = 0x5fc10c
+)
+
+// ErrNoObject represents a missing data object error.
+var ErrNoObject = errors.New("data object not found")
+
+// ReadObject returns the content of the given data object.
+// If the data object requires the PIN (i.e. Printed Information) then the card PIN is verified.
+// It returns ErrNoObject if the data object doesn't exist.
+func (card *Card) ReadObject(object uint32) ([]byte, error) {
+	// Read the data object
+	var data []byte
+	read := func(s *session) error {
+		var err error
+		data, err = getData(s, object)
+		if isStatus(err, swNotFound) {
+			return ErrNoObject
+		} else if err != nil && !isStatus(err, swSecurityStatus) {
+			return fmt.Errorf("couldn't read the data object (%x): %s", object, err)
+		}
+		return err
+	}
+	err := card.withSession(aidPIV, read)
+	if isStatus(err, swSecurityStatus) {
+		// Resolve the PIN and read the data object again by a new session
+		err = card.withPIN(true, func(verify func(s *session) error) error {
+			return card.withSession(aidPIV, func(s *session) error {
+				if err := verify(s); err != nil {
+					return card.pinError(err, ErrInvalidPIN)
+				}
+				err := read(s)
+				if isStatus(err, swSecurityStatus) {
+					return fmt.Errorf("couldn't read the data object (%x): %s", object, err)
+				}
+				return err
+			})
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// WriteObject writes the given content into the given data object by the card management key.
+// Empty content deletes the data object. The Key History is updated if a retired slot certificate is written.
+func (card *Card) WriteObject(object uint32, data []byte) error {
+	// Connect to the smart card
+	return card.withSession(aidPIV, func(s *session) error {
+		// Write the data object
+		if err := card.authenticate(s, nil); err != nil {
+			return err
+		}
+		if err := putData(s, object, data); err != nil {
+			return fmt.Errorf("couldn't write the data object (%x): %s", object, managementKeyError(err))
+		}
+		for _, v := range slotMap {
+			if v.Object == object && isRetiredSlot(v.Key) {
+				// The retired slot certificates are counted by the key history
+				return card.updateKeyHistory(s)
+			}
+		}
+
+		return nil
+	})
+}
+
+// getData returns the content of the given data object.
+func getData(s *session, object uint32) ([]byte, error) {
+	resp, err := s.send(apdu{ins: insGetData, p1: 0x3f, p2: 0xff, data: objectID(object)})
+	if err != nil {
+		return nil, err
+	}
+	list, err := parseTLVs(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data object (%x): %s", object, err)
+	}
+	data, ok := list.get(objectTag(object))
+	if !ok {
+		return nil, fmt.Errorf("invalid data object (%x): missing data", object)
+	}
+	return data, nil
+}
+
+// readCertificate returns the certificate of the given slot certificate data object.
+// It returns ErrNoObject if the data object doesn't exist.
+func readCertificate(s *session, object uint32) (*x509.Certificate, error) {
+	data, err := getData(s, object)
+	if isStatus(err, swNotFound) {
+		return nil, ErrNoObject
+	} else if err != nil {
+		return nil, err
+	}
+	list, err := parseTLVs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate object (%x): %s", object, err)
+	}
+	der, ok := list.get(tagCertificate)
+	if !ok {
+		return nil, fmt.Errorf("invalid certificate object (%x): missing certificate", object)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate object (%x): %s", object, err)
+	}
+	return cert, nil
+}
+
+// putData writes the given content into the given data object.
+// Empty content deletes the data object. The session must be authenticated by the management key.
+func putData(s *session, object uint32, data []byte) error {
+	cmd := apdu{ins: insPutData, p1: 0x3f, p2: 0xff}
+	if tag := objectTag(object); tag == tagObjectData {
+		cmd.data = append(objectID(object), marshalTLV(tag, data)...)
+	} else {
+		// The data objects which have their own tags (i.e. Discovery) are written without the identifier
+		cmd.data = marshalTLV(tag, data)
+	}
+	_, err := s.send(cmd)
+	return err
+}
+
+// objectTag returns the tag of the given data object content.
+// The content of the short data objects (i.e. Discovery) is wrapped by the object tag instead of 0x53.
+func objectTag(object uint32) uint32 {
+	if object <= 0xffff {
+		return object
+	}
+	return tagObjectData
+}
+
+// objectID returns the BER-TLV encoded data object identifier.
+func objectID(object uint32) []byte {
+	switch {
+	case object > 0xffff:
+		return marshalTLV(tagObjectID, []byte{byte(object >> 16), byte(object >> 8), byte(object)})
+	case object > 0xff:
+		return marshalTLV(tagObjectID, []byte{byte(object >> 8), byte(object)})
+	default:
+		return marshalTLV(tagObjectID, []byte{byte(object)})
+	}
+}
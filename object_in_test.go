@@ -0,0 +1,109 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fakeObjects represents fake card data objects which reply the GET DATA and PUT DATA requests.
+type fakeObjects map[uint32][]byte
+
+// handle handles the given data object request. It returns nil if the request isn't handled.
+func (fo fakeObjects) handle(req []byte) []byte {
+	if req[1] != insGetData && req[1] != insPutData {
+		return nil
+	}
+	list, _ := parseTLVs(req[5 : 5+int(req[4])])
+	id, _ := list.get(tagObjectID)
+	var object uint32
+	for _, v := range id {
+		object = object<<8 | uint32(v)
+	}
+	if req[1] == insGetData {
+		data, ok := fo[object]
+		if !ok {
+			return []byte{0x6a, 0x82}
+		}
+		return append(marshalTLV(tagObjectData, data), 0x90, 0x00)
+	}
+	if data, _ := list.get(tagObjectData); len(data) == 0 {
+		delete(fo, object)
+	} else {
+		fo[object] = append([]byte(nil), data...)
+	}
+	return []byte{0x90, 0x00}
+}
+
+func TestObjectID(t *testing.T) {
+	table := []struct {
+		object uint32
+		want   []byte
+	}{
+		{0x7e, []byte{0x5c, 0x01, 0x7e}},
+		{0x7f61, []byte{0x5c, 0x02, 0x7f, 0x61}},
+		{0x5fc109, []byte{0x5c, 0x03, 0x5f, 0xc1, 0x09}},
+	}
+	for _, v := range table {
+		if b := objectID(v.object); !bytes.Equal(b, v.want) {
+			t.Errorf("got %x, want %x", b, v.want)
+		}
+	}
+}
+
+func TestCardReadWriteObject(t *testing.T) {
+	fmk := &fakeManagementKey{alg: ManagementKeyAlgorithmAES192, key: DefaultManagementKey[:]}
+	objects := fakeObjects{ObjectCHUID: {0x30, 0x00}}
+	var verified bool
+	var discovery []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := fmk.handle(t, req); resp != nil {
+			return resp
+		}
+		switch {
+		case req[1] == insVerify:
+			verified = true
+			return []byte{0x90, 0x00}
+		case req[1] == insGetData && req[9] == 0x09 && !verified:
+			return []byte{0x69, 0x82}
+		case req[1] == insPutData && req[5] == 0x7e:
+			discovery = req[5 : 5+int(req[4])]
+			return []byte{0x90, 0x00}
+		case req[1] == insPutData && !fmk.authenticated:
+			return []byte{0x69, 0x82}
+		}
+		if resp := objects.handle(req); resp != nil {
+			return resp
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+
+	if data, err := card.ReadObject(ObjectCHUID); err != nil || !bytes.Equal(data, []byte{0x30, 0x00}) {
+		t.Errorf("got %x %v, want the object", data, err)
+	}
+	if _, err := card.ReadObject(ObjectCCC); !errors.Is(err, ErrNoObject) {
+		t.Errorf("got %v, want %v", err, ErrNoObject)
+	}
+
+	// Write
+	if err := card.WriteObject(ObjectPrinted, []byte{0x01, 0x01, 0x41}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if data, err := card.ReadObject(ObjectPrinted); err != nil || !bytes.Equal(data, []byte{0x01, 0x01, 0x41}) || !verified {
+		t.Errorf("got %x %v, want the object", data, err)
+	}
+	if err := card.WriteObject(ObjectDiscovery, []byte{0x4f, 0x00}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := []byte{0x7e, 0x02, 0x4f, 0x00}; !bytes.Equal(discovery, want) {
+		t.Errorf("got %x, want %x", discovery, want)
+	}
+	card.SetManKey(bytes.Repeat([]byte{0x01}, 24))
+	if err := card.WriteObject(ObjectCHUID, nil); !errors.Is(err, ErrAuthError) {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+}
@@ -0,0 +1,111 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardReadObject(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		data, err := card.ReadObject(yubikey.ObjectCHUID)
+		if errors.Is(err, yubikey.ErrNoObject) {
+			continue
+		} else if err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if _, err := yubikey.ParseCHUID(data); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+}
+
+func TestCHUID(t *testing.T) {
+	chuid, err := yubikey.NewCHUID()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	chuid.OrgID = []byte{0x01, 0x02}
+	parsed, err := yubikey.ParseCHUID(chuid.Marshal())
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !bytes.Equal(parsed.FASCN, chuid.FASCN) || parsed.GUID != chuid.GUID || !parsed.Expiration.Equal(chuid.Expiration) || !bytes.Equal(parsed.OrgID, chuid.OrgID) {
+		t.Errorf("got %+v, want %+v", parsed, chuid)
+	}
+	if other, _ := yubikey.NewCHUID(); other.GUID == chuid.GUID {
+		t.Error("got the same GUID, want a random GUID")
+	}
+	if _, err := yubikey.ParseCHUID([]byte{0x30, 0x01, 0x00}); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
+
+func TestCCC(t *testing.T) {
+	ccc, err := yubikey.NewCCC()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(ccc.CardIdentifier) != 21 {
+		t.Errorf("got %v, want 21", len(ccc.CardIdentifier))
+	}
+	parsed, err := yubikey.ParseCCC(ccc.Marshal())
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !bytes.Equal(parsed.CardIdentifier, ccc.CardIdentifier) || parsed.ContainerVersion != 0x21 || parsed.GrammarVersion != 0x21 || parsed.DataModel != 0x10 {
+		t.Errorf("got %+v, want %+v", parsed, ccc)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	table := []struct {
+		discovery *yubikey.Discovery
+		policy    []byte
+	}{
+		{yubikey.NewDiscovery(), []byte{0x40, 0x00}},
+		{&yubikey.Discovery{AID: []byte{0xa0}, PIVPIN: true, GlobalPIN: true}, []byte{0x60, 0x10}},
+		{&yubikey.Discovery{AID: []byte{0xa0}, PIVPIN: true, GlobalPIN: true, GlobalPINPrimary: true}, []byte{0x60, 0x20}},
+	}
+	for _, v := range table {
+		b := v.discovery.Marshal()
+		if !bytes.HasSuffix(b, append([]byte{0x5f, 0x2f, 0x02}, v.policy...)) {
+			t.Errorf("got %x, want the policy %x", b, v.policy)
+		}
+		parsed, err := yubikey.ParseDiscovery(b)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if parsed.PIVPIN != v.discovery.PIVPIN || parsed.GlobalPIN != v.discovery.GlobalPIN || parsed.GlobalPINPrimary != v.discovery.GlobalPINPrimary {
+			t.Errorf("got %+v, want %+v", parsed, v.discovery)
+		}
+	}
+}
+
+func TestPrinted(t *testing.T) {
+	printed := yubikey.Printed{
+		Name:       "John Doe",
+		Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Issuer:     "Example",
+	}
+	b := printed.Marshal()
+	if !bytes.Contains(b, []byte("2030JAN01")) {
+		t.Errorf("got %x, want the expiration date", b)
+	}
+	parsed, err := yubikey.ParsePrinted(b)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if parsed.Name != printed.Name || parsed.Issuer != printed.Issuer || !parsed.Expiration.Equal(printed.Expiration) {
+		t.Errorf("got %+v, want %+v", parsed, printed)
+	}
+}
@@ -0,0 +1,559 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// OpenPGP instructions
+	// Ref: https://gnupg.org/ftp/specs/OpenPGP-smart-card-application-3.4.1.pdf
+	insOpenPGPGetData = 0xca
+	insOpenPGPPSO     = 0x2a
+
+	// OpenPGP data objects
+	openPGPObjectApplicationData = 0x6e
+	openPGPObjectCardholderData  = 0x65
+	openPGPObjectSecuritySupport = 0x7a
+	openPGPObjectURL             = 0x5f50
+
+	// OpenPGP tags
+	tagOpenPGPAID            = 0x4f
+	tagOpenPGPDiscretionary  = 0x73
+	tagOpenPGPExtendedCaps   = 0xc0
+	tagOpenPGPAttrSignature  = 0xc1
+	tagOpenPGPAttrDecryption = 0xc2
+	tagOpenPGPAttrAuth       = 0xc3
+	tagOpenPGPPWStatus       = 0xc4
+	tagOpenPGPFingerprints   = 0xc5
+	tagOpenPGPCAFingerprints = 0xc6
+	tagOpenPGPTimestamps     = 0xcd
+	tagOpenPGPSigCounter     = 0x93
+	tagOpenPGPName           = 0x5b
+	tagOpenPGPLanguage       = 0x5f2d
+	tagOpenPGPSex            = 0x5f35
+
+	// OpenPGP password references
+	openPGPPW1Sign  = 0x81
+	openPGPPW1Other = 0x82
+	openPGPPW3      = 0x83
+
+	// OpenPGP algorithm identifiers
+	openPGPAlgorithmRSA   = 0x01
+	openPGPAlgorithmECDH  = 0x12
+	openPGPAlgorithmECDSA = 0x13
+	openPGPAlgorithmEdDSA = 0x16
+
+	// openPGPFingerprintLen holds the length of a key fingerprint.
+	openPGPFingerprintLen = 20
+)
+
+var (
+	// OpenPGPDefaultPW1 holds the default OpenPGP user PIN (PW1).
+	OpenPGPDefaultPW1 = "123456"
+	// OpenPGPDefaultPW3 holds the default OpenPGP admin PIN (PW3).
+	OpenPGPDefaultPW3 = "12345678"
+
+	// aidOpenPGP holds the OpenPGP application identifier.
+	aidOpenPGP = []byte{0xd2, 0x76, 0x00, 0x01, 0x24, 0x01}
+
+	// openPGPCurves holds the supported OpenPGP curves by their OIDs.
+	// The hash and cipher values are the ECDH KDF parameters of the curves (RFC 6637).
+	openPGPCurves = []struct {
+		oid    []byte
+		name   string
+		hash   byte
+		cipher byte
+	}{
+		{[]byte{0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}, "P-256", 0x08, 0x07},
+		{[]byte{0x2b, 0x81, 0x04, 0x00, 0x22}, "P-384", 0x09, 0x09},
+		{[]byte{0x2b, 0x81, 0x04, 0x00, 0x23}, "P-521", 0x0a, 0x09},
+		{[]byte{0x2b, 0x24, 0x03, 0x03, 0x02, 0x08, 0x01, 0x01, 0x07}, "brainpoolP256r1", 0x08, 0x07},
+		{[]byte{0x2b, 0x24, 0x03, 0x03, 0x02, 0x08, 0x01, 0x01, 0x0b}, "brainpoolP384r1", 0x09, 0x09},
+		{[]byte{0x2b, 0x24, 0x03, 0x03, 0x02, 0x08, 0x01, 0x01, 0x0d}, "brainpoolP512r1", 0x0a, 0x09},
+		{[]byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}, "Ed25519", 0x08, 0x07},
+		{[]byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0x97, 0x55, 0x01, 0x05, 0x01}, "X25519", 0x08, 0x07},
+	}
+
+	// digestInfoPrefixes holds the DER encoded DigestInfo prefixes of the RSA signatures.
+	// Ref: https://www.rfc-editor.org/rfc/rfc8017#section-9.2
+	digestInfoPrefixes = map[crypto.Hash][]byte{
+		crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+		crypto.SHA224: {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+		crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+		crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+		crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+	}
+)
+
+// OpenPGPKeyAttributes represents the algorithm attributes of an OpenPGP key.
+type OpenPGPKeyAttributes struct {
+	// ID is the OpenPGP algorithm identifier (1 for RSA, 18 for ECDH, 19 for ECDSA and 22 for EdDSA).
+	ID byte
+	// RSABits is the RSA modulus length. It's zero for the elliptic curve keys.
+	RSABits int
+	// Curve is the elliptic curve name (i.e. P-256 or Ed25519). It's empty for the RSA keys.
+	Curve string
+}
+
+// IsRSA returns whether the key is an RSA key or not.
+func (attrs *OpenPGPKeyAttributes) IsRSA() bool {
+	return attrs.ID == openPGPAlgorithmRSA
+}
+
+// String returns the algorithm name (i.e. rsa2048 or Ed25519).
+func (attrs *OpenPGPKeyAttributes) String() string {
+	if attrs.IsRSA() {
+		return fmt.Sprintf("rsa%d", attrs.RSABits)
+	}
+	return attrs.Curve
+}
+
+// OpenPGPKey represents the information of an OpenPGP key slot.
+type OpenPGPKey struct {
+	// Attributes is the algorithm attributes of the key.
+	Attributes OpenPGPKeyAttributes
+	// Fingerprint is the key fingerprint. It's empty if the slot has no key.
+	Fingerprint []byte
+	// CAFingerprint is the fingerprint of the certification authority.
+	CAFingerprint []byte
+	// Created is the key generation time.
+	Created time.Time
+}
+
+// HasKey returns whether the key slot has a key or not.
+func (key *OpenPGPKey) HasKey() bool {
+	return len(key.Fingerprint) > 0
+}
+
+// OpenPGPData represents the OpenPGP application related data.
+type OpenPGPData struct {
+	// AID is the application identifier which includes the version, manufacturer and serial number.
+	AID []byte
+	// Version is the OpenPGP specification version.
+	Version string
+	// Serial is the card serial number of the application.
+	Serial string
+	// Signature is the signature key.
+	Signature OpenPGPKey
+	// Decryption is the decryption key.
+	Decryption OpenPGPKey
+	// Authentication is the authentication key.
+	Authentication OpenPGPKey
+	// PW1ValidMultiple indicates whether PW1 is valid for multiple signatures or not.
+	PW1ValidMultiple bool
+	// PW1Retries is the remaining PW1 (user PIN) retries.
+	PW1Retries int
+	// ResetRetries is the remaining reset code retries.
+	ResetRetries int
+	// PW3Retries is the remaining PW3 (admin PIN) retries.
+	PW3Retries int
+	// SignatureCounter is the number of the signatures which are computed by the card.
+	SignatureCounter int
+	// Name is the cardholder name.
+	Name string
+	// Language is the cardholder language preference.
+	Language string
+	// URL is the URL of the public keys.
+	URL string
+}
+
+// OpenPGP represents the OpenPGP application of a YubiKey smart card.
+type OpenPGP struct {
+	card *Card
+	pw1  *Secret
+	pw3  *Secret
+}
+
+// OpenPGP returns the OpenPGP application of the card. The user and admin PINs must be verified
+// (VerifyPW1 and VerifyPW3) before the operations which require them, otherwise they return ErrMissingPIN.
+// The card PIN and PIN provider are the PIV PIN so they aren't used for the OpenPGP PINs.
+func (card *Card) OpenPGP() *OpenPGP {
+	return &OpenPGP{card: card}
+}
+
+// Data returns the OpenPGP application related data.
+func (pgp *OpenPGP) Data() (*OpenPGPData, error) {
+	var data *OpenPGPData
+	err := pgp.card.withSession(aidOpenPGP, func(s *session) (err error) {
+		data, err = openPGPApplicationData(s)
+		if err != nil {
+			return err
+		}
+
+		// Security support template and cardholder data
+		if list, err := openPGPTemplate(s, openPGPObjectSecuritySupport); err == nil {
+			if v, ok := list.get(tagOpenPGPSigCounter); ok && len(v) == 3 {
+				data.SignatureCounter = int(v[0])<<16 | int(v[1])<<8 | int(v[2])
+			}
+		}
+		if list, err := openPGPTemplate(s, openPGPObjectCardholderData); err == nil {
+			if v, ok := list.get(tagOpenPGPName); ok {
+				data.Name = string(v)
+			}
+			if v, ok := list.get(tagOpenPGPLanguage); ok {
+				data.Language = string(v)
+			}
+		}
+		if resp, err := openPGPGetData(s, openPGPObjectURL); err == nil {
+			data.URL = string(resp)
+		}
+		return nil
+	})
+	return data, err
+}
+
+// VerifyPW1 verifies the given user PIN (PW1). The PIN is used for the later requests.
+// The string can't be zeroized so VerifyPW1Secret should be preferred.
+func (pgp *OpenPGP) VerifyPW1(pin string) error {
+	secret := NewSecretString(pin)
+	defer secret.Zero()
+	return pgp.VerifyPW1Secret(secret)
+}
+
+// VerifyPW1Secret verifies the given user PIN (PW1). A copy of the PIN is used for the later requests.
+func (pgp *OpenPGP) VerifyPW1Secret(pin *Secret) error {
+	return pgp.verify(openPGPPW1Other, pin)
+}
+
+// VerifyPW3 verifies the given admin PIN (PW3). The PIN is used for the later requests.
+// The string can't be zeroized so VerifyPW3Secret should be preferred.
+func (pgp *OpenPGP) VerifyPW3(pin string) error {
+	secret := NewSecretString(pin)
+	defer secret.Zero()
+	return pgp.VerifyPW3Secret(secret)
+}
+
+// VerifyPW3Secret verifies the given admin PIN (PW3). A copy of the PIN is used for the later requests.
+func (pgp *OpenPGP) VerifyPW3Secret(pin *Secret) error {
+	return pgp.verify(openPGPPW3, pin)
+}
+
+// verify verifies the given OpenPGP password and stores a copy of it.
+func (pgp *OpenPGP) verify(ref byte, pin *Secret) error {
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, ref, pin); err != nil {
+			return openPGPPINError(s, ref, err, ErrInvalidPIN)
+		}
+		pgp.setPIN(ref, pin.Clone())
+		return nil
+	})
+}
+
+// setPIN sets the given OpenPGP password and zeroizes the previous one.
+func (pgp *OpenPGP) setPIN(ref byte, pin *Secret) {
+	if ref == openPGPPW3 {
+		pgp.pw3.Zero()
+		pgp.pw3 = pin
+		return
+	}
+	pgp.pw1.Zero()
+	pgp.pw1 = pin
+}
+
+// Sign signs the given digest by the signature key.
+// The digest is wrapped by DigestInfo for the RSA keys and the ECDSA signatures are ASN.1 encoded.
+// The message itself must be given for the EdDSA keys (the hash must be zero).
+// It waits for touch if the key has a touch policy (UIF) but the card touch functions aren't called.
+func (pgp *OpenPGP) Sign(digest []byte, hash crypto.Hash) ([]byte, error) {
+	var sig []byte
+	err := pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		data, err := openPGPApplicationData(s)
+		if err != nil {
+			return err
+		}
+		attrs := data.Signature.Attributes
+
+		// Prepare the data to be signed
+		input := digest
+		if attrs.IsRSA() {
+			prefix, ok := digestInfoPrefixes[hash]
+			if !ok {
+				return fmt.Errorf("unsupported hash function: %s", hash)
+			} else if len(digest) != hash.Size() {
+				return fmt.Errorf("invalid digest length for %s: %d", hash, len(digest))
+			}
+			input = append(append([]byte(nil), prefix...), digest...)
+		}
+
+		// Compute the signature
+		if err := openPGPVerify(s, openPGPPW1Sign, pgp.pw1); err != nil {
+			return openPGPPINError(s, openPGPPW1Sign, err, ErrInvalidPIN)
+		}
+		resp, err := s.send(apdu{ins: insOpenPGPPSO, p1: 0x9e, p2: 0x9a, data: input})
+		if err != nil {
+			return fmt.Errorf("couldn't compute the signature: %s", openPGPError(err))
+		}
+		if attrs.ID == openPGPAlgorithmECDSA {
+			if sig, err = ecdsaSignatureASN1(resp); err != nil {
+				return err
+			}
+			return nil
+		}
+		sig = resp
+		return nil
+	})
+	return sig, err
+}
+
+// Decrypt decrypts the given RSA ciphertext (PKCS #1 v1.5) by the decryption key.
+// Like Sign, it waits for touch (without the card touch functions) if the key has a touch policy.
+func (pgp *OpenPGP) Decrypt(ciphertext []byte) ([]byte, error) {
+	var plaintext []byte
+	err := pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, openPGPPW1Other, pgp.pw1); err != nil {
+			return openPGPPINError(s, openPGPPW1Other, err, ErrInvalidPIN)
+		}
+		// The padding indicator byte is prepended for the RSA ciphertexts
+		resp, err := s.send(apdu{ins: insOpenPGPPSO, p1: 0x80, p2: 0x86, data: append([]byte{0x00}, ciphertext...)})
+		if err != nil {
+			return fmt.Errorf("couldn't decrypt the ciphertext: %s", openPGPError(err))
+		}
+		plaintext = resp
+		return nil
+	})
+	return plaintext, err
+}
+
+// SharedKey returns the ECDH shared secret by the given peer public key and the decryption key.
+// The peer public key is an uncompressed point for the NIST and Brainpool curves and 32 bytes for X25519.
+// The shared secret should be zeroized when it's no longer needed. It waits for touch like Decrypt.
+func (pgp *OpenPGP) SharedKey(peerPublicKey []byte) (*Secret, error) {
+	if len(peerPublicKey) == 0 {
+		return nil, errors.New("missing peer public key")
+	}
+	var secret *Secret
+	err := pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, openPGPPW1Other, pgp.pw1); err != nil {
+			return openPGPPINError(s, openPGPPW1Other, err, ErrInvalidPIN)
+		}
+		// Cipher DO: A6 { 7F49 { 86 point } }
+		data := marshalTLV(0xa6, marshalTLV(0x7f49, marshalTLV(0x86, peerPublicKey)))
+		resp, err := s.send(apdu{ins: insOpenPGPPSO, p1: 0x80, p2: 0x86, data: data})
+		if err != nil {
+			return fmt.Errorf("couldn't compute the shared key: %s", openPGPError(err))
+		}
+		secret = NewSecret(s.keep(resp))
+		return nil
+	})
+	return secret, err
+}
+
+// openPGPGetData returns the given OpenPGP data object by the given session.
+func openPGPGetData(s *session, tag uint16) ([]byte, error) {
+	return s.send(apdu{ins: insOpenPGPGetData, p1: byte(tag >> 8), p2: byte(tag)})
+}
+
+// openPGPTemplate returns the data objects of the given OpenPGP template by the given session.
+func openPGPTemplate(s *session, tag uint16) (tlvs, error) {
+	resp, err := openPGPGetData(s, tag)
+	if err != nil {
+		return nil, err
+	}
+	list, err := parseTLVs(resp)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := list.get(uint32(tag)); ok {
+		return parseTLVs(v)
+	}
+	return list, nil
+}
+
+// openPGPVerify verifies the given OpenPGP password by the given session and reference.
+func openPGPVerify(s *session, ref byte, pin *Secret) error {
+	if pin.IsEmpty() {
+		return ErrMissingPIN
+	}
+	kdf, err := readOpenPGPKDF(s)
+	if err != nil {
+		return err
+	}
+	_, err = s.send(apdu{ins: insVerify, p2: ref, data: s.keep(kdf.encode(ref, pin.Bytes()))})
+	return err
+}
+
+// openPGPPWStatus returns the PW status bytes (C4) by the given session.
+// The remaining PW1, reset code and PW3 retries are the bytes 4, 5 and 6.
+func openPGPPWStatus(s *session) ([]byte, error) {
+	resp, err := openPGPGetData(s, tagOpenPGPPWStatus)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the PW status bytes: %s", err)
+	} else if len(resp) < 7 {
+		return nil, fmt.Errorf("invalid PW status bytes: %x", resp)
+	}
+	return resp, nil
+}
+
+// openPGPPINError returns the PIN error by the given OpenPGP verification error of the given password reference.
+// The card returns 6982 for the wrong PINs (not 63Cx like PIV) so the remaining retries are read from the PW status bytes.
+func openPGPPINError(s *session, ref byte, err error, errInvalid error) error {
+	if isStatus(err, swAuthBlocked) {
+		return ErrAuthBlocked
+	}
+	if !isStatus(err, swSecurityStatus) {
+		// The 63Cx status is handled too (i.e. the older firmwares)
+		var apduErr *apduError
+		if !errors.As(err, &apduErr) {
+			return err
+		} else if _, ok := apduErr.retries(); !ok {
+			return err
+		}
+	}
+
+	// Read the remaining retries
+	status, sErr := openPGPPWStatus(s)
+	if sErr != nil {
+		return errInvalid
+	}
+	retries := status[4]
+	switch ref {
+	case openPGPObjectResetCode:
+		retries = status[5]
+	case openPGPPW3:
+		retries = status[6]
+	}
+	if retries == 0 {
+		return ErrAuthBlocked
+	}
+	return fmt.Errorf("%w (%d retries remaining)", errInvalid, retries)
+}
+
+// openPGPError returns the error by the given OpenPGP operation error.
+func openPGPError(err error) error {
+	if isStatus(err, swSecurityStatus) {
+		// pso: smart card error 6982: security status not satisfied
+		return ErrAuthError
+	} else if isStatus(err, swNotFound) || isStatus(err, 0x6a88) {
+		return ErrNoKey
+	}
+	return err
+}
+
+// openPGPApplicationData returns the parsed OpenPGP application related data by the given session.
+func openPGPApplicationData(s *session) (*OpenPGPData, error) {
+	resp, err := openPGPGetData(s, openPGPObjectApplicationData)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the OpenPGP application data: %s", err)
+	}
+	return parseOpenPGPApplicationData(resp)
+}
+
+// parseOpenPGPApplicationData parses the given OpenPGP application related data object.
+func parseOpenPGPApplicationData(b []byte) (*OpenPGPData, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP application data: %s", err)
+	}
+	if v, ok := list.get(openPGPObjectApplicationData); ok {
+		if list, err = parseTLVs(v); err != nil {
+			return nil, fmt.Errorf("invalid OpenPGP application data: %s", err)
+		}
+	}
+
+	var data OpenPGPData
+	aid, ok := list.get(tagOpenPGPAID)
+	if !ok || len(aid) != 16 {
+		return nil, errors.New("invalid OpenPGP application data: missing AID")
+	}
+	data.AID = aid
+	data.Version = fmt.Sprintf("%d.%d", aid[6], aid[7])
+	data.Serial = fmt.Sprintf("%x", aid[10:14])
+
+	// The discretionary data objects are nested in the newer cards
+	if v, ok := list.get(tagOpenPGPDiscretionary); ok {
+		if list, err = parseTLVs(v); err != nil {
+			return nil, fmt.Errorf("invalid OpenPGP discretionary data: %s", err)
+		}
+	}
+	keys := []*OpenPGPKey{&data.Signature, &data.Decryption, &data.Authentication}
+	for i, tag := range []uint32{tagOpenPGPAttrSignature, tagOpenPGPAttrDecryption, tagOpenPGPAttrAuth} {
+		if v, ok := list.get(tag); ok {
+			if keys[i].Attributes, err = parseOpenPGPKeyAttributes(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	fingerprints, _ := list.get(tagOpenPGPFingerprints)
+	caFingerprints, _ := list.get(tagOpenPGPCAFingerprints)
+	timestamps, _ := list.get(tagOpenPGPTimestamps)
+	for i, key := range keys {
+		if fp := fingerprintAt(fingerprints, i); fp != nil {
+			key.Fingerprint = fp
+		}
+		if fp := fingerprintAt(caFingerprints, i); fp != nil {
+			key.CAFingerprint = fp
+		}
+		if len(timestamps) >= (i+1)*4 {
+			if v := binary.BigEndian.Uint32(timestamps[i*4:]); v != 0 {
+				key.Created = time.Unix(int64(v), 0).UTC()
+			}
+		}
+	}
+	if v, ok := list.get(tagOpenPGPPWStatus); ok && len(v) >= 7 {
+		data.PW1ValidMultiple = v[0] == 0x01
+		data.PW1Retries, data.ResetRetries, data.PW3Retries = int(v[4]), int(v[5]), int(v[6])
+	}
+
+	return &data, nil
+}
+
+// parseOpenPGPKeyAttributes parses the given OpenPGP algorithm attributes.
+func parseOpenPGPKeyAttributes(b []byte) (OpenPGPKeyAttributes, error) {
+	if len(b) == 0 {
+		return OpenPGPKeyAttributes{}, errors.New("invalid OpenPGP key attributes")
+	}
+	attrs := OpenPGPKeyAttributes{ID: b[0]}
+	switch b[0] {
+	case openPGPAlgorithmRSA:
+		if len(b) < 3 {
+			return attrs, errors.New("invalid OpenPGP RSA key attributes")
+		}
+		attrs.RSABits = int(b[1])<<8 | int(b[2])
+	case openPGPAlgorithmECDH, openPGPAlgorithmECDSA, openPGPAlgorithmEdDSA:
+		oid := b[1:]
+		// The optional trailing byte indicates the public key import format
+		for _, v := range openPGPCurves {
+			if bytes.Equal(oid, v.oid) || (len(oid) == len(v.oid)+1 && bytes.Equal(oid[:len(v.oid)], v.oid)) {
+				attrs.Curve = v.name
+				break
+			}
+		}
+		if attrs.Curve == "" {
+			return attrs, fmt.Errorf("unsupported OpenPGP curve: %x", oid)
+		}
+	default:
+		return attrs, fmt.Errorf("unsupported OpenPGP algorithm: %d", b[0])
+	}
+	return attrs, nil
+}
+
+// fingerprintAt returns the fingerprint at the given index. It returns nil for the empty fingerprints.
+func fingerprintAt(b []byte, i int) []byte {
+	if len(b) < (i+1)*openPGPFingerprintLen {
+		return nil
+	}
+	fp := b[i*openPGPFingerprintLen : (i+1)*openPGPFingerprintLen]
+	if bytes.Equal(fp, make([]byte, openPGPFingerprintLen)) {
+		return nil
+	}
+	return fp
+}
+
+// ecdsaSignatureASN1 returns the ASN.1 encoded ECDSA signature by the given raw signature (r || s).
+func ecdsaSignatureASN1(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+	l := len(raw) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(raw[:l]), new(big.Int).SetBytes(raw[l:])})
+}
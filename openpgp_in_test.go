@@ -0,0 +1,354 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOpenPGP represents a fake OpenPGP application which replies the OpenPGP requests.
+type fakeOpenPGP struct {
+	pw1      string
+	pw3      string
+	sigAttrs []byte
+	verified map[byte]bool
+	pso      []byte
+	objects  map[uint16][]byte
+	retries  map[byte]int
+	point    []byte
+	verifySW []byte
+}
+
+// useFakeOpenPGP replaces the smart card transport with a fake OpenPGP application during the test.
+func useFakeOpenPGP(t *testing.T) *fakeOpenPGP {
+	t.Helper()
+	fp := &fakeOpenPGP{pw1: OpenPGPDefaultPW1, pw3: OpenPGPDefaultPW3, sigAttrs: []byte{0x13, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}}
+	fp.objects = map[uint16][]byte{}
+	fp.retries = map[byte]int{openPGPPW1Sign: 3, openPGPPW3: 3}
+	ft := useFakeTransport(t, fp.handle)
+	ft.selected = func() []byte {
+		fp.verified = map[byte]bool{}
+		return nil
+	}
+	return fp
+}
+
+// applicationData returns the application related data.
+func (fp *fakeOpenPGP) applicationData() []byte {
+	aid := []byte{0xd2, 0x76, 0x00, 0x01, 0x24, 0x01, 0x03, 0x04, 0x00, 0x06, 0x12, 0x34, 0x56, 0x78, 0x00, 0x00}
+	fingerprints := append(bytes.Repeat([]byte{0xaa}, 20), make([]byte, 40)...)
+	timestamps := []byte{0x65, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	var dd []byte
+	dd = append(dd, marshalTLV(tagOpenPGPAttrSignature, fp.sigAttrs)...)
+	dd = append(dd, marshalTLV(tagOpenPGPAttrDecryption, []byte{0x01, 0x08, 0x00, 0x00, 0x20, 0x00})...)
+	dd = append(dd, marshalTLV(tagOpenPGPAttrAuth, []byte{0x16, 0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01})...)
+	dd = append(dd, marshalTLV(tagOpenPGPPWStatus, fp.pwStatus())...)
+	dd = append(dd, marshalTLV(tagOpenPGPFingerprints, fingerprints)...)
+	dd = append(dd, marshalTLV(tagOpenPGPCAFingerprints, make([]byte, 60))...)
+	dd = append(dd, marshalTLV(tagOpenPGPTimestamps, timestamps)...)
+	return marshalTLV(openPGPObjectApplicationData, append(marshalTLV(tagOpenPGPAID, aid), marshalTLV(tagOpenPGPDiscretionary, dd)...))
+}
+
+// pwStatus returns the PW status bytes.
+func (fp *fakeOpenPGP) pwStatus() []byte {
+	return []byte{0x00, 0x7f, 0x7f, 0x7f, byte(fp.retries[openPGPPW1Sign]), byte(fp.retries[openPGPObjectResetCode]), byte(fp.retries[openPGPPW3])}
+}
+
+// handle handles the given OpenPGP request.
+func (fp *fakeOpenPGP) handle(req []byte) []byte {
+	var data []byte
+	if len(req) > 5 {
+		data = req[5 : 5+int(req[4])]
+	}
+	switch req[1] {
+	case insOpenPGPGetData:
+		switch uint16(req[2])<<8 | uint16(req[3]) {
+		case openPGPObjectApplicationData:
+			return append(fp.applicationData(), 0x90, 0x00)
+		case openPGPObjectSecuritySupport:
+			return append(marshalTLV(openPGPObjectSecuritySupport, marshalTLV(tagOpenPGPSigCounter, []byte{0x00, 0x01, 0x02})), 0x90, 0x00)
+		case openPGPObjectCardholderData:
+			resp := append(marshalTLV(tagOpenPGPName, []byte("Doe<<John")), marshalTLV(tagOpenPGPLanguage, []byte("en"))...)
+			return append(marshalTLV(openPGPObjectCardholderData, resp), 0x90, 0x00)
+		case tagOpenPGPPWStatus:
+			return append(fp.pwStatus(), 0x90, 0x00)
+		}
+		if v, ok := fp.objects[uint16(req[2])<<8|uint16(req[3])]; ok {
+			return append(append([]byte(nil), v...), 0x90, 0x00)
+		}
+		return []byte{0x6a, 0x88}
+	case insOpenPGPPutData:
+		if !fp.verified[openPGPPW3] {
+			return []byte{0x69, 0x82}
+		}
+		tag := uint16(req[2])<<8 | uint16(req[3])
+		fp.objects[tag] = data
+		if tag == openPGPObjectResetCode {
+			fp.retries[openPGPObjectResetCode] = 3
+		}
+		if tag == openPGPObjectKDF {
+			list, _ := parseTLVs(data)
+			pw1, _ := list.get(tagOpenPGPKDFHashPW1)
+			pw3, _ := list.get(tagOpenPGPKDFHashPW3)
+			fp.pw1, fp.pw3 = string(pw1), string(pw3)
+		}
+		return []byte{0x90, 0x00}
+	case insVerify:
+		if fp.verifySW != nil {
+			return fp.verifySW
+		}
+		ref, pin := byte(openPGPPW1Sign), fp.pw1
+		if req[3] == openPGPPW3 {
+			ref, pin = openPGPPW3, fp.pw3
+		}
+		if fp.retries[ref] == 0 {
+			return []byte{0x69, 0x83}
+		} else if string(data) != pin {
+			// The card returns 6982 (not 63Cx) for the wrong PINs
+			fp.retries[ref]--
+			return []byte{0x69, 0x82}
+		}
+		fp.verified[req[3]] = true
+		return []byte{0x90, 0x00}
+	case insChangeReference:
+		ref, pin := byte(openPGPPW1Sign), &fp.pw1
+		if req[3] == openPGPPW3 {
+			ref, pin = openPGPPW3, &fp.pw3
+		}
+		if fp.retries[ref] == 0 {
+			return []byte{0x69, 0x83}
+		} else if !bytes.HasPrefix(data, []byte(*pin)) {
+			fp.retries[ref]--
+			return []byte{0x69, 0x82}
+		}
+		*pin = string(data[len(*pin):])
+		return []byte{0x90, 0x00}
+	case insOpenPGPResetRetry:
+		rc := fp.objects[openPGPObjectResetCode]
+		if rc == nil || fp.retries[openPGPObjectResetCode] == 0 {
+			return []byte{0x69, 0x83}
+		} else if !bytes.HasPrefix(data, rc) {
+			fp.retries[openPGPObjectResetCode]--
+			return []byte{0x69, 0x82}
+		}
+		fp.pw1, fp.retries[openPGPPW1Sign] = string(data[len(rc):]), 3
+		return []byte{0x90, 0x00}
+	case insOpenPGPGenerateKey:
+		if req[2] == 0x80 && !fp.verified[openPGPPW3] {
+			return []byte{0x69, 0x82}
+		}
+		return append(marshalTLV(0x7f49, marshalTLV(0x86, fp.point)), 0x90, 0x00)
+	case insOpenPGPSetPINRetries:
+		if !fp.verified[openPGPPW3] {
+			return []byte{0x69, 0x82}
+		}
+		fp.retries[openPGPPW1Sign], fp.retries[openPGPPW3] = int(data[0]), int(data[2])
+		return []byte{0x90, 0x00}
+	case insOpenPGPTerminate:
+		if fp.retries[openPGPPW1Sign] != 0 || fp.retries[openPGPPW3] != 0 {
+			return []byte{0x69, 0x85}
+		}
+		fp.objects = map[uint16][]byte{}
+		return []byte{0x90, 0x00}
+	case insOpenPGPActivate:
+		fp.pw1, fp.pw3 = OpenPGPDefaultPW1, OpenPGPDefaultPW3
+		fp.retries = map[byte]int{openPGPPW1Sign: 3, openPGPPW3: 3}
+		return []byte{0x90, 0x00}
+	case insOpenPGPPSO:
+		fp.pso = data
+		switch {
+		case req[2] == 0x9e && fp.verified[openPGPPW1Sign]:
+			if fp.sigAttrs[0] == openPGPAlgorithmECDSA {
+				return append(append(bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 32)...), 0x90, 0x00)
+			}
+			return append(bytes.Repeat([]byte{0x03}, 256), 0x90, 0x00)
+		case req[2] == 0x80 && fp.verified[openPGPPW1Other]:
+			return append(bytes.Repeat([]byte{0x04}, 32), 0x90, 0x00)
+		}
+		return []byte{0x69, 0x82}
+	}
+	return []byte{0x6d, 0x00}
+}
+
+func TestParseOpenPGPApplicationData(t *testing.T) {
+	fp := &fakeOpenPGP{sigAttrs: []byte{0x01, 0x10, 0x00, 0x00, 0x20, 0x00}, retries: map[byte]int{openPGPPW1Sign: 3, openPGPPW3: 3}}
+	data, err := parseOpenPGPApplicationData(fp.applicationData())
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if data.Version != "3.4" || data.Serial != "12345678" {
+		t.Errorf("got %v %v, want %v %v", data.Version, data.Serial, "3.4", "12345678")
+	}
+	if s := data.Signature.Attributes.String(); s != "rsa4096" {
+		t.Errorf("got %v, want %v", s, "rsa4096")
+	}
+	if s := data.Decryption.Attributes.String(); s != "rsa2048" {
+		t.Errorf("got %v, want %v", s, "rsa2048")
+	}
+	if s := data.Authentication.Attributes.String(); s != "Ed25519" {
+		t.Errorf("got %v, want %v", s, "Ed25519")
+	}
+	if !data.Signature.HasKey() || data.Decryption.HasKey() || data.Signature.CAFingerprint != nil {
+		t.Errorf("got %x %x, want only the signature fingerprint", data.Signature.Fingerprint, data.Decryption.Fingerprint)
+	}
+	if want := time.Unix(0x65000000, 0).UTC(); !data.Signature.Created.Equal(want) || !data.Decryption.Created.IsZero() {
+		t.Errorf("got %v, want %v", data.Signature.Created, want)
+	}
+	if data.PW1Retries != 3 || data.ResetRetries != 0 || data.PW3Retries != 3 || data.PW1ValidMultiple {
+		t.Errorf("got %v %v %v, want %v %v %v", data.PW1Retries, data.ResetRetries, data.PW3Retries, 3, 0, 3)
+	}
+
+	// Unsupported curve
+	if _, err := parseOpenPGPKeyAttributes([]byte{0x13, 0x01, 0x02}); err == nil {
+		t.Error("got nil, want error")
+	}
+	// Missing AID
+	if _, err := parseOpenPGPApplicationData(marshalTLV(openPGPObjectApplicationData, nil)); err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestOpenPGPData(t *testing.T) {
+	useFakeOpenPGP(t)
+	data, err := testCard(5, 4, 3).OpenPGP().Data()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if s := data.Signature.Attributes.String(); s != "P-256" {
+		t.Errorf("got %v, want %v", s, "P-256")
+	}
+	if data.SignatureCounter != 0x0102 {
+		t.Errorf("got %v, want %v", data.SignatureCounter, 0x0102)
+	}
+	if data.Name != "Doe<<John" || data.Language != "en" || data.URL != "" {
+		t.Errorf("got %v %v %v, want %v %v", data.Name, data.Language, data.URL, "Doe<<John", "en")
+	}
+}
+
+func TestOpenPGPVerify(t *testing.T) {
+	fp := useFakeOpenPGP(t)
+	fp.pw1 = "654321"
+	pgp := testCard(5, 4, 3).OpenPGP()
+
+	if err := pgp.VerifyPW1("123456"); !errors.Is(err, ErrInvalidPIN) || !strings.Contains(err.Error(), "(2 retries remaining)") {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+	// The wrong PIN isn't stored so the signing doesn't use a try
+	if _, err := pgp.Sign(make([]byte, 32), crypto.SHA256); !errors.Is(err, ErrMissingPIN) || fp.retries[openPGPPW1Sign] != 2 {
+		t.Errorf("got %v (%d retries), want %v", err, fp.retries[openPGPPW1Sign], ErrMissingPIN)
+	}
+	if err := pgp.VerifyPW1("123456"); !errors.Is(err, ErrInvalidPIN) || !strings.Contains(err.Error(), "(1 retries remaining)") {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+	if err := pgp.VerifyPW1("123456"); !errors.Is(err, ErrAuthBlocked) {
+		t.Errorf("got %v, want %v", err, ErrAuthBlocked)
+	}
+	if err := pgp.VerifyPW1("654321"); !errors.Is(err, ErrAuthBlocked) {
+		t.Errorf("got %v, want %v", err, ErrAuthBlocked)
+	}
+	fp.retries[openPGPPW1Sign] = 3
+	if err := pgp.VerifyPW1("654321"); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := pgp.VerifyPW3(OpenPGPDefaultPW3); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	old := pgp.pw1.Bytes()
+	if err := pgp.VerifyPW1Secret(NewSecretString("654321")); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	// The previous PIN is zeroized
+	if !bytes.Equal(old, make([]byte, len(old))) {
+		t.Errorf("got %x, want zeros", old)
+	}
+	if err := pgp.VerifyPW3(""); !errors.Is(err, ErrMissingPIN) {
+		t.Errorf("got %v, want %v", err, ErrMissingPIN)
+	}
+}
+
+func TestOpenPGPSign(t *testing.T) {
+	fp := useFakeOpenPGP(t)
+	pgp := testCard(5, 4, 3).OpenPGP()
+	digest := bytes.Repeat([]byte{0x05}, 32)
+
+	// The PINs must be verified before
+	if _, err := pgp.Sign(digest, crypto.SHA256); !errors.Is(err, ErrMissingPIN) {
+		t.Errorf("got %v, want %v", err, ErrMissingPIN)
+	}
+	if len(fp.verified) != 0 || fp.retries[openPGPPW1Sign] != 3 {
+		t.Errorf("got %v %v, want no verification", fp.verified, fp.retries)
+	}
+	if err := pgp.VerifyPW1(OpenPGPDefaultPW1); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	// ECDSA
+	sig, err := pgp.Sign(digest, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	var v struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &v); err != nil {
+		t.Errorf("got %v, want nil", err)
+	} else if want := new(big.Int).SetBytes(bytes.Repeat([]byte{0x02}, 32)); v.S.Cmp(want) != 0 {
+		t.Errorf("got %v, want %v", v.S, want)
+	}
+	if !bytes.Equal(fp.pso, digest) {
+		t.Errorf("got %x, want %x", fp.pso, digest)
+	}
+
+	// RSA
+	fp.sigAttrs = []byte{0x01, 0x08, 0x00, 0x00, 0x20, 0x00}
+	if sig, err = pgp.Sign(digest, crypto.SHA256); err != nil || len(sig) != 256 {
+		t.Errorf("got %v, want nil", err)
+	}
+	if want := append(digestInfoPrefixes[crypto.SHA256], digest...); !bytes.Equal(fp.pso, want) {
+		t.Errorf("got %x, want %x", fp.pso, want)
+	}
+	if _, err := pgp.Sign(digest, crypto.MD5); err == nil {
+		t.Error("got nil, want error")
+	}
+	if _, err := pgp.Sign(digest[:20], crypto.SHA256); err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestOpenPGPDecipher(t *testing.T) {
+	fp := useFakeOpenPGP(t)
+	pgp := testCard(5, 4, 3).OpenPGP()
+	if err := pgp.VerifyPW1(OpenPGPDefaultPW1); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	// RSA
+	if _, err := pgp.Decrypt([]byte{0x01, 0x02}); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if want := []byte{0x00, 0x01, 0x02}; !bytes.Equal(fp.pso, want) {
+		t.Errorf("got %x, want %x", fp.pso, want)
+	}
+
+	// ECDH
+	point := bytes.Repeat([]byte{0x09}, 32)
+	secret, err := pgp.SharedKey(point)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if secret.Len() != 32 {
+		t.Errorf("got %v, want %v", secret.Len(), 32)
+	}
+	if want := marshalTLV(0xa6, marshalTLV(0x7f49, marshalTLV(0x86, point))); !bytes.Equal(fp.pso, want) {
+		t.Errorf("got %x, want %x", fp.pso, want)
+	}
+	if _, err := pgp.SharedKey(nil); err == nil {
+		t.Error("got nil, want error")
+	}
+}
@@ -0,0 +1,41 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardOpenPGP(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		data, err := card.OpenPGP().Data()
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if len(data.AID) != 16 {
+			t.Errorf("got %v, want %v", len(data.AID), 16)
+		}
+	}
+}
+
+func TestOpenPGPKeyAttributesString(t *testing.T) {
+	table := []struct {
+		attrs yubikey.OpenPGPKeyAttributes
+		want  string
+	}{
+		{yubikey.OpenPGPKeyAttributes{ID: 1, RSABits: 2048}, "rsa2048"},
+		{yubikey.OpenPGPKeyAttributes{ID: 19, Curve: "P-384"}, "P-384"},
+		{yubikey.OpenPGPKeyAttributes{ID: 22, Curve: "Ed25519"}, "Ed25519"},
+	}
+	for _, v := range table {
+		if s := v.attrs.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
@@ -0,0 +1,728 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// OpenPGP administration instructions
+	// Ref: https://gnupg.org/ftp/specs/OpenPGP-smart-card-application-3.4.1.pdf
+	insOpenPGPPutData       = 0xda
+	insOpenPGPGenerateKey   = 0x47
+	insOpenPGPResetRetry    = 0x2c
+	insOpenPGPTerminate     = 0xe6
+	insOpenPGPActivate      = 0x44
+	insOpenPGPSetPINRetries = 0xf2 // YubiKey specific
+
+	// OpenPGP administration data objects
+	openPGPObjectResetCode = 0xd3
+	openPGPObjectKDF       = 0xf9
+
+	// OpenPGP KDF tags
+	tagOpenPGPKDFAlgorithm  = 0x81
+	tagOpenPGPKDFHash       = 0x82
+	tagOpenPGPKDFIterations = 0x83
+	tagOpenPGPKDFSaltPW1    = 0x84
+	tagOpenPGPKDFSaltRC     = 0x85
+	tagOpenPGPKDFSaltPW3    = 0x86
+	tagOpenPGPKDFHashPW1    = 0x87
+	tagOpenPGPKDFHashPW3    = 0x88
+
+	// OpenPGP KDF values
+	openPGPKDFIterSaltedS2K = 0x03
+	openPGPKDFSHA256        = 0x08
+	openPGPKDFIterations    = 0x780000
+	openPGPKDFSaltLen       = 8
+
+	// OpenPGP password length limits
+	openPGPPW1MinLen = 6
+	openPGPPW3MinLen = 8
+	openPGPPINMaxLen = 127
+
+	// openPGPTouchButton holds the button feature of the user interaction flags.
+	openPGPTouchButton = 0x20
+)
+
+const (
+	// OpenPGPKeyUnknown represents the unknown OpenPGP key.
+	OpenPGPKeyUnknown OpenPGPKeyRef = 0
+	// OpenPGPKeySignature represents the OpenPGP signature key.
+	OpenPGPKeySignature OpenPGPKeyRef = 1
+	// OpenPGPKeyDecryption represents the OpenPGP decryption key.
+	OpenPGPKeyDecryption OpenPGPKeyRef = 2
+	// OpenPGPKeyAuthentication represents the OpenPGP authentication key.
+	OpenPGPKeyAuthentication OpenPGPKeyRef = 3
+)
+
+// OpenPGPKeyRef represents an OpenPGP key reference.
+type OpenPGPKeyRef int
+
+// String returns the key name.
+func (ref OpenPGPKeyRef) String() string {
+	switch ref {
+	case OpenPGPKeySignature:
+		return "Signature"
+	case OpenPGPKeyDecryption:
+		return "Decryption"
+	case OpenPGPKeyAuthentication:
+		return "Authentication"
+	default:
+		return ""
+	}
+}
+
+// tags returns the control reference template, algorithm attributes, user interaction flags,
+// fingerprint and generation time tags of the key.
+func (ref OpenPGPKeyRef) tags() (crt byte, attrs, uif, fingerprint, created uint16, err error) {
+	switch ref {
+	case OpenPGPKeySignature:
+		return 0xb6, 0xc1, 0xd6, 0xc7, 0xce, nil
+	case OpenPGPKeyDecryption:
+		return 0xb8, 0xc2, 0xd7, 0xc8, 0xcf, nil
+	case OpenPGPKeyAuthentication:
+		return 0xa4, 0xc3, 0xd8, 0xc9, 0xd0, nil
+	default:
+		return 0, 0, 0, 0, 0, fmt.Errorf("invalid OpenPGP key: %d", ref)
+	}
+}
+
+const (
+	// OpenPGPTouchPolicyUnknown represents the unknown OpenPGP touch policy.
+	OpenPGPTouchPolicyUnknown OpenPGPTouchPolicy = 0
+	// OpenPGPTouchPolicyOff represents the "off" OpenPGP touch policy.
+	OpenPGPTouchPolicyOff OpenPGPTouchPolicy = 1
+	// OpenPGPTouchPolicyOn represents the "on" OpenPGP touch policy.
+	OpenPGPTouchPolicyOn OpenPGPTouchPolicy = 2
+	// OpenPGPTouchPolicyFixed represents the "fixed" OpenPGP touch policy which can't be changed without a reset.
+	OpenPGPTouchPolicyFixed OpenPGPTouchPolicy = 3
+	// OpenPGPTouchPolicyCached represents the "cached" OpenPGP touch policy (touch is cached for 15 seconds).
+	OpenPGPTouchPolicyCached OpenPGPTouchPolicy = 4
+	// OpenPGPTouchPolicyCachedFixed represents the "cached-fixed" OpenPGP touch policy.
+	OpenPGPTouchPolicyCachedFixed OpenPGPTouchPolicy = 5
+)
+
+// OpenPGPTouchPolicy represents an OpenPGP key touch (user interaction flag) policy.
+type OpenPGPTouchPolicy int
+
+// String returns the policy name.
+func (touchPolicy OpenPGPTouchPolicy) String() string {
+	switch touchPolicy {
+	case OpenPGPTouchPolicyOff:
+		return "Off"
+	case OpenPGPTouchPolicyOn:
+		return "On"
+	case OpenPGPTouchPolicyFixed:
+		return "Fixed"
+	case OpenPGPTouchPolicyCached:
+		return "Cached"
+	case OpenPGPTouchPolicyCachedFixed:
+		return "CachedFixed"
+	default:
+		return ""
+	}
+}
+
+// code returns the OpenPGP encoded value of the touch policy.
+func (touchPolicy OpenPGPTouchPolicy) code() byte {
+	return byte(touchPolicy - 1)
+}
+
+// OpenPGPGenerateKeyOpts represents the options of an OpenPGP key generation.
+type OpenPGPGenerateKeyOpts struct {
+	// Attributes is the algorithm attributes of the key. Either RSABits or Curve must be set.
+	// The algorithm identifier is inferred from the key reference if it's not set.
+	Attributes OpenPGPKeyAttributes
+	// Created is the key generation time which is used for the fingerprint. It's the current time by default.
+	Created time.Time
+}
+
+// GenerateKey generates a key in the given key slot by the admin PIN (PW3).
+// The key fingerprint and generation time are stored on the card so the key can be used by OpenPGP clients.
+// The public keys of the X25519 and Brainpool curves are returned as raw points ([]byte).
+func (pgp *OpenPGP) GenerateKey(ref OpenPGPKeyRef, opts OpenPGPGenerateKeyOpts) (crypto.PublicKey, error) {
+	crt, attrsTag, _, fpTag, createdTag, err := ref.tags()
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := openPGPAttributes(ref, opts.Attributes)
+	if err != nil {
+		return nil, err
+	} else if !attrs.IsRSA() && !pgp.card.isVersion(5, 2, 0) {
+		return nil, ErrNotSupported
+	}
+	created := opts.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	created = created.UTC().Truncate(time.Second)
+
+	var pub crypto.PublicKey
+	err = pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, openPGPPW3, pgp.pw3); err != nil {
+			return openPGPPINError(s, openPGPPW3, err, ErrInvalidPIN)
+		}
+
+		// Set the algorithm attributes and generate the key
+		if _, err := s.send(apdu{ins: insOpenPGPPutData, p1: byte(attrsTag >> 8), p2: byte(attrsTag), data: attrs.marshal()}); err != nil {
+			return fmt.Errorf("couldn't set the key attributes: %s", err)
+		}
+		resp, err := s.send(apdu{ins: insOpenPGPGenerateKey, p1: 0x80, data: []byte{crt, 0x00}})
+		if err != nil {
+			return fmt.Errorf("couldn't generate the key: %s", err)
+		}
+		material, err := openPGPKeyMaterial(resp)
+		if err != nil {
+			return err
+		}
+		if pub, err = openPGPPublicKey(attrs, material); err != nil {
+			return err
+		}
+
+		// Store the fingerprint and generation time
+		fp, err := openPGPFingerprint(attrs, material, created)
+		if err != nil {
+			return err
+		}
+		if _, err := s.send(apdu{ins: insOpenPGPPutData, p1: byte(fpTag >> 8), p2: byte(fpTag), data: fp}); err != nil {
+			return fmt.Errorf("couldn't set the key fingerprint: %s", err)
+		}
+		ts := make([]byte, 4)
+		binary.BigEndian.PutUint32(ts, uint32(created.Unix()))
+		if _, err := s.send(apdu{ins: insOpenPGPPutData, p1: byte(createdTag >> 8), p2: byte(createdTag), data: ts}); err != nil {
+			return fmt.Errorf("couldn't set the key generation time: %s", err)
+		}
+		return nil
+	})
+	return pub, err
+}
+
+// PublicKey returns the public key of the given key slot.
+// The public keys of the X25519 and Brainpool curves are returned as raw points ([]byte).
+func (pgp *OpenPGP) PublicKey(ref OpenPGPKeyRef) (crypto.PublicKey, error) {
+	crt, _, _, _, _, err := ref.tags()
+	if err != nil {
+		return nil, err
+	}
+	var pub crypto.PublicKey
+	err = pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		data, err := openPGPApplicationData(s)
+		if err != nil {
+			return err
+		}
+		resp, err := s.send(apdu{ins: insOpenPGPGenerateKey, p1: 0x81, data: []byte{crt, 0x00}})
+		if err != nil {
+			return fmt.Errorf("couldn't get the public key: %s", openPGPError(err))
+		}
+		material, err := openPGPKeyMaterial(resp)
+		if err != nil {
+			return err
+		}
+		pub, err = openPGPPublicKey(data.key(ref).Attributes, material)
+		return err
+	})
+	return pub, err
+}
+
+// TouchPolicy returns the touch policy of the given key slot.
+func (pgp *OpenPGP) TouchPolicy(ref OpenPGPKeyRef) (OpenPGPTouchPolicy, error) {
+	_, _, uifTag, _, _, err := ref.tags()
+	if err != nil {
+		return OpenPGPTouchPolicyUnknown, err
+	} else if !pgp.card.isVersion(4, 2, 0) {
+		return OpenPGPTouchPolicyUnknown, ErrNotSupported
+	}
+	policy := OpenPGPTouchPolicyUnknown
+	err = pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		resp, err := openPGPGetData(s, uifTag)
+		if err != nil {
+			return fmt.Errorf("couldn't get the touch policy: %s", err)
+		} else if len(resp) == 0 || resp[0] > OpenPGPTouchPolicyCachedFixed.code() {
+			return fmt.Errorf("invalid touch policy: %x", resp)
+		}
+		policy = OpenPGPTouchPolicy(resp[0] + 1)
+		return nil
+	})
+	return policy, err
+}
+
+// SetTouchPolicy sets the touch policy of the given key slot by the admin PIN (PW3).
+// The fixed policies can't be changed without resetting the application.
+func (pgp *OpenPGP) SetTouchPolicy(ref OpenPGPKeyRef, policy OpenPGPTouchPolicy) error {
+	_, _, uifTag, _, _, err := ref.tags()
+	if err != nil {
+		return err
+	} else if policy < OpenPGPTouchPolicyOff || policy > OpenPGPTouchPolicyCachedFixed {
+		return fmt.Errorf("invalid touch policy: %d", policy)
+	} else if !pgp.card.isVersion(4, 2, 0) || (policy >= OpenPGPTouchPolicyCached && !pgp.card.isVersion(5, 2, 1)) {
+		return ErrNotSupported
+	}
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, openPGPPW3, pgp.pw3); err != nil {
+			return openPGPPINError(s, openPGPPW3, err, ErrInvalidPIN)
+		}
+		data := []byte{policy.code(), openPGPTouchButton}
+		if _, err := s.send(apdu{ins: insOpenPGPPutData, p1: byte(uifTag >> 8), p2: byte(uifTag), data: data}); err != nil {
+			// put data: smart card error 6982: security status not satisfied (fixed policy)
+			return fmt.Errorf("couldn't set the touch policy: %s", err)
+		}
+		return nil
+	})
+}
+
+// ChangePW1 changes the user PIN (PW1). The stored PIN is updated after the PIN is changed.
+func (pgp *OpenPGP) ChangePW1(oldPIN, newPIN string) error {
+	return pgp.changePIN(openPGPPW1Sign, oldPIN, newPIN, openPGPPW1MinLen)
+}
+
+// ChangePW3 changes the admin PIN (PW3). The stored PIN is updated after the PIN is changed.
+func (pgp *OpenPGP) ChangePW3(oldPIN, newPIN string) error {
+	return pgp.changePIN(openPGPPW3, oldPIN, newPIN, openPGPPW3MinLen)
+}
+
+// SetResetCode sets the reset code by the admin PIN (PW3). The reset code can unblock the user PIN.
+func (pgp *OpenPGP) SetResetCode(resetCode string) error {
+	if err := validateOpenPGPPIN(resetCode, openPGPPW3MinLen); err != nil {
+		return err
+	}
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, openPGPPW3, pgp.pw3); err != nil {
+			return openPGPPINError(s, openPGPPW3, err, ErrInvalidPIN)
+		}
+		kdf, err := readOpenPGPKDF(s)
+		if err != nil {
+			return err
+		}
+		data := s.keep(kdf.encode(openPGPObjectResetCode, []byte(resetCode)))
+		if _, err := s.send(apdu{ins: insOpenPGPPutData, p2: openPGPObjectResetCode, data: data}); err != nil {
+			return fmt.Errorf("couldn't set the reset code: %s", err)
+		}
+		return nil
+	})
+}
+
+// UnblockPW1 unblocks and changes the user PIN (PW1) by the given reset code.
+func (pgp *OpenPGP) UnblockPW1(resetCode, newPIN string) error {
+	if err := validateOpenPGPPIN(newPIN, openPGPPW1MinLen); err != nil {
+		return err
+	}
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		kdf, err := readOpenPGPKDF(s)
+		if err != nil {
+			return err
+		}
+		data := s.keep(append(s.keep(kdf.encode(openPGPObjectResetCode, []byte(resetCode))), s.keep(kdf.encode(openPGPPW1Sign, []byte(newPIN)))...))
+		if _, err := s.send(apdu{ins: insOpenPGPResetRetry, p2: openPGPPW1Sign, data: data}); err != nil {
+			return openPGPPINError(s, openPGPObjectResetCode, err, ErrInvalidPUK)
+		}
+		pgp.setPIN(openPGPPW1Sign, NewSecretString(newPIN))
+		return nil
+	})
+}
+
+// SetRetries sets the retry counters of the user PIN, reset code and admin PIN by the admin PIN (PW3).
+func (pgp *OpenPGP) SetRetries(pw1Retries, resetRetries, pw3Retries int) error {
+	for _, v := range []int{pw1Retries, resetRetries, pw3Retries} {
+		if v < 1 || v > 0xff {
+			return fmt.Errorf("invalid retries (%d, %d, %d): must be between 1 and 255", pw1Retries, resetRetries, pw3Retries)
+		}
+	}
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, openPGPPW3, pgp.pw3); err != nil {
+			return openPGPPINError(s, openPGPPW3, err, ErrInvalidPIN)
+		}
+		data := []byte{byte(pw1Retries), byte(resetRetries), byte(pw3Retries)}
+		if _, err := s.send(apdu{ins: insOpenPGPSetPINRetries, data: data}); err != nil {
+			return fmt.Errorf("couldn't set the retries: %s", err)
+		}
+		return nil
+	})
+}
+
+// EnableKDF enables the PIN hashing (KDF-DO) by the admin PIN (PW3) so the PINs are never sent in plain text.
+// The card resets the user and admin PINs to their default values so the stored PINs are updated too.
+func (pgp *OpenPGP) EnableKDF() error {
+	if !pgp.card.isVersion(5, 2, 0) {
+		return ErrNotSupported
+	}
+	kdf, err := newOpenPGPKDF()
+	if err != nil {
+		return err
+	}
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		if err := openPGPVerify(s, openPGPPW3, pgp.pw3); err != nil {
+			return openPGPPINError(s, openPGPPW3, err, ErrInvalidPIN)
+		}
+		if _, err := s.send(apdu{ins: insOpenPGPPutData, p2: openPGPObjectKDF, data: kdf.marshal()}); err != nil {
+			return fmt.Errorf("couldn't enable the KDF: %s", err)
+		}
+		pgp.setPIN(openPGPPW1Sign, NewSecretString(OpenPGPDefaultPW1))
+		pgp.setPIN(openPGPPW3, NewSecretString(OpenPGPDefaultPW3))
+		return nil
+	})
+}
+
+// Reset resets the OpenPGP application of the card. All the keys and data objects are deleted.
+// The given confirmation must be the card serial number so a card can't be reset by mistake.
+// The user and admin PINs are blocked first since the card only accepts the reset when they're blocked.
+func (pgp *OpenPGP) Reset(confirm string) error {
+	if confirm == "" || confirm != pgp.card.serial {
+		return ErrResetNotConfirmed
+	}
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		// Block the PINs by invalid values (all zero bytes, hashed if the KDF is enabled)
+		// The card returns 6982 for the wrong PINs (not 63Cx) so the remaining tries are read from the PW status bytes.
+		status, err := openPGPPWStatus(s)
+		if err != nil {
+			return err
+		}
+		kdf, err := readOpenPGPKDF(s)
+		if err != nil {
+			return err
+		}
+		for _, pw := range []struct {
+			ref   byte
+			tries byte
+		}{{openPGPPW1Sign, status[4]}, {openPGPPW3, status[6]}} {
+			invalid := kdf.encode(pw.ref, make([]byte, openPGPPW3MinLen))
+			for i := 0; i < int(pw.tries); i++ {
+				if _, err := s.send(apdu{ins: insVerify, p2: pw.ref, data: invalid}); err == nil {
+					return errors.New("couldn't block the PINs: the invalid PIN is verified")
+				} else if !isOpenPGPWrongPIN(err) {
+					return fmt.Errorf("couldn't block the PINs: %s", err)
+				}
+			}
+		}
+		if status, err = openPGPPWStatus(s); err != nil {
+			return err
+		} else if status[4] != 0 || status[6] != 0 {
+			return fmt.Errorf("couldn't block the PINs: %d user and %d admin PIN retries remaining", status[4], status[6])
+		}
+
+		// Terminate and activate the application
+		if _, err := s.send(apdu{ins: insOpenPGPTerminate}); err != nil {
+			return fmt.Errorf("couldn't terminate the application: %s", err)
+		}
+		if _, err := s.send(apdu{ins: insOpenPGPActivate}); err != nil {
+			return fmt.Errorf("couldn't activate the application: %s", err)
+		}
+		pgp.setPIN(openPGPPW1Sign, NewSecretString(OpenPGPDefaultPW1))
+		pgp.setPIN(openPGPPW3, NewSecretString(OpenPGPDefaultPW3))
+		return nil
+	})
+}
+
+// isOpenPGPWrongPIN returns whether the given error is a wrong or blocked PIN error (6982, 6983 or 63Cx) or not.
+func isOpenPGPWrongPIN(err error) bool {
+	if isStatus(err, swSecurityStatus) || isStatus(err, swAuthBlocked) {
+		return true
+	}
+	var apduErr *apduError
+	if errors.As(err, &apduErr) {
+		_, ok := apduErr.retries()
+		return ok
+	}
+	return false
+}
+
+// changePIN changes the given OpenPGP password.
+func (pgp *OpenPGP) changePIN(ref byte, oldPIN, newPIN string, minLen int) error {
+	if err := validateOpenPGPPIN(newPIN, minLen); err != nil {
+		return err
+	}
+	return pgp.card.withSession(aidOpenPGP, func(s *session) error {
+		kdf, err := readOpenPGPKDF(s)
+		if err != nil {
+			return err
+		}
+		data := s.keep(append(s.keep(kdf.encode(ref, []byte(oldPIN))), s.keep(kdf.encode(ref, []byte(newPIN)))...))
+		if _, err := s.send(apdu{ins: insChangeReference, p2: ref, data: data}); err != nil {
+			return openPGPPINError(s, ref, err, ErrInvalidPIN)
+		}
+		pgp.setPIN(ref, NewSecretString(newPIN))
+		return nil
+	})
+}
+
+// key returns the key information by the given key reference.
+func (data *OpenPGPData) key(ref OpenPGPKeyRef) *OpenPGPKey {
+	switch ref {
+	case OpenPGPKeyDecryption:
+		return &data.Decryption
+	case OpenPGPKeyAuthentication:
+		return &data.Authentication
+	default:
+		return &data.Signature
+	}
+}
+
+// validateOpenPGPPIN validates the given OpenPGP password by the given minimum length.
+func validateOpenPGPPIN(pin string, minLen int) error {
+	if l := len(pin); l < minLen || l > openPGPPINMaxLen {
+		return fmt.Errorf("invalid PIN length: must be %d to %d characters", minLen, openPGPPINMaxLen)
+	}
+	return nil
+}
+
+// openPGPAttributes returns the complete algorithm attributes by the given key reference and attributes.
+func openPGPAttributes(ref OpenPGPKeyRef, attrs OpenPGPKeyAttributes) (OpenPGPKeyAttributes, error) {
+	if attrs.RSABits > 0 {
+		if attrs.RSABits != 2048 && attrs.RSABits != 3072 && attrs.RSABits != 4096 {
+			return attrs, fmt.Errorf("unsupported RSA key size: %d", attrs.RSABits)
+		}
+		attrs.ID, attrs.Curve = openPGPAlgorithmRSA, ""
+		return attrs, nil
+	}
+	if _, err := openPGPCurve(attrs.Curve); err != nil {
+		return attrs, err
+	}
+	if attrs.ID == 0 {
+		switch {
+		case attrs.Curve == "Ed25519":
+			attrs.ID = openPGPAlgorithmEdDSA
+		case attrs.Curve == "X25519" || ref == OpenPGPKeyDecryption:
+			attrs.ID = openPGPAlgorithmECDH
+		default:
+			attrs.ID = openPGPAlgorithmECDSA
+		}
+	}
+	if (attrs.ID == openPGPAlgorithmECDH) != (ref == OpenPGPKeyDecryption) {
+		return attrs, fmt.Errorf("invalid %s key algorithm: %s", ref, attrs.String())
+	}
+	return attrs, nil
+}
+
+// marshal returns the OpenPGP encoded algorithm attributes.
+func (attrs *OpenPGPKeyAttributes) marshal() []byte {
+	if attrs.IsRSA() {
+		// Modulus length, public exponent length (17 bits) and the standard import format
+		return []byte{attrs.ID, byte(attrs.RSABits >> 8), byte(attrs.RSABits), 0x00, 0x11, 0x00}
+	}
+	curve, _ := openPGPCurve(attrs.Curve)
+	return append([]byte{attrs.ID}, curve...)
+}
+
+// openPGPCurve returns the OID of the given curve name.
+func openPGPCurve(name string) ([]byte, error) {
+	for _, v := range openPGPCurves {
+		if v.name == name {
+			return v.oid, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported OpenPGP curve: %q", name)
+}
+
+// openPGPKeyMaterial returns the public key data objects of the given generate key response.
+func openPGPKeyMaterial(b []byte) (tlvs, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %s", err)
+	}
+	v, ok := list.get(0x7f49)
+	if !ok {
+		return nil, errors.New("invalid public key: missing template")
+	}
+	if list, err = parseTLVs(v); err != nil {
+		return nil, fmt.Errorf("invalid public key: %s", err)
+	}
+	return list, nil
+}
+
+// openPGPPublicKey returns the public key by the given algorithm attributes and key material.
+func openPGPPublicKey(attrs OpenPGPKeyAttributes, material tlvs) (crypto.PublicKey, error) {
+	if attrs.IsRSA() {
+		n, okN := material.get(0x81)
+		e, okE := material.get(0x82)
+		if !okN || !okE || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid public key modulus or exponent")
+		}
+		var exp int
+		for _, v := range e {
+			exp = exp<<8 | int(v)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	}
+	point, ok := material.get(0x86)
+	if !ok || len(point) == 0 {
+		return nil, errors.New("missing public key point")
+	}
+	var curve elliptic.Curve
+	switch attrs.Curve {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	case "Ed25519":
+		if len(point) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key point")
+		}
+		return ed25519.PublicKey(point), nil
+	default:
+		return point, nil
+	}
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, errors.New("invalid public key point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// openPGPFingerprint returns the OpenPGP v4 fingerprint of the given public key.
+// Ref: https://www.rfc-editor.org/rfc/rfc4880#section-12.2
+func openPGPFingerprint(attrs OpenPGPKeyAttributes, material tlvs, created time.Time) ([]byte, error) {
+	body := []byte{0x04, 0x00, 0x00, 0x00, 0x00, attrs.ID}
+	binary.BigEndian.PutUint32(body[1:], uint32(created.Unix()))
+	if attrs.IsRSA() {
+		n, _ := material.get(0x81)
+		e, _ := material.get(0x82)
+		body = append(append(body, mpi(n)...), mpi(e)...)
+	} else {
+		point, _ := material.get(0x86)
+		for _, v := range openPGPCurves {
+			if v.name != attrs.Curve {
+				continue
+			}
+			if v.name == "Ed25519" || v.name == "X25519" {
+				// Native point format
+				point = append([]byte{0x40}, point...)
+			}
+			body = append(append(append(body, byte(len(v.oid))), v.oid...), mpi(point)...)
+			if attrs.ID == openPGPAlgorithmECDH {
+				body = append(body, 0x03, 0x01, v.hash, v.cipher)
+			}
+		}
+	}
+	if len(body) == 6 {
+		return nil, fmt.Errorf("unsupported OpenPGP key: %s", attrs.String())
+	}
+	h := sha1.New()
+	h.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+	h.Write(body)
+	return h.Sum(nil), nil
+}
+
+// mpi returns the OpenPGP multiprecision integer encoding of the given value.
+func mpi(b []byte) []byte {
+	b = bytes.TrimLeft(b, "\x00")
+	bits := 0
+	if len(b) > 0 {
+		bits = (len(b)-1)*8 + new(big.Int).SetBytes(b[:1]).BitLen()
+	}
+	return append([]byte{byte(bits >> 8), byte(bits)}, b...)
+}
+
+// openPGPKDF represents the OpenPGP iterated and salted S2K PIN hashing parameters.
+type openPGPKDF struct {
+	iterations int
+	saltPW1    []byte
+	saltRC     []byte
+	saltPW3    []byte
+}
+
+// newOpenPGPKDF returns new KDF parameters with random salts.
+func newOpenPGPKDF() (*openPGPKDF, error) {
+	kdf := &openPGPKDF{iterations: openPGPKDFIterations}
+	for _, v := range []*[]byte{&kdf.saltPW1, &kdf.saltRC, &kdf.saltPW3} {
+		*v = make([]byte, openPGPKDFSaltLen)
+		if _, err := rand.Read(*v); err != nil {
+			return nil, fmt.Errorf("couldn't generate the KDF salt: %s", err)
+		}
+	}
+	return kdf, nil
+}
+
+// readOpenPGPKDF returns the KDF parameters by the given session. It returns nil if the KDF isn't enabled.
+func readOpenPGPKDF(s *session) (*openPGPKDF, error) {
+	list, err := openPGPTemplate(s, openPGPObjectKDF)
+	if err != nil {
+		if isStatus(err, 0x6a88) || isStatus(err, swNotFound) || isStatus(err, swNotSupported) {
+			// KDF-DO isn't supported by the card
+			return nil, nil
+		}
+		return nil, fmt.Errorf("couldn't get the KDF: %s", err)
+	}
+	if v, ok := list.get(tagOpenPGPKDFAlgorithm); !ok || len(v) != 1 || v[0] != openPGPKDFIterSaltedS2K {
+		return nil, nil
+	}
+	if v, ok := list.get(tagOpenPGPKDFHash); !ok || len(v) != 1 || v[0] != openPGPKDFSHA256 {
+		return nil, fmt.Errorf("unsupported KDF hash algorithm: %x", v)
+	}
+	kdf := &openPGPKDF{}
+	if v, ok := list.get(tagOpenPGPKDFIterations); ok && len(v) == 4 {
+		kdf.iterations = int(binary.BigEndian.Uint32(v))
+	}
+	kdf.saltPW1, _ = list.get(tagOpenPGPKDFSaltPW1)
+	kdf.saltRC, _ = list.get(tagOpenPGPKDFSaltRC)
+	kdf.saltPW3, _ = list.get(tagOpenPGPKDFSaltPW3)
+	if kdf.saltRC == nil {
+		kdf.saltRC = kdf.saltPW1
+	}
+	if kdf.saltPW3 == nil {
+		kdf.saltPW3 = kdf.saltPW1
+	}
+	return kdf, nil
+}
+
+// encode returns the value of the given password which is sent to the card.
+// The password is hashed if the KDF is enabled (the KDF can be nil). The returned value is always a new slice
+// so it can be zeroized by the caller.
+func (kdf *openPGPKDF) encode(ref byte, pin []byte) []byte {
+	if kdf == nil {
+		return append([]byte(nil), pin...)
+	}
+	salt := kdf.saltPW1
+	switch ref {
+	case openPGPPW3:
+		salt = kdf.saltPW3
+	case openPGPObjectResetCode:
+		salt = kdf.saltRC
+	}
+
+	// Iterated and salted S2K
+	// Ref: https://www.rfc-editor.org/rfc/rfc4880#section-3.7.1.3
+	data := append(append(make([]byte, 0, len(salt)+len(pin)), salt...), pin...)
+	defer zero(data)
+	count := kdf.iterations
+	if count < len(data) {
+		count = len(data)
+	}
+	h := sha256.New()
+	for ; count > len(data); count -= len(data) {
+		h.Write(data)
+	}
+	h.Write(data[:count])
+	return h.Sum(nil)
+}
+
+// marshal returns the KDF data object which includes the initial hashes of the default PINs.
+func (kdf *openPGPKDF) marshal() []byte {
+	iterations := make([]byte, 4)
+	binary.BigEndian.PutUint32(iterations, uint32(kdf.iterations))
+	var b []byte
+	b = append(b, marshalTLV(tagOpenPGPKDFAlgorithm, []byte{openPGPKDFIterSaltedS2K})...)
+	b = append(b, marshalTLV(tagOpenPGPKDFHash, []byte{openPGPKDFSHA256})...)
+	b = append(b, marshalTLV(tagOpenPGPKDFIterations, iterations)...)
+	b = append(b, marshalTLV(tagOpenPGPKDFSaltPW1, kdf.saltPW1)...)
+	b = append(b, marshalTLV(tagOpenPGPKDFSaltRC, kdf.saltRC)...)
+	b = append(b, marshalTLV(tagOpenPGPKDFSaltPW3, kdf.saltPW3)...)
+	b = append(b, marshalTLV(tagOpenPGPKDFHashPW1, kdf.encode(openPGPPW1Sign, []byte(OpenPGPDefaultPW1)))...)
+	b = append(b, marshalTLV(tagOpenPGPKDFHashPW3, kdf.encode(openPGPPW3, []byte(OpenPGPDefaultPW3)))...)
+	return b
+}
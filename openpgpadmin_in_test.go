@@ -0,0 +1,292 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openPGPTestPoint holds the Ed25519 public key of the RFC 9580 sample v4 key.
+// Ref: https://www.rfc-editor.org/rfc/rfc9580#appendix-A.1
+var openPGPTestPoint, _ = hex.DecodeString("3f098994bdd916ed4053197934e4a87c80733a1280d62f8010992e43ee3b2406")
+
+func TestOpenPGPFingerprint(t *testing.T) {
+	attrs := OpenPGPKeyAttributes{ID: openPGPAlgorithmEdDSA, Curve: "Ed25519"}
+	material := tlvs{{0x86, openPGPTestPoint}}
+	fp, err := openPGPFingerprint(attrs, material, time.Unix(0x53f35f0b, 0))
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := "c959bdbafa32a2f89a153b678cfde12197965a9a"; hex.EncodeToString(fp) != want {
+		t.Errorf("got %x, want %v", fp, want)
+	}
+
+	if _, err := openPGPFingerprint(OpenPGPKeyAttributes{ID: 0x13, Curve: "P-999"}, material, time.Now()); err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestMPI(t *testing.T) {
+	table := []struct {
+		b    []byte
+		want []byte
+	}{
+		{[]byte{0x00, 0x01}, []byte{0x00, 0x01, 0x01}},
+		{[]byte{0x40, 0x01}, []byte{0x00, 0x0f, 0x40, 0x01}},
+		{[]byte{0x01, 0x00, 0x01}, []byte{0x00, 0x11, 0x01, 0x00, 0x01}},
+		{nil, []byte{0x00, 0x00}},
+	}
+	for _, v := range table {
+		if b := mpi(v.b); !bytes.Equal(b, v.want) {
+			t.Errorf("got %x, want %x", b, v.want)
+		}
+	}
+}
+
+func TestOpenPGPAttributes(t *testing.T) {
+	table := []struct {
+		ref   OpenPGPKeyRef
+		attrs OpenPGPKeyAttributes
+		want  []byte
+		err   bool
+	}{
+		{OpenPGPKeySignature, OpenPGPKeyAttributes{RSABits: 2048}, []byte{0x01, 0x08, 0x00, 0x00, 0x11, 0x00}, false},
+		{OpenPGPKeySignature, OpenPGPKeyAttributes{Curve: "P-256"}, []byte{0x13, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}, false},
+		{OpenPGPKeyDecryption, OpenPGPKeyAttributes{Curve: "P-256"}, []byte{0x12, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}, false},
+		{OpenPGPKeyAuthentication, OpenPGPKeyAttributes{Curve: "Ed25519"}, []byte{0x16, 0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}, false},
+		{OpenPGPKeyDecryption, OpenPGPKeyAttributes{Curve: "X25519"}, []byte{0x12, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x97, 0x55, 0x01, 0x05, 0x01}, false},
+		{OpenPGPKeySignature, OpenPGPKeyAttributes{Curve: "X25519"}, nil, true},
+		{OpenPGPKeyDecryption, OpenPGPKeyAttributes{Curve: "Ed25519"}, nil, true},
+		{OpenPGPKeySignature, OpenPGPKeyAttributes{RSABits: 1024}, nil, true},
+		{OpenPGPKeySignature, OpenPGPKeyAttributes{}, nil, true},
+	}
+	for _, v := range table {
+		attrs, err := openPGPAttributes(v.ref, v.attrs)
+		if (err != nil) != v.err {
+			t.Errorf("got %v, want error %v", err, v.err)
+		} else if err == nil && !bytes.Equal(attrs.marshal(), v.want) {
+			t.Errorf("got %x, want %x", attrs.marshal(), v.want)
+		}
+	}
+}
+
+func TestOpenPGPGenerateKey(t *testing.T) {
+	fp := useFakeOpenPGP(t)
+	fp.point = openPGPTestPoint
+	pgp := testCard(5, 4, 3).OpenPGP()
+	if err := pgp.VerifyPW3(OpenPGPDefaultPW3); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	opts := OpenPGPGenerateKeyOpts{Attributes: OpenPGPKeyAttributes{Curve: "Ed25519"}, Created: time.Unix(0x53f35f0b, 0)}
+	pub, err := pgp.GenerateKey(OpenPGPKeyAuthentication, opts)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v, ok := pub.(ed25519.PublicKey); !ok || !bytes.Equal(v, openPGPTestPoint) {
+		t.Errorf("got %x, want %x", pub, openPGPTestPoint)
+	}
+	if want := []byte{0x16, 0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}; !bytes.Equal(fp.objects[0xc3], want) {
+		t.Errorf("got %x, want %x", fp.objects[0xc3], want)
+	}
+	if want := "c959bdbafa32a2f89a153b678cfde12197965a9a"; hex.EncodeToString(fp.objects[0xc9]) != want {
+		t.Errorf("got %x, want %v", fp.objects[0xc9], want)
+	}
+	if want := []byte{0x53, 0xf3, 0x5f, 0x0b}; !bytes.Equal(fp.objects[0xd0], want) {
+		t.Errorf("got %x, want %x", fp.objects[0xd0], want)
+	}
+
+	// Public key
+	pub, err = pgp.PublicKey(OpenPGPKeyAuthentication)
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	} else if v, ok := pub.(ed25519.PublicKey); !ok || !bytes.Equal(v, openPGPTestPoint) {
+		t.Errorf("got %x, want %x", pub, openPGPTestPoint)
+	}
+
+	// Invalid PIN, key reference and version
+	pgp.pw3 = NewSecretString("87654321")
+	if _, err := pgp.GenerateKey(OpenPGPKeyAuthentication, opts); !errors.Is(err, ErrInvalidPIN) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+	if _, err := pgp.GenerateKey(OpenPGPKeyUnknown, opts); err == nil {
+		t.Error("got nil, want error")
+	}
+	if _, err := testCard(5, 1, 0).OpenPGP().GenerateKey(OpenPGPKeyAuthentication, opts); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestOpenPGPTouchPolicy(t *testing.T) {
+	fp := useFakeOpenPGP(t)
+	pgp := testCard(5, 4, 3).OpenPGP()
+	if err := pgp.VerifyPW3(OpenPGPDefaultPW3); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	if err := pgp.SetTouchPolicy(OpenPGPKeySignature, OpenPGPTouchPolicyCached); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := []byte{0x03, 0x20}; !bytes.Equal(fp.objects[0xd6], want) {
+		t.Errorf("got %x, want %x", fp.objects[0xd6], want)
+	}
+	if policy, err := pgp.TouchPolicy(OpenPGPKeySignature); err != nil || policy != OpenPGPTouchPolicyCached {
+		t.Errorf("got %v (%v), want %v", policy, err, OpenPGPTouchPolicyCached)
+	}
+
+	if err := pgp.SetTouchPolicy(OpenPGPKeySignature, OpenPGPTouchPolicyUnknown); err == nil {
+		t.Error("got nil, want error")
+	}
+	if err := testCard(5, 2, 0).OpenPGP().SetTouchPolicy(OpenPGPKeySignature, OpenPGPTouchPolicyCachedFixed); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+	if _, err := testCard(4, 1, 0).OpenPGP().TouchPolicy(OpenPGPKeySignature); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestOpenPGPChangePIN(t *testing.T) {
+	fp := useFakeOpenPGP(t)
+	pgp := testCard(5, 4, 3).OpenPGP()
+
+	if err := pgp.ChangePW1("654321", "111111"); !errors.Is(err, ErrInvalidPIN) || !strings.Contains(err.Error(), "(2 retries remaining)") {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+	if err := pgp.ChangePW1(OpenPGPDefaultPW1, "12345"); err == nil {
+		t.Error("got nil, want error")
+	}
+	if err := pgp.ChangePW1(OpenPGPDefaultPW1, "654321"); err != nil || fp.pw1 != "654321" || string(pgp.pw1.Bytes()) != "654321" {
+		t.Errorf("got %v (%v), want %v", fp.pw1, err, "654321")
+	}
+	if err := pgp.ChangePW3(OpenPGPDefaultPW3, "87654321"); err != nil || fp.pw3 != "87654321" || string(pgp.pw3.Bytes()) != "87654321" {
+		t.Errorf("got %v (%v), want %v", fp.pw3, err, "87654321")
+	}
+
+	// Reset code
+	if err := pgp.SetResetCode("1234"); err == nil {
+		t.Error("got nil, want error")
+	}
+	if err := pgp.SetResetCode("11223344"); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if err := pgp.UnblockPW1("44332211", "222222"); !errors.Is(err, ErrInvalidPUK) || !strings.Contains(err.Error(), "(2 retries remaining)") {
+		t.Errorf("got %v, want %v", err, ErrInvalidPUK)
+	}
+	if err := pgp.UnblockPW1("11223344", "222222"); err != nil || fp.pw1 != "222222" || string(pgp.pw1.Bytes()) != "222222" {
+		t.Errorf("got %v (%v), want %v", fp.pw1, err, "222222")
+	}
+
+	// Retries
+	if err := pgp.SetRetries(5, 0, 5); err == nil {
+		t.Error("got nil, want error")
+	}
+	if err := pgp.SetRetries(5, 3, 6); err != nil || fp.retries[openPGPPW1Sign] != 5 || fp.retries[openPGPPW3] != 6 {
+		t.Errorf("got %v (%v), want %v", fp.retries, err, []int{5, 6})
+	}
+}
+
+func TestOpenPGPKDF(t *testing.T) {
+	// Single iteration
+	kdf := &openPGPKDF{saltPW1: []byte{0x01}, saltRC: []byte{0x02}, saltPW3: []byte{0x03}}
+	for _, v := range []struct {
+		ref  byte
+		salt byte
+	}{{openPGPPW1Sign, 0x01}, {openPGPPW1Other, 0x01}, {openPGPObjectResetCode, 0x02}, {openPGPPW3, 0x03}} {
+		if want := sha256.Sum256(append([]byte{v.salt}, "pin"...)); !bytes.Equal(kdf.encode(v.ref, []byte("pin")), want[:]) {
+			t.Errorf("got %x, want %x", kdf.encode(v.ref, []byte("pin")), want)
+		}
+	}
+	// Multiple iterations
+	kdf.iterations = 10
+	if want := sha256.Sum256([]byte("\x01pin\x01pin\x01p")); !bytes.Equal(kdf.encode(openPGPPW1Sign, []byte("pin")), want[:]) {
+		t.Errorf("got %x, want %x", kdf.encode(openPGPPW1Sign, []byte("pin")), want)
+	}
+	var nilKDF *openPGPKDF
+	if b := nilKDF.encode(openPGPPW1Sign, []byte("pin")); string(b) != "pin" {
+		t.Errorf("got %s, want %s", b, "pin")
+	}
+
+	// Enable the KDF
+	fp := useFakeOpenPGP(t)
+	pgp := testCard(5, 4, 3).OpenPGP()
+	pgp.pw1, pgp.pw3 = NewSecretString("654321"), NewSecretString(OpenPGPDefaultPW3)
+	if err := pgp.EnableKDF(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if fp.pw1 == OpenPGPDefaultPW1 || string(pgp.pw1.Bytes()) != OpenPGPDefaultPW1 {
+		t.Errorf("got %s, want %v", pgp.pw1.Bytes(), OpenPGPDefaultPW1)
+	}
+	if err := pgp.VerifyPW1(OpenPGPDefaultPW1); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := pgp.VerifyPW3(OpenPGPDefaultPW3); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := testCard(5, 1, 0).OpenPGP().EnableKDF(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestOpenPGPReset(t *testing.T) {
+	fp := useFakeOpenPGP(t)
+	fp.pw1, fp.pw3 = "654321", "87654321"
+	fp.objects[0xc9] = bytes.Repeat([]byte{0x01}, 20)
+	pgp := testCard(5, 4, 3).OpenPGP()
+	pgp.pw1, pgp.pw3 = NewSecretString(fp.pw1), NewSecretString(fp.pw3)
+	fp.retries[openPGPPW1Sign], fp.retries[openPGPPW3] = 5, 2
+
+	if err := pgp.Reset("87654321"); !errors.Is(err, ErrResetNotConfirmed) {
+		t.Errorf("got %v, want %v", err, ErrResetNotConfirmed)
+	}
+	if err := pgp.Reset("12345678"); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if fp.pw1 != OpenPGPDefaultPW1 || fp.pw3 != OpenPGPDefaultPW3 || len(fp.objects) != 0 {
+		t.Errorf("got %v %v %v, want the default values", fp.pw1, fp.pw3, fp.objects)
+	}
+	if string(pgp.pw1.Bytes()) != OpenPGPDefaultPW1 || string(pgp.pw3.Bytes()) != OpenPGPDefaultPW3 {
+		t.Errorf("got %s %s, want %v %v", pgp.pw1.Bytes(), pgp.pw3.Bytes(), OpenPGPDefaultPW1, OpenPGPDefaultPW3)
+	}
+
+	// The application isn't terminated if the PINs can't be blocked
+	fp.objects[0xc9] = bytes.Repeat([]byte{0x01}, 20)
+	fp.verifySW = []byte{0x67, 0x00}
+	if err := pgp.Reset("12345678"); err == nil || !strings.Contains(err.Error(), "couldn't block the PINs") {
+		t.Errorf("got %v, want a block error", err)
+	}
+	fp.verifySW = nil
+	fp.pw1 = string(make([]byte, openPGPPW3MinLen))
+	if err := pgp.Reset("12345678"); err == nil || !strings.Contains(err.Error(), "couldn't block the PINs") {
+		t.Errorf("got %v, want a block error", err)
+	}
+	if len(fp.objects) == 0 {
+		t.Error("got the terminated application, want the data objects")
+	}
+}
+
+func TestIsOpenPGPWrongPIN(t *testing.T) {
+	table := []struct {
+		err  error
+		want bool
+	}{
+		{&apduError{sw: 0x6982}, true},
+		{&apduError{sw: 0x6983}, true},
+		{&apduError{sw: 0x63c1}, true},
+		{&apduError{sw: 0x6700}, false},
+		{errors.New("transport error"), false},
+		{nil, false},
+	}
+	for _, v := range table {
+		if got := isOpenPGPWrongPIN(v.err); got != v.want {
+			t.Errorf("got %v, want %v (%v)", got, v.want, v.err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestOpenPGPKeyRefString(t *testing.T) {
+	table := []struct {
+		ref  yubikey.OpenPGPKeyRef
+		want string
+	}{
+		{yubikey.OpenPGPKeyUnknown, ""},
+		{yubikey.OpenPGPKeySignature, "Signature"},
+		{yubikey.OpenPGPKeyDecryption, "Decryption"},
+		{yubikey.OpenPGPKeyAuthentication, "Authentication"},
+	}
+	for _, v := range table {
+		if s := v.ref.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
+
+func TestOpenPGPTouchPolicyString(t *testing.T) {
+	table := []struct {
+		policy yubikey.OpenPGPTouchPolicy
+		want   string
+	}{
+		{yubikey.OpenPGPTouchPolicyUnknown, ""},
+		{yubikey.OpenPGPTouchPolicyOff, "Off"},
+		{yubikey.OpenPGPTouchPolicyOn, "On"},
+		{yubikey.OpenPGPTouchPolicyFixed, "Fixed"},
+		{yubikey.OpenPGPTouchPolicyCached, "Cached"},
+		{yubikey.OpenPGPTouchPolicyCachedFixed, "CachedFixed"},
+	}
+	for _, v := range table {
+		if s := v.policy.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// KeyOriginUnknown represents the unknown key origin.
+	KeyOriginUnknown KeyOrigin = 0
+	// KeyOriginGenerated represents the keys which have been generated on the card.
+	KeyOriginGenerated KeyOrigin = 1
+	// KeyOriginImported represents the keys which have been imported into the card.
+	KeyOriginImported KeyOrigin = 2
+)
+
+// KeyOrigin represents a slot key origin.
+type KeyOrigin int
+
+// String returns the origin name.
+func (origin KeyOrigin) String() string {
+	switch origin {
+	case KeyOriginGenerated:
+		return "Generated"
+	case KeyOriginImported:
+		return "Imported"
+	default:
+		return ""
+	}
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (origin KeyOrigin) MarshalText() ([]byte, error) {
+	return []byte(origin.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. The names are case-insensitive.
+func (origin *KeyOrigin) UnmarshalText(text []byte) error {
+	for _, v := range []KeyOrigin{KeyOriginUnknown, KeyOriginGenerated, KeyOriginImported} {
+		if strings.EqualFold(v.String(), string(text)) {
+			*origin = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key origin: %s", text)
+}
+
+// keyOriginFromByte returns the key origin by the given PIV encoded origin value.
+func keyOriginFromByte(b byte) KeyOrigin {
+	switch b {
+	case 0x01:
+		return KeyOriginGenerated
+	case 0x02:
+		return KeyOriginImported
+	default:
+		return KeyOriginUnknown
+	}
+}
@@ -0,0 +1,24 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"testing"
+)
+
+func TestKeyOriginFromByte(t *testing.T) {
+	table := []struct {
+		b    byte
+		want KeyOrigin
+	}{
+		{0x00, KeyOriginUnknown},
+		{0x01, KeyOriginGenerated},
+		{0x02, KeyOriginImported},
+	}
+	for _, v := range table {
+		if o := keyOriginFromByte(v.b); o != v.want {
+			t.Errorf("got %v, want %v", o, v.want)
+		}
+	}
+}
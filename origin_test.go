@@ -0,0 +1,26 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestKeyOriginString(t *testing.T) {
+	table := []struct {
+		origin yubikey.KeyOrigin
+		want   string
+	}{
+		{yubikey.KeyOriginUnknown, ""},
+		{yubikey.KeyOriginGenerated, "Generated"},
+		{yubikey.KeyOriginImported, "Imported"},
+	}
+	for _, v := range table {
+		if s := v.origin.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
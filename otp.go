@@ -0,0 +1,273 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// OTP instructions
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-otp/commands.html
+	insOTPRequest = 0x01
+	insOTPStatus  = 0x03
+
+	// OTP slot commands
+	otpCommandConfig1 = 0x01
+	otpCommandConfig2 = 0x03
+	otpCommandHMAC1   = 0x30
+	otpCommandHMAC2   = 0x38
+	otpCommandSerial  = 0x10
+
+	// OTP sizes
+	otpConfigSize     = 52
+	otpFixedSize      = 16
+	otpUIDSize        = 6
+	otpKeySize        = 16
+	otpAccessCodeSize = 6
+	otpHMACKeySize    = 20
+	otpHMACChallenge  = 64
+	otpHMACResponse   = 20
+	otpStatusSize     = 6
+
+	// OTP touch level flags of the first slot (shifted by one bit for the second slot)
+	otpTouchLevelValid = 0x01
+	otpTouchLevelTouch = 0x04
+
+	// OTP configuration flags
+	otpExtSerialAPIVisible = 0x04
+	otpExtAllowUpdate      = 0x20
+	otpTktChalResp         = 0x40
+	otpCfgChalHMAC         = 0x22
+	otpCfgHMACLT64         = 0x04
+	otpCfgChalBtnTrig      = 0x08
+)
+
+const (
+	// OTPSlotUnknown represents the unknown OTP slot.
+	OTPSlotUnknown OTPSlot = 0
+	// OTPSlot1 represents the first OTP slot (short touch).
+	OTPSlot1 OTPSlot = 1
+	// OTPSlot2 represents the second OTP slot (long touch).
+	OTPSlot2 OTPSlot = 2
+)
+
+var (
+	// ErrOTPWriteFailed represents an OTP slot configuration write error.
+	// The card doesn't report the reason but it's mostly a wrong or missing access code.
+	ErrOTPWriteFailed = errors.New("OTP slot configuration is not written (access code may be required)")
+
+	// aidOTP holds the OTP application identifier.
+	aidOTP = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x20, 0x01, 0x01}
+)
+
+// OTPSlot represents an OTP slot.
+type OTPSlot int
+
+// String returns the slot name.
+func (slot OTPSlot) String() string {
+	switch slot {
+	case OTPSlot1:
+		return "Slot 1"
+	case OTPSlot2:
+		return "Slot 2"
+	default:
+		return ""
+	}
+}
+
+// commands returns the configuration and HMAC challenge-response commands of the slot.
+func (slot OTPSlot) commands() (config, hmac byte, err error) {
+	switch slot {
+	case OTPSlot1:
+		return otpCommandConfig1, otpCommandHMAC1, nil
+	case OTPSlot2:
+		return otpCommandConfig2, otpCommandHMAC2, nil
+	default:
+		return 0, 0, fmt.Errorf("invalid OTP slot: %d", slot)
+	}
+}
+
+// OTPStatus represents the status of the OTP application.
+type OTPStatus struct {
+	// Version is the firmware version of the OTP application.
+	Version string
+	// ProgrammingSequence is the configuration sequence number which is incremented by every write.
+	ProgrammingSequence int
+	touchLevel          uint16
+}
+
+// IsConfigured returns whether the given slot is configured or not.
+func (status *OTPStatus) IsConfigured(slot OTPSlot) bool {
+	return slot >= OTPSlot1 && slot <= OTPSlot2 && status.touchLevel&(otpTouchLevelValid<<(slot-1)) != 0
+}
+
+// IsTouchTriggered returns whether the given slot is triggered by touch (i.e. a Yubico OTP or static password) or not.
+func (status *OTPStatus) IsTouchTriggered(slot OTPSlot) bool {
+	return slot >= OTPSlot1 && slot <= OTPSlot2 && status.touchLevel&(otpTouchLevelTouch<<(slot-1)) != 0
+}
+
+// OTPChallengeResponseOpts represents the options of an HMAC-SHA1 challenge-response slot configuration.
+type OTPChallengeResponseOpts struct {
+	// Key is the HMAC-SHA1 secret (up to 20 bytes).
+	Key []byte
+	// RequireTouch indicates whether the challenge-response requires touch or not.
+	RequireTouch bool
+	// AccessCode is the current access code of the slot (6 bytes) if any.
+	AccessCode []byte
+}
+
+// OTP represents the OTP application of a YubiKey smart card.
+type OTP struct {
+	card *Card
+}
+
+// OTP returns the OTP application of the card.
+func (card *Card) OTP() *OTP {
+	return &OTP{card: card}
+}
+
+// Status returns the status of the OTP application.
+func (otp *OTP) Status() (*OTPStatus, error) {
+	var status *OTPStatus
+	err := otp.card.withSession(aidOTP, func(s *session) (err error) {
+		resp, err := s.send(apdu{ins: insOTPStatus})
+		if err != nil {
+			return fmt.Errorf("couldn't get the OTP status: %s", err)
+		}
+		status, err = parseOTPStatus(resp)
+		return err
+	})
+	return status, err
+}
+
+// SetChallengeResponse programs the given slot with an HMAC-SHA1 challenge-response secret.
+func (otp *OTP) SetChallengeResponse(slot OTPSlot, opts OTPChallengeResponseOpts) error {
+	command, _, err := slot.commands()
+	if err != nil {
+		return err
+	} else if len(opts.Key) == 0 || len(opts.Key) > otpHMACKeySize {
+		return fmt.Errorf("invalid HMAC-SHA1 key length: must be 1 to %d bytes", otpHMACKeySize)
+	}
+
+	// HMAC-SHA1 key is split into the key (16 bytes) and uid (4 bytes) fields
+	key := make([]byte, otpHMACKeySize)
+	copy(key, opts.Key)
+	config := make([]byte, otpConfigSize)
+	copy(config[otpFixedSize:], key[otpKeySize:])
+	copy(config[otpFixedSize+otpUIDSize:], key[:otpKeySize])
+	flags := config[otpFixedSize+otpUIDSize+otpKeySize+otpAccessCodeSize+1:]
+	flags[0] = otpExtSerialAPIVisible | otpExtAllowUpdate
+	flags[1] = otpTktChalResp
+	flags[2] = otpCfgChalHMAC | otpCfgHMACLT64
+	if opts.RequireTouch {
+		flags[2] |= otpCfgChalBtnTrig
+	}
+	binary.LittleEndian.PutUint16(config[otpConfigSize-2:], ^otpCRC(config[:otpConfigSize-2]))
+
+	return otp.writeConfig(command, config, opts.AccessCode)
+}
+
+// DeleteSlot deletes the configuration of the given slot.
+func (otp *OTP) DeleteSlot(slot OTPSlot, accessCode []byte) error {
+	command, _, err := slot.commands()
+	if err != nil {
+		return err
+	}
+	return otp.writeConfig(command, make([]byte, otpConfigSize), accessCode)
+}
+
+// ChallengeResponse returns the HMAC-SHA1 response of the given challenge (up to 64 bytes) by the given slot.
+// The request waits for touch if the slot requires touch. The card touch functions aren't called for it.
+func (otp *OTP) ChallengeResponse(slot OTPSlot, challenge []byte) ([]byte, error) {
+	_, command, err := slot.commands()
+	if err != nil {
+		return nil, err
+	} else if len(challenge) > otpHMACChallenge {
+		return nil, fmt.Errorf("invalid challenge length: must be up to %d bytes", otpHMACChallenge)
+	}
+
+	// The challenge is padded by a byte which differs from the last byte (HMAC_LT64)
+	pad := byte(0x00)
+	if len(challenge) > 0 && challenge[len(challenge)-1] == 0x00 {
+		pad = 0x01
+	}
+	data := append(append([]byte(nil), challenge...), bytes.Repeat([]byte{pad}, otpHMACChallenge-len(challenge))...)
+
+	var response []byte
+	err = otp.card.withSession(aidOTP, func(s *session) error {
+		resp, err := s.send(apdu{ins: insOTPRequest, p1: command, data: data})
+		if err != nil {
+			return fmt.Errorf("couldn't calculate the challenge-response: %s", err)
+		} else if len(resp) < otpHMACResponse {
+			// The slot isn't configured for the challenge-response
+			return fmt.Errorf("couldn't calculate the challenge-response: %s is not configured", slot)
+		}
+		response = resp[:otpHMACResponse]
+		return nil
+	})
+	return response, err
+}
+
+// writeConfig writes the given slot configuration by the given access code.
+func (otp *OTP) writeConfig(command byte, config, accessCode []byte) error {
+	if accessCode != nil && len(accessCode) != otpAccessCodeSize {
+		return fmt.Errorf("invalid access code length: must be %d bytes", otpAccessCodeSize)
+	}
+	data := append(append([]byte(nil), config...), make([]byte, otpAccessCodeSize)...)
+	copy(data[otpConfigSize:], accessCode)
+
+	return otp.card.withSession(aidOTP, func(s *session) error {
+		before, err := parseOTPStatus(s.selected)
+		if err != nil {
+			return err
+		}
+		resp, err := s.send(apdu{ins: insOTPRequest, p1: command, data: data})
+		if err != nil {
+			return fmt.Errorf("couldn't write the OTP slot configuration: %s", err)
+		}
+		after, err := parseOTPStatus(resp)
+		if err != nil {
+			return err
+		}
+
+		// The sequence is incremented by the writes and it's reset when there is no configured slot
+		if after.ProgrammingSequence != before.ProgrammingSequence+1 && (after.ProgrammingSequence != 0 ||
+			before.ProgrammingSequence == 0 || after.IsConfigured(OTPSlot1) || after.IsConfigured(OTPSlot2)) {
+			return ErrOTPWriteFailed
+		}
+		return nil
+	})
+}
+
+// parseOTPStatus parses the given OTP status (version, programming sequence and touch level).
+func parseOTPStatus(b []byte) (*OTPStatus, error) {
+	if len(b) < otpStatusSize {
+		return nil, fmt.Errorf("invalid OTP status: %x", b)
+	}
+	return &OTPStatus{
+		Version:             fmt.Sprintf("%d.%d.%d", b[0], b[1], b[2]),
+		ProgrammingSequence: int(b[3]),
+		touchLevel:          binary.LittleEndian.Uint16(b[4:6]),
+	}, nil
+}
+
+// otpCRC returns the ISO 13239 CRC of the given data.
+func otpCRC(b []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, v := range b {
+		crc ^= uint16(v)
+		for i := 0; i < 8; i++ {
+			j := crc & 1
+			crc >>= 1
+			if j != 0 {
+				crc ^= 0x8408
+			}
+		}
+	}
+	return crc
+}
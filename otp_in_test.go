@@ -0,0 +1,170 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// fakeOTP represents a fake OTP application which replies the OTP requests.
+type fakeOTP struct {
+	seq        byte
+	touchLevel byte
+	keys       [2][]byte
+	accessCode []byte
+}
+
+// useFakeOTP replaces the smart card transport with a fake OTP application during the test.
+func useFakeOTP(t *testing.T) *fakeOTP {
+	t.Helper()
+	fo := &fakeOTP{}
+	ft := useFakeTransport(t, fo.handle)
+	ft.selected = fo.status
+	return fo
+}
+
+// status returns the OTP status.
+func (fo *fakeOTP) status() []byte {
+	return []byte{0x05, 0x04, 0x03, fo.seq, fo.touchLevel, 0x00}
+}
+
+// handle handles the given OTP request.
+func (fo *fakeOTP) handle(req []byte) []byte {
+	var data []byte
+	if len(req) > 5 {
+		data = req[5 : 5+int(req[4])]
+	}
+	switch {
+	case req[1] == insOTPStatus:
+		return append(fo.status(), 0x90, 0x00)
+	case req[1] == insOTPRequest && (req[2] == otpCommandConfig1 || req[2] == otpCommandConfig2):
+		i := 0
+		if req[2] == otpCommandConfig2 {
+			i = 1
+		}
+		config, accessCode := data[:otpConfigSize], data[otpConfigSize:]
+		if fo.accessCode != nil && !bytes.Equal(accessCode, fo.accessCode) {
+			return append(fo.status(), 0x90, 0x00)
+		}
+		if bytes.Equal(config, make([]byte, otpConfigSize)) {
+			fo.keys[i] = nil
+			fo.touchLevel &^= otpTouchLevelValid << i
+		} else {
+			if otpCRC(config) != 0xf0b8 {
+				return append(fo.status(), 0x90, 0x00)
+			}
+			fo.keys[i] = append(append([]byte(nil), config[22:38]...), config[16:20]...)
+			fo.touchLevel |= otpTouchLevelValid << i
+		}
+		fo.seq++
+		if fo.touchLevel == 0 {
+			fo.seq = 0
+		}
+		return append(fo.status(), 0x90, 0x00)
+	case req[1] == insOTPRequest && (req[2] == otpCommandHMAC1 || req[2] == otpCommandHMAC2):
+		key := fo.keys[0]
+		if req[2] == otpCommandHMAC2 {
+			key = fo.keys[1]
+		}
+		if key == nil {
+			return []byte{0x90, 0x00}
+		}
+		// HMAC_LT64 strips the trailing padding bytes
+		challenge := bytes.TrimRight(data, string(data[len(data)-1:]))
+		mac := hmac.New(sha1.New, key)
+		mac.Write(challenge)
+		return append(mac.Sum(nil), 0x90, 0x00)
+	}
+	return []byte{0x6d, 0x00}
+}
+
+func TestOTPStatus(t *testing.T) {
+	fo := useFakeOTP(t)
+	fo.seq, fo.touchLevel = 3, 0x06
+
+	status, err := testCard(5, 4, 3).OTP().Status()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if status.Version != "5.4.3" || status.ProgrammingSequence != 3 {
+		t.Errorf("got %v %v, want %v %v", status.Version, status.ProgrammingSequence, "5.4.3", 3)
+	}
+	if status.IsConfigured(OTPSlot1) || !status.IsConfigured(OTPSlot2) || !status.IsTouchTriggered(OTPSlot1) || status.IsTouchTriggered(OTPSlot2) {
+		t.Errorf("got %x, want %x", status.touchLevel, 0x06)
+	}
+	if status.IsConfigured(OTPSlotUnknown) {
+		t.Error("got true, want false")
+	}
+	if _, err := parseOTPStatus([]byte{0x05}); err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestOTPChallengeResponse(t *testing.T) {
+	fo := useFakeOTP(t)
+	otp := testCard(5, 4, 3).OTP()
+
+	// RFC 2202 HMAC-SHA1 test case 2
+	if err := otp.SetChallengeResponse(OTPSlot2, OTPChallengeResponseOpts{Key: []byte("Jefe")}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	resp, err := otp.ChallengeResponse(OTPSlot2, []byte("what do ya want for nothing?"))
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79"; hex.EncodeToString(resp) != want {
+		t.Errorf("got %x, want %v", resp, want)
+	}
+
+	// Full length key and a challenge which ends with a zero byte
+	key := bytes.Repeat([]byte{0x0b}, otpHMACKeySize)
+	if err := otp.SetChallengeResponse(OTPSlot1, OTPChallengeResponseOpts{Key: key, RequireTouch: true}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	challenge := []byte{0x01, 0x00}
+	mac := hmac.New(sha1.New, key)
+	mac.Write(challenge)
+	if resp, err := otp.ChallengeResponse(OTPSlot1, challenge); err != nil || !bytes.Equal(resp, mac.Sum(nil)) {
+		t.Errorf("got %x (%v), want %x", resp, err, mac.Sum(nil))
+	}
+
+	// Delete
+	if err := otp.DeleteSlot(OTPSlot1, nil); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := otp.DeleteSlot(OTPSlot2, nil); err != nil || fo.seq != 0 {
+		t.Errorf("got %v (%v), want nil", fo.seq, err)
+	}
+	if _, err := otp.ChallengeResponse(OTPSlot2, []byte{0x01}); err == nil {
+		t.Error("got nil, want error")
+	}
+
+	// Access code
+	fo.accessCode = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	if err := otp.SetChallengeResponse(OTPSlot1, OTPChallengeResponseOpts{Key: key}); !errors.Is(err, ErrOTPWriteFailed) {
+		t.Errorf("got %v, want %v", err, ErrOTPWriteFailed)
+	}
+	if err := otp.SetChallengeResponse(OTPSlot1, OTPChallengeResponseOpts{Key: key, AccessCode: fo.accessCode}); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := otp.DeleteSlot(OTPSlot1, []byte{0x01}); err == nil {
+		t.Error("got nil, want error")
+	}
+
+	// Invalid values
+	if err := otp.SetChallengeResponse(OTPSlotUnknown, OTPChallengeResponseOpts{Key: key}); err == nil {
+		t.Error("got nil, want error")
+	}
+	if err := otp.SetChallengeResponse(OTPSlot1, OTPChallengeResponseOpts{Key: make([]byte, 21)}); err == nil {
+		t.Error("got nil, want error")
+	}
+	if _, err := otp.ChallengeResponse(OTPSlot1, make([]byte, 65)); err == nil {
+		t.Error("got nil, want error")
+	}
+}
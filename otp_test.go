@@ -0,0 +1,38 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardOTP(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		if _, err := card.OTP().Status(); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+}
+
+func TestOTPSlotString(t *testing.T) {
+	table := []struct {
+		slot yubikey.OTPSlot
+		want string
+	}{
+		{yubikey.OTPSlotUnknown, ""},
+		{yubikey.OTPSlot1, "Slot 1"},
+		{yubikey.OTPSlot2, "Slot 2"},
+	}
+	for _, v := range table {
+		if s := v.slot.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
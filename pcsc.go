@@ -0,0 +1,63 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// scardSuccess represents the PC/SC success return code.
+	scardSuccess = 0x00000000
+	// scardSharingViolation represents the PC/SC return code of the outstanding connections.
+	scardSharingViolation = 0x8010000b
+	// scardNoReaders represents the PC/SC return code of the missing readers.
+	scardNoReaders = 0x8010002e
+)
+
+// scardError represents a PC/SC error.
+// Ref: https://pcsclite.apdu.fr/api/group__ErrorCodes.html
+type scardError struct {
+	rc uint32
+}
+
+// Error returns the error message.
+func (err *scardError) Error() string {
+	switch err.rc {
+	case 0x80100009:
+		return fmt.Sprintf("pcsc error 0x%08x: unknown reader", err.rc)
+	case scardSharingViolation:
+		return fmt.Sprintf("pcsc error 0x%08x: the smart card cannot be accessed because of other connections outstanding", err.rc)
+	case 0x8010000c:
+		return fmt.Sprintf("pcsc error 0x%08x: no smart card", err.rc)
+	case 0x8010001d:
+		return fmt.Sprintf("pcsc error 0x%08x: the smart card resource manager is not running", err.rc)
+	case scardNoReaders:
+		return fmt.Sprintf("pcsc error 0x%08x: no smart card reader", err.rc)
+	case 0x80100069:
+		return fmt.Sprintf("pcsc error 0x%08x: the smart card has been removed", err.rc)
+	default:
+		return fmt.Sprintf("pcsc error 0x%08x", err.rc)
+	}
+}
+
+// scardCheck returns an error by the given PC/SC return code.
+func scardCheck(rc uint32) error {
+	if rc == scardSuccess {
+		return nil
+	}
+	return &scardError{rc: rc}
+}
+
+// parseReaders returns the reader names by the given PC/SC multi-string (null separated names).
+func parseReaders(multi string) []string {
+	var readers []string
+	for _, v := range strings.Split(multi, "\x00") {
+		if v != "" {
+			readers = append(readers, v)
+		}
+	}
+	return readers
+}
@@ -0,0 +1,31 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSCardCheck(t *testing.T) {
+	if err := scardCheck(scardSuccess); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := scardCheck(0x8010000b); err == nil || !strings.Contains(err.Error(), "connections outstanding") {
+		t.Errorf("got %v, want an outstanding connections error", err)
+	}
+	if err := scardCheck(0x80100001); err == nil || err.Error() != "pcsc error 0x80100001" {
+		t.Errorf("got %v, want an unknown pcsc error", err)
+	}
+}
+
+func TestParseReaders(t *testing.T) {
+	readers := parseReaders("Yubico YubiKey OTP+FIDO+CCID 00 00\x00Yubico YubiKey CCID 01 00\x00\x00")
+	if len(readers) != 2 || readers[0] != "Yubico YubiKey OTP+FIDO+CCID 00 00" || readers[1] != "Yubico YubiKey CCID 01 00" {
+		t.Errorf("got %q, want 2 readers", readers)
+	}
+	if readers := parseReaders("\x00"); readers != nil {
+		t.Errorf("got %q, want nil", readers)
+	}
+}
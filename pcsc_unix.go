@@ -0,0 +1,105 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+//go:build darwin || linux || freebsd || openbsd
+// +build darwin linux freebsd openbsd
+
+package yubikey
+
+// Ref: https://pcsclite.apdu.fr/api/group__API.html
+
+// #cgo darwin LDFLAGS: -framework PCSC
+// #cgo linux pkg-config: libpcsclite
+// #cgo freebsd CFLAGS: -I/usr/local/include/ -I/usr/local/include/PCSC
+// #cgo freebsd LDFLAGS: -L/usr/local/lib/ -lpcsclite
+// #cgo openbsd CFLAGS: -I/usr/local/include/ -I/usr/local/include/PCSC
+// #cgo openbsd LDFLAGS: -L/usr/local/lib/ -lpcsclite
+// #include <stdlib.h>
+// #include <PCSC/winscard.h>
+// #include <PCSC/wintypes.h>
+import "C"
+
+import (
+	"unsafe"
+)
+
+// scard represents an exclusive smart card connection with an active transaction.
+type scard struct {
+	ctx C.SCARDCONTEXT
+	h   C.SCARDHANDLE
+}
+
+// scardReaders returns the smart card reader names.
+func scardReaders() ([]string, error) {
+	var ctx C.SCARDCONTEXT
+	if err := scardCheck(uint32(C.SCardEstablishContext(C.SCARD_SCOPE_SYSTEM, nil, nil, &ctx))); err != nil {
+		return nil, err
+	}
+	defer C.SCardReleaseContext(ctx)
+
+	// Get the length of the reader list first (the daemon returns an error if there is no reader)
+	var n C.DWORD
+	rc := uint32(C.SCardListReaders(ctx, nil, nil, &n))
+	if rc == scardNoReaders {
+		return nil, nil
+	} else if err := scardCheck(rc); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	if err := scardCheck(uint32(C.SCardListReaders(ctx, nil, (*C.char)(unsafe.Pointer(&buf[0])), &n))); err != nil {
+		return nil, err
+	}
+
+	return parseReaders(string(buf[:n])), nil
+}
+
+// scardOpen connects to the smart card by the given reader name and begins a transaction.
+func scardOpen(reader string) (*scard, error) {
+	var sc scard
+	if err := scardCheck(uint32(C.SCardEstablishContext(C.SCARD_SCOPE_SYSTEM, nil, nil, &sc.ctx))); err != nil {
+		return nil, err
+	}
+
+	cReader := C.CString(reader)
+	defer C.free(unsafe.Pointer(cReader))
+	var protocol C.DWORD
+	if err := scardCheck(uint32(C.SCardConnect(sc.ctx, cReader, C.SCARD_SHARE_EXCLUSIVE, C.SCARD_PROTOCOL_T1, &sc.h, &protocol))); err != nil {
+		C.SCardReleaseContext(sc.ctx)
+		return nil, err
+	}
+	if err := scardCheck(uint32(C.SCardBeginTransaction(sc.h))); err != nil {
+		C.SCardDisconnect(sc.h, C.SCARD_LEAVE_CARD)
+		C.SCardReleaseContext(sc.ctx)
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+// transmit transmits the given request and returns the response (including the status word).
+func (sc *scard) transmit(req []byte) ([]byte, error) {
+	var resp [C.MAX_BUFFER_SIZE_EXTENDED]byte
+	respN := C.DWORD(len(resp))
+	rc := C.SCardTransmit(
+		sc.h,
+		C.SCARD_PCI_T1,
+		(*C.BYTE)(&req[0]), C.DWORD(len(req)), nil,
+		(*C.BYTE)(&resp[0]), &respN,
+	)
+	if err := scardCheck(uint32(rc)); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), resp[:respN]...), nil
+}
+
+// Close ends the transaction and disconnects from the smart card.
+func (sc *scard) Close() error {
+	err := scardCheck(uint32(C.SCardEndTransaction(sc.h, C.SCARD_LEAVE_CARD)))
+	if errDisconnect := scardCheck(uint32(C.SCardDisconnect(sc.h, C.SCARD_LEAVE_CARD))); err == nil {
+		err = errDisconnect
+	}
+	if errRelease := scardCheck(uint32(C.SCardReleaseContext(sc.ctx))); err == nil {
+		err = errRelease
+	}
+	return err
+}
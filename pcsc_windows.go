@@ -0,0 +1,132 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+// Ref: https://learn.microsoft.com/en-us/windows/win32/api/winscard/
+
+import (
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+const (
+	scardScopeSystem      = 2
+	scardShareExclusive   = 1
+	scardProtocolT1       = 2
+	scardLeaveCard        = 0
+	maxBufferSizeExtended = 4 + 3 + (1 << 16) + 3 + 2
+)
+
+var (
+	winscard                  = syscall.NewLazyDLL("winscard.dll")
+	procSCardEstablishContext = winscard.NewProc("SCardEstablishContext")
+	procSCardReleaseContext   = winscard.NewProc("SCardReleaseContext")
+	procSCardListReaders      = winscard.NewProc("SCardListReadersW")
+	procSCardConnect          = winscard.NewProc("SCardConnectW")
+	procSCardDisconnect       = winscard.NewProc("SCardDisconnect")
+	procSCardBeginTransaction = winscard.NewProc("SCardBeginTransaction")
+	procSCardEndTransaction   = winscard.NewProc("SCardEndTransaction")
+	procSCardTransmit         = winscard.NewProc("SCardTransmit")
+	procSCardT1Pci            = winscard.NewProc("g_rgSCardT1Pci")
+)
+
+// scard represents an exclusive smart card connection with an active transaction.
+type scard struct {
+	ctx uintptr
+	h   uintptr
+}
+
+// scardReaders returns the smart card reader names.
+func scardReaders() ([]string, error) {
+	var ctx uintptr
+	rc, _, _ := procSCardEstablishContext.Call(scardScopeSystem, 0, 0, uintptr(unsafe.Pointer(&ctx)))
+	if err := scardCheck(uint32(rc)); err != nil {
+		return nil, err
+	}
+	defer procSCardReleaseContext.Call(ctx)
+
+	// Get the length of the reader list first (the service returns an error if there is no reader)
+	var n uint32
+	rc, _, _ = procSCardListReaders.Call(ctx, 0, 0, uintptr(unsafe.Pointer(&n)))
+	if uint32(rc) == scardNoReaders {
+		return nil, nil
+	} else if err := scardCheck(uint32(rc)); err != nil {
+		return nil, err
+	}
+	buf := make([]uint16, n)
+	rc, _, _ = procSCardListReaders.Call(ctx, 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n)))
+	if err := scardCheck(uint32(rc)); err != nil {
+		return nil, err
+	}
+
+	return parseReaders(string(utf16.Decode(buf[:n]))), nil
+}
+
+// scardOpen connects to the smart card by the given reader name and begins a transaction.
+func scardOpen(reader string) (*scard, error) {
+	var sc scard
+	rc, _, _ := procSCardEstablishContext.Call(scardScopeSystem, 0, 0, uintptr(unsafe.Pointer(&sc.ctx)))
+	if err := scardCheck(uint32(rc)); err != nil {
+		return nil, err
+	}
+
+	readerPtr, err := syscall.UTF16PtrFromString(reader)
+	if err != nil {
+		procSCardReleaseContext.Call(sc.ctx)
+		return nil, err
+	}
+	var protocol uint32
+	rc, _, _ = procSCardConnect.Call(
+		sc.ctx,
+		uintptr(unsafe.Pointer(readerPtr)),
+		scardShareExclusive,
+		scardProtocolT1,
+		uintptr(unsafe.Pointer(&sc.h)),
+		uintptr(unsafe.Pointer(&protocol)),
+	)
+	if err := scardCheck(uint32(rc)); err != nil {
+		procSCardReleaseContext.Call(sc.ctx)
+		return nil, err
+	}
+	rc, _, _ = procSCardBeginTransaction.Call(sc.h)
+	if err := scardCheck(uint32(rc)); err != nil {
+		procSCardDisconnect.Call(sc.h, scardLeaveCard)
+		procSCardReleaseContext.Call(sc.ctx)
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+// transmit transmits the given request and returns the response (including the status word).
+func (sc *scard) transmit(req []byte) ([]byte, error) {
+	var resp [maxBufferSizeExtended]byte
+	respN := uint32(len(resp))
+	rc, _, _ := procSCardTransmit.Call(
+		sc.h,
+		procSCardT1Pci.Addr(),
+		uintptr(unsafe.Pointer(&req[0])), uintptr(len(req)), 0,
+		uintptr(unsafe.Pointer(&resp[0])), uintptr(unsafe.Pointer(&respN)),
+	)
+	if err := scardCheck(uint32(rc)); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), resp[:respN]...), nil
+}
+
+// Close ends the transaction and disconnects from the smart card.
+func (sc *scard) Close() error {
+	rc, _, _ := procSCardEndTransaction.Call(sc.h, scardLeaveCard)
+	err := scardCheck(uint32(rc))
+	rc, _, _ = procSCardDisconnect.Call(sc.h, scardLeaveCard)
+	if errDisconnect := scardCheck(uint32(rc)); err == nil {
+		err = errDisconnect
+	}
+	rc, _, _ = procSCardReleaseContext.Call(sc.ctx)
+	if errRelease := scardCheck(uint32(rc)); err == nil {
+		err = errRelease
+	}
+	return err
+}
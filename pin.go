@@ -0,0 +1,198 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// PIV instructions
+	insVerify            = 0x20
+	insResetRetryCounter = 0x2c
+	insSetRetries        = 0xfa
+
+	// PIN references
+	keyPIN = 0x80
+	keyPUK = 0x81
+
+	// pinMinLen and pinMaxLen hold the PIN and PUK length limits.
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/pin-puk-mgmt-key.html
+	pinMinLen = 6
+	pinMaxLen = 8
+)
+
+var (
+	// ErrInvalidPUK represents an invalid PUK error.
+	ErrInvalidPUK = errors.New("invalid PUK")
+	// ErrPINComplexity represents a PIN complexity error.
+	// The cards which enforce the PIN complexity (firmware 5.7+) reject the trivial PINs and PUKs
+	// (i.e. 123456, 111111 or the values in the Yubico blocklist).
+	ErrPINComplexity = errors.New("PIN or PUK doesn't meet the complexity requirements")
+)
+
+// PINRetries returns the remaining PIN retries.
+func (card *Card) PINRetries() (int, error) {
+	// An empty verification returns the remaining retries
+	var retries int
+	err := card.withSession(aidPIV, func(s *session) error {
+		_, err := s.send(apdu{ins: insVerify, p2: keyPIN})
+		var apduErr *apduError
+		if errors.As(err, &apduErr) {
+			if r, ok := apduErr.retries(); ok {
+				retries = r
+				return nil
+			} else if apduErr.sw == swAuthBlocked {
+				return nil
+			}
+		}
+		return fmt.Errorf("couldn't get the PIN retries: %v", err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return retries, nil
+}
+
+// ChangePIN changes the card PIN. The card PIN is updated after the PIN is changed.
+// The strings can't be zeroized so ChangePINSecret should be preferred.
+func (card *Card) ChangePIN(oldPIN, newPIN string) error {
+	oldSecret, newSecret := NewSecretString(oldPIN), NewSecretString(newPIN)
+	defer oldSecret.Zero()
+	defer newSecret.Zero()
+	return card.ChangePINSecret(oldSecret, newSecret)
+}
+
+// ChangePINSecret changes the card PIN. The card PIN is updated after the PIN is changed.
+func (card *Card) ChangePINSecret(oldPIN, newPIN *Secret) error {
+	if err := validatePINLength(newPIN.Len()); err != nil {
+		return err
+	}
+
+	// Connect to the smart card
+	return card.withSession(aidPIV, func(s *session) error {
+		// Change the PIN
+		if err := changeReference(s, keyPIN, oldPIN, newPIN); err != nil {
+			return card.pinError(err, ErrInvalidPIN)
+		}
+		card.setPIN(newPIN)
+
+		return nil
+	})
+}
+
+// ChangePUK changes the card PUK. The card PUK is updated after the PUK is changed.
+// The strings can't be zeroized so ChangePUKSecret should be preferred.
+func (card *Card) ChangePUK(oldPUK, newPUK string) error {
+	oldSecret, newSecret := NewSecretString(oldPUK), NewSecretString(newPUK)
+	defer oldSecret.Zero()
+	defer newSecret.Zero()
+	return card.ChangePUKSecret(oldSecret, newSecret)
+}
+
+// ChangePUKSecret changes the card PUK. The card PUK is updated after the PUK is changed.
+func (card *Card) ChangePUKSecret(oldPUK, newPUK *Secret) error {
+	if err := validatePINLength(newPUK.Len()); err != nil {
+		return err
+	}
+
+	// Connect to the smart card
+	return card.withSession(aidPIV, func(s *session) error {
+		// Change the PUK
+		if err := changeReference(s, keyPUK, oldPUK, newPUK); err != nil {
+			return card.pinError(err, ErrInvalidPUK)
+		}
+		card.setPUK(newPUK.Clone())
+
+		return nil
+	})
+}
+
+// SetRetries sets the PIN and PUK retry counters by the card PIN and management key.
+// The card resets the PIN and PUK to their default values so the card PIN and PUK are updated too.
+func (card *Card) SetRetries(pinRetries, pukRetries int) error {
+	if pinRetries < 1 || pinRetries > 0xff || pukRetries < 1 || pukRetries > 0xff {
+		return fmt.Errorf("invalid retries (%d, %d): must be between 1 and 255", pinRetries, pukRetries)
+	}
+
+	// Resolve the PIN and connect to the smart card
+	return card.withPIN(true, func(verify func(s *session) error) error {
+		return card.withSession(aidPIV, func(s *session) error {
+			// Authenticate and set the retries
+			if err := card.authenticate(s, nil); err != nil {
+				return err
+			}
+			if err := verify(s); err != nil {
+				return card.pinError(err, ErrInvalidPIN)
+			}
+			if _, err := s.send(apdu{ins: insSetRetries, p1: byte(pinRetries), p2: byte(pukRetries)}); err != nil {
+				return fmt.Errorf("couldn't set the retries: %s", err)
+			}
+			defaultPIN := NewSecretString(DefaultPIN)
+			defer defaultPIN.Zero()
+			card.setPIN(defaultPIN)
+			card.setPUK(NewSecretString(DefaultPUK))
+
+			return nil
+		})
+	})
+}
+
+// verifyPIN verifies the given PIN by the given session.
+func verifyPIN(s *session, pin []byte) error {
+	if err := validatePINLength(len(pin)); err != nil {
+		return err
+	}
+	_, err := s.send(apdu{ins: insVerify, p2: keyPIN, data: s.keep(encodePIN(pin))})
+	return err
+}
+
+// changeReference changes the given PIN or PUK by the given session.
+func changeReference(s *session, key byte, oldPIN, newPIN *Secret) error {
+	if err := validatePINLength(oldPIN.Len()); err != nil {
+		return err
+	}
+	data := s.keep(append(s.keep(encodePIN(oldPIN.Bytes())), s.keep(encodePIN(newPIN.Bytes()))...))
+	_, err := s.send(apdu{ins: insChangeReference, p2: key, data: data})
+	return err
+}
+
+// encodePIN returns a copy of the PIV encoded PIN which is padded with 0xff.
+func encodePIN(pin []byte) []byte {
+	b := make([]byte, 0, pinMaxLen)
+	b = append(b, pin...)
+	for len(b) < pinMaxLen {
+		b = append(b, 0xff)
+	}
+	return b
+}
+
+// validatePINLength validates the given PIN or PUK length by the PIV length rules.
+func validatePINLength(l int) error {
+	if l < pinMinLen || l > pinMaxLen {
+		return fmt.Errorf("invalid PIN or PUK length: must be %d to %d characters", pinMinLen, pinMaxLen)
+	}
+	return nil
+}
+
+// pinError returns the PIN error by the given PIN or PUK verification error.
+// Verification failures are returned as the given error with the remaining retries.
+func (card *Card) pinError(err error, errInvalid error) error {
+	if isStatus(err, swAuthBlocked) {
+		// verify pin: smart card error 6983: authentication method blocked
+		return ErrAuthBlocked
+	}
+	var apduErr *apduError
+	if errors.As(err, &apduErr) {
+		if retries, ok := apduErr.retries(); ok {
+			return fmt.Errorf("%w (%d retries remaining)", errInvalid, retries)
+		}
+	}
+	if isStatus(err, 0x6a80) && card.isVersion(5, 7, 0) {
+		// change pin: smart card error 6a80: incorrect parameter in command data field
+		return ErrPINComplexity
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestValidatePIN(t *testing.T) {
+	table := []struct {
+		pin   string
+		valid bool
+	}{
+		{"", false},
+		{"12345", false},
+		{"123456", true},
+		{"12345678", true},
+		{"123456789", false},
+	}
+	for _, v := range table {
+		if err := validatePINLength(len(v.pin)); (err == nil) != v.valid {
+			t.Errorf("got %v, want valid=%v for %v", err, v.valid, v.pin)
+		}
+	}
+}
+
+func TestEncodePIN(t *testing.T) {
+	if b := encodePIN([]byte("123456")); !bytes.Equal(b, []byte{'1', '2', '3', '4', '5', '6', 0xff, 0xff}) {
+		t.Errorf("got %x, want a padded PIN", b)
+	}
+}
+
+func TestCardPINError(t *testing.T) {
+	card := testCard(5, 7, 1)
+	if err := card.pinError(&apduError{sw: 0x63c2}, ErrInvalidPIN); !errors.Is(err, ErrInvalidPIN) || err.Error() != "invalid PIN (2 retries remaining)" {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+	if err := card.pinError(&apduError{sw: 0x63c1}, ErrInvalidPUK); !errors.Is(err, ErrInvalidPUK) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPUK)
+	}
+	if err := card.pinError(&apduError{sw: swAuthBlocked}, ErrInvalidPIN); !errors.Is(err, ErrAuthBlocked) {
+		t.Errorf("got %v, want %v", err, ErrAuthBlocked)
+	}
+	if err := card.pinError(&apduError{sw: 0x6a80}, ErrInvalidPIN); !errors.Is(err, ErrPINComplexity) {
+		t.Errorf("got %v, want %v", err, ErrPINComplexity)
+	}
+	card = testCard(5, 4, 3)
+	if err := card.pinError(&apduError{sw: 0x6a80}, ErrInvalidPIN); errors.Is(err, ErrPINComplexity) {
+		t.Errorf("got %v, want a smart card error", err)
+	}
+}
+
+func TestCardSetRetries(t *testing.T) {
+	fmk := &fakeManagementKey{alg: ManagementKeyAlgorithm3DES, key: DefaultManagementKey[:]}
+	pin := encodePIN([]byte("654321"))
+	var retries []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := fmk.handle(t, req); resp != nil {
+			return resp
+		}
+		switch req[1] {
+		case insVerify:
+			if !bytes.Equal(req[5:13], pin) {
+				return []byte{0x63, 0xc2}
+			}
+			return []byte{0x90, 0x00}
+		case insSetRetries:
+			retries = []byte{req[2], req[3]}
+			return []byte{0x90, 0x00}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 4, 3)
+
+	if err := card.SetRetries(0, 3); err == nil {
+		t.Error("got nil, want an error")
+	}
+	card.SetPIN("123456")
+	if err := card.SetRetries(5, 3); !errors.Is(err, ErrInvalidPIN) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+	card.SetPIN("654321")
+	card.SetPUK("87654321")
+	if err := card.SetRetries(5, 3); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := []byte{5, 3}; !bytes.Equal(retries, want) {
+		t.Errorf("got %x, want %x", retries, want)
+	}
+	if string(card.pin.Bytes()) != DefaultPIN || string(card.puk.Bytes()) != DefaultPUK {
+		t.Errorf("got %v %v, want the default PIN and PUK", card.pin, card.puk)
+	}
+}
+
+func TestCardUnblock(t *testing.T) {
+	puk := encodePIN([]byte(DefaultPUK))
+	var pin []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		if req[1] != insResetRetryCounter || req[3] != keyPIN {
+			return []byte{0x6d, 0x00}
+		} else if !bytes.Equal(req[5:13], puk) {
+			return []byte{0x63, 0xc1}
+		}
+		pin = req[13:21]
+		return []byte{0x90, 0x00}
+	})
+	card := testCard(5, 4, 3)
+
+	if err := card.Unblock("87654321", "654321"); !errors.Is(err, ErrInvalidPUK) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPUK)
+	}
+	if err := card.Unblock(DefaultPUK, "12345"); err == nil {
+		t.Error("got nil, want an invalid PIN length error")
+	}
+	if err := card.UnblockSecret(NewSecretString(DefaultPUK), nil); err == nil {
+		t.Error("got nil, want an invalid PIN length error")
+	}
+	if err := card.Unblock(DefaultPUK, "654321"); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := encodePIN([]byte("654321")); !bytes.Equal(pin, want) || string(card.pin.Bytes()) != "654321" {
+		t.Errorf("got %x (%v), want %x", pin, card.pin, want)
+	}
+}
+
+func TestCardChangePINSecret(t *testing.T) {
+	var reference []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		if req[1] != insChangeReference {
+			return []byte{0x6d, 0x00}
+		} else if !bytes.Equal(req[5:13], encodePIN([]byte(DefaultPIN))) && !bytes.Equal(req[5:13], encodePIN([]byte(DefaultPUK))) {
+			return []byte{0x63, 0xc2}
+		}
+		reference = req[5 : 5+int(req[4])]
+		return []byte{0x90, 0x00}
+	})
+	card := testCard(5, 4, 3)
+
+	oldPIN, newPIN := NewSecretString(DefaultPIN), NewSecretString("654321")
+	if err := card.ChangePINSecret(oldPIN, newPIN); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := append(encodePIN([]byte(DefaultPIN)), encodePIN([]byte("654321"))...); !bytes.Equal(reference, want) {
+		t.Errorf("got %x, want %x", reference, want)
+	}
+	// The card keeps a copy of the new PIN
+	newPIN.Zero()
+	if string(card.pin.Bytes()) != "654321" || string(oldPIN.Bytes()) != DefaultPIN {
+		t.Errorf("got %v, want a copy of the new PIN", card.pin)
+	}
+
+	oldPUK, newPUK := NewSecretString(DefaultPUK), NewSecretString("87654321")
+	if err := card.ChangePUKSecret(oldPUK, newPUK); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	newPUK.Zero()
+	if string(card.puk.Bytes()) != "87654321" {
+		t.Errorf("got %v, want a copy of the new PUK", card.puk)
+	}
+	if err := card.ChangePINSecret(NewSecretString("111111"), NewSecretString("1")); err == nil {
+		t.Error("got nil, want an invalid PIN length error")
+	}
+}
@@ -0,0 +1,33 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardPIN(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		if retries, err := card.PINRetries(); err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if retries == 0 {
+			t.Errorf("got %v, want PIN retries", retries)
+		}
+		if err := card.ChangePIN(yubikey.DefaultPIN, yubikey.DefaultPIN); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		if err := card.ChangePUK(yubikey.DefaultPUK, yubikey.DefaultPUK); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		if err := card.ChangePIN(yubikey.DefaultPIN, "1"); err == nil {
+			t.Error("got nil, want an error")
+		}
+	}
+}
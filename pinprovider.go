@@ -0,0 +1,313 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// pinLineMaxLen holds the maximum length of a PIN line (including the line ending).
+// The line buffer isn't grown so the read PIN isn't copied into the other buffers.
+const pinLineMaxLen = 256
+
+// ErrNoSecret represents a missing keyring secret error.
+var ErrNoSecret = errors.New("secret not found in the keyring")
+
+// PINRequest represents a PIN request of a card.
+type PINRequest struct {
+	// Serial is the card serial number.
+	Serial string
+	// Retries is the remaining PIN retries if the previous PIN was wrong, otherwise it's -1.
+	Retries int
+}
+
+// PINProvider represents a PIN provider which is called lazily when a card operation requires the PIN.
+// It's called before the card is connected so it doesn't block the other card operations (i.e. a terminal prompt).
+type PINProvider interface {
+	// PIN returns the PIN by the given request. The returned secret is zeroized by the card after it's used.
+	// The providers which can't provide another PIN should return an error for the retry requests (i.e. StaticPIN)
+	// so the wrong PIN isn't verified again.
+	PIN(req PINRequest) (*Secret, error)
+}
+
+// StaticPIN represents a PIN provider which provides the given PIN.
+type StaticPIN string
+
+// PIN implements the PINProvider interface.
+func (pin StaticPIN) PIN(req PINRequest) (*Secret, error) {
+	if err := req.retryError(); err != nil {
+		return nil, err
+	}
+	return NewSecretString(string(pin)), nil
+}
+
+// EnvPIN represents a PIN provider which provides the PIN by the given environment variable name.
+type EnvPIN string
+
+// PIN implements the PINProvider interface.
+func (name EnvPIN) PIN(req PINRequest) (*Secret, error) {
+	if err := req.retryError(); err != nil {
+		return nil, err
+	}
+	pin, ok := os.LookupEnv(string(name))
+	if !ok {
+		return nil, fmt.Errorf("%w: environment variable %s is not set", ErrMissingPIN, name)
+	}
+	return NewSecretString(pin), nil
+}
+
+// FDPIN represents a PIN provider which provides the PIN by the first line of the given file descriptor (i.e. a pipe).
+// The file descriptor is read once and the PIN is kept by the provider.
+type FDPIN struct {
+	// FD is the file descriptor.
+	FD uintptr
+
+	once sync.Once
+	pin  *Secret
+	err  error
+}
+
+// PIN implements the PINProvider interface.
+func (p *FDPIN) PIN(req PINRequest) (*Secret, error) {
+	if err := req.retryError(); err != nil {
+		return nil, err
+	}
+	p.once.Do(func() {
+		f := os.NewFile(p.FD, "pin")
+		if f == nil {
+			p.err = fmt.Errorf("invalid PIN file descriptor: %d", p.FD)
+			return
+		}
+		defer f.Close()
+		p.pin, p.err = readLine(f)
+	})
+	return p.pin.Clone(), p.err
+}
+
+// FilePIN represents a PIN provider which provides the PIN by the first line of the given file path.
+type FilePIN string
+
+// PIN implements the PINProvider interface.
+func (path FilePIN) PIN(req PINRequest) (*Secret, error) {
+	if err := req.retryError(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(string(path))
+	if err != nil {
+		return nil, fmt.Errorf("%w: couldn't open the PIN file: %s", ErrMissingPIN, err)
+	}
+	defer f.Close()
+	return readLine(f)
+}
+
+// TerminalPIN represents a PIN provider which prompts the PIN on the terminal.
+// The wrong PINs are prompted again with the remaining retries.
+type TerminalPIN struct {
+	// Input is the input which the PIN is read from. The default is the standard input (without echo if it's a terminal).
+	Input io.Reader
+	// Output is the output which the prompt is written to. The default is the standard error.
+	Output io.Writer
+}
+
+// PIN implements the PINProvider interface.
+func (p *TerminalPIN) PIN(req PINRequest) (*Secret, error) {
+	input, output := p.Input, p.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	prompt := fmt.Sprintf("Enter the PIN of YubiKey %s: ", req.Serial)
+	if req.Retries >= 0 {
+		prompt = fmt.Sprintf("Wrong PIN (%d retries remaining). %s", req.Retries, prompt)
+	}
+	if _, err := fmt.Fprint(output, prompt); err != nil {
+		return nil, err
+	}
+	if input == nil {
+		// The PIN is read without echo if the standard input is a terminal
+		if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+			pin, err := term.ReadPassword(fd)
+			defer zero(pin)
+			fmt.Fprintln(output)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read the PIN: %s", err)
+			}
+			return NewSecret(pin), nil
+		}
+		input = os.Stdin
+	}
+	return readLine(input)
+}
+
+// Keyring represents a secret store (i.e. an OS keyring).
+type Keyring interface {
+	// Secret returns the secret by the given service and account. It returns ErrNoSecret if it's not found.
+	Secret(service, account string) (string, error)
+}
+
+// MapKeyring represents an in-memory keyring which is keyed by "service/account".
+// It's a local stand-in for the OS keyrings.
+type MapKeyring map[string]string
+
+// Secret implements the Keyring interface.
+func (keyring MapKeyring) Secret(service, account string) (string, error) {
+	secret, ok := keyring[service+"/"+account]
+	if !ok {
+		return "", ErrNoSecret
+	}
+	return secret, nil
+}
+
+// KeyringPIN represents a PIN provider which provides the PIN by a keyring.
+// The card serial number is used as the keyring account.
+type KeyringPIN struct {
+	// Keyring is the keyring.
+	Keyring Keyring
+	// Service is the keyring service name.
+	Service string
+}
+
+// PIN implements the PINProvider interface.
+func (p *KeyringPIN) PIN(req PINRequest) (*Secret, error) {
+	if err := req.retryError(); err != nil {
+		return nil, err
+	}
+	pin, err := p.Keyring.Secret(p.Service, req.Serial)
+	if err != nil {
+		return nil, fmt.Errorf("%w: couldn't get the keyring secret (%s/%s): %s", ErrMissingPIN, p.Service, req.Serial, err)
+	}
+	return NewSecretString(pin), nil
+}
+
+// retryError returns the invalid PIN error if the request is a retry request.
+func (req PINRequest) retryError() error {
+	if req.Retries >= 0 {
+		return fmt.Errorf("%w (%d retries remaining)", ErrInvalidPIN, req.Retries)
+	}
+	return nil
+}
+
+// SetPINProvider sets the PIN provider of the card. The provided PIN is cached for the given duration
+// (it's not cached if it's zero). The PIN which is set by SetPIN is used if the provider is nil.
+func (card *Card) SetPINProvider(provider PINProvider, ttl time.Duration) {
+	card.pinMu.Lock()
+	defer card.pinMu.Unlock()
+	card.pinProvider = provider
+	card.pinTTL = ttl
+	card.cachedPIN.Zero()
+	card.cachedPIN, card.cachedAt = nil, time.Time{}
+}
+
+// currentPIN returns a copy of the card PIN by the cache or the PIN provider. The caller must zeroize it.
+// The retries are the remaining retries of the previous wrong PIN (-1 for the first request).
+// The PIN provider is called without holding the locks so it can be interactive (i.e. TerminalPIN).
+func (card *Card) currentPIN(retries int) (*Secret, error) {
+	card.pinMu.Lock()
+	if card.pinProvider == nil {
+		defer card.pinMu.Unlock()
+		if card.pin.IsEmpty() {
+			return nil, ErrMissingPIN
+		}
+		return card.pin.Clone(), nil
+	}
+	if retries < 0 && !card.cachedPIN.IsEmpty() && time.Since(card.cachedAt) < card.pinTTL {
+		defer card.pinMu.Unlock()
+		return card.cachedPIN.Clone(), nil
+	}
+	card.cachedPIN.Zero()
+	card.cachedPIN = nil
+	provider := card.pinProvider
+	card.pinMu.Unlock()
+
+	return provider.PIN(PINRequest{Serial: card.serial, Retries: retries})
+}
+
+// setPIN sets a copy of the card PIN (or caches it if the card has a PIN provider) after a successful verification or change.
+func (card *Card) setPIN(pin *Secret) {
+	card.pinMu.Lock()
+	defer card.pinMu.Unlock()
+	if card.pinProvider == nil {
+		card.pin.Zero()
+		card.pin = pin.Clone()
+	} else if card.pinTTL > 0 {
+		card.cachedPIN.Zero()
+		card.cachedPIN, card.cachedAt = pin.Clone(), time.Now()
+	}
+}
+
+// withPIN resolves the card PIN and calls the given function by a function which verifies the PIN by a session.
+// The PIN is resolved before the card is connected so the PIN provider doesn't block the other card operations.
+// The given function is called again by the next provided PIN if the PIN is wrong and the card has a PIN provider.
+// The verify function doesn't verify anything if the PIN isn't required.
+func (card *Card) withPIN(required bool, f func(verify func(s *session) error) error) error {
+	if !required {
+		return f(func(*session) error { return nil })
+	}
+	retries := -1
+	for {
+		pin, err := card.currentPIN(retries)
+		if err != nil {
+			return err
+		}
+		var verifyErr error
+		err = f(func(s *session) error {
+			if verifyErr = verifyPIN(s, pin.Bytes()); verifyErr == nil {
+				card.setPIN(pin)
+			}
+			return verifyErr
+		})
+		pin.Zero()
+		var apduErr *apduError
+		if errors.As(verifyErr, &apduErr) && card.hasPINProvider() {
+			if r, ok := apduErr.retries(); ok && r > 0 {
+				retries = r
+				continue
+			}
+		}
+		return err
+	}
+}
+
+// hasPINProvider returns whether the card has a PIN provider or not.
+func (card *Card) hasPINProvider() bool {
+	card.pinMu.Lock()
+	defer card.pinMu.Unlock()
+	return card.pinProvider != nil
+}
+
+// readLine reads a line from the given reader without the line ending.
+// It reads byte by byte so the following lines aren't consumed. The lines longer than pinLineMaxLen are rejected.
+func readLine(r io.Reader) (*Secret, error) {
+	line := make([]byte, 0, pinLineMaxLen)
+	b := make([]byte, 1)
+	defer func() {
+		zero(line[:cap(line)])
+		zero(b)
+	}()
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			} else if len(line) == cap(line) {
+				return nil, fmt.Errorf("couldn't read the PIN: longer than %d bytes", pinLineMaxLen)
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("couldn't read the PIN: %s", err)
+		}
+	}
+	return NewSecret(bytes.TrimRight(line, "\r")), nil
+}
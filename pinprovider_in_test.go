@@ -0,0 +1,199 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePINProvider represents a PIN provider which provides the given PINs in order.
+type fakePINProvider struct {
+	pins     []string
+	requests []PINRequest
+	onPIN    func()
+}
+
+// PIN implements the PINProvider interface.
+func (p *fakePINProvider) PIN(req PINRequest) (*Secret, error) {
+	if p.onPIN != nil {
+		p.onPIN()
+	}
+	p.requests = append(p.requests, req)
+	if len(p.requests) > len(p.pins) {
+		return nil, ErrMissingPIN
+	}
+	return NewSecretString(p.pins[len(p.requests)-1]), nil
+}
+
+// useFakePIN replaces the smart card transport with a fake PIV application which verifies the given PIN.
+// It returns the number of the verifications.
+func useFakePIN(t *testing.T, pin string) *int {
+	t.Helper()
+	verifications := 0
+	retries := 3
+	useFakeTransport(t, func(req []byte) []byte {
+		if req[1] != insVerify {
+			return []byte{0x6d, 0x00}
+		}
+		verifications++
+		if !bytes.Equal(req[5:13], encodePIN([]byte(pin))) {
+			retries--
+			return []byte{0x63, 0xc0 | byte(retries)}
+		}
+		retries = 3
+		return []byte{0x90, 0x00}
+	})
+	return &verifications
+}
+
+// verifyCardPIN verifies the card PIN by a new session.
+func verifyCardPIN(card *Card) error {
+	return card.withPIN(true, func(verify func(s *session) error) error {
+		return card.withSession(aidPIV, verify)
+	})
+}
+
+func TestCardVerifyPINProvider(t *testing.T) {
+	verifications := useFakePIN(t, "654321")
+	card := testCard(5, 4, 3)
+
+	// Wrong PIN is requested again with the remaining retries
+	p := &fakePINProvider{pins: []string{"111111", "654321"}}
+	card.SetPINProvider(p, time.Minute)
+	if err := verifyCardPIN(card); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(p.requests) != 2 || p.requests[0].Retries != -1 || p.requests[1].Retries != 2 || p.requests[1].Serial != "12345678" {
+		t.Errorf("got %+v, want a retry request", p.requests)
+	}
+
+	// The PIN is cached
+	if err := verifyCardPIN(card); err != nil || len(p.requests) != 2 {
+		t.Errorf("got %v (%d requests), want a cached PIN", err, len(p.requests))
+	}
+	card.cachedAt = time.Now().Add(-time.Hour)
+	p.pins = append(p.pins, "654321")
+	if err := verifyCardPIN(card); err != nil || len(p.requests) != 3 {
+		t.Errorf("got %v (%d requests), want an expired PIN", err, len(p.requests))
+	}
+
+	// The provider is called without holding the locks
+	p = &fakePINProvider{pins: []string{"111111", "654321"}, onPIN: func() {
+		if !openMu.TryLock() {
+			t.Error("got a held card lock, want an unlocked card")
+			return
+		}
+		openMu.Unlock()
+		if !card.pinMu.TryLock() {
+			t.Error("got a held PIN lock, want an unlocked PIN")
+			return
+		}
+		card.pinMu.Unlock()
+	}}
+	card.SetPINProvider(p, 0)
+	if err := verifyCardPIN(card); err != nil || len(p.requests) != 2 {
+		t.Errorf("got %v (%d requests), want nil", err, len(p.requests))
+	}
+
+	// Static PINs aren't verified again
+	*verifications = 0
+	card.SetPINProvider(StaticPIN("111111"), 0)
+	if err := verifyCardPIN(card); !errors.Is(err, ErrInvalidPIN) || *verifications != 1 {
+		t.Errorf("got %v (%d verifications), want %v", err, *verifications, ErrInvalidPIN)
+	}
+
+	// PIN changes are cached
+	card.SetPINProvider(&fakePINProvider{}, time.Minute)
+	card.setPIN(NewSecretString("654321"))
+	if err := verifyCardPIN(card); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+
+	// SetPIN removes the provider
+	card.SetPIN("")
+	if err := verifyCardPIN(card); !errors.Is(err, ErrMissingPIN) {
+		t.Errorf("got %v, want %v", err, ErrMissingPIN)
+	}
+}
+
+func TestPINProviders(t *testing.T) {
+	req := PINRequest{Serial: "12345678", Retries: -1}
+	retry := PINRequest{Serial: "12345678", Retries: 2}
+
+	if pin, err := StaticPIN("123456").PIN(req); err != nil || string(pin.Bytes()) != "123456" {
+		t.Errorf("got %v (%v), want 123456", pin, err)
+	}
+	if _, err := StaticPIN("123456").PIN(retry); !errors.Is(err, ErrInvalidPIN) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+
+	t.Setenv("YUBIKEY_TEST_PIN", "234567")
+	if pin, err := EnvPIN("YUBIKEY_TEST_PIN").PIN(req); err != nil || string(pin.Bytes()) != "234567" {
+		t.Errorf("got %v (%v), want 234567", pin, err)
+	}
+	if _, err := EnvPIN("YUBIKEY_TEST_MISSING_PIN").PIN(req); !errors.Is(err, ErrMissingPIN) {
+		t.Errorf("got %v, want %v", err, ErrMissingPIN)
+	}
+
+	keyring := &KeyringPIN{Keyring: MapKeyring{"yubikey/12345678": "345678"}, Service: "yubikey"}
+	if pin, err := keyring.PIN(req); err != nil || string(pin.Bytes()) != "345678" {
+		t.Errorf("got %v (%v), want 345678", pin, err)
+	}
+	if _, err := keyring.PIN(PINRequest{Serial: "87654321", Retries: -1}); !errors.Is(err, ErrMissingPIN) {
+		t.Errorf("got %v, want %v", err, ErrMissingPIN)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	w.WriteString("456789\n")
+	w.Close()
+	fd := &FDPIN{FD: r.Fd()}
+	for i := 0; i < 2; i++ {
+		if pin, err := fd.PIN(req); err != nil || string(pin.Bytes()) != "456789" {
+			t.Errorf("got %v (%v), want 456789", pin, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "pin")
+	if err := os.WriteFile(path, []byte("987654\n"), 0600); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if pin, err := FilePIN(path).PIN(req); err != nil || string(pin.Bytes()) != "987654" {
+		t.Errorf("got %v (%v), want 987654", pin, err)
+	}
+	if _, err := FilePIN(path + ".missing").PIN(req); !errors.Is(err, ErrMissingPIN) {
+		t.Errorf("got %v, want %v", err, ErrMissingPIN)
+	}
+
+	var output bytes.Buffer
+	terminal := &TerminalPIN{Input: strings.NewReader("567890\r\n678901\n"), Output: &output}
+	if pin, err := terminal.PIN(req); err != nil || string(pin.Bytes()) != "567890" {
+		t.Errorf("got %v (%v), want 567890", pin, err)
+	}
+	if pin, err := terminal.PIN(retry); err != nil || string(pin.Bytes()) != "678901" {
+		t.Errorf("got %v (%v), want 678901", pin, err)
+	}
+	if s := output.String(); !strings.Contains(s, "YubiKey 12345678") || !strings.Contains(s, "2 retries remaining") {
+		t.Errorf("got %v, want the prompts", s)
+	}
+	if _, err := terminal.PIN(req); err == nil {
+		t.Error("got nil, want a read error")
+	}
+
+	// The line buffer isn't grown
+	if pin, err := readLine(strings.NewReader(strings.Repeat("1", pinLineMaxLen) + "\n")); err != nil || pin.Len() != pinLineMaxLen {
+		t.Errorf("got %v (%v), want %d bytes", pin.Len(), err, pinLineMaxLen)
+	}
+	if _, err := readLine(strings.NewReader(strings.Repeat("1", pinLineMaxLen+1) + "\n")); err == nil {
+		t.Error("got nil, want a length error")
+	}
+}
@@ -4,7 +4,7 @@
 package yubikey
 
 import (
-	"github.com/go-piv/piv-go/piv"
+	"fmt"
 )
 
 const (
@@ -35,17 +35,67 @@ func (pinPolicy PINPolicy) String() string {
 	}
 }
 
-// piv returns the PIV representation of the policy.
-func (pinPolicy PINPolicy) piv() piv.PINPolicy {
+// MarshalText implements the encoding.TextMarshaler interface.
+func (pinPolicy PINPolicy) MarshalText() ([]byte, error) {
+	return []byte(pinPolicy.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface by ParsePINPolicy.
+// An empty text is the unknown policy.
+func (pinPolicy *PINPolicy) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*pinPolicy = PINPolicyUnknown
+		return nil
+	}
+	v, err := ParsePINPolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*pinPolicy = v
+	return nil
+}
+
+// ParsePINPolicy returns the PIN policy by the given name. The names are case-insensitive.
+// The "default" name is the unknown policy which means the card default policy.
+func ParsePINPolicy(name string) (PINPolicy, error) {
+	switch normalizeName(name) {
+	case "default":
+		return PINPolicyUnknown, nil
+	case "never":
+		return PINPolicyNever, nil
+	case "once":
+		return PINPolicyOnce, nil
+	case "always":
+		return PINPolicyAlways, nil
+	}
+	return PINPolicyUnknown, fmt.Errorf("unknown PIN policy: %q", name)
+}
+
+// code returns the PIV encoded value of the PIN policy.
+func (pinPolicy PINPolicy) code() byte {
 	switch pinPolicy {
 	case PINPolicyNever:
-		return piv.PINPolicyNever
+		return 0x01
 	case PINPolicyOnce:
-		return piv.PINPolicyOnce
+		return 0x02
 	case PINPolicyAlways:
-		return piv.PINPolicyAlways
+		return 0x03
+	default:
+		return 0x00
+	}
+}
+
+// pinPolicyFromByte returns the PIN policy by the given PIV encoded policy value.
+func pinPolicyFromByte(b byte) PINPolicy {
+	switch b {
+	case 0x01:
+		return PINPolicyNever
+	case 0x02:
+		return PINPolicyOnce
+	case 0x03:
+		return PINPolicyAlways
 	default:
-		return piv.PINPolicy(0)
+		return PINPolicyUnknown
 	}
 }
 
@@ -77,16 +127,66 @@ func (touchPolicy TouchPolicy) String() string {
 	}
 }
 
-// piv returns the PIV representation of the policy.
-func (touchPolicy TouchPolicy) piv() piv.TouchPolicy {
+// MarshalText implements the encoding.TextMarshaler interface.
+func (touchPolicy TouchPolicy) MarshalText() ([]byte, error) {
+	return []byte(touchPolicy.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface by ParseTouchPolicy.
+// An empty text is the unknown policy.
+func (touchPolicy *TouchPolicy) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*touchPolicy = TouchPolicyUnknown
+		return nil
+	}
+	v, err := ParseTouchPolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*touchPolicy = v
+	return nil
+}
+
+// ParseTouchPolicy returns the touch policy by the given name. The names are case-insensitive.
+// The "default" name is the unknown policy which means the card default policy.
+func ParseTouchPolicy(name string) (TouchPolicy, error) {
+	switch normalizeName(name) {
+	case "default":
+		return TouchPolicyUnknown, nil
+	case "never", "off":
+		return TouchPolicyNever, nil
+	case "always", "on":
+		return TouchPolicyAlways, nil
+	case "cached":
+		return TouchPolicyCached, nil
+	}
+	return TouchPolicyUnknown, fmt.Errorf("unknown touch policy: %q", name)
+}
+
+// code returns the PIV encoded value of the touch policy.
+func (touchPolicy TouchPolicy) code() byte {
 	switch touchPolicy {
 	case TouchPolicyNever:
-		return piv.TouchPolicyNever
+		return 0x01
 	case TouchPolicyAlways:
-		return piv.TouchPolicyAlways
+		return 0x02
 	case TouchPolicyCached:
-		return piv.TouchPolicyCached
+		return 0x03
+	default:
+		return 0x00
+	}
+}
+
+// touchPolicyFromByte returns the touch policy by the given PIV encoded policy value.
+func touchPolicyFromByte(b byte) TouchPolicy {
+	switch b {
+	case 0x01:
+		return TouchPolicyNever
+	case 0x02:
+		return TouchPolicyAlways
+	case 0x03:
+		return TouchPolicyCached
 	default:
-		return piv.TouchPolicy(0)
+		return TouchPolicyUnknown
 	}
 }
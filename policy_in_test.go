@@ -5,22 +5,20 @@ package yubikey
 
 import (
 	"testing"
-
-	"github.com/go-piv/piv-go/piv"
 )
 
 func TestPINPolicyPIV(t *testing.T) {
 	table := []struct {
 		policy PINPolicy
-		want   piv.PINPolicy
+		want   byte
 	}{
 		{PINPolicyUnknown, 0},
-		{PINPolicyNever, piv.PINPolicyNever},
-		{PINPolicyOnce, piv.PINPolicyOnce},
-		{PINPolicyAlways, piv.PINPolicyAlways},
+		{PINPolicyNever, 0x01},
+		{PINPolicyOnce, 0x02},
+		{PINPolicyAlways, 0x03},
 	}
 	for _, v := range table {
-		if p := v.policy.piv(); p != v.want {
+		if p := v.policy.code(); p != v.want {
 			t.Errorf("got %v, want %v", p, v.want)
 		}
 	}
@@ -29,16 +27,75 @@ func TestPINPolicyPIV(t *testing.T) {
 func TestTouchPolicyPIV(t *testing.T) {
 	table := []struct {
 		policy TouchPolicy
-		want   piv.TouchPolicy
+		want   byte
 	}{
 		{TouchPolicyUnknown, 0},
-		{TouchPolicyNever, piv.TouchPolicyNever},
-		{TouchPolicyAlways, piv.TouchPolicyAlways},
-		{TouchPolicyCached, piv.TouchPolicyCached},
+		{TouchPolicyNever, 0x01},
+		{TouchPolicyAlways, 0x02},
+		{TouchPolicyCached, 0x03},
+	}
+	for _, v := range table {
+		if p := v.policy.code(); p != v.want {
+			t.Errorf("got %v, want %v", p, v.want)
+		}
+	}
+}
+
+func TestPINPolicyFromByte(t *testing.T) {
+	table := []struct {
+		b    byte
+		want PINPolicy
+	}{
+		{0x00, PINPolicyUnknown},
+		{0x01, PINPolicyNever},
+		{0x02, PINPolicyOnce},
+		{0x03, PINPolicyAlways},
 	}
 	for _, v := range table {
-		if p := v.policy.piv(); p != v.want {
+		if p := pinPolicyFromByte(v.b); p != v.want {
 			t.Errorf("got %v, want %v", p, v.want)
 		}
 	}
 }
+
+func TestTouchPolicyFromByte(t *testing.T) {
+	table := []struct {
+		b    byte
+		want TouchPolicy
+	}{
+		{0x00, TouchPolicyUnknown},
+		{0x01, TouchPolicyNever},
+		{0x02, TouchPolicyAlways},
+		{0x03, TouchPolicyCached},
+	}
+	for _, v := range table {
+		if p := touchPolicyFromByte(v.b); p != v.want {
+			t.Errorf("got %v, want %v", p, v.want)
+		}
+	}
+}
+
+func TestPolicyText(t *testing.T) {
+	for _, policy := range []PINPolicy{PINPolicyUnknown, PINPolicyNever, PINPolicyOnce, PINPolicyAlways} {
+		b, _ := policy.MarshalText()
+		var got PINPolicy
+		if err := got.UnmarshalText(b); err != nil || got != policy {
+			t.Errorf("got %v (%v), want %v", got, err, policy)
+		}
+	}
+	for _, policy := range []TouchPolicy{TouchPolicyUnknown, TouchPolicyNever, TouchPolicyAlways, TouchPolicyCached} {
+		b, _ := policy.MarshalText()
+		var got TouchPolicy
+		if err := got.UnmarshalText(b); err != nil || got != policy {
+			t.Errorf("got %v (%v), want %v", got, err, policy)
+		}
+	}
+	var pinPolicy PINPolicy
+	if err := pinPolicy.UnmarshalText([]byte("once")); err != nil || pinPolicy != PINPolicyOnce {
+		t.Errorf("got %v (%v), want %v", pinPolicy, err, PINPolicyOnce)
+	}
+	var touchPolicy TouchPolicy
+	if err := touchPolicy.UnmarshalText([]byte("sometimes")); err == nil {
+		t.Errorf("got nil, want error")
+	}
+}
@@ -42,3 +42,48 @@ func TestTouchPolicyString(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePINPolicy(t *testing.T) {
+	table := []struct {
+		name string
+		want yubikey.PINPolicy
+	}{
+		{"default", yubikey.PINPolicyUnknown},
+		{"never", yubikey.PINPolicyNever},
+		{"Once", yubikey.PINPolicyOnce},
+		{"ALWAYS", yubikey.PINPolicyAlways},
+	}
+	for _, v := range table {
+		if policy, err := yubikey.ParsePINPolicy(v.name); err != nil || policy != v.want {
+			t.Errorf("got %v (%v), want %v", policy, err, v.want)
+		}
+	}
+	for _, name := range []string{"", "match-once", "sometimes"} {
+		if _, err := yubikey.ParsePINPolicy(name); err == nil {
+			t.Errorf("got nil, want error (%s)", name)
+		}
+	}
+}
+
+func TestParseTouchPolicy(t *testing.T) {
+	table := []struct {
+		name string
+		want yubikey.TouchPolicy
+	}{
+		{"default", yubikey.TouchPolicyUnknown},
+		{"Never", yubikey.TouchPolicyNever},
+		{"off", yubikey.TouchPolicyNever},
+		{"always", yubikey.TouchPolicyAlways},
+		{"CACHED", yubikey.TouchPolicyCached},
+	}
+	for _, v := range table {
+		if policy, err := yubikey.ParseTouchPolicy(v.name); err != nil || policy != v.want {
+			t.Errorf("got %v (%v), want %v", policy, err, v.want)
+		}
+	}
+	for _, name := range []string{"", "once", "sometimes"} {
+		if _, err := yubikey.ParseTouchPolicy(name); err == nil {
+			t.Errorf("got nil, want error (%s)", name)
+		}
+	}
+}
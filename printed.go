@@ -0,0 +1,104 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// Printed Information tags
+	// Ref: https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-73-4.pdf#page=41
+	tagPrintedName         = 0x01
+	tagPrintedEmployee     = 0x02
+	tagPrintedExpiration   = 0x04
+	tagPrintedAgencySerial = 0x05
+	tagPrintedIssuer       = 0x06
+	tagPrintedOrgLine1     = 0x07
+	tagPrintedOrgLine2     = 0x08
+	printedDateLayout      = "2006Jan02"
+)
+
+// Printed represents the Printed Information data object.
+// Writing it removes the PIN-protected management key since it's stored in the same data object.
+type Printed struct {
+	// Name is the cardholder name (up to 125 characters).
+	Name string
+	// EmployeeAffiliation is the employee affiliation (up to 20 characters).
+	EmployeeAffiliation string
+	// Expiration is the card expiration date.
+	Expiration time.Time
+	// AgencySerial is the agency card serial number (up to 20 characters).
+	AgencySerial string
+	// Issuer is the issuer identification (up to 15 characters).
+	Issuer string
+	// OrganizationAffiliation1 is the first line of the organization affiliation (up to 20 characters).
+	OrganizationAffiliation1 string
+	// OrganizationAffiliation2 is the second line of the organization affiliation (up to 20 characters).
+	OrganizationAffiliation2 string
+}
+
+// ParsePrinted parses the given Printed Information data object content.
+func ParsePrinted(b []byte) (*Printed, error) {
+	list, err := parseTLVs(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid printed information: %s", err)
+	}
+
+	var printed Printed
+	for _, v := range list {
+		switch v.tag {
+		case tagPrintedName:
+			printed.Name = string(v.value)
+		case tagPrintedEmployee:
+			printed.EmployeeAffiliation = string(v.value)
+		case tagPrintedExpiration:
+			if printed.Expiration, err = time.Parse(printedDateLayout, string(v.value)); err != nil {
+				return nil, fmt.Errorf("invalid printed information expiration date: %s", err)
+			}
+		case tagPrintedAgencySerial:
+			printed.AgencySerial = string(v.value)
+		case tagPrintedIssuer:
+			printed.Issuer = string(v.value)
+		case tagPrintedOrgLine1:
+			printed.OrganizationAffiliation1 = string(v.value)
+		case tagPrintedOrgLine2:
+			printed.OrganizationAffiliation2 = string(v.value)
+		}
+	}
+
+	return &printed, nil
+}
+
+// Marshal returns the Printed Information data object content.
+func (printed *Printed) Marshal() []byte {
+	var b []byte
+	for _, v := range []struct {
+		tag   uint32
+		value string
+	}{
+		{tagPrintedName, printed.Name},
+		{tagPrintedEmployee, printed.EmployeeAffiliation},
+		{tagPrintedExpiration, expirationDate(printed.Expiration)},
+		{tagPrintedAgencySerial, printed.AgencySerial},
+		{tagPrintedIssuer, printed.Issuer},
+		{tagPrintedOrgLine1, printed.OrganizationAffiliation1},
+		{tagPrintedOrgLine2, printed.OrganizationAffiliation2},
+	} {
+		if v.value != "" {
+			b = append(b, marshalTLV(v.tag, []byte(v.value))...)
+		}
+	}
+	return append(b, marshalTLV(tagErrorDetection, nil)...)
+}
+
+// expirationDate returns the printed expiration date (i.e. 2030JAN01) of the given time.
+func expirationDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strings.ToUpper(t.Format(printedDateLayout))
+}
@@ -0,0 +1,199 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+)
+
+// jwk represents a JSON Web Key.
+// Ref: https://www.rfc-editor.org/rfc/rfc7517
+// Ref: https://www.rfc-editor.org/rfc/rfc8037
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// CryptoPublicKey returns the public key of the slot as a crypto.PublicKey
+// (*ecdsa.PublicKey, ed25519.PublicKey or *rsa.PublicKey) if any.
+func (slot *Slot) CryptoPublicKey() crypto.PublicKey {
+	return slot.cryptoKey
+}
+
+// PublicKeyUncompressed returns the uncompressed SEC1 point of the slot public key if it's an ECDSA key.
+func (slot *Slot) PublicKeyUncompressed() []byte {
+	if slot.publicKeyECDSA == nil {
+		return nil
+	}
+	return elliptic.Marshal(slot.publicKeyECDSA.Curve, slot.publicKeyECDSA.X, slot.publicKeyECDSA.Y)
+}
+
+// PublicKeyPKIX returns the PKIX (SubjectPublicKeyInfo) DER encoding of the slot public key.
+func (slot *Slot) PublicKeyPKIX() ([]byte, error) {
+	if slot.cryptoKey == nil {
+		return nil, ErrNoKey
+	}
+	b, err := x509.MarshalPKIXPublicKey(slot.cryptoKey)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal the public key (%s): %s", slot.key, err)
+	}
+	return b, nil
+}
+
+// PublicKeyPEM returns the PEM encoding ("PUBLIC KEY" block) of the slot public key.
+func (slot *Slot) PublicKeyPEM() ([]byte, error) {
+	b, err := slot.PublicKeyPKIX()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}), nil
+}
+
+// PublicKeyJWK returns the JSON Web Key encoding of the slot public key.
+func (slot *Slot) PublicKeyJWK() ([]byte, error) {
+	key, err := slot.jwk()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(key)
+}
+
+// PublicKeySSH returns the OpenSSH authorized_keys line of the slot public key with the given comment (if any).
+func (slot *Slot) PublicKeySSH(comment string) (string, error) {
+	keyType, b, err := slot.sshPublicKey()
+	if err != nil {
+		return "", err
+	}
+	line := keyType + " " + base64.StdEncoding.EncodeToString(b)
+	if comment != "" {
+		line += " " + comment
+	}
+	return line, nil
+}
+
+// jwk returns the JSON Web Key of the slot public key.
+func (slot *Slot) jwk() (*jwk, error) {
+	enc := base64.RawURLEncoding
+	var key jwk
+	switch pub := slot.cryptoKey.(type) {
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		key = jwk{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   enc.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   enc.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		key = jwk{Kty: "OKP", Crv: "Ed25519", X: enc.EncodeToString(pub)}
+	case *rsa.PublicKey:
+		key = jwk{Kty: "RSA", N: enc.EncodeToString(pub.N.Bytes()), E: enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())}
+	case nil:
+		return nil, ErrNoKey
+	default:
+		return nil, fmt.Errorf("unsupported public key type: %T", pub)
+	}
+	return &key, nil
+}
+
+// sshPublicKey returns the SSH key type and wire encoding of the slot public key.
+// Ref: https://www.rfc-editor.org/rfc/rfc4253#section-6.6
+// Ref: https://www.rfc-editor.org/rfc/rfc5656#section-3.1
+func (slot *Slot) sshPublicKey() (string, []byte, error) {
+	var keyType string
+	var b []byte
+	switch pub := slot.cryptoKey.(type) {
+	case *ecdsa.PublicKey:
+		var curve string
+		switch pub.Curve {
+		case elliptic.P256():
+			curve = "nistp256"
+		case elliptic.P384():
+			curve = "nistp384"
+		default:
+			return "", nil, fmt.Errorf("unsupported curve: %s", pub.Curve.Params().Name)
+		}
+		keyType = "ecdsa-sha2-" + curve
+		b = sshString(b, []byte(keyType))
+		b = sshString(b, []byte(curve))
+		b = sshString(b, elliptic.Marshal(pub.Curve, pub.X, pub.Y))
+	case ed25519.PublicKey:
+		keyType = "ssh-ed25519"
+		b = sshString(b, []byte(keyType))
+		b = sshString(b, pub)
+	case *rsa.PublicKey:
+		keyType = "ssh-rsa"
+		b = sshString(b, []byte(keyType))
+		b = sshString(b, sshMPInt(big.NewInt(int64(pub.E))))
+		b = sshString(b, sshMPInt(pub.N))
+	case nil:
+		return "", nil, ErrNoKey
+	default:
+		return "", nil, fmt.Errorf("unsupported public key type: %T", pub)
+	}
+	return keyType, b, nil
+}
+
+// setPublicKey sets the slot public key fields by the given public key.
+func (slot *Slot) setPublicKey(pub crypto.PublicKey) {
+	slot.cryptoKey = pub
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		slot.publicKeyECDSA = pub
+		slot.publicKey = elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y)
+		switch pub.Curve {
+		case elliptic.P256():
+			slot.publicKeyAlg = AlgorithmEC256
+		case elliptic.P384():
+			slot.publicKeyAlg = AlgorithmEC384
+		default:
+			slot.publicKeyAlg = AlgorithmUnknown
+		}
+	case ed25519.PublicKey:
+		slot.publicKeyAlg = AlgorithmEd25519
+	case *rsa.PublicKey:
+		switch pub.N.BitLen() {
+		case 1024:
+			slot.publicKeyAlg = AlgorithmRSA1024
+		case 2048:
+			slot.publicKeyAlg = AlgorithmRSA2048
+		case 3072:
+			slot.publicKeyAlg = AlgorithmRSA3072
+		case 4096:
+			slot.publicKeyAlg = AlgorithmRSA4096
+		default:
+			slot.publicKeyAlg = AlgorithmUnknown
+		}
+	}
+}
+
+// sshString appends the given data as an SSH string (uint32 length and data).
+func sshString(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// sshMPInt returns the SSH mpint encoding of the given positive integer (with a leading zero byte if the high bit is set).
+func sshMPInt(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0x00}, b...)
+	}
+	return b
+}
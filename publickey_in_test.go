@@ -0,0 +1,125 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSlotPublicKeyFormats(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	table := []struct {
+		key crypto.PublicKey
+		alg Algorithm
+		jwk map[string]string
+		ssh string
+	}{
+		{&ecKey.PublicKey, AlgorithmEC256, map[string]string{"kty": "EC", "crv": "P-256"}, "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBB"},
+		{edKey, AlgorithmEd25519, map[string]string{"kty": "OKP", "crv": "Ed25519"}, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI"},
+		{&rsaKey.PublicKey, AlgorithmRSA2048, map[string]string{"kty": "RSA", "e": "AQAB"}, "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ"},
+	}
+	for _, v := range table {
+		slot := &Slot{key: "9a"}
+		slot.setPublicKey(v.key)
+		// The compressed public key is only set for the ECDSA keys
+		if slot.PublicKeyAlgorithm() != v.alg || !reflect.DeepEqual(slot.CryptoPublicKey(), v.key) || (len(slot.PublicKey()) == 0) != (v.alg != AlgorithmEC256) {
+			t.Errorf("got %v, want %v", slot.PublicKeyAlgorithm(), v.alg)
+		}
+
+		// PKIX and PEM
+		der, err := slot.PublicKeyPKIX()
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if pub, err := x509.ParsePKIXPublicKey(der); err != nil || !reflect.DeepEqual(pub, v.key) {
+			t.Errorf("got %v (%v), want %v", pub, err, v.key)
+		}
+		b, err := slot.PublicKeyPEM()
+		if block, _ := pem.Decode(b); err != nil || block == nil || block.Type != "PUBLIC KEY" || !bytes.Equal(block.Bytes, der) {
+			t.Errorf("got %s (%v), want a PEM public key", b, err)
+		}
+
+		// JWK
+		b, err = slot.PublicKeyJWK()
+		var jwk map[string]string
+		if err != nil || json.Unmarshal(b, &jwk) != nil {
+			t.Fatalf("got %s (%v), want a JWK", b, err)
+		}
+		for k, want := range v.jwk {
+			if jwk[k] != want {
+				t.Errorf("got %v, want %v for %v", jwk[k], want, k)
+			}
+		}
+
+		// SSH
+		line, err := slot.PublicKeySSH("yubikey 9a")
+		if err != nil || !strings.HasPrefix(line, v.ssh) || !strings.HasSuffix(line, " yubikey 9a") {
+			t.Errorf("got %v (%v), want %v...", line, err, v.ssh)
+		}
+	}
+	// RSA 3072 and 4096 keys (firmware 5.7+)
+	for bits, want := range map[int]Algorithm{3072: AlgorithmRSA3072, 4096: AlgorithmRSA4096} {
+		slot := &Slot{key: "9a"}
+		slot.setPublicKey(&rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), E: 65537})
+		if slot.PublicKeyAlgorithm() != want {
+			t.Errorf("got %v, want %v", slot.PublicKeyAlgorithm(), want)
+		}
+	}
+}
+
+func TestSlotPublicKeyJWKCoordinates(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	slot := &Slot{key: "9c"}
+	slot.setPublicKey(&key.PublicKey)
+	b, err := slot.PublicKeyJWK()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	var jwk map[string]string
+	json.Unmarshal(b, &jwk)
+	x, _ := base64.RawURLEncoding.DecodeString(jwk["x"])
+	y, _ := base64.RawURLEncoding.DecodeString(jwk["y"])
+	if jwk["crv"] != "P-384" || len(x) != 48 || len(y) != 48 {
+		t.Errorf("got %s, want P-384 coordinates", b)
+	}
+	if want := elliptic.Marshal(elliptic.P384(), key.X, key.Y); !bytes.Equal(slot.PublicKeyUncompressed(), want) {
+		t.Errorf("got %x, want %x", slot.PublicKeyUncompressed(), want)
+	}
+}
+
+func TestSlotPublicKeyNoKey(t *testing.T) {
+	slot := &Slot{key: "9a"}
+	if _, err := slot.PublicKeyPKIX(); !errors.Is(err, ErrNoKey) {
+		t.Errorf("got %v, want %v", err, ErrNoKey)
+	}
+	if _, err := slot.PublicKeyJWK(); !errors.Is(err, ErrNoKey) {
+		t.Errorf("got %v, want %v", err, ErrNoKey)
+	}
+	if _, err := slot.PublicKeySSH(""); !errors.Is(err, ErrNoKey) {
+		t.Errorf("got %v, want %v", err, ErrNoKey)
+	}
+	if slot.PublicKeyUncompressed() != nil || slot.CryptoPublicKey() != nil {
+		t.Error("got a public key, want nil")
+	}
+}
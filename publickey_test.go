@@ -0,0 +1,37 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestSlotPublicKeyFormats(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		slots, err := card.Slots()
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		for _, slot := range slots {
+			if !slot.HasKey() || slot.CryptoPublicKey() == nil {
+				continue
+			}
+			if _, err := slot.PublicKeyPEM(); err != nil {
+				t.Errorf("got %v, want nil", err)
+			}
+			if _, err := slot.PublicKeyJWK(); err != nil {
+				t.Errorf("got %v, want nil", err)
+			}
+			if _, err := slot.PublicKeySSH(card.Serial()); err != nil {
+				t.Errorf("got %v, want nil", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	// PIV instructions
+	insChangeReference = 0x24
+	insReset           = 0xfb
+
+	// resetMaxAttempts holds the maximum number of the attempts for blocking the PIN or PUK.
+	resetMaxAttempts = 0xff
+)
+
+// ErrResetNotConfirmed represents a not confirmed reset error.
+var ErrResetNotConfirmed = errors.New("reset is not confirmed")
+
+// Reset resets the PIV application of the card. All the slot keys, certificates and data objects are deleted.
+// The given confirmation must be the card serial number so a card can't be reset by mistake.
+// The PIN and PUK are blocked first since the card only accepts the reset when both of them are blocked.
+// The card PIN, PUK and management key are set to their default values after the reset.
+func (card *Card) Reset(confirm string) error {
+	if confirm == "" || confirm != card.serial {
+		return ErrResetNotConfirmed
+	}
+
+	// Connect to the smart card
+	return card.withSession(aidPIV, func(s *session) error {
+		// Block the PIN and PUK by invalid values which are never accepted by the card (all padding bytes)
+		if err := blockPIN(s, apdu{ins: insVerify, p2: keyPIN, data: bytes.Repeat([]byte{0xff}, pinMaxLen)}); err != nil {
+			return fmt.Errorf("couldn't block the PIN: %s", err)
+		}
+		if err := blockPIN(s, apdu{ins: insChangeReference, p2: keyPUK, data: bytes.Repeat([]byte{0xff}, pinMaxLen*2)}); err != nil {
+			return fmt.Errorf("couldn't block the PUK: %s", err)
+		}
+
+		// Reset the card
+		// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/reset-piv.html
+		if _, err := s.send(apdu{ins: insReset}); err != nil {
+			return fmt.Errorf("couldn't reset the card: %s", err)
+		}
+		defaultPIN := NewSecretString(DefaultPIN)
+		defer defaultPIN.Zero()
+		card.setPIN(defaultPIN)
+		card.setPUK(NewSecretString(DefaultPUK))
+		card.setManKey(NewSecret(DefaultManagementKey[:]))
+
+		return nil
+	})
+}
+
+// blockPIN blocks the PIN or PUK by sending the given invalid verification command until it's blocked.
+func blockPIN(s *session, cmd apdu) error {
+	for i := 0; i < resetMaxAttempts; i++ {
+		_, err := s.send(cmd)
+		if isStatus(err, swAuthBlocked) {
+			return nil
+		}
+		var apduErr *apduError
+		if !errors.As(err, &apduErr) {
+			if err == nil {
+				return errors.New("invalid value is accepted")
+			}
+			return err
+		} else if retries, ok := apduErr.retries(); !ok {
+			return err
+		} else if retries == 0 {
+			return nil
+		}
+	}
+	return errors.New("too many attempts")
+}
@@ -0,0 +1,78 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCardReset(t *testing.T) {
+	retries := map[byte]int{keyPIN: 3, keyPUK: 2}
+	var reset bool
+	useFakeTransport(t, func(req []byte) []byte {
+		switch req[1] {
+		case insVerify, insChangeReference:
+			if retries[req[3]] == 0 {
+				return []byte{0x69, 0x83}
+			}
+			retries[req[3]]--
+			return []byte{0x63, 0xc0 | byte(retries[req[3]])}
+		case insReset:
+			if retries[keyPIN] != 0 || retries[keyPUK] != 0 {
+				return []byte{0x69, 0x85}
+			}
+			reset = true
+			return []byte{0x90, 0x00}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+	card.SetPIN("654321")
+	card.SetManKey(bytes.Repeat([]byte{0x01}, 16))
+
+	for _, confirm := range []string{"", "87654321"} {
+		if err := card.Reset(confirm); !errors.Is(err, ErrResetNotConfirmed) {
+			t.Errorf("got %v, want %v", err, ErrResetNotConfirmed)
+		}
+	}
+	if reset || retries[keyPIN] != 3 {
+		t.Fatal("got a reset, want no reset")
+	}
+	if err := card.Reset(card.Serial()); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if !reset {
+		t.Error("got false, want true")
+	}
+	if string(card.pin.Bytes()) != DefaultPIN || string(card.puk.Bytes()) != DefaultPUK || !bytes.Equal(card.manKey.Bytes(), DefaultManagementKey[:]) {
+		t.Errorf("got %v %v %x, want the default values", card.pin, card.puk, card.manKey)
+	}
+}
+
+func TestBlockPIN(t *testing.T) {
+	table := []struct {
+		resp []byte
+		ok   bool
+	}{
+		{[]byte{0x69, 0x83}, true},
+		{[]byte{0x63, 0xc0}, true},
+		{[]byte{0x90, 0x00}, false},
+		{[]byte{0x6a, 0x80}, false},
+	}
+	for _, v := range table {
+		useFakeTransport(t, func(req []byte) []byte {
+			return v.resp
+		})
+		s, err := openSession("Yubico YubiKey", aidPIV)
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if err := blockPIN(s, apdu{ins: insVerify, p2: keyPIN}); (err == nil) != v.ok {
+			t.Errorf("got %v, want ok=%v for %x", err, v.ok, v.resp)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,519 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// GlobalPlatform secure channel instructions
+	// Ref: https://globalplatform.org/specs-library/secure-channel-protocol-03-amendment-d/
+	// Ref: https://globalplatform.org/specs-library/secure-channel-protocol-11-amendment-f/
+	insSCPInitializeUpdate        = 0x50
+	insSCPExternalAuthenticate    = 0x82
+	insSCPInternalAuthenticate    = 0x88
+	insSCPGetData                 = 0xca
+	claSCPProprietary             = 0x80
+	claSCPSecureMessaging         = 0x04
+	scpSecurityLevel              = 0x33 // C-MAC, C-DECRYPTION, R-MAC and R-ENCRYPTION
+	scpKeyLen                     = 16
+	scpChallengeLen               = 8
+	scpMACLen                     = 8
+	scp03DefaultKeyVersion        = 0xff
+	scp11bDefaultKeyVersion       = 0x01
+	scp11bKeyID                   = 0x13
+	scp03DerivationCardCryptogram = 0x00
+	scp03DerivationHostCryptogram = 0x01
+	scp03DerivationSENC           = 0x04
+	scp03DerivationSMAC           = 0x06
+	scp03DerivationSRMAC          = 0x07
+
+	// GlobalPlatform secure channel tags
+	tagSCPControlReference = 0xa6
+	tagSCPKeyID            = 0x83
+	tagSCPCertificateStore = 0xbf21
+	tagSCPIdentifier       = 0x90
+	tagSCPKeyUsage         = 0x95
+	tagSCPKeyType          = 0x80
+	tagSCPKeyLength        = 0x81
+	tagSCPEphemeralKey     = 0x5f49
+	tagSCPReceipt          = 0x86
+	scp11KeyUsage          = 0x3c // C-MAC, C-ENC, R-MAC and R-ENC
+	scp11KeyTypeAES        = 0x88
+)
+
+const (
+	// SCPProtocolUnknown represents the unknown secure channel protocol.
+	SCPProtocolUnknown SCPProtocol = 0
+	// SCPProtocolSCP03 represents the SCP03 secure channel protocol (symmetric keys, firmware 5.3+).
+	SCPProtocolSCP03 SCPProtocol = 1
+	// SCPProtocolSCP11b represents the SCP11b secure channel protocol (asymmetric keys, firmware 5.7+).
+	SCPProtocolSCP11b SCPProtocol = 2
+)
+
+var (
+	// SCP03DefaultKey holds the default SCP03 static key which is used for the encryption and MAC keys.
+	SCP03DefaultKey = []byte{0x40, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4a, 0x4b, 0x4c, 0x4d, 0x4e, 0x4f}
+
+	// aidSecurityDomain holds the GlobalPlatform Issuer Security Domain application identifier.
+	aidSecurityDomain = []byte{0xa0, 0x00, 0x00, 0x01, 0x51, 0x00, 0x00, 0x00}
+)
+
+// SCPProtocol represents a GlobalPlatform secure channel protocol.
+type SCPProtocol int
+
+// String returns the protocol name.
+func (protocol SCPProtocol) String() string {
+	switch protocol {
+	case SCPProtocolSCP03:
+		return "SCP03"
+	case SCPProtocolSCP11b:
+		return "SCP11b"
+	default:
+		return ""
+	}
+}
+
+// SecureChannel represents the GlobalPlatform secure channel options of a card.
+// All the commands of the card sessions are encrypted and authenticated when it's set by Card.SetSecureChannel.
+type SecureChannel struct {
+	// Protocol is the secure channel protocol.
+	Protocol SCPProtocol
+	// KeyVersion is the key version number of the Security Domain key.
+	// The default is 0xff (the default key set) for SCP03 and 0x01 for SCP11b.
+	KeyVersion byte
+	// EncKey is the SCP03 static encryption key. The default is SCP03DefaultKey.
+	EncKey []byte
+	// MACKey is the SCP03 static MAC key. The default is SCP03DefaultKey.
+	MACKey []byte
+	// Roots are the trusted certificates which the Security Domain certificate chain is verified by for SCP11b.
+	// It's required for SCP11b unless InsecureSkipVerify is set.
+	Roots []*x509.Certificate
+	// InsecureSkipVerify disables the SCP11b Security Domain certificate verification so the card key isn't
+	// authenticated and the secure channel is open to the man-in-the-middle attacks. It should be used for testing only.
+	InsecureSkipVerify bool
+}
+
+// SetSecureChannel sets the secure channel options of the card. The secure channel is disabled if it's nil.
+// All the card commands except the initial version and serial reads of Cards are wrapped by the secure channel
+// (PIN, management key, key generation, data objects, certificates, attestations, etc.).
+func (card *Card) SetSecureChannel(sc *SecureChannel) error {
+	card.sdKey = nil
+	if sc == nil {
+		card.secureChannel = nil
+		return nil
+	}
+	opts := *sc
+	switch opts.Protocol {
+	case SCPProtocolSCP03:
+		if !card.isVersion(5, 3, 0) {
+			return ErrNotSupported
+		}
+		if opts.KeyVersion == 0 {
+			opts.KeyVersion = scp03DefaultKeyVersion
+		}
+		if opts.EncKey == nil {
+			opts.EncKey = SCP03DefaultKey
+		}
+		if opts.MACKey == nil {
+			opts.MACKey = SCP03DefaultKey
+		}
+		if len(opts.EncKey) != scpKeyLen || len(opts.MACKey) != scpKeyLen {
+			return fmt.Errorf("invalid SCP03 key length: must be %d bytes", scpKeyLen)
+		}
+	case SCPProtocolSCP11b:
+		if !card.isVersion(5, 7, 0) {
+			return ErrNotSupported
+		}
+		if opts.KeyVersion == 0 {
+			opts.KeyVersion = scp11bDefaultKeyVersion
+		}
+		if len(opts.Roots) == 0 && !opts.InsecureSkipVerify {
+			return errors.New("missing Security Domain roots: must be set for SCP11b")
+		}
+	default:
+		return fmt.Errorf("unsupported secure channel protocol: %d", opts.Protocol)
+	}
+	card.secureChannel = &opts
+	return nil
+}
+
+// openSession opens a session by the given application and opens the card secure channel if it's set.
+// The caller must hold openMu.
+func (card *Card) openSession(aid []byte) (*session, error) {
+	sc := card.secureChannel
+	if sc != nil && sc.Protocol == SCPProtocolSCP11b && card.sdKey == nil {
+		// Get the Security Domain key once
+		s, err := openSession(card.name, aidSecurityDomain)
+		if err != nil {
+			return nil, err
+		}
+		key, err := securityDomainKey(s, sc)
+		s.Close()
+		if err != nil {
+			return nil, err
+		}
+		card.sdKey = key
+	}
+
+	s, err := openSession(card.name, aid)
+	if err != nil {
+		return nil, err
+	}
+	if sc != nil {
+		if sc.Protocol == SCPProtocolSCP11b {
+			err = s.openSCP11b(sc, card.sdKey)
+		} else {
+			err = s.openSCP03(sc)
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("couldn't open the secure channel (%s): %s", sc.Protocol, err)
+		}
+	}
+	return s, nil
+}
+
+// withSession opens a session by the given application and calls the given function.
+func (card *Card) withSession(aid []byte, f func(s *session) error) error {
+	// Connect to the smart card
+	openMu.Lock()
+	defer openMu.Unlock()
+	s, err := card.openSession(aid)
+	if err != nil {
+		return fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", card.serial, err)
+	}
+	defer s.Close()
+
+	return f(s)
+}
+
+// securityDomainKey returns the verified SCP11b public key of the Security Domain by the given session.
+func securityDomainKey(s *session, sc *SecureChannel) (*ecdsa.PublicKey, error) {
+	data := marshalTLV(tagSCPControlReference, marshalTLV(tagSCPKeyID, []byte{scp11bKeyID, sc.KeyVersion}))
+	resp, err := s.send(apdu{ins: insSCPGetData, p1: byte(tagSCPCertificateStore >> 8), p2: byte(tagSCPCertificateStore & 0xff), data: data})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the Security Domain certificates: %s", err)
+	}
+	certs, err := x509.ParseCertificates(resp)
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("invalid Security Domain certificates: %v", err)
+	}
+
+	// The leaf certificate is the last one
+	leaf := certs[len(certs)-1]
+	if !sc.InsecureSkipVerify {
+		roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+		for _, v := range sc.Roots {
+			roots.AddCert(v)
+		}
+		for _, v := range certs[:len(certs)-1] {
+			intermediates.AddCert(v)
+		}
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+		if _, err := leaf.Verify(opts); err != nil {
+			return nil, fmt.Errorf("couldn't verify the Security Domain certificate: %s", err)
+		}
+	}
+	key, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, errors.New("invalid Security Domain key: must be a P-256 key")
+	}
+	return key, nil
+}
+
+// scpState represents the session keys and state of an open secure channel.
+type scpState struct {
+	enc      []byte
+	mac      []byte
+	rmac     []byte
+	macChain []byte
+	counter  uint32
+}
+
+// openSCP03 opens an SCP03 secure channel on the session.
+func (s *session) openSCP03(sc *SecureChannel) error {
+	hostChallenge := make([]byte, scpChallengeLen)
+	if _, err := rand.Read(hostChallenge); err != nil {
+		return fmt.Errorf("couldn't generate the host challenge: %s", err)
+	}
+	resp, err := s.send(apdu{cla: claSCPProprietary, ins: insSCPInitializeUpdate, p1: sc.KeyVersion, data: hostChallenge})
+	if err != nil {
+		return fmt.Errorf("couldn't initialize the update: %s", err)
+	}
+	// Key diversification data (10) | key information (3) | card challenge (8) | card cryptogram (8) | sequence counter (3)
+	if len(resp) < 29 {
+		return fmt.Errorf("invalid initialize update response: %x", resp)
+	}
+	context := append(append([]byte(nil), hostChallenge...), resp[13:21]...)
+	st := &scpState{
+		enc:      scp03Derive(sc.EncKey, scp03DerivationSENC, context, scpKeyLen),
+		mac:      scp03Derive(sc.MACKey, scp03DerivationSMAC, context, scpKeyLen),
+		rmac:     scp03Derive(sc.MACKey, scp03DerivationSRMAC, context, scpKeyLen),
+		macChain: make([]byte, aes.BlockSize),
+		counter:  1,
+	}
+	if cryptogram := scp03Derive(st.mac, scp03DerivationCardCryptogram, context, scpMACLen); subtle.ConstantTimeCompare(cryptogram, resp[21:29]) != 1 {
+		return errors.New("invalid card cryptogram (wrong keys)")
+	}
+
+	// External authenticate is only MACed
+	cmd := apdu{cla: claSCPProprietary | claSCPSecureMessaging, ins: insSCPExternalAuthenticate, p1: scpSecurityLevel}
+	cmd.data = scp03Derive(st.mac, scp03DerivationHostCryptogram, context, scpMACLen)
+	cmd.data = append(cmd.data, st.commandMAC(cmd)...)
+	if _, err := s.send(cmd); err != nil {
+		return fmt.Errorf("couldn't authenticate the host: %s", err)
+	}
+	s.scp = st
+	return nil
+}
+
+// openSCP11b opens an SCP11b secure channel on the session by the given Security Domain key.
+func (s *session) openSCP11b(sc *SecureChannel, sdKey *ecdsa.PublicKey) error {
+	// Ephemeral OCE key
+	eSK, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("couldn't generate the ephemeral key: %s", err)
+	}
+	ePK := eSK.PublicKey().Bytes()
+	var params []byte
+	params = append(params, marshalTLV(tagSCPIdentifier, []byte{0x11, 0x00})...)
+	params = append(params, marshalTLV(tagSCPKeyUsage, []byte{scp11KeyUsage})...)
+	params = append(params, marshalTLV(tagSCPKeyType, []byte{scp11KeyTypeAES})...)
+	params = append(params, marshalTLV(tagSCPKeyLength, []byte{scpKeyLen})...)
+	data := append(marshalTLV(tagSCPControlReference, params), marshalTLV(tagSCPEphemeralKey, ePK)...)
+
+	resp, err := s.send(apdu{cla: claSCPProprietary, ins: insSCPInternalAuthenticate, p1: sc.KeyVersion, p2: scp11bKeyID, data: data})
+	if err != nil {
+		return fmt.Errorf("couldn't authenticate the card: %s", err)
+	}
+	list, err := parseTLVs(resp)
+	if err != nil {
+		return fmt.Errorf("invalid internal authenticate response: %s", err)
+	}
+	sdEPK, okKey := list.get(tagSCPEphemeralKey)
+	receipt, okReceipt := list.get(tagSCPReceipt)
+	if !okKey || !okReceipt {
+		return fmt.Errorf("invalid internal authenticate response: %x", resp)
+	}
+
+	// Shared secrets (ephemeral-ephemeral and ephemeral-static)
+	sdEPub, err := ecdh.P256().NewPublicKey(sdEPK)
+	if err != nil {
+		return errors.New("invalid card ephemeral key")
+	}
+	sdPub, err := sdKey.ECDH()
+	if err != nil {
+		return fmt.Errorf("invalid Security Domain key: %s", err)
+	}
+	shSee, err := eSK.ECDH(sdEPub)
+	if err != nil {
+		return fmt.Errorf("couldn't compute the shared secret: %s", err)
+	}
+	defer zero(shSee)
+	shSes, err := eSK.ECDH(sdPub)
+	if err != nil {
+		return fmt.Errorf("couldn't compute the shared secret: %s", err)
+	}
+	defer zero(shSes)
+	z := append(append(make([]byte, 0, len(shSee)+len(shSes)), shSee...), shSes...)
+	keys := x963KDF(z, []byte{scp11KeyUsage, scp11KeyTypeAES, scpKeyLen}, scpKeyLen*5)
+	zero(z)
+
+	// Receipt key | S-ENC | S-MAC | S-RMAC | S-DEK
+	// The receipt key and S-DEK aren't used after the handshake so they're zeroized.
+	defer zero(keys[:scpKeyLen])
+	defer zero(keys[scpKeyLen*4:])
+	expected := aesCMAC(keys[:scpKeyLen], append(data, marshalTLV(tagSCPEphemeralKey, sdEPK)...))
+	if subtle.ConstantTimeCompare(expected, receipt) != 1 {
+		zero(keys)
+		return errors.New("invalid card receipt")
+	}
+	s.scp = &scpState{
+		enc:      keys[scpKeyLen : scpKeyLen*2],
+		mac:      keys[scpKeyLen*2 : scpKeyLen*3],
+		rmac:     keys[scpKeyLen*3 : scpKeyLen*4],
+		macChain: receipt,
+		counter:  1,
+	}
+	return nil
+}
+
+// wrap returns the encrypted and MACed command.
+func (st *scpState) wrap(cmd apdu) (apdu, error) {
+	data, err := st.encrypt(cmd.data)
+	if err != nil {
+		return cmd, err
+	}
+	wrapped := apdu{cla: cmd.cla | claSCPSecureMessaging, ins: cmd.ins, p1: cmd.p1, p2: cmd.p2, data: data}
+	wrapped.data = append(wrapped.data, st.commandMAC(wrapped)...)
+	return wrapped, nil
+}
+
+// unwrap verifies and decrypts the given successful response data.
+func (st *scpState) unwrap(resp []byte) ([]byte, error) {
+	if len(resp) < scpMACLen {
+		return nil, fmt.Errorf("invalid secure channel response: %x", resp)
+	}
+	data, mac := resp[:len(resp)-scpMACLen], resp[len(resp)-scpMACLen:]
+	msg := append(append(append([]byte(nil), st.macChain...), data...), byte(swSuccess>>8), byte(swSuccess&0xff))
+	if subtle.ConstantTimeCompare(aesCMAC(st.rmac, msg)[:scpMACLen], mac) != 1 {
+		return nil, errors.New("invalid secure channel response MAC")
+	}
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	// The response ICV is the encrypted counter of the command with the leading 0x80 byte
+	block, _ := aes.NewCipher(st.enc)
+	iv := make([]byte, aes.BlockSize)
+	iv[0] = 0x80
+	binary.BigEndian.PutUint32(iv[aes.BlockSize-4:], st.counter-1)
+	block.Encrypt(iv, iv)
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid secure channel response length")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	i := bytes.LastIndexByte(plain, 0x80)
+	if i < 0 || len(bytes.Trim(plain[i+1:], "\x00")) != 0 {
+		return nil, errors.New("invalid secure channel response padding")
+	}
+	return plain[:i], nil
+}
+
+// encrypt returns the encrypted command data and increments the counter.
+func (st *scpState) encrypt(data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(st.enc)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv[aes.BlockSize-4:], st.counter)
+	block.Encrypt(iv, iv)
+	st.counter++
+
+	// ISO/IEC 9797-1 padding method 2
+	padded := append(append([]byte(nil), data...), 0x80)
+	for len(padded)%aes.BlockSize != 0 {
+		padded = append(padded, 0x00)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	return padded, nil
+}
+
+// commandMAC returns the C-MAC of the given command (without the MAC) and updates the MAC chaining value.
+func (st *scpState) commandMAC(cmd apdu) []byte {
+	lc := len(cmd.data) + scpMACLen
+	header := []byte{cmd.cla, cmd.ins, cmd.p1, cmd.p2, byte(lc)}
+	if lc > apduMaxData {
+		header = []byte{cmd.cla, cmd.ins, cmd.p1, cmd.p2, 0x00, byte(lc >> 8), byte(lc)}
+	}
+	st.macChain = aesCMAC(st.mac, append(append(append([]byte(nil), st.macChain...), header...), cmd.data...))
+	return st.macChain[:scpMACLen]
+}
+
+// scp03Derive derives data by the given key, derivation constant and context (NIST SP 800-108 counter mode with AES-CMAC).
+func scp03Derive(key []byte, constant byte, context []byte, length int) []byte {
+	bits := length * 8
+	data := make([]byte, 11, 16+len(context))
+	data = append(data, constant, 0x00, byte(bits>>8), byte(bits), 0x01)
+	data = append(data, context...)
+	mac := aesCMAC(key, data)
+	defer zero(mac)
+	return append([]byte(nil), mac[:length]...)
+}
+
+// x963KDF derives a key by the given shared secret and shared info (ANSI X9.63 KDF with SHA-256).
+func x963KDF(z, info []byte, length int) []byte {
+	out := make([]byte, 0, length+sha256.Size)
+	for counter := uint32(1); len(out) < length; counter++ {
+		h := sha256.New()
+		h.Write(z)
+		h.Write([]byte{byte(counter >> 24), byte(counter >> 16), byte(counter >> 8), byte(counter)})
+		h.Write(info)
+		out = h.Sum(out)
+	}
+	zero(out[length:])
+	return out[:length]
+}
+
+// aesCMAC returns the AES-CMAC of the given message.
+// Ref: https://www.rfc-editor.org/rfc/rfc4493
+func aesCMAC(key, msg []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+
+	// Subkeys
+	l := make([]byte, aes.BlockSize)
+	block.Encrypt(l, l)
+	k1 := cmacShift(l)
+	k2 := cmacShift(k1)
+	zero(l)
+	defer zero(k1)
+	defer zero(k2)
+
+	// Last block
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	last := make([]byte, aes.BlockSize)
+	defer zero(last)
+	if n > 0 && len(msg)%aes.BlockSize == 0 {
+		copy(last, msg[(n-1)*aes.BlockSize:])
+		xorBytes(last, k1)
+	} else {
+		if n == 0 {
+			n = 1
+		}
+		rest := msg[(n-1)*aes.BlockSize:]
+		copy(last, rest)
+		last[len(rest)] = 0x80
+		xorBytes(last, k2)
+	}
+
+	mac := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		xorBytes(mac, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(mac, mac)
+	}
+	xorBytes(mac, last)
+	block.Encrypt(mac, mac)
+	return mac
+}
+
+// cmacShift returns the CMAC subkey by shifting the given block left by one bit.
+func cmacShift(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := 0; i < len(b); i++ {
+		out[i] = b[i] << 1
+		if i+1 < len(b) {
+			out[i] |= b[i+1] >> 7
+		}
+	}
+	if b[0]&0x80 != 0 {
+		out[len(out)-1] ^= 0x87
+	}
+	return out
+}
+
+// xorBytes sets dst to dst XOR src.
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
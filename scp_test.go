@@ -0,0 +1,47 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestCardSetSecureChannel(t *testing.T) {
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		if err := card.SetSecureChannel(&yubikey.SecureChannel{Protocol: yubikey.SCPProtocolSCP03}); errors.Is(err, yubikey.ErrNotSupported) {
+			continue
+		} else if err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		if _, err := card.PINRetries(); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		if err := card.SetSecureChannel(nil); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+}
+
+func TestSCPProtocolString(t *testing.T) {
+	table := []struct {
+		protocol yubikey.SCPProtocol
+		want     string
+	}{
+		{yubikey.SCPProtocolUnknown, ""},
+		{yubikey.SCPProtocolSCP03, "SCP03"},
+		{yubikey.SCPProtocolSCP11b, "SCP11b"},
+	}
+	for _, v := range table {
+		if s := v.protocol.String(); s != v.want {
+			t.Errorf("got %v, want %v", s, v.want)
+		}
+	}
+}
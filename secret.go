@@ -0,0 +1,105 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+// secretRedacted holds the text which is used instead of the secret values.
+const secretRedacted = "[REDACTED]"
+
+// Secret represents a sensitive value (i.e. a PIN, PUK, management key or shared key) which can be zeroized.
+// The value is redacted in the fmt and JSON outputs. A nil secret is an empty secret.
+type Secret struct {
+	b []byte
+}
+
+// NewSecret returns a secret by a copy of the given bytes.
+// The caller should zeroize the given bytes when they're no longer needed.
+func NewSecret(b []byte) *Secret {
+	return &Secret{b: append([]byte(nil), b...)}
+}
+
+// NewSecretString returns a secret by the given string.
+// The string itself can't be zeroized so NewSecret should be preferred when the value is available as bytes.
+func NewSecretString(s string) *Secret {
+	return &Secret{b: []byte(s)}
+}
+
+// Bytes returns the secret value. The returned slice is zeroized by Zero so it must not be retained.
+func (secret *Secret) Bytes() []byte {
+	if secret == nil {
+		return nil
+	}
+	return secret.b
+}
+
+// Len returns the secret length.
+func (secret *Secret) Len() int {
+	if secret == nil {
+		return 0
+	}
+	return len(secret.b)
+}
+
+// IsEmpty returns whether the secret is empty (or zeroized) or not.
+func (secret *Secret) IsEmpty() bool {
+	return secret.Len() == 0
+}
+
+// Equal returns whether the secret is equal to the given secret or not (in constant time).
+func (secret *Secret) Equal(other *Secret) bool {
+	return subtle.ConstantTimeCompare(secret.Bytes(), other.Bytes()) == 1
+}
+
+// Clone returns a copy of the secret.
+func (secret *Secret) Clone() *Secret {
+	if secret == nil {
+		return nil
+	}
+	return NewSecret(secret.b)
+}
+
+// Zero zeroizes and empties the secret.
+func (secret *Secret) Zero() {
+	if secret == nil {
+		return
+	}
+	zero(secret.b)
+	secret.b = nil
+}
+
+// String implements the fmt.Stringer interface. The value is redacted.
+func (secret *Secret) String() string {
+	return secretRedacted
+}
+
+// GoString implements the fmt.GoStringer interface. The value is redacted.
+func (secret *Secret) GoString() string {
+	return secretRedacted
+}
+
+// Format implements the fmt.Formatter interface so all the verbs are redacted.
+func (secret *Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, secretRedacted)
+}
+
+// MarshalJSON implements the json.Marshaler interface. The value is redacted.
+func (secret *Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + secretRedacted + `"`), nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. The value is redacted.
+func (secret *Secret) MarshalText() ([]byte, error) {
+	return []byte(secretRedacted), nil
+}
+
+// zero zeroizes the given bytes.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,61 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestSecret(t *testing.T) {
+	b := []byte("123456")
+	secret := yubikey.NewSecret(b)
+	b[0] = 'x'
+	if s := string(secret.Bytes()); s != "123456" || secret.Len() != 6 || secret.IsEmpty() {
+		t.Errorf("got %v (%d), want a copy of the value", s, secret.Len())
+	}
+	if !secret.Equal(yubikey.NewSecretString("123456")) || secret.Equal(yubikey.NewSecretString("654321")) {
+		t.Error("got wrong equality, want constant time comparison")
+	}
+
+	clone := secret.Clone()
+	value := secret.Bytes()
+	secret.Zero()
+	if !secret.IsEmpty() || string(value) != "\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("got %x, want a zeroized secret", value)
+	}
+	if s := string(clone.Bytes()); s != "123456" {
+		t.Errorf("got %v, want 123456", s)
+	}
+
+	var empty *yubikey.Secret
+	empty.Zero()
+	if !empty.IsEmpty() || empty.Bytes() != nil || empty.Clone() != nil {
+		t.Error("got a non-empty nil secret, want an empty secret")
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	secret := yubikey.NewSecretString("123456")
+	opts := struct {
+		PIN *yubikey.Secret
+	}{PIN: secret}
+	for _, s := range []string{
+		fmt.Sprint(secret),
+		fmt.Sprintf("%s", secret),
+		fmt.Sprintf("%x", secret),
+		fmt.Sprintf("%#v", secret),
+	} {
+		if s != "[REDACTED]" {
+			t.Errorf("got %v, want [REDACTED]", s)
+		}
+	}
+	b, err := json.Marshal(opts)
+	if err != nil || string(b) != `{"PIN":"[REDACTED]"}` {
+		t.Errorf("got %s (%v), want a redacted secret", b, err)
+	}
+}
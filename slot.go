@@ -4,13 +4,24 @@
 package yubikey
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode"
+)
 
-	"github.com/go-piv/piv-go/piv"
+const (
+	// Key generation template tags
+	// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/generate-pair.html
+	tagKeyParams      = 0xac
+	tagKeyAlgorithm   = 0x80
+	tagKeyPINPolicy   = 0xaa
+	tagKeyTouchPolicy = 0xab
 )
 
 var (
@@ -22,17 +33,19 @@ var (
 	ErrAuthError = errors.New("authentication error")
 	// ErrAuthBlocked represents an authentication block error.
 	ErrAuthBlocked = errors.New("authentication method blocked")
+	// ErrNoKey represents a missing slot key error.
+	ErrNoKey = errors.New("slot has no key")
 
 	// slotMap holds the YubiKey slot mapping.
 	// Ref:
 	// 	https://docs.yubico.com/yesdk/users-manual/application-piv/slots.html
 	//	https://developers.yubico.com/PIV/Introduction/Certificate_slots.html
 	//	https://nvlpubs.nist.gov/nistpubs/SpecialPublications/NIST.SP.800-73-4.pdf#page=32
-	slotMap = map[string]piv.Slot{
-		"9a": piv.SlotAuthentication,
-		"9c": piv.SlotSignature,
-		"9d": piv.SlotKeyManagement,
-		"9e": piv.SlotCardAuthentication,
+	slotMap = map[string]pivSlot{
+		"9a": {Key: 0x9a, Object: 0x5FC105},
+		"9c": {Key: 0x9c, Object: 0x5FC10A},
+		"9d": {Key: 0x9d, Object: 0x5FC10B},
+		"9e": {Key: 0x9e, Object: 0x5FC101},
 		"82": {Key: 0x82, Object: 0x5FC10D},
 		"83": {Key: 0x83, Object: 0x5FC10E},
 		"84": {Key: 0x84, Object: 0x5FC10F},
@@ -58,11 +71,55 @@ var (
 	}
 )
 
+// pivSlot represents a PIV key slot and its certificate data object.
+type pivSlot struct {
+	Key    uint32
+	Object uint32
+}
+
+// ParseSlot returns the slot key (i.e. "9a") by the given slot name. The names are case-insensitive and
+// the common aliases are accepted (i.e. "9a", "0x9a", "authentication", "PIV AUTHENTICATE", "signature",
+// "key management", "card authentication", "retired1" ... "retired20", "Retired Key 1").
+func ParseSlot(name string) (string, error) {
+	key := normalizeName(name)
+	switch key {
+	case "authentication", "auth", "pivauth", "pivauthenticate", "pivauthentication":
+		return "9a", nil
+	case "signature", "sign", "digitalsignature", "pivsign", "pivsignature":
+		return "9c", nil
+	case "keymanagement", "keymgmt", "pivkeymanagement":
+		return "9d", nil
+	case "cardauthentication", "cardauth", "pivcardauth", "pivcardauthenticate", "pivcardauthentication":
+		return "9e", nil
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(key, "retired"), "key")); err == nil && strings.HasPrefix(key, "retired") {
+		if n >= 1 && n <= retiredSlotLast-retiredSlotFirst+1 {
+			return fmt.Sprintf("%x", retiredSlotFirst+n-1), nil
+		}
+	}
+	key = strings.TrimPrefix(key, "0x")
+	if _, ok := slotMap[key]; ok {
+		return key, nil
+	}
+	return "", fmt.Errorf("unknown slot: %q", name)
+}
+
+// normalizeName returns the given name in lower case without the spaces, hyphens and underscores.
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, strings.TrimSpace(name))
+}
+
 // Slot represents a YubiKey smart card slot.
 type Slot struct {
 	key            string
 	card           *Card
-	slot           piv.Slot
+	slot           pivSlot
 	pinPolicy      PINPolicy
 	touchPolicy    TouchPolicy
 	hasKey         bool
@@ -71,6 +128,8 @@ type Slot struct {
 	publicKey      []byte
 	publicKeyAlg   Algorithm
 	publicKeyECDSA *ecdsa.PublicKey
+	cryptoKey      crypto.PublicKey
+	certificate    *x509.Certificate
 }
 
 // Key returns the slot key.
@@ -103,7 +162,8 @@ func (slot *Slot) IsImported() bool {
 	return slot.isImported
 }
 
-// PublicKey returns the public key of the slot if any.
+// PublicKey returns the public key (compressed) of the slot if it's an ECDSA key.
+// It's nil for the other algorithms (see PublicKeyPKIX and CryptoPublicKey).
 func (slot *Slot) PublicKey() []byte {
 	return slot.publicKey
 }
@@ -113,21 +173,20 @@ func (slot *Slot) PublicKeyAlgorithm() Algorithm {
 	return slot.publicKeyAlg
 }
 
+// Certificate returns the certificate which is stored in the slot if any.
+func (slot *Slot) Certificate() *x509.Certificate {
+	return slot.certificate
+}
+
 // SharedKey returns a shared key by the given peer public key (compressed).
-func (slot *Slot) SharedKey(peerPublicKey []byte) ([]byte, error) {
+// The caller should zeroize the shared key when it's no longer needed.
+func (slot *Slot) SharedKey(peerPublicKey []byte) (*Secret, error) {
 	// Check the slot key
 	if !slot.hasKey {
-		return nil, errors.New("slot has no key")
-	}
-
-	// Connect to the smartcard
-	openMu.Lock()
-	defer openMu.Unlock()
-	yk, err := piv.Open(slot.card.name)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", slot.card.name, err)
+		return nil, ErrNoKey
+	} else if slot.publicKeyECDSA == nil {
+		return nil, errors.New("slot doesn't have an ECDSA key")
 	}
-	defer yk.Close()
 
 	// Determine the curve
 	var curve elliptic.Curve
@@ -139,41 +198,60 @@ func (slot *Slot) SharedKey(peerPublicKey []byte) ([]byte, error) {
 	default:
 		return nil, errors.New("unsupported public key")
 	}
+	if curve != slot.publicKeyECDSA.Curve {
+		return nil, errors.New("peer public key curve doesn't match the slot key")
+	}
 
-	// Unmarshal the peer public key and generate the ECDSA public key instance
+	// Unmarshal the peer public key
 	x, y := elliptic.UnmarshalCompressed(curve, peerPublicKey)
 	if x == nil {
 		return nil, errors.New("invalid public key size")
 	}
-	peerPublicKeyECDSA := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
-
-	// Get private key object
-	privateKey, err := yk.PrivateKey(slot.slot, slot.publicKeyECDSA, slot.card.keyAuth)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't get the slot key (%s): %s", slot.key, err)
-	}
-	privateKeyECDSA, ok := privateKey.(*piv.ECDSAPrivateKey)
-	if !ok {
-		return nil, errors.New("slot doesn't have an ECDSA key")
-	}
 
 	// Get the shared key
-	// PIN and Touch policies are enforced in this call
-	sharedKey, err := privateKeyECDSA.SharedKey(&peerPublicKeyECDSA)
+	// The PIN is resolved before the card is connected and the touch functions are called if the slot requires touch
+	var sharedKey *Secret
+	err := slot.card.withPIN(slot.pinPolicy != PINPolicyNever, func(verify func(s *session) error) error {
+		return slot.touch(func() error {
+			return slot.card.withSession(aidPIV, func(s *session) error {
+				// Verify the PIN unless the slot policy doesn't require it
+				if slot.pinPolicy != PINPolicyNever {
+					if err := verify(s); err != nil {
+						return slot.card.pinError(err, ErrInvalidPIN)
+					}
+				}
+
+				// Get the shared key
+				// Touch policy is enforced in this call
+				data := marshalTLV(tagDynamicAuth, append(marshalTLV(tagResponse, nil), marshalTLV(tagExponentiation, elliptic.Marshal(curve, x, y))...))
+				resp, err := s.send(apdu{ins: insAuthenticate, p1: slot.publicKeyAlg.code(), p2: byte(slot.slot.Key), data: data})
+				s.keep(resp)
+				if err != nil {
+					if isStatus(err, swSecurityStatus) {
+						// auth challenge: smart card error 6982: security status not satisfied
+						return ErrAuthError
+					}
+					return fmt.Errorf("couldn't get the shared key (%s): %s", slot.key, err)
+				}
+				list, err := parseTLVs(resp)
+				if err != nil {
+					return fmt.Errorf("invalid shared key response: %s", err)
+				}
+				auth, _ := list.get(tagDynamicAuth)
+				if list, err = parseTLVs(auth); err != nil {
+					return fmt.Errorf("invalid shared key response: %s", err)
+				}
+				secret, ok := list.get(tagResponse)
+				if !ok {
+					return errors.New("invalid shared key response")
+				}
+				sharedKey = NewSecret(secret)
+
+				return nil
+			})
+		})
+	})
 	if err != nil {
-		if strings.Contains(err.Error(), "63c") {
-			// verify pin: smart card error 63c2: verification failed (2 retries remaining)
-			// verify pin: smart card error 63c1: verification failed (1 retry remaining)
-			return nil, ErrInvalidPIN
-		} else if strings.Contains(err.Error(), "6982") {
-			// auth challenge: smart card error 6982: security status not satisfied
-			return nil, ErrAuthError
-		} else if strings.Contains(err.Error(), "6983") {
-			// verify pin: smart card error 6983: authentication method blocked
-			return nil, ErrAuthBlocked
-		} else if strings.Contains(err.Error(), "pin required but wasn't provided") {
-			return nil, ErrMissingPIN
-		}
 		return nil, err
 	}
 
@@ -186,7 +264,7 @@ type GenerateKeyOpts struct {
 	Algorithm   Algorithm
 	PINPolicy   PINPolicy
 	TouchPolicy TouchPolicy
-	ManKey      []byte
+	ManKey      *Secret
 }
 
 // GenerateKey generates an asymmetric key by the given slot name and options.
@@ -197,36 +275,158 @@ func (slot *Slot) GenerateKey(opts GenerateKeyOpts) error {
 		return errors.New("slot has already a key")
 	}
 
-	// Connect to the smart card
-	openMu.Lock()
-	defer openMu.Unlock()
-	yk, err := piv.Open(slot.card.name)
-	if err != nil {
-		return fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", slot.card.serial, err)
+	if opts.Algorithm.code() == 0 {
+		return fmt.Errorf("unsupported algorithm: %d", opts.Algorithm)
+	} else if (opts.Algorithm == AlgorithmRSA3072 || opts.Algorithm == AlgorithmRSA4096) && !slot.card.isVersion(5, 7, 0) {
+		return ErrNotSupported
 	}
-	defer yk.Close()
 
-	// Generate a key
-	manKey := slot.card.manKey
-	if len(opts.ManKey) > 0 {
-		copy(manKey[:], opts.ManKey)
+	// Connect to the smart card
+	return slot.card.withSession(aidPIV, func(s *session) error {
+		if err := slot.card.authenticate(s, opts.ManKey); err != nil {
+			return err
+		}
+
+		// Generate a key (the card default policies are used for the unknown policies)
+		// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/apdu/generate-pair.html
+		params := marshalTLV(tagKeyAlgorithm, []byte{opts.Algorithm.code()})
+		if v := opts.PINPolicy.code(); v != 0 {
+			params = append(params, marshalTLV(tagKeyPINPolicy, []byte{v})...)
+		}
+		if v := opts.TouchPolicy.code(); v != 0 {
+			params = append(params, marshalTLV(tagKeyTouchPolicy, []byte{v})...)
+		}
+		_, err := s.send(apdu{ins: insGenerateKey, p2: byte(slot.slot.Key), data: marshalTLV(tagKeyParams, params)})
+		if err != nil {
+			return managementKeyError(err)
+		}
+		if isRetiredSlot(slot.slot.Key) {
+			if err := slot.card.updateKeyHistory(s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// MoveKeyOpts represents the options which can be used for moving a key.
+type MoveKeyOpts struct {
+	Overwrite bool
+	ManKey    *Secret
+}
+
+// MoveKey moves the slot key and its certificate (if any) into the given slot.
+// It requires firmware 5.7 or later. Both slots are updated after the key is moved.
+func (slot *Slot) MoveKey(destSlot *Slot, opts MoveKeyOpts) error {
+	if slot == nil || slot.card == nil || destSlot == nil || destSlot.card != slot.card {
+		return errors.New("invalid slot")
+	} else if slot.key == destSlot.key {
+		return errors.New("same source and destination slots")
+	} else if !slot.hasKey {
+		return ErrNoKey
+	} else if destSlot.hasKey && !opts.Overwrite {
+		return errors.New("destination slot has already a key")
+	} else if !slot.card.isVersion(5, 7, 0) {
+		return ErrNotSupported
 	}
-	_, err = yk.GenerateKey(
-		manKey,
-		slot.slot,
-		piv.Key{
-			Algorithm:   opts.Algorithm.piv(),
-			PINPolicy:   opts.PINPolicy.piv(),
-			TouchPolicy: opts.TouchPolicy.piv(),
-		},
-	)
-	if err != nil {
-		if strings.Contains(err.Error(), "6982") {
-			// auth challenge: smart card error 6982: security status not satisfied
-			return ErrAuthError
+
+	// Connect to the smart card
+	return slot.card.withSession(aidPIV, func(s *session) error {
+		if err := slot.card.authenticate(s, opts.ManKey); err != nil {
+			return err
+		}
+
+		// Delete the destination key first so the destination slot doesn't keep a stale certificate
+		if destSlot.hasKey {
+			if err := deleteKey(s, destSlot); err != nil {
+				return err
+			}
+		}
+
+		// Move the key
+		_, err := s.send(apdu{ins: insMoveKey, p1: byte(destSlot.slot.Key), p2: byte(slot.slot.Key)})
+		if err != nil {
+			return fmt.Errorf("couldn't move the slot key (%s): %s", slot.key, managementKeyError(err))
+		}
+
+		// Move the certificate
+		cert, err := getData(s, slot.slot.Object)
+		if err != nil && !isStatus(err, swNotFound) {
+			return fmt.Errorf("couldn't get the slot certificate (%s): %s", slot.key, err)
+		} else if err == nil {
+			if err := putData(s, destSlot.slot.Object, cert); err != nil {
+				return fmt.Errorf("couldn't move the slot certificate (%s): %s", slot.key, err)
+			}
+			if err := putData(s, slot.slot.Object, nil); err != nil {
+				return fmt.Errorf("couldn't delete the slot certificate (%s): %s", slot.key, err)
+			}
 		}
-		return err
+
+		if isRetiredSlot(slot.slot.Key) || isRetiredSlot(destSlot.slot.Key) {
+			if err := slot.card.updateKeyHistory(s); err != nil {
+				return err
+			}
+		}
+
+		// Update the slots
+		key, object := destSlot.key, destSlot.slot
+		*destSlot = *slot
+		destSlot.key, destSlot.slot = key, object
+		slot.reset()
+
+		return nil
+	})
+}
+
+// DeleteKeyOpts represents the options which can be used for deleting a key.
+type DeleteKeyOpts struct {
+	ManKey *Secret
+}
+
+// DeleteKey deletes the slot key and its certificate (if any).
+// It requires firmware 5.7 or later. The slot is updated after the key is deleted.
+func (slot *Slot) DeleteKey(opts DeleteKeyOpts) error {
+	if slot == nil || slot.card == nil {
+		return errors.New("invalid slot")
+	} else if !slot.card.isVersion(5, 7, 0) {
+		return ErrNotSupported
 	}
 
+	// Connect to the smart card
+	return slot.card.withSession(aidPIV, func(s *session) error {
+		if err := slot.card.authenticate(s, opts.ManKey); err != nil {
+			return err
+		}
+
+		// Delete the key and update the slot
+		if err := deleteKey(s, slot); err != nil {
+			return err
+		}
+		if isRetiredSlot(slot.slot.Key) {
+			if err := slot.card.updateKeyHistory(s); err != nil {
+				return err
+			}
+		}
+		slot.reset()
+
+		return nil
+	})
+}
+
+// deleteKey deletes the key and the certificate of the given slot by the given authenticated session.
+func deleteKey(s *session, slot *Slot) error {
+	_, err := s.send(apdu{ins: insMoveKey, p1: 0xff, p2: byte(slot.slot.Key)})
+	if err != nil && !isStatus(err, swNotFound) {
+		return fmt.Errorf("couldn't delete the slot key (%s): %s", slot.key, managementKeyError(err))
+	}
+	if err := putData(s, slot.slot.Object, nil); err != nil && !isStatus(err, swNotFound) {
+		return fmt.Errorf("couldn't delete the slot certificate (%s): %s", slot.key, err)
+	}
 	return nil
 }
+
+// reset resets the slot key state.
+func (slot *Slot) reset() {
+	*slot = Slot{key: slot.key, card: slot.card, slot: slot.slot}
+}
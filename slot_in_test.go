@@ -0,0 +1,268 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSlotMoveKey(t *testing.T) {
+	fmk := &fakeManagementKey{alg: ManagementKeyAlgorithmAES192, key: DefaultManagementKey[:]}
+	objects := fakeObjects{0x5fc10b: {0x70, 0x01, 0xaa}}
+	keys := map[byte]bool{0x9d: true}
+	var moved, deleted []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := fmk.handle(t, req); resp != nil {
+			return resp
+		} else if resp := objects.handle(req); resp != nil {
+			return resp
+		}
+		switch req[1] {
+		case insGetMetadata:
+			if !keys[req[3]] {
+				return []byte{0x6a, 0x82}
+			}
+			return append(marshalTLV(metadataTagAlgorithm, []byte{AlgorithmEC256.code()}), 0x90, 0x00)
+		case insMoveKey:
+			if !fmk.authenticated {
+				return []byte{0x69, 0x82}
+			}
+			if req[2] == 0xff {
+				deleted = append(deleted, req[3])
+				delete(keys, req[3])
+			} else {
+				moved = append(moved, req[2], req[3])
+				keys[req[2]] = keys[req[3]]
+				delete(keys, req[3])
+			}
+			return []byte{0x90, 0x00}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+	src := &Slot{key: "9d", card: card, slot: slotMap["9d"], hasKey: true, isGenerated: true, pinPolicy: PINPolicyOnce, publicKeyAlg: AlgorithmEC256}
+	dest := &Slot{key: "82", card: card, slot: slotMap["82"]}
+
+	// Move the key
+	if err := src.MoveKey(dest, MoveKeyOpts{}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := []byte{0x82, 0x9d}; !bytes.Equal(moved, want) {
+		t.Errorf("got %x, want %x", moved, want)
+	}
+	if src.HasKey() || src.Key() != "9d" || src.PINPolicy() != PINPolicyUnknown {
+		t.Errorf("got %+v, want an empty slot", src)
+	}
+	if !dest.HasKey() || dest.Key() != "82" || dest.slot != slotMap["82"] || dest.PINPolicy() != PINPolicyOnce || dest.PublicKeyAlgorithm() != AlgorithmEC256 {
+		t.Errorf("got %+v, want the moved key", dest)
+	}
+	if _, ok := objects[0x5fc10b]; ok {
+		t.Error("got true, want false")
+	}
+	if v := objects[0x5fc10d]; !bytes.Equal(v, []byte{0x70, 0x01, 0xaa}) {
+		t.Errorf("got %x, want the moved certificate", v)
+	}
+	if v, want := objects[ObjectKeyHistory], (&KeyHistory{OnCardCerts: 1}).Marshal(); !bytes.Equal(v, want) {
+		t.Errorf("got %x, want %x", v, want)
+	}
+
+	// Overwrite
+	src.hasKey = true
+	if err := src.MoveKey(dest, MoveKeyOpts{}); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if err := src.MoveKey(dest, MoveKeyOpts{Overwrite: true}); err != nil {
+		t.Errorf("got %v, want nil", err)
+	} else if want := []byte{0x82}; !bytes.Equal(deleted, want) {
+		t.Errorf("got %x, want %x", deleted, want)
+	}
+
+	// Delete the key
+	if err := dest.DeleteKey(DeleteKeyOpts{}); err != nil {
+		t.Errorf("got %v, want nil", err)
+	} else if dest.HasKey() {
+		t.Error("got true, want false")
+	}
+	if v, want := objects[ObjectKeyHistory], (&KeyHistory{}).Marshal(); !bytes.Equal(v, want) {
+		t.Errorf("got %x, want %x", v, want)
+	}
+
+	// Invalid management key and version
+	fmk.authenticated = false
+	src.hasKey = true
+	if err := src.MoveKey(dest, MoveKeyOpts{ManKey: NewSecret(bytes.Repeat([]byte{0x01}, 24))}); !errors.Is(err, ErrAuthError) {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+	if err := src.DeleteKey(DeleteKeyOpts{ManKey: NewSecret(bytes.Repeat([]byte{0x01}, 24))}); !errors.Is(err, ErrAuthError) {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+	card.version.Minor = 4
+	if err := src.MoveKey(dest, MoveKeyOpts{}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+	if err := src.DeleteKey(DeleteKeyOpts{}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestSlotGenerateKey(t *testing.T) {
+	fmk := &fakeManagementKey{alg: ManagementKeyAlgorithmAES128, key: bytes.Repeat([]byte{0x01}, 16)}
+	var generated []byte
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := fmk.handle(t, req); resp != nil {
+			return resp
+		}
+		if req[1] == insGenerateKey {
+			if !fmk.authenticated {
+				return []byte{0x69, 0x82}
+			}
+			generated = append([]byte{req[3]}, req[5:5+int(req[4])]...)
+			return []byte{0x90, 0x00}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 7, 1)
+	slot := &Slot{key: "9a", card: card, slot: slotMap["9a"]}
+
+	if err := slot.GenerateKey(GenerateKeyOpts{Algorithm: AlgorithmEC256}); err == nil {
+		t.Error("got nil, want an error")
+	}
+	if err := slot.GenerateKey(GenerateKeyOpts{Algorithm: AlgorithmEC256, ManKey: NewSecret(bytes.Repeat([]byte{0x02}, 16))}); !errors.Is(err, ErrAuthError) {
+		t.Errorf("got %v, want %v", err, ErrAuthError)
+	}
+	card.SetManKey(fmk.key)
+	if err := slot.GenerateKey(GenerateKeyOpts{Algorithm: AlgorithmEC384, PINPolicy: PINPolicyOnce, TouchPolicy: TouchPolicyCached}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if want := []byte{0x9a, 0xac, 0x09, 0x80, 0x01, 0x14, 0xaa, 0x01, 0x02, 0xab, 0x01, 0x03}; !bytes.Equal(generated, want) {
+		t.Errorf("got %x, want %x", generated, want)
+	}
+	if err := slot.GenerateKey(GenerateKeyOpts{}); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
+
+func TestSlotSharedKey(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	peer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verified := false
+	useFakeTransport(t, func(req []byte) []byte {
+		switch req[1] {
+		case insVerify:
+			if !bytes.Equal(req[5:13], encodePIN([]byte(DefaultPIN))) {
+				return []byte{0x63, 0xc2}
+			}
+			verified = true
+			return []byte{0x90, 0x00}
+		case insAuthenticate:
+			if !verified {
+				return []byte{0x69, 0x82}
+			} else if req[2] != AlgorithmEC256.code() || req[3] != 0x9d {
+				return []byte{0x6a, 0x86}
+			}
+			list, _ := parseTLVs(req[5 : 5+int(req[4])])
+			auth, _ := list.get(tagDynamicAuth)
+			list, _ = parseTLVs(auth)
+			point, _ := list.get(tagExponentiation)
+			x, y := elliptic.Unmarshal(elliptic.P256(), point)
+			secret, _ := elliptic.P256().ScalarMult(x, y, priv.D.Bytes())
+			resp := marshalTLV(tagDynamicAuth, marshalTLV(tagResponse, secret.FillBytes(make([]byte, 32))))
+			return append(resp, 0x90, 0x00)
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 4, 3)
+	slot := &Slot{key: "9d", card: card, slot: slotMap["9d"], hasKey: true, pinPolicy: PINPolicyOnce, publicKeyAlg: AlgorithmEC256, publicKeyECDSA: &priv.PublicKey}
+	peerPublicKey := elliptic.MarshalCompressed(elliptic.P256(), peer.X, peer.Y)
+
+	if _, err := slot.SharedKey(peerPublicKey[:20]); err == nil {
+		t.Error("got nil, want an unsupported public key error")
+	}
+	card.SetPIN("654321")
+	if _, err := slot.SharedKey(peerPublicKey); !errors.Is(err, ErrInvalidPIN) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPIN)
+	}
+	card.SetPIN(DefaultPIN)
+	sharedKey, err := slot.SharedKey(peerPublicKey)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	x, _ := elliptic.P256().ScalarMult(priv.X, priv.Y, peer.D.Bytes())
+	if want := x.FillBytes(make([]byte, 32)); !bytes.Equal(sharedKey.Bytes(), want) {
+		t.Errorf("got %x, want %x", sharedKey.Bytes(), want)
+	}
+}
+
+func TestCardSlotsByKeyUnknown(t *testing.T) {
+	useFakeTransport(t, func(req []byte) []byte {
+		t.Errorf("got %x, want no requests", req)
+		return []byte{0x6d, 0x00}
+	})
+	if _, err := testCard(5, 4, 3).SlotsByKey([]string{"9a", "authentcation"}); err == nil || !strings.Contains(err.Error(), "unknown slot") {
+		t.Errorf("got %v, want an unknown slot error", err)
+	}
+}
+
+func TestCardSlotsByKey(t *testing.T) {
+	root, attestationCert, slotCert := testAttestationChain(t, "9a", 12345678)
+	objects := fakeObjects{
+		objectAttestation:    marshalTLV(tagCertificate, attestationCert.Raw),
+		slotMap["9c"].Object: marshalTLV(tagCertificate, attestationCert.Raw),
+	}
+	useFakeTransport(t, func(req []byte) []byte {
+		if resp := objects.handle(req); resp != nil {
+			return resp
+		}
+		switch req[1] {
+		case insAttest:
+			switch req[2] {
+			case 0x9a:
+				return append(append([]byte(nil), slotCert.Raw...), 0x90, 0x00)
+			case 0x9c:
+				return []byte{0x6a, 0x80}
+			}
+			return []byte{0x6a, 0x82}
+		case insGetMetadata:
+			if req[3] == 0x9c {
+				return append(append(marshalTLV(metadataTagAlgorithm, []byte{0x11}), marshalTLV(metadataTagPolicy, []byte{0x03, 0x02})...), 0x90, 0x00)
+			}
+			return []byte{0x6a, 0x82}
+		}
+		return []byte{0x6d, 0x00}
+	})
+	card := testCard(5, 4, 3)
+
+	// Untrusted attestation
+	if _, err := card.SlotsByKey([]string{"9a"}); err == nil || !strings.Contains(err.Error(), "slot attestation") {
+		t.Errorf("got %v, want an attestation error", err)
+	}
+
+	card.SetAttestationRoots(root)
+	slots, err := card.SlotsByKey([]string{"signature", "9a", "9d"})
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(slots) != 3 {
+		t.Fatalf("got %v, want 3 slots", len(slots))
+	}
+
+	// Generated key
+	if s := slots[0]; s.Key() != "9a" || !s.HasKey() || !s.IsGenerated() || s.PINPolicy() != PINPolicyOnce || s.TouchPolicy() != TouchPolicyCached {
+		t.Errorf("got %+v, want the generated 9a slot", s)
+	}
+	// Imported key
+	if s := slots[1]; s.Key() != "9c" || !s.HasKey() || !s.IsImported() || s.PINPolicy() != PINPolicyAlways || s.TouchPolicy() != TouchPolicyAlways || !s.Certificate().Equal(attestationCert) {
+		t.Errorf("got %+v, want the imported 9c slot", s)
+	}
+	// Empty slot
+	if s := slots[2]; s.Key() != "9d" || s.HasKey() {
+		t.Errorf("got %+v, want the empty 9d slot", s)
+	}
+}
@@ -60,9 +60,39 @@ func TestSlot(t *testing.T) {
 			sk, err := slot.SharedKey(publicKey)
 			if err != nil {
 				t.Errorf("got %v, want nil", err)
-			} else if len(sk) == 0 {
+			} else if sk.IsEmpty() {
 				t.Errorf("got %v, want a shared key", sk)
 			}
 		}
 	}
 }
+
+func TestParseSlot(t *testing.T) {
+	table := []struct {
+		name string
+		want string
+	}{
+		{"9a", "9a"},
+		{"9A", "9a"},
+		{"0x9c", "9c"},
+		{"authentication", "9a"},
+		{"PIV AUTHENTICATE", "9a"},
+		{"signature", "9c"},
+		{"key_management", "9d"},
+		{"Card Authentication", "9e"},
+		{"retired1", "82"},
+		{"RETIRED10", "8b"},
+		{"retired-20", "95"},
+		{"82", "82"},
+	}
+	for _, v := range table {
+		if key, err := yubikey.ParseSlot(v.name); err != nil || key != v.want {
+			t.Errorf("got %v (%v), want %v", key, err, v.want)
+		}
+	}
+	for _, name := range []string{"", "9b", "f9", "retired0", "retired21", "management"} {
+		if _, err := yubikey.ParseSlot(name); err == nil {
+			t.Errorf("got nil, want error (%s)", name)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+)
+
+// tlv represents a BER-TLV encoded data object.
+// Ref: https://docs.yubico.com/yesdk/users-manual/support/support-tlv.html
+type tlv struct {
+	tag   uint32
+	value []byte
+}
+
+// tlvs represents a list of BER-TLV encoded data objects.
+type tlvs []tlv
+
+// get returns the value of the first data object by the given tag.
+func (list tlvs) get(tag uint32) ([]byte, bool) {
+	for _, v := range list {
+		if v.tag == tag {
+			return v.value, true
+		}
+	}
+	return nil, false
+}
+
+// parseTLVs parses the given BER-TLV encoded data objects.
+func parseTLVs(b []byte) (tlvs, error) {
+	var list tlvs
+	for len(b) > 0 {
+		// Parse the tag (multi byte tags have the lower 5 bits of the first byte set)
+		tag := uint32(b[0])
+		n := 1
+		if b[0]&0x1f == 0x1f {
+			for {
+				if n >= len(b) || n > 3 {
+					return nil, errors.New("invalid tlv tag")
+				}
+				tag = tag<<8 | uint32(b[n])
+				n++
+				if b[n-1]&0x80 == 0 {
+					break
+				}
+			}
+		}
+		b = b[n:]
+
+		// Parse the length
+		if len(b) == 0 {
+			return nil, fmt.Errorf("missing tlv length (%x)", tag)
+		}
+		l := int(b[0])
+		n = 1
+		if l > 0x80 {
+			n += l - 0x80
+			if n > 4 || n > len(b) {
+				return nil, fmt.Errorf("invalid tlv length (%x)", tag)
+			}
+			l = 0
+			for _, v := range b[1:n] {
+				l = l<<8 | int(v)
+			}
+		} else if l == 0x80 {
+			return nil, fmt.Errorf("indefinite tlv length (%x)", tag)
+		}
+		b = b[n:]
+		if l > len(b) {
+			return nil, fmt.Errorf("invalid tlv value length (%x)", tag)
+		}
+
+		list = append(list, tlv{tag: tag, value: b[:l]})
+		b = b[l:]
+	}
+	return list, nil
+}
+
+// marshalTLV returns the BER-TLV encoded data object by the given tag and value.
+func marshalTLV(tag uint32, value []byte) []byte {
+	var b []byte
+	switch {
+	case tag > 0xffffff:
+		b = append(b, byte(tag>>24), byte(tag>>16), byte(tag>>8), byte(tag))
+	case tag > 0xffff:
+		b = append(b, byte(tag>>16), byte(tag>>8), byte(tag))
+	case tag > 0xff:
+		b = append(b, byte(tag>>8), byte(tag))
+	default:
+		b = append(b, byte(tag))
+	}
+	b = append(b, tlvLength(len(value))...)
+	return append(b, value...)
+}
+
+// tlvLength returns the BER-TLV encoded length.
+func tlvLength(l int) []byte {
+	switch {
+	case l < 0x80:
+		return []byte{byte(l)}
+	case l <= 0xff:
+		return []byte{0x81, byte(l)}
+	case l <= 0xffff:
+		return []byte{0x82, byte(l >> 8), byte(l)}
+	default:
+		return []byte{0x83, byte(l >> 16), byte(l >> 8), byte(l)}
+	}
+}
@@ -0,0 +1,76 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseTLVs(t *testing.T) {
+	long := bytes.Repeat([]byte{0xaa}, 300)
+	b := append(marshalTLV(0x01, []byte{0x11}), marshalTLV(0x7f49, []byte{0x86, 0x01, 0x04})...)
+	b = append(b, marshalTLV(0x5fc102, long)...)
+	b = append(b, marshalTLV(0x02, nil)...)
+
+	list, err := parseTLVs(b)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if l := len(list); l != 4 {
+		t.Fatalf("got %v, want %v", l, 4)
+	}
+	table := []struct {
+		tag  uint32
+		want []byte
+	}{
+		{0x01, []byte{0x11}},
+		{0x7f49, []byte{0x86, 0x01, 0x04}},
+		{0x5fc102, long},
+		{0x02, []byte{}},
+	}
+	for _, v := range table {
+		if value, ok := list.get(v.tag); !ok || !bytes.Equal(value, v.want) {
+			t.Errorf("got %x, want %x", value, v.want)
+		}
+	}
+	if _, ok := list.get(0x03); ok {
+		t.Error("got true, want false")
+	}
+}
+
+func TestParseTLVsInvalid(t *testing.T) {
+	table := [][]byte{
+		{0x01},
+		{0x01, 0x02, 0x00},
+		{0x01, 0x80},
+		{0x01, 0x85, 0x00, 0x00, 0x00, 0x00, 0x01},
+		{0x1f},
+		{0x1f, 0x81, 0x81, 0x81, 0x81, 0x01, 0x00},
+	}
+	for _, v := range table {
+		if _, err := parseTLVs(v); err == nil {
+			t.Errorf("got nil, want an error for %x", v)
+		}
+	}
+}
+
+func TestTLVLength(t *testing.T) {
+	table := []struct {
+		l    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x80}},
+		{0xff, []byte{0x81, 0xff}},
+		{0x100, []byte{0x82, 0x01, 0x00}},
+		{0x10000, []byte{0x83, 0x01, 0x00, 0x00}},
+	}
+	for _, v := range table {
+		if b := tlvLength(v.l); !bytes.Equal(b, v.want) {
+			t.Errorf("got %x, want %x", b, v.want)
+		}
+	}
+}
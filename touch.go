@@ -0,0 +1,66 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"time"
+)
+
+// touchCacheTimeout holds the duration which the card caches a touch for the slots with the cached touch policy.
+// Ref: https://docs.yubico.com/yesdk/users-manual/application-piv/pin-touch-policies.html
+const touchCacheTimeout = 15 * time.Second
+
+// TouchFunc represents a function which is called before a PIV slot operation which requires touch.
+// It's called before the card is connected and it should only notify the user (i.e. "touch your YubiKey").
+// The touch-gated OpenPGP, OATH, OTP and YubiHSM Auth operations don't call the touch functions.
+type TouchFunc func(card *Card, slot *Slot)
+
+// TouchCompletedFunc represents a function which is called after a slot operation which required touch.
+// The given error is the operation error (nil if the operation is completed).
+type TouchCompletedFunc func(card *Card, slot *Slot, err error)
+
+// OnTouchRequired sets the function which is called before the operations on the PIV slots with the "always" touch policy
+// and the "cached" touch policy (when the touch cache has likely expired). It's disabled if it's nil.
+func (card *Card) OnTouchRequired(f TouchFunc) {
+	card.onTouchRequired = f
+}
+
+// OnTouchCompleted sets the function which is called after the operations which the touch required function is called for.
+// It's disabled if it's nil.
+func (card *Card) OnTouchCompleted(f TouchCompletedFunc) {
+	card.onTouchCompleted = f
+}
+
+// touchRequired returns whether an operation on the slot likely requires touch or not.
+func (slot *Slot) touchRequired() bool {
+	switch slot.touchPolicy {
+	case TouchPolicyAlways:
+		return true
+	case TouchPolicyCached:
+		slot.card.touchMu.Lock()
+		defer slot.card.touchMu.Unlock()
+		return slot.card.touchedAt.IsZero() || time.Since(slot.card.touchedAt) >= touchCacheTimeout
+	default:
+		return false
+	}
+}
+
+// touch calls the given slot operation and the touch functions of the card if the operation requires touch.
+func (slot *Slot) touch(f func() error) error {
+	card := slot.card
+	required := slot.touchRequired()
+	if required && card.onTouchRequired != nil {
+		card.onTouchRequired(card, slot)
+	}
+	err := f()
+	if err == nil && (slot.touchPolicy == TouchPolicyAlways || slot.touchPolicy == TouchPolicyCached) {
+		card.touchMu.Lock()
+		card.touchedAt = time.Now()
+		card.touchMu.Unlock()
+	}
+	if required && card.onTouchCompleted != nil {
+		card.onTouchCompleted(card, slot, err)
+	}
+	return err
+}
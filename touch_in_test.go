@@ -0,0 +1,108 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlotTouchRequired(t *testing.T) {
+	table := []struct {
+		policy    TouchPolicy
+		touchedAt time.Duration
+		want      bool
+	}{
+		{TouchPolicyUnknown, 0, false},
+		{TouchPolicyNever, 0, false},
+		{TouchPolicyAlways, 0, true},
+		{TouchPolicyAlways, time.Second, true},
+		{TouchPolicyCached, 0, true},
+		{TouchPolicyCached, time.Second, false},
+		{TouchPolicyCached, touchCacheTimeout, true},
+	}
+	for _, v := range table {
+		card := testCard(5, 4, 3)
+		if v.touchedAt > 0 {
+			card.touchedAt = time.Now().Add(-v.touchedAt)
+		}
+		slot := &Slot{key: "9d", card: card, touchPolicy: v.policy}
+		if required := slot.touchRequired(); required != v.want {
+			t.Errorf("got %v, want %v for %v (%v)", required, v.want, v.policy, v.touchedAt)
+		}
+	}
+}
+
+func TestSlotTouch(t *testing.T) {
+	card := testCard(5, 4, 3)
+	var events []string
+	card.OnTouchRequired(func(c *Card, slot *Slot) {
+		if c != card || slot.key != "9d" {
+			t.Errorf("got %v %v, want the card and slot", c, slot)
+		}
+		events = append(events, "required")
+	})
+	card.OnTouchCompleted(func(c *Card, slot *Slot, err error) {
+		events = append(events, "completed")
+		if err != nil {
+			events = append(events, err.Error())
+		}
+	})
+	slot := &Slot{key: "9d", card: card, touchPolicy: TouchPolicyCached}
+	op := func() error {
+		events = append(events, "op")
+		return nil
+	}
+
+	if err := slot.touch(op); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	// The touch is cached
+	if err := slot.touch(op); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	want := []string{"required", "op", "completed", "op"}
+	if len(events) != len(want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("got %v, want %v", events, want)
+			break
+		}
+	}
+
+	// Errors are passed to the completed function
+	events = nil
+	slot.touchPolicy = TouchPolicyAlways
+	errTouch := errors.New("touch timeout")
+	if err := slot.touch(func() error { return errTouch }); !errors.Is(err, errTouch) {
+		t.Errorf("got %v, want %v", err, errTouch)
+	}
+	if len(events) != 3 || events[2] != errTouch.Error() {
+		t.Errorf("got %v, want the operation error", events)
+	}
+
+	// Touch functions are disabled
+	events = nil
+	card.OnTouchRequired(nil)
+	card.OnTouchCompleted(nil)
+	if err := slot.touch(op); err != nil || len(events) != 1 {
+		t.Errorf("got %v (%v), want only the operation", events, err)
+	}
+
+	// Concurrent operations (go test -race)
+	var wg sync.WaitGroup
+	slot.touchPolicy = TouchPolicyCached
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slot.touch(func() error { return nil })
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,343 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// URI schemes
+	uriScheme       = "yubikey"
+	uriSchemePKCS11 = "pkcs11"
+
+	// pkcs11SlotIDs holds the number of the YKCS11 key IDs which are mapped onto the PIV slots (9a, 9c, 9d, 9e and the retired slots).
+	pkcs11SlotIDs = 24
+)
+
+// URI represents a key reference on a card slot.
+// The "yubikey" URI format is "yubikey:serial=12345678;slot=9d" with the optional reader, pin-source and pin-value attributes.
+// The attribute values are percent-encoded.
+type URI struct {
+	// Serial is the card serial number. It's optional if the reader is set or only one card is connected.
+	Serial string
+	// Slot is the slot key (i.e. "9d").
+	Slot string
+	// Reader is the smart card reader name.
+	Reader string
+	// PINSource is the PIN source (i.e. "env:YUBIKEY_PIN", "file:/run/secrets/pin", "fd:3" or "terminal").
+	PINSource string
+	// PINValue is the PIN. It's not included in the string representation of the URI.
+	PINValue *Secret
+}
+
+// ParseURI parses the given "yubikey" or RFC 7512 "pkcs11" URI.
+// The PKCS #11 URIs are mapped onto the PIV slots by the YKCS11 conventions: the key IDs 1 to 4 are the 9a, 9c, 9d
+// and 9e slots, the key IDs 5 to 24 are the retired slots, the token label is "YubiKey PIV #<serial>" and
+// the object labels end with the slot name (i.e. "Private key for Digital Signature").
+func ParseURI(s string) (*URI, error) {
+	scheme, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid URI: %q", s)
+	}
+	switch strings.ToLower(scheme) {
+	case uriScheme:
+		return parseYubiKeyURI(rest)
+	case uriSchemePKCS11:
+		return parsePKCS11URI(rest)
+	}
+	return nil, fmt.Errorf("unsupported URI scheme: %s", scheme)
+}
+
+// OpenURI returns the slot by the given URI. The PIN source (if any) is set as the card PIN provider.
+func OpenURI(s string) (*Slot, error) {
+	uri, err := ParseURI(s)
+	if err != nil {
+		return nil, err
+	}
+	return uri.Open()
+}
+
+// Open returns the slot of the URI. The PIN source (if any) is set as the card PIN provider.
+// It returns ErrSlotNotFound if the card or slot is not found.
+func (uri *URI) Open() (*Slot, error) {
+	provider, err := uri.PINProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the card list
+	cards, err := Cards()
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the card
+	var card *Card
+	for _, v := range cards {
+		if (uri.Serial != "" && v.Serial() != uri.Serial) || (uri.Reader != "" && v.Name() != uri.Reader) {
+			continue
+		}
+		if card != nil {
+			return nil, fmt.Errorf("multiple cards match the URI: %s", uri)
+		}
+		card = v
+	}
+	if card == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSlotNotFound, uri)
+	}
+	if provider != nil {
+		card.SetPINProvider(provider, 0)
+	}
+
+	// Get the slot
+	slots, err := card.SlotsByKey([]string{uri.Slot})
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSlotNotFound, uri)
+	}
+	return slots[0], nil
+}
+
+// PINProvider returns the PIN provider by the URI PIN value or source. It returns nil if the URI has none of them.
+func (uri *URI) PINProvider() (PINProvider, error) {
+	if !uri.PINValue.IsEmpty() {
+		return StaticPIN(uri.PINValue.Bytes()), nil
+	}
+	if uri.PINSource == "" {
+		return nil, nil
+	}
+	kind, value, _ := strings.Cut(uri.PINSource, ":")
+	switch kind {
+	case "env":
+		if value != "" {
+			return EnvPIN(value), nil
+		}
+	case "file":
+		// RFC 8089 file URIs ("file:///path") are accepted too
+		if value = strings.TrimPrefix(value, "//"); value != "" {
+			return FilePIN(value), nil
+		}
+	case "fd":
+		if fd, err := strconv.ParseUint(value, 10, 32); err == nil {
+			return &FDPIN{FD: uintptr(fd)}, nil
+		}
+	case "terminal":
+		if value == "" {
+			return &TerminalPIN{}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid PIN source: %s", uri.PINSource)
+}
+
+// String returns the "yubikey" URI representation. The PIN value is omitted.
+func (uri *URI) String() string {
+	var attrs []string
+	for _, v := range []struct{ name, value string }{
+		{"serial", uri.Serial},
+		{"slot", uri.Slot},
+		{"reader", uri.Reader},
+		{"pin-source", uri.PINSource},
+	} {
+		if v.value != "" {
+			attrs = append(attrs, v.name+"="+uriEscape(v.value))
+		}
+	}
+	return uriScheme + ":" + strings.Join(attrs, ";")
+}
+
+// parseYubiKeyURI parses the given "yubikey" URI (without the scheme).
+func parseYubiKeyURI(s string) (*URI, error) {
+	attrs, err := parseURIAttributes(s, ";")
+	if err != nil {
+		return nil, err
+	}
+	uri := URI{}
+	for name, value := range attrs {
+		switch name {
+		case "serial":
+			uri.Serial = value
+		case "slot":
+			if uri.Slot, err = ParseSlot(value); err != nil {
+				return nil, err
+			}
+		case "reader":
+			uri.Reader = value
+		case "pin-source":
+			uri.PINSource = value
+		case "pin-value":
+			uri.PINValue = NewSecretString(value)
+		default:
+			return nil, fmt.Errorf("unknown URI attribute: %s", name)
+		}
+	}
+	if err := uri.validate(); err != nil {
+		return nil, err
+	}
+	return &uri, nil
+}
+
+// parsePKCS11URI parses the given RFC 7512 PKCS #11 URI (without the scheme).
+// Ref: https://www.rfc-editor.org/rfc/rfc7512
+func parsePKCS11URI(s string) (*URI, error) {
+	path, query, _ := strings.Cut(s, "?")
+	attrs, err := parseURIAttributes(path, ";")
+	if err != nil {
+		return nil, err
+	}
+	queryAttrs, err := parseURIAttributes(query, "&")
+	if err != nil {
+		return nil, err
+	}
+
+	uri := URI{}
+	setSerial := func(serial string) error {
+		if uri.Serial != "" && uri.Serial != serial {
+			return fmt.Errorf("conflicting URI serial numbers: %s, %s", uri.Serial, serial)
+		}
+		uri.Serial = serial
+		return nil
+	}
+	setSlot := func(slot string) error {
+		if uri.Slot != "" && uri.Slot != slot {
+			return fmt.Errorf("conflicting URI slots: %s, %s", uri.Slot, slot)
+		}
+		uri.Slot = slot
+		return nil
+	}
+	for name, value := range attrs {
+		switch name {
+		case "serial":
+			err = setSerial(value)
+		case "token":
+			if _, serial, ok := strings.Cut(value, "#"); ok {
+				err = setSerial(serial)
+			}
+		case "id":
+			err = pkcs11SlotByID([]byte(value), setSlot)
+		case "object":
+			// The YKCS11 object labels end with the slot name (i.e. "Private key for PIV Authentication")
+			label := value
+			if _, v, ok := strings.Cut(value, " for "); ok {
+				label = v
+			}
+			var slot string
+			if slot, err = ParseSlot(label); err == nil {
+				err = setSlot(slot)
+			}
+		case "type":
+			switch value {
+			case "private", "public", "cert":
+			default:
+				err = fmt.Errorf("unsupported PKCS #11 object type: %s", value)
+			}
+		case "library-description", "library-manufacturer", "library-version", "manufacturer", "model",
+			"slot-description", "slot-id", "slot-manufacturer":
+			// The module and PKCS #11 slot (reader) attributes aren't used
+		default:
+			// The vendor specific attributes (i.e. "x-name") are ignored
+			if !strings.Contains(name, "-") {
+				err = fmt.Errorf("unknown URI attribute: %s", name)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range queryAttrs {
+		switch name {
+		case "pin-source":
+			uri.PINSource = value
+		case "pin-value":
+			uri.PINValue = NewSecretString(value)
+		case "module-name", "module-path":
+			// The PKCS #11 module isn't used
+		default:
+			// The vendor specific attributes (i.e. "x-name") are ignored
+			if !strings.Contains(name, "-") {
+				return nil, fmt.Errorf("unknown URI query attribute: %s", name)
+			}
+		}
+	}
+	if err := uri.validate(); err != nil {
+		return nil, err
+	}
+	return &uri, nil
+}
+
+// pkcs11SlotByID sets the slot by the given YKCS11 key ID.
+func pkcs11SlotByID(id []byte, setSlot func(string) error) error {
+	if len(id) != 1 || id[0] < 1 || id[0] > pkcs11SlotIDs {
+		return fmt.Errorf("unsupported PKCS #11 key ID: %x", id)
+	}
+	switch n := int(id[0]); n {
+	case 1:
+		return setSlot("9a")
+	case 2:
+		return setSlot("9c")
+	case 3:
+		return setSlot("9d")
+	case 4:
+		return setSlot("9e")
+	default:
+		return setSlot(fmt.Sprintf("%x", retiredSlotFirst+n-5))
+	}
+}
+
+// parseURIAttributes parses the given percent-encoded "name=value" attributes which are separated by the given separator.
+func parseURIAttributes(s, sep string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	if s == "" {
+		return attrs, nil
+	}
+	for _, attr := range strings.Split(s, sep) {
+		name, value, ok := strings.Cut(attr, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid URI attribute: %q", attr)
+		}
+		if _, ok := attrs[name]; ok {
+			return nil, fmt.Errorf("duplicate URI attribute: %s", name)
+		}
+		v, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URI attribute value (%s): %s", name, err)
+		}
+		attrs[name] = v
+	}
+	return attrs, nil
+}
+
+// validate validates the URI attributes.
+func (uri *URI) validate() error {
+	if uri.Slot == "" {
+		return errors.New("missing URI slot")
+	}
+	if uri.Serial != "" {
+		if _, err := strconv.ParseUint(uri.Serial, 10, 32); err != nil {
+			return fmt.Errorf("invalid URI serial number: %s", uri.Serial)
+		}
+	}
+	return nil
+}
+
+// uriEscape returns the percent-encoded URI attribute value.
+// The unreserved characters and the "/", ":" and "@" characters are kept so the readers and paths are readable.
+func uriEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("-._~/:@", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
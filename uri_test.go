@@ -0,0 +1,113 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/devfacet/yubikey"
+)
+
+func TestParseURI(t *testing.T) {
+	table := []struct {
+		uri  string
+		want yubikey.URI
+	}{
+		{"yubikey:serial=12345678;slot=9d", yubikey.URI{Serial: "12345678", Slot: "9d"}},
+		{"yubikey:slot=signature;reader=Yubico%20YubiKey%20CCID%2000%2000;pin-source=env:YUBIKEY_PIN", yubikey.URI{Slot: "9c", Reader: "Yubico YubiKey CCID 00 00", PINSource: "env:YUBIKEY_PIN"}},
+		{"YUBIKEY:serial=1;slot=retired2;pin-source=file:/run/secrets/pin", yubikey.URI{Serial: "1", Slot: "83", PINSource: "file:/run/secrets/pin"}},
+		{"pkcs11:token=YubiKey%20PIV%20%2312345678;id=%02;type=private", yubikey.URI{Serial: "12345678", Slot: "9c"}},
+		{"pkcs11:serial=12345678;object=Private%20key%20for%20Key%20Management?pin-source=fd:3&module-path=/usr/lib/libykcs11.so", yubikey.URI{Serial: "12345678", Slot: "9d", PINSource: "fd:3"}},
+		{"pkcs11:id=%05;object=X.509%20Certificate%20for%20Retired%20Key%201;x-vendor=1", yubikey.URI{Slot: "82"}},
+		{"pkcs11:id=%18;slot-id=0", yubikey.URI{Slot: "95"}},
+	}
+	for _, v := range table {
+		uri, err := yubikey.ParseURI(v.uri)
+		if err != nil {
+			t.Errorf("got %v, want nil (%s)", err, v.uri)
+		} else if !reflect.DeepEqual(*uri, v.want) {
+			t.Errorf("got %+v, want %+v", *uri, v.want)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"yubikey",
+		"http:slot=9a",
+		"yubikey:serial=12345678",
+		"yubikey:serial=abc;slot=9a",
+		"yubikey:slot=9b",
+		"yubikey:slot=9a;slot=9c",
+		"yubikey:slot=9a;color=red",
+		"yubikey:slot=9a;reader",
+		"pkcs11:id=%01;object=Private%20key%20for%20Digital%20Signature",
+		"pkcs11:token=YubiKey%20PIV%20%231;serial=2;id=%01",
+		"pkcs11:id=%19",
+		"pkcs11:id=%01;type=secret-key",
+		"pkcs11:id=%01;color=red",
+	} {
+		if _, err := yubikey.ParseURI(s); err == nil {
+			t.Errorf("got nil, want error (%s)", s)
+		}
+	}
+}
+
+func TestURIString(t *testing.T) {
+	uri := &yubikey.URI{Serial: "12345678", Slot: "9a", Reader: "Yubico YubiKey;1", PINSource: "file:/run/pin", PINValue: yubikey.NewSecretString("123456")}
+	want := "yubikey:serial=12345678;slot=9a;reader=Yubico%20YubiKey%3B1;pin-source=file:/run/pin"
+	if s := uri.String(); s != want {
+		t.Errorf("got %v, want %v", s, want)
+	}
+	parsed, err := yubikey.ParseURI(uri.String())
+	if err != nil || parsed.Reader != uri.Reader || parsed.PINSource != uri.PINSource || !parsed.PINValue.IsEmpty() {
+		t.Errorf("got %+v (%v), want %+v", parsed, err, uri)
+	}
+}
+
+func TestURIPINProvider(t *testing.T) {
+	table := []struct {
+		uri  yubikey.URI
+		want yubikey.PINProvider
+	}{
+		{yubikey.URI{}, nil},
+		{yubikey.URI{PINValue: yubikey.NewSecretString("123456")}, yubikey.StaticPIN("123456")},
+		{yubikey.URI{PINSource: "env:YUBIKEY_PIN"}, yubikey.EnvPIN("YUBIKEY_PIN")},
+		{yubikey.URI{PINSource: "file:///run/pin"}, yubikey.FilePIN("/run/pin")},
+		{yubikey.URI{PINSource: "fd:3"}, &yubikey.FDPIN{FD: 3}},
+		{yubikey.URI{PINSource: "terminal"}, &yubikey.TerminalPIN{}},
+	}
+	for _, v := range table {
+		if p, err := v.uri.PINProvider(); err != nil || !reflect.DeepEqual(p, v.want) {
+			t.Errorf("got %v (%v), want %v", p, err, v.want)
+		}
+	}
+	for _, s := range []string{"env:", "fd:x", "|/bin/pin", "terminal:tty"} {
+		uri := yubikey.URI{PINSource: s}
+		if _, err := uri.PINProvider(); err == nil {
+			t.Errorf("got nil, want error (%s)", s)
+		}
+	}
+}
+
+func TestOpenURI(t *testing.T) {
+	if _, err := yubikey.OpenURI("yubikey:serial=1;slot=9a"); err != nil && !errors.Is(err, yubikey.ErrSlotNotFound) {
+		t.Errorf("got %v, want %v", err, yubikey.ErrSlotNotFound)
+	}
+
+	cards, err := yubikey.Cards()
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	for _, card := range cards {
+		uri := yubikey.URI{Serial: card.Serial(), Slot: "9a"}
+		slot, err := yubikey.OpenURI(uri.String())
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+		} else if slot.Key() != "9a" {
+			t.Errorf("got %v, want %v", slot.Key(), "9a")
+		}
+	}
+}
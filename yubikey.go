@@ -7,10 +7,7 @@ package yubikey
 import (
 	"errors"
 	"fmt"
-	"strings"
 	"sync"
-
-	"github.com/go-piv/piv-go/piv"
 )
 
 var (
@@ -18,11 +15,15 @@ var (
 	openMu = sync.Mutex{}
 
 	// DefaultPIN holds the default card PIN.
-	DefaultPIN = piv.DefaultPIN
+	DefaultPIN = "123456"
 	// DefaultPUK holds the default card PUK.
-	DefaultPUK = piv.DefaultPUK
+	DefaultPUK = "12345678"
 	// DefaultManagementKey holds the default card management key.
-	DefaultManagementKey = piv.DefaultManagementKey
+	DefaultManagementKey = [24]byte{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+	}
 
 	// ErrOutstandingConnections returns an outstanding connections error.
 	ErrOutstandingConnections = errors.New("outstanding connections")
@@ -34,59 +35,85 @@ func Cards() ([]*Card, error) {
 	defer openMu.Unlock()
 
 	// Get the card list
-	pivCards, err := piv.Cards()
+	readers, err := listReaders()
 	if err != nil {
 		return nil, fmt.Errorf("couldn't get the smart card list: %s", err)
 	}
 
 	// Iterate over the card list and initialize the card instances
 	var cards []*Card
-	for _, v := range pivCards {
+	for _, v := range readers {
 		card := Card{
 			name:   v,
-			pin:    DefaultPIN,
-			puk:    DefaultPUK,
-			manKey: DefaultManagementKey,
-		}
-		card.keyAuth = piv.KeyAuth{
-			PINPrompt: func() (string, error) {
-				return card.pin, nil
-			},
+			pin:    NewSecretString(DefaultPIN),
+			puk:    NewSecretString(DefaultPUK),
+			manKey: NewSecret(DefaultManagementKey[:]),
 		}
 
 		// Connect to the smart card and set the card info
-		yk, err := piv.Open(card.name)
-		if err != nil {
-			if strings.Contains(err.Error(), "connections outstanding") {
-				return nil, ErrOutstandingConnections
-			}
-			return nil, fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", card.name, err)
-		}
-		s, err := yk.Serial()
-		if err != nil {
-			yk.Close()
-			return nil, fmt.Errorf("couldn't determined the YubiKey serial (%s): %s", card.name, err)
+		if err := card.readInfo(); err != nil {
+			return nil, err
 		}
-		card.serial = fmt.Sprintf("%d", s)
-		card.version = yk.Version()
 
 		// Check the version
 		// Ref: https://developers.yubico.com/PIV/Introduction/PIV_attestation.html
-		if card.version.Major < 4 || (card.version.Major == 4 && card.version.Minor < 3) {
-			yk.Close()
+		if !card.isVersion(4, 3, 0) {
 			return nil, fmt.Errorf("version of the YubiKey (%s) is not supported: %s", card.serial, card.Version())
 		}
 
-		// Add it into the list and close the card.
+		// Add it into the list
 		cards = append(cards, &card)
-		yk.Close()
 	}
 
 	return cards, nil
 }
 
+// readInfo reads the firmware version and the serial number of the card. The caller must hold openMu.
+// The card info is read without the secure channel since the card isn't configured yet.
+func (card *Card) readInfo() error {
+	s, err := openSession(card.name, aidPIV)
+	if err != nil {
+		var e *scardError
+		if errors.As(err, &e) && e.rc == scardSharingViolation {
+			return ErrOutstandingConnections
+		}
+		return fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", card.name, err)
+	}
+	resp, err := s.send(apdu{ins: insGetVersion})
+	if err == nil && len(resp) != 3 {
+		err = fmt.Errorf("invalid version: %x", resp)
+	}
+	if err != nil {
+		s.Close()
+		return fmt.Errorf("couldn't determine the YubiKey version (%s): %s", card.name, err)
+	}
+	card.version = version{Major: int(resp[0]), Minor: int(resp[1]), Patch: int(resp[2])}
+
+	// The older YubiKeys have the serial number in the OTP application only
+	if card.version.Major < 5 {
+		s.Close()
+		if s, err = openSession(card.name, aidOTP); err != nil {
+			return fmt.Errorf("couldn't connect to the YubiKey smart card (%s): %s", card.name, err)
+		}
+		resp, err = s.send(apdu{ins: insOTPRequest, p1: otpCommandSerial})
+	} else {
+		resp, err = s.send(apdu{ins: insGetSerial})
+	}
+	s.Close()
+	if err == nil && len(resp) != 4 {
+		err = fmt.Errorf("invalid serial: %x", resp)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't determine the YubiKey serial (%s): %s", card.name, err)
+	}
+	card.serial = fmt.Sprintf("%d", uint32(resp[0])<<24|uint32(resp[1])<<16|uint32(resp[2])<<8|uint32(resp[3]))
+
+	return nil
+}
+
 // CardSlots returns the card slots by the given card serials, slots and pins.
-// It doesn't return error if the given serial or slot not found.
+// The default PIN is used for the cards which don't have a PIN. It doesn't return error if the given serial or slot not found
+// but it returns error if a slot is unknown (see ParseSlot).
 func CardSlots(serials, slots, pins []string) (map[string]map[string]*Slot, error) {
 	// Get the card list
 	cards, err := Cards()
@@ -105,9 +132,9 @@ func CardSlots(serials, slots, pins []string) (map[string]map[string]*Slot, erro
 			if result[serial] == nil {
 				result[serial] = make(map[string]*Slot)
 			}
-			// TODO: Check https://github.com/go-piv/piv-go/issues/47
-			if k < len(pins) {
-				card.SetPIN(pins[k])
+			// The PIN is provided by a static PIN provider of the card
+			if k < len(pins) && pins[k] != "" {
+				card.SetPINProvider(StaticPIN(pins[k]), 0)
 			}
 			// Get the card slots
 			cardSlots, err := card.SlotsByKey(slots)
@@ -131,6 +158,10 @@ func CardSlot(serial, slot, pin string) (*Slot, error) {
 		return nil, errors.New("missing key serial or slot")
 	}
 
+	if key, err := ParseSlot(slot); err == nil {
+		slot = key
+	}
+
 	// Get the card slots
 	slots, err := CardSlots([]string{serial}, []string{slot}, []string{pin})
 	if err != nil {
@@ -0,0 +1,100 @@
+// YubiKey
+// For the full copyright and license information, please view the LICENSE.txt file.
+
+package yubikey
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// useFakeReaders replaces the reader list by the given readers for the test.
+func useFakeReaders(t *testing.T, readers ...string) {
+	t.Helper()
+	orig := listReaders
+	listReaders = func() ([]string, error) {
+		return readers, nil
+	}
+	t.Cleanup(func() { listReaders = orig })
+}
+
+// fakeCardInfo returns a fake handler which replies the version and serial requests.
+// The older versions reply the serial by the OTP application only.
+func fakeCardInfo(ver []byte) func(req []byte) []byte {
+	return func(req []byte) []byte {
+		switch {
+		case req[1] == insGetVersion:
+			return append(append([]byte(nil), ver...), 0x90, 0x00)
+		case req[1] == insGetSerial && ver[0] >= 5:
+			return []byte{0x00, 0xbc, 0x61, 0x4e, 0x90, 0x00}
+		case req[1] == insOTPRequest && req[2] == otpCommandSerial && ver[0] < 5:
+			return []byte{0x00, 0x12, 0xd6, 0x87, 0x90, 0x00}
+		}
+		return []byte{0x6d, 0x00}
+	}
+}
+
+func TestCardsInfo(t *testing.T) {
+	useFakeReaders(t, "Yubico YubiKey OTP+FIDO+CCID 00 00")
+
+	// Serial by the PIV application
+	useFakeTransport(t, fakeCardInfo([]byte{5, 4, 3}))
+	cards, err := Cards()
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(cards) != 1 {
+		t.Fatalf("got %v, want 1 card", len(cards))
+	}
+	if v := cards[0].Name(); v != "Yubico YubiKey OTP+FIDO+CCID 00 00" {
+		t.Errorf("got %v, want %v", v, "Yubico YubiKey OTP+FIDO+CCID 00 00")
+	}
+	if v := cards[0].Serial(); v != "12345678" {
+		t.Errorf("got %v, want %v", v, "12345678")
+	}
+	if v := cards[0].Version(); v != "5.4.3" {
+		t.Errorf("got %v, want %v", v, "5.4.3")
+	}
+
+	// Serial by the OTP application
+	ft := useFakeTransport(t, fakeCardInfo([]byte{4, 3, 7}))
+	if cards, err = Cards(); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if v := cards[0].Serial(); v != "1234567" {
+		t.Errorf("got %v, want %v", v, "1234567")
+	}
+	var selected bool
+	for _, req := range ft.requests {
+		if req[1] == insSelect && bytes.Equal(req[5:5+int(req[4])], aidOTP) {
+			selected = true
+		}
+	}
+	if !selected {
+		t.Error("got false, want the OTP application selection")
+	}
+
+	// Unsupported version
+	useFakeTransport(t, fakeCardInfo([]byte{4, 2, 7}))
+	if _, err := Cards(); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("got %v, want a not supported error", err)
+	}
+
+	// Outstanding connections
+	orig := openTransport
+	openTransport = func(reader string) (transport, error) {
+		return nil, &scardError{rc: scardSharingViolation}
+	}
+	t.Cleanup(func() { openTransport = orig })
+	if _, err := Cards(); !errors.Is(err, ErrOutstandingConnections) {
+		t.Errorf("got %v, want %v", err, ErrOutstandingConnections)
+	}
+
+	// No readers
+	useFakeReaders(t)
+	if cards, err := Cards(); err != nil || len(cards) != 0 {
+		t.Errorf("got %v (%v), want no cards", cards, err)
+	}
+}